@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"ledger/internal/api"
 	"ledger/internal/auth"
 	"ledger/internal/db"
+	"ledger/internal/middleware"
 	"ledger/internal/models"
 	"ledger/internal/services"
 )
@@ -27,6 +30,7 @@ func main() {
 		flagDataDir      = flag.String("data-dir", "", "Directory to persist snapshots")
 		flagAutosaveSecs = flag.Int("autosave-secs", 0, "Autosave interval seconds (0 to disable)")
 		flagRetention    = flag.Int("retention", 0, "Number of rolling backups to retain")
+		flagProxies      = flag.String("trusted-proxies", "", "Comma-separated CIDRs or addresses of reverse proxies trusted to set X-Forwarded-For")
 	)
 	flag.Parse()
 
@@ -44,7 +48,18 @@ func main() {
 		}()
 	}
 
-	store := models.NewLedgerStore()
+	var storeCfg models.StoreConfig
+	if v := os.Getenv("LEDGER_TRASH_RETENTION_DAYS"); v != "" {
+		var days int
+		if _, err := fmt.Sscanf(v, "%d", &days); err == nil && days >= 0 {
+			storeCfg.TrashRetentionDays = &days
+		}
+	}
+	if v, lockout := os.Getenv("LEDGER_LOGIN_MAX_FAILURES"), envDuration("LEDGER_LOGIN_LOCKOUT"); v != "" || lockout > 0 {
+		storeCfg.LoginPolicy.Lockout = lockout
+		fmt.Sscanf(v, "%d", &storeCfg.LoginPolicy.MaxFailures)
+	}
+	store := models.NewLedgerStoreWithConfig(storeCfg)
 
 	dataDir := *flagDataDir
 	if dataDir == "" {
@@ -134,7 +149,43 @@ func main() {
 		}()
 	}
 
-	sessions := auth.NewManager(12 * time.Hour)
+	trashPurge := time.NewTicker(time.Hour)
+	defer trashPurge.Stop()
+	go func() {
+		for now := range trashPurge.C {
+			if purged := store.PurgeExpiredTrash(now.UTC(), "system"); purged > 0 {
+				log.Printf("purged %d expired trash items", purged)
+			}
+		}
+	}()
+
+	if dataDir != "" {
+		go api.NewReportScheduler(store, dataDir).Run(ctx)
+	}
+
+	sessionCfg := auth.Config{
+		AccessTTL:   envDuration("LEDGER_SESSION_ACCESS_TTL"),
+		IdleTimeout: envDuration("LEDGER_SESSION_IDLE_TIMEOUT"),
+		AbsoluteTTL: envDuration("LEDGER_SESSION_TTL"),
+	}
+	if useDB {
+		sessionCfg.Persister = auth.SQLPersister{DB: database.SQL}
+	} else if dataDir != "" {
+		sessionCfg.Persister = auth.FilePersister{Path: filepath.Join(dataDir, "sessions.json")}
+	}
+	sessions := auth.NewManagerWithConfig(sessionCfg)
+	if err := sessions.Load(); err != nil {
+		log.Printf("load sessions error: %v", err)
+	}
+	sessionPurge := time.NewTicker(5 * time.Minute)
+	defer sessionPurge.Stop()
+	go func() {
+		for now := range sessionPurge.C {
+			if _, err := sessions.Purge(now.UTC()); err != nil {
+				log.Printf("save sessions error: %v", err)
+			}
+		}
+	}()
 
 	var roledgerSvc *services.RoledgerService
 	var importSvc *services.ImportService
@@ -143,7 +194,16 @@ func main() {
 		importSvc = services.NewImportService(database.SQL)
 	}
 
-	router := api.NewRouter(api.Config{Database: database, Store: store, Sessions: sessions, DataDir: dataDir, Retention: retention, Roledger: roledgerSvc, Import: importSvc})
+	proxyList := *flagProxies
+	if proxyList == "" {
+		proxyList = os.Getenv("LEDGER_TRUSTED_PROXIES")
+	}
+	proxies, err := middleware.ParseTrustedProxies(strings.Split(proxyList, ","))
+	if err != nil {
+		log.Fatalf("trusted proxies: %v", err)
+	}
+
+	router := api.NewRouter(api.Config{Database: database, Store: store, Sessions: sessions, DataDir: dataDir, Retention: retention, Roledger: roledgerSvc, Import: importSvc, TrustedProxies: proxies})
 
 	srv := &http.Server{
 		Addr:              ":8080",
@@ -167,6 +227,9 @@ func main() {
 		log.Printf("server shutdown error: %v", err)
 	}
 
+	if _, err := sessions.Purge(time.Now().UTC()); err != nil {
+		log.Printf("final sessions save error: %v", err)
+	}
 	if useDB {
 		if err := store.SaveToDatabaseWithRetention(database.SQL, retention); err != nil {
 			log.Printf("final db save error: %v", err)
@@ -177,3 +240,17 @@ func main() {
 		}
 	}
 }
+
+// envDuration reads a duration such as "30m" from the environment, zero when unset or invalid.
+func envDuration(key string) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s %q: %v", key, v, err)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/middleware"
+	"ledger/internal/models"
+)
+
+// Scope resolvers for the path parameters routes name their resources with.
+var (
+	byLedger    = middleware.LedgerScope("type")
+	byWorkspace = middleware.WorkspaceScope("id")
+	byTable     = middleware.TableScope("id")
+)
+
+// require builds the role check for a route. Every user holds at least viewer, so read-only
+// routes need no check. System administration routes also require a network the admin-scoped
+// allowlist entries admit.
+func (s *Server) require(role models.AccessRole, scope middleware.ScopeFunc) gin.HandlerFunc {
+	check := middleware.RequireRole(s.Store, role, scope)
+	if role != models.AccessSystemAdmin {
+		return check
+	}
+	return func(c *gin.Context) {
+		if middleware.CheckIPAllowlist(c, s.Store, s.TrustedProxies, models.AllowlistScopeAdmin) {
+			check(c)
+		}
+	}
+}
+
+type grantRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Scope    string `json:"scope"`
+	Target   string `json:"target"`
+}
+
+func (r grantRequest) toModel() models.PermissionGrant {
+	return models.PermissionGrant{
+		Username: r.Username,
+		Role:     models.AccessRole(strings.TrimSpace(r.Role)),
+		Scope:    models.AccessScopeKind(strings.TrimSpace(r.Scope)),
+		Target:   r.Target,
+	}
+}
+
+type userRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// registerAccessRoutes attaches permission grant management for system administrators and
+// lets every session look up its own role and grants.
+func (s *Server) registerAccessRoutes(group *gin.RouterGroup) {
+	admin := s.require(models.AccessSystemAdmin, nil)
+	group.GET("/access/me", s.handleAccessMe)
+	group.GET("/access/grants", admin, s.handleListGrants)
+	group.POST("/access/grants", admin, s.handleCreateGrant)
+	group.DELETE("/access/grants/:id", admin, s.handleDeleteGrant)
+	group.PUT("/users/:id/role", admin, s.handleSetUserRole)
+}
+
+func (s *Server) handleAccessMe(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	c.JSON(http.StatusOK, gin.H{
+		"username": session,
+		"role":     s.Store.UserRole(session),
+		"grants":   s.Store.ListGrants(session),
+	})
+}
+
+// handleListGrants lists every grant, or those of one user with ?username=.
+func (s *Server) handleListGrants(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListGrants(c.Query("username"))})
+}
+
+func (s *Server) handleCreateGrant(c *gin.Context) {
+	var req grantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	grant, err := s.Store.CreateGrant(req.toModel(), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithAccessError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, grant)
+}
+
+func (s *Server) handleDeleteGrant(c *gin.Context) {
+	if err := s.Store.DeleteGrant(c.Param("id"), currentSession(c, s.Sessions)); err != nil {
+		abortWithAccessError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleSetUserRole(c *gin.Context) {
+	var req userRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	user, err := s.Store.SetUserRole(c.Param("id"), models.AccessRole(strings.TrimSpace(req.Role)), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithAccessError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": userToResponse(user)})
+}
+
+func abortWithAccessError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrGrantNotFound), errors.Is(err, models.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrUserDemoteLastAdmin):
+		status = http.StatusConflict
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+// registerBulkRoutes attaches the bulk change endpoint for ledger entries.
+func (s *Server) registerBulkRoutes(group *gin.RouterGroup) {
+	group.POST("/ledgers/:type/bulk", s.require(models.AccessEditor, byLedger), s.handleBulkLedger)
+}
+
+type bulkOperationRequest struct {
+	Op          string              `json:"op"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Attributes  map[string]string   `json:"attributes"`
+	Tags        []string            `json:"tags"`
+	Links       map[string][]string `json:"links"`
+}
+
+// bulkRequest targets ids, or every entry matching filters and q when ids is empty.
+type bulkRequest struct {
+	IDs        []string               `json:"ids"`
+	Filters    []models.FilterClause  `json:"filters"`
+	Query      string                 `json:"q"`
+	Operations []bulkOperationRequest `json:"operations"`
+	DryRun     bool                   `json:"dryRun"`
+}
+
+func (r bulkRequest) toModel() models.BulkRequest {
+	req := models.BulkRequest{IDs: r.IDs, DryRun: r.DryRun}
+	if len(r.IDs) == 0 && (len(r.Filters) > 0 || strings.TrimSpace(r.Query) != "") {
+		req.Query = &models.LedgerQuery{Filters: r.Filters, Text: r.Query}
+	}
+	for _, op := range r.Operations {
+		req.Operations = append(req.Operations, models.BulkOperation{
+			Op:          strings.ToLower(strings.TrimSpace(op.Op)),
+			Name:        op.Name,
+			Description: op.Description,
+			Attributes:  op.Attributes,
+			Tags:        op.Tags,
+			Links:       convertLinks(op.Links),
+		})
+	}
+	return req
+}
+
+// handleBulkLedger applies update, delete, tag_add, tag_remove, link_add and attribute_set
+// operations to many entries at once. With dryRun the response reports the per-entry changes
+// without applying them.
+func (s *Server) handleBulkLedger(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	actor := currentSession(c, s.Sessions)
+	bulk := req.toModel()
+	bulk.Visibility = s.visibility(c)
+	result, err := s.Store.BulkUpdateEntries(typ, bulk, actor)
+	if err != nil {
+		if errors.Is(err, models.ErrBulkInvalid) || errors.Is(err, models.ErrQueryInvalid) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -22,10 +23,11 @@ type sortParam struct {
 	Direction string `json:"direction"`
 }
 
-func parseFilters(c *gin.Context) ([]models.FilterClause, []models.SortClause, bool) {
+// decodeFilterParams reads the JSON-encoded ?filters= and ?sort= query parameters shared by the
+// Roledger records API and the classic ledgers.
+func decodeFilterParams(c *gin.Context) ([]filterParam, []sortParam, bool) {
 	var filters []filterParam
 	var sorts []sortParam
-	validProp := regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 	if raw := c.Query("filters"); raw != "" {
 		if err := json.Unmarshal([]byte(raw), &filters); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_filters"})
@@ -38,6 +40,15 @@ func parseFilters(c *gin.Context) ([]models.FilterClause, []models.SortClause, b
 			return nil, nil, false
 		}
 	}
+	return filters, sorts, true
+}
+
+func parseFilters(c *gin.Context) ([]models.FilterClause, []models.SortClause, bool) {
+	filters, sorts, ok := decodeFilterParams(c)
+	if !ok {
+		return nil, nil, false
+	}
+	validProp := regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 	var outFilters []models.FilterClause
 	for _, f := range filters {
 		prop := strings.TrimSpace(f.Property)
@@ -70,3 +81,32 @@ func parseFilters(c *gin.Context) ([]models.FilterClause, []models.SortClause, b
 	}
 	return outFilters, outSorts, true
 }
+
+// parseLedgerQuery builds a ledger query from ?filters=, ?sort=, ?q=, ?page= and ?pageSize=.
+// Clauses are passed through unchanged; QueryEntries validates properties and operators.
+func parseLedgerQuery(c *gin.Context) (models.LedgerQuery, bool) {
+	filters, sorts, ok := decodeFilterParams(c)
+	if !ok {
+		return models.LedgerQuery{}, false
+	}
+	query := models.LedgerQuery{Text: c.Query("q")}
+	for _, f := range filters {
+		query.Filters = append(query.Filters, models.FilterClause{Property: f.Property, Op: f.Op, Value: f.Value})
+	}
+	for _, srt := range sorts {
+		dir := "asc"
+		if strings.ToLower(srt.Direction) == "desc" {
+			dir = "desc"
+		}
+		query.Sorts = append(query.Sorts, models.SortClause{Property: srt.Property, Direction: dir})
+	}
+	query.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	query.PageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "0"))
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize < 0 {
+		query.PageSize = 0
+	}
+	return query, true
+}
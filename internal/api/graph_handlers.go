@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+// registerGraphRoutes attaches traversal, impact analysis, shortest path and orphan detection
+// over ledger links.
+func (s *Server) registerGraphRoutes(group *gin.RouterGroup) {
+	group.GET("/graph/orphans", s.handleGraphOrphans)
+	group.GET("/graph/path", s.handleGraphPath)
+	group.GET("/graph/:type/:id", s.handleGraphTraverse)
+	group.GET("/graph/:type/:id/impact", s.handleGraphImpact)
+}
+
+func graphDepth(c *gin.Context) int {
+	depth, _ := strconv.Atoi(c.DefaultQuery("depth", "0"))
+	return depth
+}
+
+// handleGraphTraverse returns nodes and edges within ?depth= hops of an entry. The :id segment
+// may also be the entry name or, for the IP ledger, its address.
+func (s *Server) handleGraphTraverse(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	graph, err := s.Store.Traverse(typ, c.Param("id"), graphDepth(c), s.visibility(c))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, graph)
+}
+
+// handleGraphImpact answers "what is affected if this entry goes away", grouped by ledger type
+// and optionally restricted with ?types=systems,personnel.
+func (s *Server) handleGraphImpact(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	var types []models.LedgerType
+	for _, raw := range strings.Split(c.Query("types"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		resolved, ok := s.Store.ResolveLedgerType(raw)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown_ledger"})
+			return
+		}
+		types = append(types, resolved)
+	}
+	report, err := s.Store.Impact(typ, c.Param("id"), graphDepth(c), types, s.visibility(c))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// handleGraphPath finds the shortest link chain for
+// ?fromType=ips&from=10.1.2.3&toType=personnel&to=<id>.
+func (s *Server) handleGraphPath(c *gin.Context) {
+	fromType, ok := s.Store.ResolveLedgerType(c.Query("fromType"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	toType, ok := s.Store.ResolveLedgerType(c.Query("toType"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	path, err := s.Store.ShortestPath(fromType, c.Query("from"), toType, c.Query("to"), s.visibility(c))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nodes": path.Nodes, "edges": path.Edges, "length": len(path.Edges)})
+}
+
+// handleGraphOrphans lists entries without any links, optionally for a single ?type=.
+func (s *Server) handleGraphOrphans(c *gin.Context) {
+	var typ models.LedgerType
+	if raw := strings.TrimSpace(c.Query("type")); raw != "" {
+		resolved, ok := s.Store.ResolveLedgerType(raw)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+			return
+		}
+		typ = resolved
+	}
+	items := s.Store.Orphans(typ, s.visibility(c))
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
@@ -18,7 +18,7 @@ func (s *Server) registerImportRoutes(group *gin.RouterGroup) {
 		return
 	}
 
-	group.POST("/import", func(c *gin.Context) {
+	group.POST("/import", s.require(models.AccessLedgerAdmin, nil), func(c *gin.Context) {
 		tableName := c.Request.FormValue("tableName")
 		_, fileHeader, err := c.Request.FormFile("file")
 		if err != nil || fileHeader == nil {
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+type ipSubnetTreeItem struct {
+	models.IPSubnetUsage
+	Children []ipSubnetTreeItem `json:"children,omitempty"`
+}
+
+// registerIPAMRoutes attaches address-management views over the IP ledger.
+func (s *Server) registerIPAMRoutes(group *gin.RouterGroup) {
+	group.GET("/ipam/subnets", s.handleListSubnets)
+	group.GET("/ipam/subnets/:id/next-free", s.handleNextFreeIP)
+	group.GET("/ipam/conflicts", s.handleIPConflicts)
+}
+
+func (s *Server) handleListSubnets(c *gin.Context) {
+	subnets := s.Store.IPSubnets()
+	buckets := make(map[string][]ipSubnetTreeItem)
+	for _, subnet := range subnets {
+		buckets[subnet.ParentID] = append(buckets[subnet.ParentID], ipSubnetTreeItem{IPSubnetUsage: subnet})
+	}
+	var build func(parent string) []ipSubnetTreeItem
+	build = func(parent string) []ipSubnetTreeItem {
+		nodes := buckets[parent]
+		result := make([]ipSubnetTreeItem, len(nodes))
+		for i, node := range nodes {
+			node.Children = build(node.ID)
+			result[i] = node
+		}
+		return result
+	}
+	c.JSON(http.StatusOK, gin.H{"items": build("")})
+}
+
+func (s *Server) handleNextFreeIP(c *gin.Context) {
+	address, err := s.Store.NextFreeIP(c.Param("id"))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, models.ErrEntryNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, models.ErrIPSubnetExhausted):
+			status = http.StatusConflict
+		}
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subnetId": c.Param("id"), "address": address})
+}
+
+func (s *Server) handleIPConflicts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.IPConflicts()})
+}
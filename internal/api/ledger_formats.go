@@ -0,0 +1,402 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"ledger/internal/models"
+	"ledger/internal/ods"
+	"ledger/internal/xlsx"
+)
+
+// Classic ledger file formats. XLSX and ODS carry one sheet per ledger; CSV and JSON Lines hold
+// a single ledger.
+const (
+	ledgerFormatXLSX  = "xlsx"
+	ledgerFormatODS   = "ods"
+	ledgerFormatCSV   = "csv"
+	ledgerFormatJSONL = "jsonl"
+)
+
+var (
+	errUnsupportedFormat = errors.New("unsupported_format")
+	errUnknownEncoding   = errors.New("unknown_encoding")
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// registerLedgerFileRoutes attaches the whole-workbook import and export. They are registered
+// ahead of /ledgers/:type, which would otherwise capture them.
+func (s *Server) registerLedgerFileRoutes(group *gin.RouterGroup) {
+	group.GET("/ledgers/export", s.handleExportLedger)
+	group.POST("/ledgers/import", s.require(models.AccessLedgerAdmin, nil), s.handleImportWorkbook)
+}
+
+func parseLedgerFormat(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ledgerFormatXLSX:
+		return ledgerFormatXLSX, nil
+	case ledgerFormatODS:
+		return ledgerFormatODS, nil
+	case ledgerFormatCSV:
+		return ledgerFormatCSV, nil
+	case ledgerFormatJSONL, "ndjson":
+		return ledgerFormatJSONL, nil
+	}
+	return "", errUnsupportedFormat
+}
+
+// decodeLedgerUpload reads an uploaded ledger file into a workbook. CSV and JSON Lines yield a
+// single unnamed sheet. Encoding only applies to CSV and is detected when empty.
+func decodeLedgerUpload(raw []byte, format, encoding string) (xlsx.Workbook, error) {
+	switch format {
+	case ledgerFormatXLSX:
+		return xlsx.Decode(raw)
+	case ledgerFormatODS:
+		return ods.Decode(raw)
+	case ledgerFormatCSV:
+		rows, err := decodeCSV(raw, encoding)
+		if err != nil {
+			return xlsx.Workbook{}, err
+		}
+		return xlsx.Workbook{Sheets: []xlsx.Sheet{{Rows: rows}}}, nil
+	case ledgerFormatJSONL:
+		rows, err := decodeLedgerJSONL(raw)
+		if err != nil {
+			return xlsx.Workbook{}, err
+		}
+		return xlsx.Workbook{Sheets: []xlsx.Sheet{{Rows: rows}}}, nil
+	}
+	return xlsx.Workbook{}, errUnsupportedFormat
+}
+
+// abortWithUploadError reports a file that could not be decoded in the given format.
+func abortWithUploadError(c *gin.Context, format string, err error) {
+	if errors.Is(err, errUnsupportedFormat) || errors.Is(err, errUnknownEncoding) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	code := "invalid_" + format
+	if format == ledgerFormatXLSX || format == ledgerFormatODS {
+		code = "invalid_workbook"
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": code})
+}
+
+// pickLedgerSheet returns the requested sheet, or the ledger's own sheet when none was requested.
+// A workbook with a single sheet is used as-is when nothing was requested.
+func pickLedgerSheet(workbook xlsx.Workbook, requested, fallback string) (xlsx.Sheet, bool) {
+	name := strings.TrimSpace(requested)
+	if name == "" {
+		name = fallback
+	}
+	if sheet, ok := workbook.SheetByName(name); ok {
+		return sheet, true
+	}
+	if strings.TrimSpace(requested) == "" && len(workbook.Sheets) == 1 {
+		return workbook.Sheets[0], true
+	}
+	return xlsx.Sheet{}, false
+}
+
+// decodeText converts raw CSV bytes to UTF-8. Without an explicit encoding a BOM decides, then
+// valid UTF-8 is kept as-is and anything else is read as GB18030, a superset of GBK and GB2312.
+func decodeText(raw []byte, encoding string) ([]byte, error) {
+	gb := simplifiedchinese.GB18030.NewDecoder()
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "auto":
+		switch {
+		case bytes.HasPrefix(raw, utf8BOM):
+			return raw[len(utf8BOM):], nil
+		case bytes.HasPrefix(raw, []byte{0xFF, 0xFE}):
+			return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(raw)
+		case bytes.HasPrefix(raw, []byte{0xFE, 0xFF}):
+			return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(raw)
+		case utf8.Valid(raw):
+			return raw, nil
+		}
+		return gb.Bytes(raw)
+	case "utf-8", "utf8":
+		return bytes.TrimPrefix(raw, utf8BOM), nil
+	case "gbk", "gb2312", "gb18030", "cp936":
+		return gb.Bytes(raw)
+	}
+	return nil, errUnknownEncoding
+}
+
+// sniffDelimiter picks comma, semicolon or tab by counting them on the header line.
+func sniffDelimiter(text []byte) rune {
+	line := text
+	if idx := bytes.IndexByte(text, '\n'); idx >= 0 {
+		line = text[:idx]
+	}
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		count, quoted := 0, false
+		for _, r := range string(line) {
+			switch {
+			case r == '"':
+				quoted = !quoted
+			case r == candidate && !quoted:
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+func decodeCSV(raw []byte, encoding string) ([][]string, error) {
+	text, err := decodeText(raw, encoding)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(text))
+	reader.Comma = sniffDelimiter(text)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+// csvCharset resolves the encoding query of a CSV export to the charset it is written in.
+func csvCharset(encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "utf-8", "utf8":
+		return "utf-8", nil
+	case "gbk", "gb2312", "gb18030", "cp936":
+		return "gb18030", nil
+	}
+	return "", errUnknownEncoding
+}
+
+// writeCSV streams the rows produced by each as UTF-8 with a BOM so spreadsheet applications
+// detect the encoding, or as GB18030 for consumers that expect the legacy Windows code page.
+func writeCSV(w io.Writer, encoding string, each func(emit func([]string) error) error) error {
+	charset, err := csvCharset(encoding)
+	if err != nil {
+		return err
+	}
+	var encoder io.WriteCloser
+	if charset == "utf-8" {
+		if _, err := w.Write(utf8BOM); err != nil {
+			return err
+		}
+	} else {
+		encoder = transform.NewWriter(w, simplifiedchinese.GB18030.NewEncoder())
+		w = encoder
+	}
+	writer := csv.NewWriter(w)
+	if err := each(writer.Write); err != nil {
+		return err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if encoder != nil {
+		return encoder.Close()
+	}
+	return nil
+}
+
+// ledgerRecord is one JSON Lines entry. Attribute values may be any JSON scalar.
+type ledgerRecord struct {
+	ID          string                 `json:"id,omitempty"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	Links       map[string][]string    `json:"links,omitempty"`
+}
+
+// decodeLedgerJSONL lays JSON Lines records out as sheet rows with ID, Name, Description, Tags,
+// attributes.<key> and link_<type> columns, so they flow through the same import as sheets.
+func decodeLedgerJSONL(raw []byte) ([][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(raw, utf8BOM)))
+	decoder.UseNumber()
+	var records []ledgerRecord
+	attrSet := make(map[string]struct{})
+	linkSet := make(map[string]struct{})
+	for {
+		var record ledgerRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for key := range record.Attributes {
+			attrSet[key] = struct{}{}
+		}
+		for typ := range record.Links {
+			linkSet[typ] = struct{}{}
+		}
+		records = append(records, record)
+	}
+	attrKeys := sortedKeys(attrSet)
+	linkKeys := sortedKeys(linkSet)
+	header := []string{"ID", "Name", "Description", "Tags"}
+	for _, key := range attrKeys {
+		header = append(header, "attributes."+key)
+	}
+	for _, typ := range linkKeys {
+		header = append(header, "link_"+typ)
+	}
+	rows := [][]string{header}
+	for _, record := range records {
+		row := []string{record.ID, record.Name, record.Description, strings.Join(record.Tags, ";")}
+		for _, key := range attrKeys {
+			row = append(row, jsonScalar(record.Attributes[key]))
+		}
+		for _, typ := range linkKeys {
+			row = append(row, strings.Join(record.Links[typ], ";"))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeLedgerJSONL writes one record per entry.
+func writeLedgerJSONL(w io.Writer, entries []models.LedgerEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, entry := range entries {
+		record := ledgerRecord{ID: entry.ID, Name: entry.Name, Description: entry.Description, Tags: entry.Tags}
+		if len(entry.Attributes) > 0 {
+			record.Attributes = make(map[string]interface{}, len(entry.Attributes))
+			for key, value := range entry.Attributes {
+				record.Attributes[key] = value
+			}
+		}
+		for typ, ids := range entry.Links {
+			if len(ids) == 0 {
+				continue
+			}
+			if record.Links == nil {
+				record.Links = make(map[string][]string)
+			}
+			record.Links[string(typ)] = ids
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleExportLedger downloads ledgers as xlsx (the default), ods, csv or jsonl. Without a type
+// the spreadsheet formats carry every ledger plus the link matrix; csv and jsonl need a type.
+// CSV is UTF-8 with a BOM unless encoding=gbk is given. Everything but ODS, whose content is a
+// single XML document, is streamed to the client as it is generated.
+func (s *Server) handleExportLedger(c *gin.Context) {
+	format, err := parseLedgerFormat(c.Query("format"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var typ models.LedgerType
+	name := "ledger"
+	if raw := strings.TrimSpace(c.Query("type")); raw != "" {
+		resolved, ok := s.Store.ResolveLedgerType(raw)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+			return
+		}
+		typ = resolved
+		name = "ledger-" + string(typ)
+	} else if format == ledgerFormatCSV || format == ledgerFormatJSONL {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "type_required"})
+		return
+	}
+
+	contentType := "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	switch format {
+	case ledgerFormatODS:
+		contentType = ods.MimeType
+	case ledgerFormatCSV:
+		charset, err := csvCharset(c.Query("encoding"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		contentType = "text/csv; charset=" + charset
+	case ledgerFormatJSONL:
+		contentType = "application/x-ndjson"
+	}
+
+	view := s.visibility(c)
+	var data []byte
+	if format == ledgerFormatODS {
+		var workbook xlsx.Workbook
+		if typ != "" {
+			layout, entries := s.ledgerSheetLayout(typ, view)
+			workbook = xlsx.Workbook{Sheets: []xlsx.Sheet{layout.build(entries)}}
+		} else {
+			workbook = s.buildWorkbook(view)
+		}
+		if data, err = ods.Encode(workbook); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
+			return
+		}
+	}
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", name, format))
+	switch format {
+	case ledgerFormatODS:
+		_, err = c.Writer.Write(data)
+	case ledgerFormatXLSX:
+		err = s.streamWorkbook(c.Writer, typ, view)
+	case ledgerFormatCSV:
+		layout, entries := s.ledgerSheetLayout(typ, view)
+		err = writeCSV(c.Writer, c.Query("encoding"), func(emit func([]string) error) error {
+			if err := emit(layout.sheet.Rows[0]); err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if err := emit(layout.row(entry)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case ledgerFormatJSONL:
+		err = writeLedgerJSONL(c.Writer, view.Entries(typ, s.Store.ListEntries(typ)))
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+// registerLedgerImportRoutes attaches the two-step workbook import: preview the mapping and
+// per-row outcome, then commit with an explicit column mapping.
+func (s *Server) registerLedgerImportRoutes(group *gin.RouterGroup) {
+	group.POST("/ledgers/:type/import/preview", s.require(models.AccessLedgerAdmin, byLedger), s.handlePreviewLedgerImport)
+	group.POST("/ledgers/:type/import/commit", s.require(models.AccessLedgerAdmin, byLedger), s.handleCommitLedgerImport)
+}
+
+// ledgerImportRequest carries a base64 workbook. Sheet defaults to the ledger's sheet name, or
+// the only sheet of a single-sheet workbook. Mapping is keyed by header text; values are id,
+// name, description, tags, links.<type>, attributes.<key> or "ignore". Mode is create (the
+// default) or merge, which matches rows on the ledger's natural key or on Key when given.
+// Format and Encoding are as for the classic import.
+type ledgerImportRequest struct {
+	Data     string            `json:"data"`
+	Format   string            `json:"format"`
+	Encoding string            `json:"encoding"`
+	Sheet    string            `json:"sheet"`
+	Mapping  map[string]string `json:"mapping"`
+	Mode     string            `json:"mode"`
+	Key      string            `json:"key"`
+}
+
+func (r ledgerImportRequest) options() (models.ImportOptions, bool) {
+	mode := strings.ToLower(strings.TrimSpace(r.Mode))
+	switch mode {
+	case "", models.ImportModeCreate:
+		mode = models.ImportModeCreate
+	case models.ImportModeMerge:
+	default:
+		return models.ImportOptions{}, false
+	}
+	return models.ImportOptions{Mode: mode, Key: r.Key}, true
+}
+
+// bindLedgerImport decodes the request and returns the rows of the selected sheet.
+func (s *Server) bindLedgerImport(c *gin.Context, typ models.LedgerType) (ledgerImportRequest, [][]string, bool) {
+	var req ledgerImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return req, nil, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_base64"})
+		return req, nil, false
+	}
+	format, err := parseLedgerFormat(req.Format)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, nil, false
+	}
+	workbook, err := decodeLedgerUpload(raw, format, req.Encoding)
+	if err != nil {
+		abortWithUploadError(c, format, err)
+		return req, nil, false
+	}
+	sheet, ok := pickLedgerSheet(workbook, req.Sheet, s.sheetNameForType(typ))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "sheet_missing"})
+		return req, nil, false
+	}
+	if _, ok := req.options(); !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_mode"})
+		return req, nil, false
+	}
+	return req, sheet.Rows, true
+}
+
+func abortWithImportError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrImportEmpty) || errors.Is(err, models.ErrImportMappingInvalid) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	abortWithLedgerError(c, err)
+}
+
+// handlePreviewLedgerImport reports the detected column mapping, per-row validation errors,
+// duplicates of existing entries and the proposed create/update/skip action, changing nothing.
+func (s *Server) handlePreviewLedgerImport(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	req, rows, ok := s.bindLedgerImport(c, typ)
+	if !ok {
+		return
+	}
+	opts, _ := req.options()
+	opts.Visibility = s.visibility(c)
+	preview, err := s.Store.PreviewImport(typ, rows, req.Mapping, opts)
+	if err != nil {
+		abortWithImportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// handleCommitLedgerImport imports the create and update rows of the sheet using the mapping
+// confirmed by the operator. Unchanged, conflicting and invalid rows are reported, not written.
+func (s *Server) handleCommitLedgerImport(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	req, rows, ok := s.bindLedgerImport(c, typ)
+	if !ok {
+		return
+	}
+	if len(req.Mapping) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "mapping_required"})
+		return
+	}
+	session := currentSession(c, s.Sessions)
+	opts, _ := req.options()
+	opts.Visibility = s.visibility(c)
+	result, err := s.Store.CommitImport(typ, rows, req.Mapping, opts, session)
+	if err != nil {
+		abortWithImportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
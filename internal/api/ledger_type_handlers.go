@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+type ledgerTypeRequest struct {
+	Type      string   `json:"type"`
+	Name      string   `json:"name"`
+	SheetName string   `json:"sheetName"`
+	LinkTypes []string `json:"linkTypes"`
+}
+
+func (r ledgerTypeRequest) toModel() models.LedgerTypeDefinition {
+	def := models.LedgerTypeDefinition{
+		Type:      models.LedgerType(r.Type),
+		Name:      r.Name,
+		SheetName: r.SheetName,
+	}
+	for _, link := range r.LinkTypes {
+		def.LinkTypes = append(def.LinkTypes, models.LedgerType(link))
+	}
+	return def
+}
+
+// registerLedgerTypeRoutes attaches management of runtime ledger types. Every session can list
+// them; registering, editing and removing types requires an administrator.
+func (s *Server) registerLedgerTypeRoutes(group *gin.RouterGroup) {
+	group.GET("/ledger-types", s.handleListLedgerTypes)
+	group.POST("/ledger-types", s.require(models.AccessLedgerAdmin, nil), s.handleCreateLedgerType)
+	group.PUT("/ledger-types/:type", s.require(models.AccessLedgerAdmin, byLedger), s.handleUpdateLedgerType)
+	group.DELETE("/ledger-types/:type", s.require(models.AccessLedgerAdmin, byLedger), s.handleDeleteLedgerType)
+	group.GET("/ledger-types/:type/natural-key", s.handleGetNaturalKey)
+	group.PUT("/ledger-types/:type/natural-key", s.require(models.AccessLedgerAdmin, byLedger), s.handleSetNaturalKey)
+}
+
+func (s *Server) handleListLedgerTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.LedgerTypes()})
+}
+
+func (s *Server) handleCreateLedgerType(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	var req ledgerTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	def, err := s.Store.RegisterLedgerType(req.toModel(), session)
+	if err != nil {
+		abortWithLedgerTypeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, def)
+}
+
+func (s *Server) handleUpdateLedgerType(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	var req ledgerTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	def, err := s.Store.UpdateLedgerType(typ, req.toModel(), session)
+	if err != nil {
+		abortWithLedgerTypeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, def)
+}
+
+func (s *Server) handleDeleteLedgerType(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	if err := s.Store.DeleteLedgerType(typ, session); err != nil {
+		abortWithLedgerTypeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func abortWithLedgerTypeError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrLedgerTypeExists), errors.Is(err, models.ErrLedgerTypeInUse):
+		status = http.StatusConflict
+	case errors.Is(err, models.ErrLedgerTypeBuiltIn):
+		status = http.StatusForbidden
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+type naturalKeyRequest struct {
+	Key string `json:"key"`
+}
+
+func (s *Server) handleGetNaturalKey(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	key, err := s.Store.NaturalKey(typ)
+	if err != nil {
+		abortWithLedgerTypeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"type": typ, "key": key})
+}
+
+// handleSetNaturalKey sets the field merge imports match rows on, such as attributes.code; an
+// empty key restores the built-in default.
+func (s *Server) handleSetNaturalKey(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	var req naturalKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	key, err := s.Store.SetNaturalKey(typ, req.Key, session)
+	if err != nil {
+		abortWithLedgerTypeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"type": typ, "key": key})
+}
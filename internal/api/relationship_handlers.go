@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+type relationshipRequest struct {
+	Role       string            `json:"role"`
+	FromType   string            `json:"fromType"`
+	FromID     string            `json:"fromId"`
+	ToType     string            `json:"toType"`
+	ToID       string            `json:"toId"`
+	Since      string            `json:"since"`
+	Notes      string            `json:"notes"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+func (r relationshipRequest) toModel() models.Relationship {
+	return models.Relationship{
+		Role:       models.RelationshipRole(r.Role),
+		FromType:   models.LedgerType(r.FromType),
+		FromID:     r.FromID,
+		ToType:     models.LedgerType(r.ToType),
+		ToID:       r.ToID,
+		Since:      r.Since,
+		Notes:      r.Notes,
+		Attributes: r.Attributes,
+	}
+}
+
+// registerRelationshipRoutes attaches typed relationship edges between ledger entries.
+func (s *Server) registerRelationshipRoutes(group *gin.RouterGroup) {
+	group.GET("/relationships", s.handleListRelationships)
+	group.POST("/relationships", s.require(models.AccessEditor, nil), s.handleCreateRelationship)
+	group.GET("/relationships/:id", s.handleGetRelationship)
+	group.PUT("/relationships/:id", s.require(models.AccessEditor, nil), s.handleUpdateRelationship)
+	group.DELETE("/relationships/:id", s.require(models.AccessEditor, nil), s.handleDeleteRelationship)
+}
+
+// handleListRelationships answers queries such as
+// ?role=owner&entryType=personnel&entryId=<alice>&relatedType=systems&direction=from.
+func (s *Server) handleListRelationships(c *gin.Context) {
+	items := s.Store.ListRelationships(models.RelationshipFilter{
+		Role:        models.RelationshipRole(c.Query("role")),
+		EntryType:   models.LedgerType(c.Query("entryType")),
+		EntryID:     c.Query("entryId"),
+		RelatedType: models.LedgerType(c.Query("relatedType")),
+		Direction:   c.Query("direction"),
+	})
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+func (s *Server) handleGetRelationship(c *gin.Context) {
+	rel, err := s.Store.GetRelationship(c.Param("id"))
+	if err != nil {
+		abortWithRelationshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rel)
+}
+
+func (s *Server) handleCreateRelationship(c *gin.Context) {
+	var req relationshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	rel, err := s.Store.CreateRelationship(req.toModel(), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithRelationshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rel)
+}
+
+func (s *Server) handleUpdateRelationship(c *gin.Context) {
+	var req relationshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	rel, err := s.Store.UpdateRelationship(c.Param("id"), req.toModel(), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithRelationshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rel)
+}
+
+func (s *Server) handleDeleteRelationship(c *gin.Context) {
+	if err := s.Store.DeleteRelationship(c.Param("id"), currentSession(c, s.Sessions)); err != nil {
+		abortWithRelationshipError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func abortWithRelationshipError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrRelationshipNotFound), errors.Is(err, models.ErrEntryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrRelationshipExists):
+		status = http.StatusConflict
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
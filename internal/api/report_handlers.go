@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+	"ledger/internal/xlsx"
+)
+
+type reportRequest struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Ledger      string                 `json:"ledger"`
+	Joins       []models.ReportJoin    `json:"joins"`
+	Columns     []models.ReportColumn  `json:"columns"`
+	Filters     []models.ReportFilter  `json:"filters"`
+	GroupBy     []string               `json:"groupBy"`
+	Schedule    *models.ReportSchedule `json:"schedule"`
+}
+
+func (r reportRequest) toModel() models.ReportDefinition {
+	return models.ReportDefinition{
+		Name:        r.Name,
+		Description: r.Description,
+		Ledger:      models.LedgerType(r.Ledger),
+		Joins:       r.Joins,
+		Columns:     r.Columns,
+		Filters:     r.Filters,
+		GroupBy:     r.GroupBy,
+		Schedule:    r.Schedule,
+	}
+}
+
+// registerReportRoutes attaches saved report definitions. Every session can list and run them;
+// creating, editing and removing reports requires a ledger administrator.
+func (s *Server) registerReportRoutes(group *gin.RouterGroup) {
+	group.GET("/reports", s.handleListReports)
+	group.POST("/reports", s.require(models.AccessLedgerAdmin, nil), s.handleCreateReport)
+	group.GET("/reports/:id", s.handleGetReport)
+	group.PUT("/reports/:id", s.require(models.AccessLedgerAdmin, nil), s.handleUpdateReport)
+	group.DELETE("/reports/:id", s.require(models.AccessLedgerAdmin, nil), s.handleDeleteReport)
+	group.GET("/reports/:id/run", s.handleRunReport)
+}
+
+func (s *Server) handleListReports(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListReports()})
+}
+
+func (s *Server) handleGetReport(c *gin.Context) {
+	report, err := s.Store.GetReport(c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) handleCreateReport(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	var req reportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	report, err := s.Store.CreateReport(req.toModel(), session)
+	if err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, report)
+}
+
+func (s *Server) handleUpdateReport(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	var req reportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	report, err := s.Store.UpdateReport(c.Param("id"), req.toModel(), session)
+	if err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) handleDeleteReport(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	if err := s.Store.DeleteReport(c.Param("id"), session); err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleRunReport evaluates a saved report as json (the default), xlsx or csv.
+func (s *Server) handleRunReport(c *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", models.ReportFormatJSON)))
+	if format != models.ReportFormatJSON && format != models.ReportFormatXLSX && format != models.ReportFormatCSV {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errUnsupportedFormat.Error()})
+		return
+	}
+	report, err := s.Store.GetReport(c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	result, err := s.Store.RunReport(report.ID, s.visibility(c))
+	if err != nil {
+		abortWithReportError(c, err)
+		return
+	}
+	if format == models.ReportFormatJSON {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	c.Writer.Header().Set("Content-Type", reportContentType(format))
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", report.ID, format))
+	if err := writeReport(c.Writer, format, report.Name, result); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
+	}
+}
+
+func abortWithReportError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrReportNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrReportTooLarge):
+		status = http.StatusUnprocessableEntity
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+func reportContentType(format string) string {
+	switch format {
+	case models.ReportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case models.ReportFormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// writeReport renders a report result in one of the report formats. Spreadsheets get a single
+// sheet named after the report with a frozen, filterable header.
+func writeReport(w io.Writer, format, name string, result *models.ReportResult) error {
+	switch format {
+	case models.ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(result)
+	case models.ReportFormatCSV:
+		return writeCSV(w, "", func(emit func([]string) error) error {
+			if err := emit(result.Columns); err != nil {
+				return err
+			}
+			for _, row := range result.Rows {
+				if err := emit(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case models.ReportFormatXLSX:
+		var widths xlsx.ColumnWidths
+		widths.Observe(result.Columns)
+		for _, row := range result.Rows {
+			widths.Observe(row)
+		}
+		sheet := xlsx.Sheet{Name: reportSheetName(name), Rows: [][]string{result.Columns}, HeaderRows: 1, AutoFilter: true}
+		sheet.Columns = widths.Apply(nil, 8, 60)
+		sw := xlsx.NewStreamWriter(w)
+		sheetWriter, err := sw.NewSheet(sheet)
+		if err != nil {
+			return err
+		}
+		for _, row := range result.Rows {
+			if err := sheetWriter.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return sw.Close()
+	}
+	return errUnsupportedFormat
+}
+
+// reportSheetName turns a report name into a valid worksheet name.
+func reportSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		return "Report"
+	}
+	return name
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ledger/internal/models"
+)
+
+// ReportScheduler generates scheduled reports into Dir, one file per run named
+// <report id>-<timestamp>.<format>, keeping the newest files of each report as its schedule
+// asks.
+type ReportScheduler struct {
+	Store *models.LedgerStore
+	Dir   string
+}
+
+// NewReportScheduler writes reports under dataDir/reports.
+func NewReportScheduler(store *models.LedgerStore, dataDir string) *ReportScheduler {
+	return &ReportScheduler{Store: store, Dir: filepath.Join(dataDir, "reports")}
+}
+
+// Run checks for due reports every minute until ctx is cancelled.
+func (r *ReportScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.RunDue(now)
+		}
+	}
+}
+
+// RunDue generates every report due at now and records the outcome on its definition. Each
+// report sees the ledgers as its creator does, and only the file name under Dir is recorded.
+func (r *ReportScheduler) RunDue(now time.Time) {
+	for _, report := range r.Store.DueReports(now) {
+		path, err := r.generate(report, now)
+		if err != nil {
+			log.Printf("scheduled report %s error: %v", report.ID, err)
+		}
+		_ = r.Store.RecordReportRun(report.ID, now, path, err)
+	}
+}
+
+func (r *ReportScheduler) generate(report *models.ReportDefinition, now time.Time) (string, error) {
+	result, err := r.Store.RunReport(report.ID, r.Store.VisibilityFor(report.CreatedBy))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return "", err
+	}
+	format := report.Schedule.Format
+	path := filepath.Join(r.Dir, fmt.Sprintf("%s-%s.%s", report.ID, now.UTC().Format("20060102T150405Z"), format))
+	tmp := path + ".tmp"
+	if err := func() error {
+		fh, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		if err := writeReport(fh, format, report.Name, result); err != nil {
+			return err
+		}
+		return fh.Sync()
+	}(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return path, r.prune(report.ID, report.Schedule.Keep)
+}
+
+// prune removes all but the newest keep files of a report.
+func (r *ReportScheduler) prune(id string, keep int) error {
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, id+"-") && !strings.HasSuffix(name, ".tmp") {
+			files = append(files, filepath.Join(r.Dir, name))
+		}
+	}
+	// Timestamps sort lexically, so the newest files come first.
+	sort.Slice(files, func(i, j int) bool { return files[i] > files[j] })
+	if len(files) > keep {
+		for _, stale := range files[keep:] {
+			_ = os.Remove(stale)
+		}
+	}
+	return nil
+}
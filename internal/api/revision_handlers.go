@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+// registerRevisionRoutes attaches per-record change history and point-in-time views for
+// ledger entries and workspaces.
+func (s *Server) registerRevisionRoutes(group *gin.RouterGroup) {
+	group.GET("/ledgers/:type/:id/revisions", s.handleEntryRevisions)
+	group.GET("/ledgers/:type/:id/revisions/diff", s.handleEntryRevisionDiff)
+	group.GET("/ledgers/:type/:id/as-of", s.handleEntryAsOf)
+	group.GET("/workspaces/:id/revisions", s.handleWorkspaceRevisions)
+	group.GET("/workspaces/:id/revisions/diff", s.handleWorkspaceRevisionDiff)
+	group.GET("/workspaces/:id/as-of", s.handleWorkspaceAsOf)
+}
+
+// parseAsOf accepts RFC 3339 timestamps or plain dates; a plain date means the end of that day
+// in UTC.
+func parseAsOf(c *gin.Context) (time.Time, bool) {
+	raw := strings.TrimSpace(c.Query("at"))
+	if raw == "" {
+		return time.Now().UTC(), true
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed, true
+	}
+	for _, layout := range []string{"2006-01-02", "2006/01/02"} {
+		if parsed, err := time.Parse(layout, raw); err == nil {
+			return parsed.Add(24*time.Hour - time.Nanosecond), true
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_time"})
+	return time.Time{}, false
+}
+
+func parseRevisionRange(c *gin.Context) (int, int, bool) {
+	from, errFrom := strconv.Atoi(c.Query("from"))
+	to, errTo := strconv.Atoi(c.Query("to"))
+	if errFrom != nil || errTo != nil || from <= 0 || to <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_revision"})
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// visibleEntryType resolves the ledger of an entry route, answering 404 for unknown ledgers and
+// for entries the visibility rules hide from the session user.
+func (s *Server) visibleEntryType(c *gin.Context) (models.LedgerType, *models.Visibility, bool) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return "", nil, false
+	}
+	view := s.visibility(c)
+	if view.Hidden(typ, c.Param("id")) {
+		abortWithLedgerError(c, models.ErrEntryNotFound)
+		return "", nil, false
+	}
+	return typ, view, true
+}
+
+// handleEntryRevisions lists an entry's revisions; ?field=attributes.owner narrows the list
+// to revisions touching one field.
+func (s *Server) handleEntryRevisions(c *gin.Context) {
+	typ, view, ok := s.visibleEntryType(c)
+	if !ok {
+		return
+	}
+	items, err := s.Store.EntryRevisions(typ, c.Param("id"), strings.TrimSpace(c.Query("field")))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	items = view.Revisions(items)
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+func (s *Server) handleEntryRevisionDiff(c *gin.Context) {
+	typ, view, ok := s.visibleEntryType(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseRevisionRange(c)
+	if !ok {
+		return
+	}
+	changes, err := s.Store.DiffEntryRevisions(typ, c.Param("id"), from, to)
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": view.Changes(typ, changes)})
+}
+
+// handleEntryAsOf shows an entry as it was at ?at=<date or timestamp>.
+func (s *Server) handleEntryAsOf(c *gin.Context) {
+	typ, view, ok := s.visibleEntryType(c)
+	if !ok {
+		return
+	}
+	at, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+	entry, rev, err := s.Store.EntryAsOf(typ, c.Param("id"), at)
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	revisions := view.Revisions([]models.Revision{rev})
+	c.JSON(http.StatusOK, gin.H{"item": view.Mask(typ, entry), "revision": revisions[0]})
+}
+
+func (s *Server) handleWorkspaceRevisions(c *gin.Context) {
+	items, err := s.Store.WorkspaceRevisions(c.Param("id"), strings.TrimSpace(c.Query("field")))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+func (s *Server) handleWorkspaceRevisionDiff(c *gin.Context) {
+	from, to, ok := parseRevisionRange(c)
+	if !ok {
+		return
+	}
+	changes, err := s.Store.DiffWorkspaceRevisions(c.Param("id"), from, to)
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": changes})
+}
+
+func (s *Server) handleWorkspaceAsOf(c *gin.Context) {
+	at, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+	workspace, rev, err := s.Store.WorkspaceAsOf(c.Param("id"), at)
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"workspace": workspaceToResponse(workspace), "revision": rev})
+}
@@ -28,7 +28,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"tables": tables})
 	})
 
-	group.POST("/tables", func(c *gin.Context) {
+	group.POST("/tables", s.require(models.AccessEditor, nil), func(c *gin.Context) {
 		var payload struct {
 			ID          string `json:"id"`
 			Name        string `json:"name"`
@@ -62,7 +62,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"views": views})
 	})
 
-	group.POST("/tables/:id/views", func(c *gin.Context) {
+	group.POST("/tables/:id/views", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		var payload models.View
 		if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Name) == "" {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
@@ -81,7 +81,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"view": view})
 	})
 
-	group.PUT("/tables/:id/views/:viewId", func(c *gin.Context) {
+	group.PUT("/tables/:id/views/:viewId", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		var payload models.View
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
@@ -113,7 +113,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"properties": properties})
 	})
 
-	group.POST("/tables/:id/properties", func(c *gin.Context) {
+	group.POST("/tables/:id/properties", s.require(models.AccessLedgerAdmin, byTable), func(c *gin.Context) {
 		propsProvider, ok := s.Roledger.(interface {
 			CreateProperty(ctx context.Context, prop models.Property) (*models.Property, error)
 		})
@@ -153,7 +153,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		Properties map[string]interface{} `json:"properties"`
 	}
 
-	group.PUT("/tables/:id/records/:recordId", func(c *gin.Context) {
+	group.PUT("/tables/:id/records/:recordId", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		var payload updateRecordPayload
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
@@ -167,7 +167,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"record": record})
 	})
 
-	group.POST("/tables/:id/records/bulk", func(c *gin.Context) {
+	group.POST("/tables/:id/records/bulk", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		var payload struct {
 			Updates []struct {
 				ID         string                 `json:"id"`
@@ -191,7 +191,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"records": updated})
 	})
 
-	group.POST("/tables/:id/records", func(c *gin.Context) {
+	group.POST("/tables/:id/records", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		var payload updateRecordPayload
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
@@ -205,7 +205,7 @@ func (s *Server) registerRoledgerRoutes(group *gin.RouterGroup) {
 		c.JSON(http.StatusOK, gin.H{"record": record})
 	})
 
-	group.DELETE("/tables/:id/records/:recordId", func(c *gin.Context) {
+	group.DELETE("/tables/:id/records/:recordId", s.require(models.AccessEditor, byTable), func(c *gin.Context) {
 		if err := s.Roledger.DeleteRecord(c.Request.Context(), c.Param("id"), c.Param("recordId"), currentSession(c, s.Sessions)); err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
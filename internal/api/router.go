@@ -20,6 +20,8 @@ type Config struct {
 	Retention int
 	Roledger  *services.RoledgerService
 	Import    *services.ImportService
+	// TrustedProxies are the reverse proxies allowed to report client addresses.
+	TrustedProxies middleware.TrustedProxies
 }
 
 // NewRouter configures HTTP routes for the application.
@@ -35,6 +37,7 @@ func NewRouter(cfg Config) *gin.Engine {
 		SnapshotRetention: cfg.Retention,
 		Roledger:          cfg.Roledger,
 		Import:            cfg.Import,
+		TrustedProxies:    cfg.TrustedProxies,
 	}
 	server.RegisterRoutes(r)
 	webembed.Register(r)
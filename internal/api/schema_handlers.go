@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+type schemaRequest struct {
+	Fields []models.SchemaField `json:"fields"`
+}
+
+// registerSchemaRoutes attaches ledger schema management. Reads are open to every session so
+// clients can render forms; changes require an administrator.
+func (s *Server) registerSchemaRoutes(group *gin.RouterGroup) {
+	group.GET("/schemas", s.handleListSchemas)
+	group.GET("/schemas/:type", s.handleGetSchema)
+	group.PUT("/schemas/:type", s.require(models.AccessLedgerAdmin, byLedger), s.handlePutSchema)
+	group.DELETE("/schemas/:type", s.require(models.AccessLedgerAdmin, byLedger), s.handleDeleteSchema)
+}
+
+func (s *Server) handleListSchemas(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListSchemas()})
+}
+
+func (s *Server) handleGetSchema(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	schema, err := s.Store.GetSchema(typ)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+func (s *Server) handlePutSchema(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	var req schemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	schema, err := s.Store.SetSchema(typ, models.LedgerSchema{Fields: req.Fields}, session)
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+func (s *Server) handleDeleteSchema(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
+	}
+	if err := s.Store.DeleteSchema(typ, session); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrSchemaNotFound) {
+			status = http.StatusNotFound
+		}
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerSearchRoutes attaches global full-text search over ledgers and workspaces.
+func (s *Server) registerSearchRoutes(group *gin.RouterGroup) {
+	group.GET("/search", s.handleSearch)
+}
+
+// handleSearch answers ?q=<text>&kind=entry,workspace&limit=20 with ranked hits. Highlight
+// offsets are rune positions within each snippet. Visibility rules apply to entry hits.
+func (s *Server) handleSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "query_required"})
+		return
+	}
+	var kinds []string
+	if raw := strings.TrimSpace(c.Query("kind")); raw != "" {
+		kinds = strings.Split(raw, ",")
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	hits, total := s.Store.SearchVisible(query, kinds, limit, s.visibility(c))
+	c.JSON(http.StatusOK, gin.H{"items": hits, "total": total})
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -52,6 +51,9 @@ type Server struct {
 		UpdateView(ctx context.Context, view models.View) (*models.View, error)
 	}
 	Import *services.ImportService
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For headers name the client
+	// checked against the IP allowlist.
+	TrustedProxies middleware.TrustedProxies
 }
 
 // RegisterRoutes attaches handlers to the gin engine.
@@ -61,64 +63,93 @@ func (s *Server) RegisterRoutes(router *gin.Engine) {
 
 	authGroup := router.Group("/auth")
 	{
-		authGroup.POST("/password-login", s.handlePasswordLogin)
+		authGroup.POST("/password-login", middleware.IPAllowlist(s.Store, s.TrustedProxies, models.AllowlistScopeAll), s.handlePasswordLogin)
+		authGroup.POST("/refresh", middleware.IPAllowlist(s.Store, s.TrustedProxies, models.AllowlistScopeAll), s.handleRefresh)
 		authGroup.POST("/logout", s.handleLogout)
-		authGroup.POST("/change-password", s.handleChangePassword)
+		authGroup.POST("/change-password", middleware.IPAllowlist(s.Store, s.TrustedProxies, models.AllowlistScopeAll), middleware.RequireSession(s.Sessions), s.handleChangePassword)
 	}
 
 	secured := router.Group("/api/v1")
-	secured.Use(middleware.RequireSession(s.Sessions))
+	secured.Use(middleware.IPAllowlist(s.Store, s.TrustedProxies, models.AllowlistScopeAll), middleware.RequireSession(s.Sessions))
 	{
 		s.registerRoledgerRoutes(secured)
 		s.registerImportRoutes(secured)
 		s.registerImportRoutes(secured)
+		s.registerIPAMRoutes(secured)
+		s.registerSchemaRoutes(secured)
+		s.registerLedgerTypeRoutes(secured)
+		s.registerRelationshipRoutes(secured)
+		s.registerGraphRoutes(secured)
+		s.registerSearchRoutes(secured)
+		s.registerRevisionRoutes(secured)
+		s.registerTrashRoutes(secured)
+		s.registerBulkRoutes(secured)
+		s.registerLedgerImportRoutes(secured)
+		s.registerLedgerFileRoutes(secured)
+		s.registerReportRoutes(secured)
+		s.registerAccessRoutes(secured)
+		s.registerVisibilityRoutes(secured)
+		s.registerSessionRoutes(secured)
+
+		editor := s.require(models.AccessEditor, nil)
+		ledgerEditor := s.require(models.AccessEditor, byLedger)
+		workspaceEditor := s.require(models.AccessEditor, byWorkspace)
+		systemAdmin := s.require(models.AccessSystemAdmin, nil)
+
 		secured.GET("/ledgers/:type", s.handleListLedger)
-		secured.POST("/ledgers/:type", s.handleCreateLedger)
-		secured.PUT("/ledgers/:type/:id", s.handleUpdateLedger)
-		secured.DELETE("/ledgers/:type/:id", s.handleDeleteLedger)
-		secured.POST("/ledgers/:type/reorder", s.handleReorderLedger)
-		secured.POST("/ledgers/:type/import", s.handleImportLedger)
-		secured.GET("/ledgers/export", s.handleExportLedger)
-		secured.POST("/ledgers/import", s.handleImportWorkbook)
+		secured.GET("/ledgers/:type/:id", s.handleGetLedger)
+		secured.POST("/ledgers/:type", ledgerEditor, s.handleCreateLedger)
+		secured.PUT("/ledgers/:type/:id", ledgerEditor, s.handleUpdateLedger)
+		secured.DELETE("/ledgers/:type/:id", ledgerEditor, s.handleDeleteLedger)
+		secured.POST("/ledgers/:type/reorder", ledgerEditor, s.handleReorderLedger)
+		secured.POST("/ledgers/:type/import", s.require(models.AccessLedgerAdmin, byLedger), s.handleImportLedger)
 		secured.GET("/ledger-cartesian", s.handleLedgerMatrix)
+		secured.GET("/ledger-links/broken", s.handleBrokenLinks)
+		secured.POST("/ledger-links/repair", s.require(models.AccessLedgerAdmin, nil), s.handleRepairLinks)
 
 		secured.GET("/workspaces", s.handleListWorkspaces)
-		secured.POST("/workspaces", s.handleCreateWorkspace)
+		secured.POST("/workspaces", editor, s.handleCreateWorkspace)
 		secured.GET("/workspaces/:id", s.handleGetWorkspace)
-		secured.PUT("/workspaces/:id", s.handleUpdateWorkspace)
-		secured.DELETE("/workspaces/:id", s.handleDeleteWorkspace)
-		secured.POST("/workspaces/:id/import/excel", s.handleImportWorkspaceExcel)
-		secured.POST("/workspaces/:id/import/text", s.handleImportWorkspaceText)
-		secured.POST("/workspaces/:id/import/docx", s.handleImportWorkspaceDocx)
-		secured.POST("/workspaces/:id/import/pdf", s.handleImportWorkspacePDF)
-		secured.POST("/workspaces/reorder", s.handleReorderWorkspaces)
+		secured.PUT("/workspaces/:id", workspaceEditor, s.handleUpdateWorkspace)
+		secured.DELETE("/workspaces/:id", workspaceEditor, s.handleDeleteWorkspace)
+		secured.POST("/workspaces/:id/import/excel", workspaceEditor, s.handleImportWorkspaceExcel)
+		secured.POST("/workspaces/:id/import/text", workspaceEditor, s.handleImportWorkspaceText)
+		secured.POST("/workspaces/:id/import/docx", workspaceEditor, s.handleImportWorkspaceDocx)
+		secured.POST("/workspaces/:id/import/pdf", workspaceEditor, s.handleImportWorkspacePDF)
+		secured.POST("/workspaces/reorder", editor, s.handleReorderWorkspaces)
 		secured.GET("/workspaces/:id/export", s.handleExportWorkspace)
 		secured.GET("/workspaces/:id/export/docx", s.handleExportWorkspaceDocx)
 		secured.POST("/workspaces/:id/export/selected", s.handleExportWorkspaceSelected)
 
-		secured.GET("/users", s.handleListUsers)
-		secured.POST("/users", s.handleCreateUser)
-		secured.DELETE("/users/:id", s.handleDeleteUser)
+		secured.GET("/users", systemAdmin, s.handleListUsers)
+		secured.POST("/users", systemAdmin, s.handleCreateUser)
+		secured.DELETE("/users/:id", systemAdmin, s.handleDeleteUser)
+		secured.POST("/users/:id/unlock", systemAdmin, s.handleUnlockUser)
+		secured.GET("/login-blocks", systemAdmin, s.handleListLoginBlocks)
+		secured.DELETE("/login-blocks/:ip", systemAdmin, s.handleUnblockLoginIP)
 
-		secured.GET("/ip-allowlist", s.handleListAllowlist)
-		secured.POST("/ip-allowlist", s.handleCreateAllowlist)
-		secured.PUT("/ip-allowlist/:id", s.handleUpdateAllowlist)
-		secured.DELETE("/ip-allowlist/:id", s.handleDeleteAllowlist)
+		secured.GET("/ip-allowlist", systemAdmin, s.handleListAllowlist)
+		secured.POST("/ip-allowlist", systemAdmin, s.handleCreateAllowlist)
+		secured.PUT("/ip-allowlist/:id", systemAdmin, s.handleUpdateAllowlist)
+		secured.DELETE("/ip-allowlist/:id", systemAdmin, s.handleDeleteAllowlist)
 
-		secured.POST("/history/undo", s.handleUndo)
-		secured.POST("/history/redo", s.handleRedo)
+		secured.POST("/history/undo", editor, s.handleUndo)
+		secured.POST("/history/redo", editor, s.handleRedo)
 		secured.GET("/history", s.handleHistoryStatus)
 
 		secured.GET("/overview", s.handleOverview)
+		secured.GET("/overview/trends", s.handleOverviewTrends)
+		secured.GET("/overview/stale", s.handleOverviewStale)
+		secured.GET("/overview/quality", s.handleOverviewQuality)
 
-		secured.GET("/audit-logs", s.handleAuditLogs)
-		secured.GET("/audit-logs/verify", s.handleAuditLogsVerify)
-		secured.GET("/export/all", s.handleExportAll)
-		secured.POST("/import/all", s.handleImportAll)
-		secured.GET("/admin/export", s.handleAdminExport)
-		secured.POST("/admin/import", s.handleAdminImport)
-		secured.POST("/admin/save-snapshot", s.handleManualSave)
-		secured.POST("/media/upload", s.handleUploadMedia)
+		secured.GET("/audit-logs", systemAdmin, s.handleAuditLogs)
+		secured.GET("/audit-logs/verify", systemAdmin, s.handleAuditLogsVerify)
+		secured.GET("/export/all", systemAdmin, s.handleExportAll)
+		secured.POST("/import/all", systemAdmin, s.handleImportAll)
+		secured.GET("/admin/export", systemAdmin, s.handleAdminExport)
+		secured.POST("/admin/import", systemAdmin, s.handleAdminImport)
+		secured.POST("/admin/save-snapshot", systemAdmin, s.handleManualSave)
+		secured.POST("/media/upload", editor, s.handleUploadMedia)
 	}
 }
 
@@ -175,30 +206,37 @@ func (s *Server) handlePasswordLogin(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
 		return
 	}
-	user, err := s.Store.AuthenticateUser(req.Username, req.Password)
+	user, err := s.Store.Login(req.Username, req.Password, s.TrustedProxies.ClientIP(c.Request))
 	if err != nil {
 		status := http.StatusUnauthorized
-		if errors.Is(err, models.ErrUsernameInvalid) || errors.Is(err, models.ErrPasswordTooShort) {
+		var blocked *models.LoginBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			status = http.StatusTooManyRequests
+			if errors.Is(err, models.ErrAccountLocked) {
+				status = http.StatusLocked
+			}
+			retry := int(time.Until(blocked.Until).Seconds()) + 1
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(retry))
+			c.AbortWithStatusJSON(status, gin.H{"error": blocked.Reason.Error(), "retryAfter": retry})
+			return
+		case errors.Is(err, models.ErrUsernameInvalid), errors.Is(err, models.ErrPasswordTooShort):
 			status = http.StatusBadRequest
 		}
 		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
 		return
 	}
-	session, err := s.Sessions.Issue(user.Username, user.ID)
+	session, err := s.issueSession(c, user.Username)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "session_issue_failed"})
 		return
 	}
 	s.Store.RecordLogin(user.Username)
-	c.JSON(http.StatusOK, gin.H{
-		"token":                session.Token,
-		"username":             user.Username,
-		"admin":                user.Admin,
-		"issuedAt":             session.IssuedAt,
-		"expiresAt":            session.ExpiresAt,
-		"defaultAdminActive":   s.Store.DefaultAdminActive(),
-		"defaultAdminUsername": "hzdsz_admin",
-	})
+	body := sessionTokens(session)
+	body["admin"] = user.Admin
+	body["defaultAdminActive"] = s.Store.DefaultAdminActive()
+	body["defaultAdminUsername"] = "hzdsz_admin"
+	c.JSON(http.StatusOK, body)
 }
 
 func (s *Server) handleLogout(c *gin.Context) {
@@ -233,6 +271,12 @@ func (s *Server) handleChangePassword(c *gin.Context) {
 		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	// Other devices signed in with the old password are signed out.
+	keep := ""
+	if current := contextSession(c); current != nil {
+		keep = current.ID
+	}
+	_, _ = s.Sessions.RevokeUser(session, keep)
 	c.JSON(http.StatusOK, gin.H{"status": "password_changed"})
 }
 
@@ -306,58 +350,96 @@ func canonicalizeJSON(raw json.RawMessage) (string, error) {
 
 // Challenge satisfaction removed
 
-func clientIP(r *http.Request) string {
-	if r == nil {
-		return ""
+func (s *Server) handleListLedger(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+		return
 	}
-	if v := r.Header.Get("X-Forwarded-For"); v != "" {
-		parts := strings.Split(v, ",")
-		candidate := strings.TrimSpace(parts[0])
-		if ip := net.ParseIP(candidate); ip != nil {
-			return ip.String()
-		}
+	query, ok := parseLedgerQuery(c)
+	if !ok {
+		return
 	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	query.Visibility = s.visibility(c)
+	entries, total, err := s.Store.QueryEntries(typ, query)
 	if err != nil {
-		if ip := net.ParseIP(strings.TrimSpace(r.RemoteAddr)); ip != nil {
-			return ip.String()
-		}
-		return r.RemoteAddr
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if ip := net.ParseIP(host); ip != nil {
-		return ip.String()
+	if query.PageSize == 0 {
+		c.JSON(http.StatusOK, gin.H{"items": entries, "total": total})
+		return
 	}
-	return host
+	c.JSON(http.StatusOK, gin.H{"items": entries, "total": total, "page": query.Page, "pageSize": query.PageSize})
 }
 
-func (s *Server) handleListLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+func (s *Server) handleGetLedger(c *gin.Context) {
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
 	}
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "0"))
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize < 0 {
-		pageSize = 0
+	entry, err := s.Store.GetEntry(typ, c.Param("id"))
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
 	}
-	if pageSize == 0 {
-		entries := s.Store.ListEntries(typ)
-		c.JSON(http.StatusOK, gin.H{"items": entries, "total": len(entries)})
+	entry, ok = s.visibility(c).Entry(typ, entry)
+	if !ok {
+		abortWithLedgerError(c, models.ErrEntryNotFound)
 		return
 	}
-	entries, total := s.Store.ListEntriesPaged(typ, page, pageSize)
-	c.JSON(http.StatusOK, gin.H{"items": entries, "total": total, "page": page, "pageSize": pageSize})
+	c.JSON(http.StatusOK, entry)
+}
+
+// visibility evaluates the visibility rules for the session user.
+func (s *Server) visibility(c *gin.Context) *models.Visibility {
+	return s.Store.VisibilityFor(currentSession(c, s.Sessions))
 }
 
 func (s *Server) handleOverview(c *gin.Context) {
-	stats := s.Store.OverviewStats()
+	stats := s.Store.OverviewStats(s.visibility(c))
 	c.JSON(http.StatusOK, gin.H{"stats": stats})
 }
 
+// handleOverviewTrends returns entries created, updated and deleted per day and ledger over
+// the last ?days= days (30 by default, at most a year).
+func (s *Server) handleOverviewTrends(c *gin.Context) {
+	days, ok := overviewDays(c, 30, 366)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "ledgers": s.Store.ActivityTrends(days, time.Now())})
+}
+
+// handleOverviewStale returns entries not updated in ?days= days (90 by default).
+func (s *Server) handleOverviewStale(c *gin.Context) {
+	days, ok := overviewDays(c, 90, 3650)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "ledgers": s.Store.StaleEntries(days, time.Now(), s.visibility(c))})
+}
+
+// handleOverviewQuality scores each ledger by entries missing required attributes, unlinked
+// entries and duplicate names.
+func (s *Server) handleOverviewQuality(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"ledgers": s.Store.DataQuality(s.visibility(c))})
+}
+
+func overviewDays(c *gin.Context, fallback, max int) (int, bool) {
+	raw := strings.TrimSpace(c.Query("days"))
+	if raw == "" {
+		return fallback, true
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 1 || days > max {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_days"})
+		return 0, false
+	}
+	return days, true
+}
+
 type ledgerRequest struct {
 	Name        string              `json:"name"`
 	Description string              `json:"description"`
@@ -405,17 +487,30 @@ type workspaceTreeItem struct {
 }
 
 type userResponse struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Admin     bool      `json:"admin"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          string            `json:"id"`
+	Username    string            `json:"username"`
+	Admin       bool              `json:"admin"`
+	Role        models.AccessRole `json:"role"`
+	Groups      []string          `json:"groups,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	LockedUntil *time.Time        `json:"lockedUntil,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
 }
 
+// userCreateRequest accepts either a role or, for older clients, the admin flag.
 type userCreateRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Admin    bool   `json:"admin"`
+	Role     string `json:"role"`
+}
+
+func (r userCreateRequest) role() models.AccessRole {
+	if r.Role == "" && r.Admin {
+		return models.AccessSystemAdmin
+	}
+	return models.AccessRole(strings.TrimSpace(r.Role))
 }
 
 type workspaceRequest struct {
@@ -449,7 +544,7 @@ type workspaceTextImportRequest struct {
 }
 
 func (s *Server) handleCreateLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
@@ -469,10 +564,43 @@ func (s *Server) handleCreateLedger(c *gin.Context) {
 	session := currentSession(c, s.Sessions)
 	created, err := s.Store.CreateEntry(typ, entry, session)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s.visibility(c).Mask(typ, created))
+}
+
+// abortWithLedgerError maps ledger store errors onto HTTP responses, exposing structured
+// details for errors that carry them.
+func abortWithLedgerError(c *gin.Context, err error) {
+	var conflict *models.IPConflictError
+	if errors.As(err, &conflict) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":     models.ErrIPConflict.Error(),
+			"address":   conflict.Address,
+			"conflicts": conflict.Conflicts,
+		})
+		return
+	}
+	var validation *models.ValidationError
+	if errors.As(err, &validation) {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  models.ErrValidationFailed.Error(),
+			"type":   validation.Type,
+			"fields": validation.Fields,
+		})
 		return
 	}
-	c.JSON(http.StatusOK, created)
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrEntryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrEntryLinked):
+		status = http.StatusConflict
+	case errors.Is(err, models.ErrNoPath), errors.Is(err, models.ErrRevisionNotFound), errors.Is(err, models.ErrWorkspaceNotFound):
+		status = http.StatusNotFound
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
 }
 
 func convertLinks(input map[string][]string) map[models.LedgerType][]string {
@@ -481,7 +609,7 @@ func convertLinks(input map[string][]string) map[models.LedgerType][]string {
 	}
 	out := make(map[models.LedgerType][]string, len(input))
 	for key, values := range input {
-		if typ, ok := parseLedgerType(key); ok {
+		if typ := models.NormaliseLedgerType(key); typ != "" {
 			out[typ] = append([]string{}, values...)
 		}
 	}
@@ -489,7 +617,7 @@ func convertLinks(input map[string][]string) map[models.LedgerType][]string {
 }
 
 func (s *Server) handleUpdateLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
@@ -499,38 +627,47 @@ func (s *Server) handleUpdateLedger(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
 		return
 	}
+	view := s.visibility(c)
+	stored, err := s.Store.GetEntry(typ, c.Param("id"))
+	if err == nil && view.Hidden(typ, stored.ID) {
+		err = models.ErrEntryNotFound
+	}
+	if err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
 	session := currentSession(c, s.Sessions)
 	updated, err := s.Store.UpdateEntry(typ, c.Param("id"), models.LedgerEntry{
 		Name:        req.Name,
 		Description: req.Description,
-		Attributes:  req.Attributes,
+		Attributes:  view.Restore(typ, req.Attributes, stored.Attributes),
 		Tags:        req.Tags,
 		Links:       convertLinks(req.Links),
 	}, session)
 	if err != nil {
-		status := http.StatusBadRequest
-		if errors.Is(err, models.ErrEntryNotFound) {
-			status = http.StatusNotFound
-		}
-		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		abortWithLedgerError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	c.JSON(http.StatusOK, view.Mask(typ, updated))
 }
 
 func (s *Server) handleDeleteLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
 	}
+	mode := models.DeleteCascade
+	if strings.EqualFold(strings.TrimSpace(c.Query("links")), string(models.DeleteRestrict)) {
+		mode = models.DeleteRestrict
+	}
+	if s.visibility(c).Hidden(typ, c.Param("id")) {
+		abortWithLedgerError(c, models.ErrEntryNotFound)
+		return
+	}
 	session := currentSession(c, s.Sessions)
-	if err := s.Store.DeleteEntry(typ, c.Param("id"), session); err != nil {
-		status := http.StatusBadRequest
-		if errors.Is(err, models.ErrEntryNotFound) {
-			status = http.StatusNotFound
-		}
-		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+	if err := s.Store.DeleteEntryWithMode(typ, c.Param("id"), mode, session); err != nil {
+		abortWithLedgerError(c, err)
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -541,7 +678,7 @@ type reorderRequest struct {
 }
 
 func (s *Server) handleReorderLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
@@ -557,15 +694,19 @@ func (s *Server) handleReorderLedger(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"items": entries})
+	c.JSON(http.StatusOK, gin.H{"items": s.visibility(c).Entries(typ, entries)})
 }
 
+// importRequest carries a base64 file. Format is xlsx (the default), ods, csv or jsonl; Encoding
+// overrides CSV encoding detection (utf-8 or gbk).
 type importRequest struct {
-	Data string `json:"data"`
+	Data     string `json:"data"`
+	Format   string `json:"format"`
+	Encoding string `json:"encoding"`
 }
 
 func (s *Server) handleImportLedger(c *gin.Context) {
-	typ, ok := parseLedgerType(c.Param("type"))
+	typ, ok := s.Store.ResolveLedgerType(c.Param("type"))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
 		return
@@ -580,25 +721,30 @@ func (s *Server) handleImportLedger(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_base64"})
 		return
 	}
-	workbook, err := xlsx.Decode(raw)
+	format, err := parseLedgerFormat(req.Format)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_workbook"})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	sheetName := sheetNameForType(typ)
-	sheet, ok := workbook.SheetByName(sheetName)
+	workbook, err := decodeLedgerUpload(raw, format, req.Encoding)
+	if err != nil {
+		abortWithUploadError(c, format, err)
+		return
+	}
+	sheet, ok := pickLedgerSheet(workbook, "", s.sheetNameForType(typ))
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "sheet_missing"})
 		return
 	}
 	entries := parseLedgerSheet(typ, sheet)
 	session := currentSession(c, s.Sessions)
-	s.Store.AppendEntries(typ, entries, session)
-	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListEntries(typ)})
+	if _, err := s.Store.AppendEntries(typ, entries, session); err != nil {
+		abortWithLedgerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": s.visibility(c).Entries(typ, s.Store.ListEntries(typ))})
 }
 
-var ipRegex = regexp.MustCompile(`(?i)^(?:\d{1,3}\.){3}\d{1,3}$|^(?:[a-f0-9]{0,4}:){2,7}[a-f0-9]{0,4}$`)
-
 func parseLedgerSheet(typ models.LedgerType, sheet xlsx.Sheet) []models.LedgerEntry {
 	if len(sheet.Rows) == 0 {
 		return nil
@@ -626,16 +772,18 @@ func parseLedgerSheet(typ models.LedgerType, sheet xlsx.Sheet) []models.LedgerEn
 				entry.Tags = strings.Split(value, ";")
 			default:
 				if header == "" {
-					if typ == models.LedgerTypeIP && ipRegex.MatchString(value) {
-						entry.Attributes["address"] = value
-						if entry.Name == "" {
-							entry.Name = value
+					if typ == models.LedgerTypeIP {
+						if address, ok := models.NormaliseIPAddress(value); ok {
+							entry.Attributes[models.IPAddressAttribute] = address
+							if entry.Name == "" {
+								entry.Name = address
+							}
 						}
 					}
 					continue
 				}
 				if strings.HasPrefix(header, "link_") {
-					if typ, ok := parseLedgerType(strings.TrimPrefix(header, "link_")); ok {
+					if typ := models.NormaliseLedgerType(strings.TrimPrefix(header, "link_")); typ != "" {
 						entry.Links[typ] = strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' })
 					}
 					continue
@@ -643,7 +791,7 @@ func parseLedgerSheet(typ models.LedgerType, sheet xlsx.Sheet) []models.LedgerEn
 				if entry.Attributes == nil {
 					entry.Attributes = make(map[string]string)
 				}
-				entry.Attributes[header] = value
+				entry.Attributes[strings.TrimPrefix(header, "attributes.")] = value
 			}
 		}
 		if typ == models.LedgerTypeIP && entry.Name == "" {
@@ -669,18 +817,6 @@ func normaliseHeaders(headers []string) []string {
 	return out
 }
 
-func (s *Server) handleExportLedger(c *gin.Context) {
-	workbook := s.buildWorkbook()
-	data, err := xlsx.Encode(workbook)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
-		return
-	}
-	c.Writer.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	c.Writer.Header().Set("Content-Disposition", "attachment; filename=ledger.xlsx")
-	_, _ = c.Writer.Write(data)
-}
-
 func (s *Server) handleImportWorkbook(c *gin.Context) {
 	var req importRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -692,25 +828,45 @@ func (s *Server) handleImportWorkbook(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_base64"})
 		return
 	}
-	workbook, err := xlsx.Decode(raw)
+	format, err := parseLedgerFormat(req.Format)
+	if err == nil && format != ledgerFormatXLSX && format != ledgerFormatODS {
+		err = errUnsupportedFormat
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	workbook, err := decodeLedgerUpload(raw, format, "")
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_workbook"})
+		abortWithUploadError(c, format, err)
 		return
 	}
 	session := currentSession(c, s.Sessions)
-	for _, typ := range models.AllLedgerTypes {
-		sheetName := sheetNameForType(typ)
+	for _, typ := range s.Store.LedgerTypeKeys() {
+		sheetName := s.sheetNameForType(typ)
 		if sheet, ok := workbook.SheetByName(sheetName); ok {
 			entries := parseLedgerSheet(typ, sheet)
-			s.Store.ReplaceEntries(typ, entries, session)
+			if err := s.Store.ReplaceEntries(typ, entries, session); err != nil {
+				abortWithLedgerError(c, err)
+				return
+			}
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "imported"})
 }
 
 func (s *Server) handleLedgerMatrix(c *gin.Context) {
-	matrix := s.buildCartesianRows()
-	c.JSON(http.StatusOK, gin.H{"rows": matrix})
+	header, matrix := s.buildLinkMatrix(s.visibility(c))
+	c.JSON(http.StatusOK, gin.H{"columns": header, "rows": matrix})
+}
+
+func (s *Server) handleBrokenLinks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.BrokenLinks()})
+}
+
+func (s *Server) handleRepairLinks(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	c.JSON(http.StatusOK, gin.H{"repaired": s.Store.RepairLinks(session)})
 }
 
 func (s *Server) handleListWorkspaces(c *gin.Context) {
@@ -916,37 +1072,46 @@ func (s *Server) handleDeleteWorkspace(c *gin.Context) {
 }
 
 func (s *Server) handleImportWorkspaceExcel(c *gin.Context) {
-	uploaded, _, err := c.Request.FormFile("file")
+	uploaded, header, err := c.Request.FormFile("file")
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing_file"})
 		return
 	}
 	defer uploaded.Close()
 
-	data, err := io.ReadAll(uploaded)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "file_read_failed"})
-		return
-	}
-
-	workbook, err := xlsx.Decode(data)
+	// Stream the chosen sheet, the first by default, instead of decoding the whole workbook.
+	reader, err := xlsx.OpenReader(uploaded, header.Size)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_workbook"})
 		return
 	}
-	if len(workbook.Sheets) == 0 {
+	names := reader.SheetNames()
+	if len(names) == 0 {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "workbook_empty"})
 		return
 	}
-	sheet := workbook.Sheets[0]
+	sheetName := names[0]
+	if requested := strings.TrimSpace(c.Request.FormValue("sheet")); requested != "" {
+		sheetName = requested
+	}
+	iter, err := reader.Rows(sheetName)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "sheet_missing"})
+		return
+	}
+	defer iter.Close()
 	headers := []string{}
 	rows := [][]string{}
-	if len(sheet.Rows) > 0 {
-		headers = append(headers, sheet.Rows[0]...)
-		for _, row := range sheet.Rows[1:] {
-			copied := append([]string{}, row...)
-			rows = append(rows, copied)
+	for iter.Next() {
+		if iter.Index() == 0 {
+			headers = append(headers, iter.Row()...)
+			continue
 		}
+		rows = append(rows, iter.Row())
+	}
+	if err := iter.Err(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_workbook"})
+		return
 	}
 	actor := currentSession(c, s.Sessions)
 	expectedVersion := extractWorkspaceVersion(
@@ -1109,34 +1274,11 @@ func (s *Server) handleExportWorkspace(c *gin.Context) {
 		return
 	}
 
-	rows := make([][]string, 0, len(workspace.Rows)+1)
-	if len(workspace.Columns) > 0 {
-		header := make([]string, len(workspace.Columns))
-		for i, column := range workspace.Columns {
-			header[i] = column.Title
-		}
-		rows = append(rows, header)
-	}
-	for _, row := range workspace.Rows {
-		record := make([]string, len(workspace.Columns))
-		for i, column := range workspace.Columns {
-			record[i] = row.Cells[column.ID]
-		}
-		rows = append(rows, record)
-	}
-	sheetName := workspace.Name
-	if strings.TrimSpace(sheetName) == "" {
-		sheetName = "workspace"
-	}
-	workbook := xlsx.Workbook{Sheets: []xlsx.Sheet{{Name: sheetName, Rows: rows}}}
-	encoded, err := xlsx.Encode(workbook)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
-		return
-	}
 	c.Writer.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.xlsx\"", "workspace"))
-	c.Writer.Write(encoded)
+	if err := streamWorkspace(c.Writer, workspace, nil); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
+	}
 }
 
 type exportSelectedRequest struct {
@@ -1169,37 +1311,113 @@ func (s *Server) handleExportWorkspaceSelected(c *gin.Context) {
 			allow[id] = struct{}{}
 		}
 	}
-	rows := make([][]string, 0, len(workspace.Rows)+1)
+	c.Writer.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_selected.xlsx\"", "workspace"))
+	if err := streamWorkspace(c.Writer, workspace, allow); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
+	}
+}
+
+// defaultWorkspaceColumnWidth mirrors the web editor's default column width in pixels.
+const defaultWorkspaceColumnWidth = 220
+
+// streamWorkspace writes a sheet workspace to w row by row as the editor shows it: column
+// widths, a frozen filterable header, bold highlighted rows and per-cell styles. When rowIDs is
+// non-nil only those rows are included.
+func streamWorkspace(w io.Writer, workspace *models.Workspace, rowIDs map[string]struct{}) error {
+	sw := xlsx.NewStreamWriter(w)
+	sheetWriter, err := sw.NewSheet(workspaceSheetLayout(workspace))
+	if err != nil {
+		return err
+	}
+	if err := eachWorkspaceRow(workspace, rowIDs, sheetWriter.WriteStyledRow); err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+// workspaceSheetLayout returns the sheet name, column widths and header row of a workspace.
+func workspaceSheetLayout(workspace *models.Workspace) xlsx.Sheet {
+	name := workspace.Name
+	if strings.TrimSpace(name) == "" {
+		name = "workspace"
+	}
+	sheet := xlsx.Sheet{Name: name}
 	if len(workspace.Columns) > 0 {
 		header := make([]string, len(workspace.Columns))
 		for i, column := range workspace.Columns {
 			header[i] = column.Title
+			width := column.Width
+			if width <= 0 {
+				width = defaultWorkspaceColumnWidth
+			}
+			// Excel widths count characters of roughly seven pixels.
+			sheet.Columns = append(sheet.Columns, xlsx.Column{Width: float64(width) / 7})
 		}
-		rows = append(rows, header)
+		sheet.Rows = append(sheet.Rows, header)
+		sheet.HeaderRows = 1
+		sheet.AutoFilter = true
 	}
+	return sheet
+}
+
+// eachWorkspaceRow calls fn with the cells, row style and cell styles by column of every row,
+// skipping rows missing from a non-nil rowIDs.
+func eachWorkspaceRow(workspace *models.Workspace, rowIDs map[string]struct{}, fn func([]string, xlsx.Style, map[int]xlsx.Style) error) error {
 	for _, row := range workspace.Rows {
-		if _, ok := allow[row.ID]; !ok {
-			continue
+		if rowIDs != nil {
+			if _, ok := rowIDs[row.ID]; !ok {
+				continue
+			}
 		}
 		record := make([]string, len(workspace.Columns))
+		var cells map[int]xlsx.Style
 		for i, column := range workspace.Columns {
 			record[i] = row.Cells[column.ID]
+			if style := parseCellStyle(row.Styles[column.ID]); !style.IsZero() {
+				if cells == nil {
+					cells = make(map[int]xlsx.Style)
+				}
+				cells[i] = style
+			}
+		}
+		var style xlsx.Style
+		if row.Highlighted {
+			style.Bold = true
+		}
+		if err := fn(record, style, cells); err != nil {
+			return err
 		}
-		rows = append(rows, record)
-	}
-	sheetName := workspace.Name
-	if strings.TrimSpace(sheetName) == "" {
-		sheetName = "workspace"
 	}
-	workbook := xlsx.Workbook{Sheets: []xlsx.Sheet{{Name: sheetName, Rows: rows}}}
-	encoded, err := xlsx.Encode(workbook)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
-		return
+	return nil
+}
+
+// parseCellStyle reads the CSS-like declarations stored in WorkspaceRow.Styles, e.g.
+// "font-weight:bold;color:#c00000;background-color:#fff2cc".
+func parseCellStyle(value string) xlsx.Style {
+	var style xlsx.Style
+	for _, declaration := range strings.Split(value, ";") {
+		property, raw, ok := strings.Cut(declaration, ":")
+		if !ok {
+			continue
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		raw = strings.ToLower(strings.TrimSpace(raw))
+		switch property {
+		case "font-weight":
+			weight, err := strconv.Atoi(raw)
+			style.Bold = raw == "bold" || raw == "bolder" || (err == nil && weight >= 600)
+		case "font-style":
+			style.Italic = raw == "italic" || raw == "oblique"
+		case "text-decoration", "text-decoration-line":
+			style.Underline = strings.Contains(raw, "underline")
+		case "color":
+			style.Color = raw
+		case "background", "background-color":
+			style.Fill = raw
+		}
 	}
-	c.Writer.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_selected.xlsx\"", "workspace"))
-	c.Writer.Write(encoded)
+	return style
 }
 
 func (s *Server) handleExportWorkspaceDocx(c *gin.Context) {
@@ -1228,11 +1446,6 @@ func (s *Server) handleExportWorkspaceDocx(c *gin.Context) {
 }
 
 func (s *Server) handleListUsers(c *gin.Context) {
-	session := currentSession(c, s.Sessions)
-	if !s.Store.IsUserAdmin(session) {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin_required"})
-		return
-	}
 	users := s.Store.ListUsers()
 	items := make([]userResponse, 0, len(users))
 	for _, user := range users {
@@ -1243,20 +1456,16 @@ func (s *Server) handleListUsers(c *gin.Context) {
 
 func (s *Server) handleCreateUser(c *gin.Context) {
 	session := currentSession(c, s.Sessions)
-	if !s.Store.IsUserAdmin(session) {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin_required"})
-		return
-	}
 	var req userCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
 		return
 	}
-	user, err := s.Store.CreateUser(req.Username, req.Password, req.Admin, session)
+	user, err := s.Store.CreateUser(req.Username, req.Password, req.role(), session)
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch {
-		case errors.Is(err, models.ErrUsernameInvalid), errors.Is(err, models.ErrPasswordTooShort):
+		case errors.Is(err, models.ErrUsernameInvalid), errors.Is(err, models.ErrPasswordTooShort), errors.Is(err, models.ErrRoleInvalid):
 			status = http.StatusBadRequest
 		case errors.Is(err, models.ErrUserExists):
 			status = http.StatusConflict
@@ -1269,10 +1478,7 @@ func (s *Server) handleCreateUser(c *gin.Context) {
 
 func (s *Server) handleDeleteUser(c *gin.Context) {
 	session := currentSession(c, s.Sessions)
-	if !s.Store.IsUserAdmin(session) {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin_required"})
-		return
-	}
+	username := s.usernameByID(c.Param("id"))
 	if err := s.Store.DeleteUser(c.Param("id"), session); err != nil {
 		status := http.StatusInternalServerError
 		switch {
@@ -1284,6 +1490,36 @@ func (s *Server) handleDeleteUser(c *gin.Context) {
 		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	_, _ = s.Sessions.RevokeUser(username, "")
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleUnlockUser(c *gin.Context) {
+	user, err := s.Store.UnlockUser(c.Param("id"), currentSession(c, s.Sessions))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrUserNotFound) {
+			status = http.StatusNotFound
+		}
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": userToResponse(user)})
+}
+
+func (s *Server) handleListLoginBlocks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListLoginBlocks()})
+}
+
+func (s *Server) handleUnblockLoginIP(c *gin.Context) {
+	if err := s.Store.UnblockLoginIP(c.Param("ip"), currentSession(c, s.Sessions)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrLoginBlockNotFound) {
+			status = http.StatusNotFound
+		}
+		c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
 
@@ -1368,11 +1604,15 @@ func userToResponse(user *models.User) userResponse {
 		return userResponse{}
 	}
 	return userResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Admin:     user.Admin,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:          user.ID,
+		Username:    user.Username,
+		Admin:       user.Admin,
+		Role:        user.EffectiveRole(),
+		Groups:      user.Groups,
+		Attributes:  user.Attributes,
+		LockedUntil: user.LockedUntil,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
 	}
 }
 
@@ -1483,6 +1723,7 @@ func (s *Server) handleListAllowlist(c *gin.Context) {
 type allowRequest struct {
 	Label       string `json:"label"`
 	CIDR        string `json:"cidr"`
+	Scope       string `json:"scope"`
 	Description string `json:"description"`
 }
 
@@ -1492,9 +1733,9 @@ func (s *Server) handleCreateAllowlist(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
 		return
 	}
-	entry, err := s.Store.AppendAllowlist(&models.IPAllowlistEntry{Label: req.Label, CIDR: req.CIDR, Description: req.Description}, currentSession(c, s.Sessions))
+	entry, err := s.Store.AppendAllowlist(&models.IPAllowlistEntry{Label: req.Label, CIDR: req.CIDR, Scope: req.Scope, Description: req.Description}, currentSession(c, s.Sessions), s.TrustedProxies.ClientIP(c.Request))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithAllowlistError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, entry)
@@ -1506,41 +1747,66 @@ func (s *Server) handleUpdateAllowlist(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
 		return
 	}
-	entry := &models.IPAllowlistEntry{ID: c.Param("id"), Label: req.Label, CIDR: req.CIDR, Description: req.Description}
-	updated, err := s.Store.AppendAllowlist(entry, currentSession(c, s.Sessions))
+	entry := &models.IPAllowlistEntry{ID: c.Param("id"), Label: req.Label, CIDR: req.CIDR, Scope: req.Scope, Description: req.Description}
+	updated, err := s.Store.AppendAllowlist(entry, currentSession(c, s.Sessions), s.TrustedProxies.ClientIP(c.Request))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithAllowlistError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, updated)
 }
 
 func (s *Server) handleDeleteAllowlist(c *gin.Context) {
-	if !s.Store.RemoveAllowlist(c.Param("id"), currentSession(c, s.Sessions)) {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not_found"})
+	if err := s.Store.RemoveAllowlist(c.Param("id"), currentSession(c, s.Sessions), s.TrustedProxies.ClientIP(c.Request)); err != nil {
+		abortWithAllowlistError(c, err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
+// abortWithAllowlistError maps allowlist errors; a change that would lock the caller's own
+// network out answers 409 with the address it protected.
+func abortWithAllowlistError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, models.ErrAllowlistNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrAllowlistLockout):
+		status = http.StatusConflict
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// handleUndo reverts the caller's own latest operation. Edits by other users are never
+// rewound; a 409 lists the records someone else changed since.
 func (s *Server) handleUndo(c *gin.Context) {
-	if err := s.Store.Undo(); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := s.Store.Undo(currentSession(c, s.Sessions)); err != nil {
+		abortWithHistoryError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 func (s *Server) handleRedo(c *gin.Context) {
-	if err := s.Store.Redo(); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := s.Store.Redo(currentSession(c, s.Sessions)); err != nil {
+		abortWithHistoryError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+func abortWithHistoryError(c *gin.Context, err error) {
+	var conflict *models.UndoConflictError
+	if errors.As(err, &conflict) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": models.ErrUndoConflict.Error(), "records": conflict.Records})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
 func (s *Server) handleHistoryStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"undo": s.Store.CanUndo(), "redo": s.Store.CanRedo()})
+	undo, redo := s.Store.HistoryDepth(currentSession(c, s.Sessions))
+	c.JSON(http.StatusOK, gin.H{"undo": undo > 0, "redo": redo > 0, "undoDepth": undo, "redoDepth": redo})
 }
 
 func (s *Server) handleAuditLogs(c *gin.Context) {
@@ -1565,7 +1831,9 @@ func (s *Server) handleExportAll(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
 		return
 	}
-	if err := writeSnapshotSQL(entry, s.Store.ExportSnapshot()); err != nil {
+	snapshot := s.Store.ExportSnapshot()
+	s.visibility(c).Redact(snapshot)
+	if err := writeSnapshotSQL(entry, snapshot); err != nil {
 		_ = zipWriter.Close()
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
 		return
@@ -1606,7 +1874,7 @@ func (s *Server) handleImportAll(c *gin.Context) {
 			return
 		}
 		if err := s.Store.ImportSnapshot(&snapshot); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortWithLedgerError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "imported"})
@@ -1648,6 +1916,10 @@ func (s *Server) handleImportAll(c *gin.Context) {
 		_ = os.RemoveAll(filepath.Join(s.DataDir, "assets"))
 	}
 	if err := importSnapshotFromFile(fh, info.Size(), s.Store, s.DataDir, mode == "merge"); err != nil {
+		if errors.Is(err, models.ErrValidationFailed) {
+			abortWithLedgerError(c, err)
+			return
+		}
 		status := http.StatusInternalServerError
 		if errors.Is(err, errSnapshotMissing) || errors.Is(err, errSnapshotInvalid) {
 			status = http.StatusBadRequest
@@ -2170,20 +2442,6 @@ func confirmOverwrite(c *gin.Context) bool {
 	return false
 }
 
-func parseLedgerType(value string) (models.LedgerType, bool) {
-	value = strings.ToLower(strings.TrimSpace(value))
-	switch value {
-	case "ips", "ip":
-		return models.LedgerTypeIP, true
-	case "personnel", "people", "person":
-		return models.LedgerTypePersonnel, true
-	case "systems", "system":
-		return models.LedgerTypeSystem, true
-	default:
-		return "", false
-	}
-}
-
 func currentSession(c *gin.Context, manager *auth.Manager) string {
 	if c == nil {
 		return "system"
@@ -2196,45 +2454,148 @@ func currentSession(c *gin.Context, manager *auth.Manager) string {
 	return "system"
 }
 
-func (s *Server) buildWorkbook() xlsx.Workbook {
-	sheets := make([]xlsx.Sheet, 0, len(models.AllLedgerTypes)+1)
-	for _, typ := range models.AllLedgerTypes {
-		entries := s.Store.ListEntries(typ)
-		sheet := xlsx.Sheet{Name: sheetNameForType(typ)}
-		header := []string{"ID", "Name", "Description", "Tags"}
-		keys := attributeKeys(entries)
-		header = append(header, keys...)
-		for _, other := range models.AllLedgerTypes {
-			if other == typ {
-				continue
-			}
-			header = append(header, "link_"+string(other))
+// buildWorkbook lays out every ledger and the link matrix as view lets its user see them.
+func (s *Server) buildWorkbook(view *models.Visibility) xlsx.Workbook {
+	types := s.Store.LedgerTypes()
+	sheets := make([]xlsx.Sheet, 0, len(types)+1)
+	order := make([]string, 0, len(types)+1)
+	for _, def := range types {
+		schema, _ := s.Store.GetSchema(def.Type)
+		sheets = append(sheets, buildLedgerSheet(def, types, view.Entries(def.Type, s.Store.ListEntries(def.Type)), schema))
+		order = append(order, def.SheetName)
+	}
+	matrix := s.newLinkMatrix(view)
+	matrixSheet := matrix.layout()
+	_ = matrix.each(func(row []string) error {
+		matrixSheet.Rows = append(matrixSheet.Rows, row)
+		return nil
+	})
+	sheets = append(sheets, matrixSheet)
+	workbook := xlsx.Workbook{Sheets: sheets}
+	workbook.SortSheets(append(order, models.MatrixSheetName))
+	return workbook
+}
+
+// streamWorkbook writes the ledger workbook to w without holding its rows: one sheet per
+// ledger followed by the link matrix, or only the sheet of typ when it is set.
+func (s *Server) streamWorkbook(w io.Writer, typ models.LedgerType, view *models.Visibility) error {
+	sw := xlsx.NewStreamWriter(w)
+	for _, def := range s.Store.LedgerTypes() {
+		if typ != "" && def.Type != typ {
+			continue
 		}
-		sheet.Rows = append(sheet.Rows, header)
+		layout, entries := s.ledgerSheetLayout(def.Type, view)
+		var widths xlsx.ColumnWidths
+		widths.Observe(layout.sheet.Rows[0])
 		for _, entry := range entries {
-			row := []string{entry.ID, entry.Name, entry.Description, strings.Join(entry.Tags, ";")}
-			for _, key := range keys {
-				row = append(row, entry.Attributes[key])
+			widths.Observe(layout.row(entry))
+		}
+		sheet := layout.sheet
+		sheet.Columns = widths.Apply(sheet.Columns, 8, 60)
+		sheetWriter, err := sw.NewSheet(sheet)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := sheetWriter.WriteRow(layout.row(entry)); err != nil {
+				return err
 			}
-			for _, other := range models.AllLedgerTypes {
-				if other == typ {
-					continue
-				}
-				row = append(row, strings.Join(entry.Links[other], ";"))
+		}
+	}
+	if typ == "" {
+		matrix := s.newLinkMatrix(view)
+		sheetWriter, err := sw.NewSheet(matrix.layout())
+		if err != nil {
+			return err
+		}
+		if err := matrix.each(sheetWriter.WriteRow); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// ledgerSheetLayout is the column layout of a ledger sheet: ID, Name, Description, Tags, one
+// column per attribute key and one link_<type> column per linkable ledger. Schema fields come
+// first, typed as declared, with a dropdown for enum fields.
+type ledgerSheetLayout struct {
+	// sheet holds the header row and column types but no data rows or widths.
+	sheet     xlsx.Sheet
+	keys      []string
+	linkTypes []models.LedgerType
+}
+
+func newLedgerSheetLayout(def *models.LedgerTypeDefinition, types []*models.LedgerTypeDefinition, entries []models.LedgerEntry, schema *models.LedgerSchema) ledgerSheetLayout {
+	layout := ledgerSheetLayout{sheet: xlsx.Sheet{Name: def.SheetName, HeaderRows: 1, AutoFilter: true}}
+	header := []string{"ID", "Name", "Description", "Tags"}
+	layout.sheet.Columns = make([]xlsx.Column, len(header))
+	seen := make(map[string]struct{})
+	if schema != nil {
+		for _, field := range schema.Fields {
+			layout.keys = append(layout.keys, field.Name)
+			seen[field.Name] = struct{}{}
+			column := xlsx.Column{}
+			switch field.Type {
+			case models.FieldTypeNumber:
+				column.Type = xlsx.CellNumber
+			case models.FieldTypeDate:
+				column.Type = xlsx.CellDate
+			case models.FieldTypeEnum:
+				column.Options = field.Options
 			}
-			sheet.Rows = append(sheet.Rows, row)
+			layout.sheet.Columns = append(layout.sheet.Columns, column)
 		}
-		sheets = append(sheets, sheet)
 	}
-	combined := s.buildCartesianRows()
-	matrixSheet := xlsx.Sheet{Name: "Matrix"}
-	matrixHeader := []string{"IP", "Personnel", "System"}
-	matrixSheet.Rows = append(matrixSheet.Rows, matrixHeader)
-	matrixSheet.Rows = append(matrixSheet.Rows, combined...)
-	sheets = append(sheets, matrixSheet)
-	workbook := xlsx.Workbook{Sheets: sheets}
-	workbook.SortSheets([]string{"IP", "Personnel", "System", "Matrix"})
-	return workbook
+	for _, key := range attributeKeys(entries) {
+		if _, ok := seen[key]; !ok {
+			layout.keys = append(layout.keys, key)
+			layout.sheet.Columns = append(layout.sheet.Columns, xlsx.Column{})
+		}
+	}
+	header = append(header, layout.keys...)
+	for _, other := range types {
+		if other.Type == def.Type || !def.AllowsLink(other.Type) {
+			continue
+		}
+		layout.linkTypes = append(layout.linkTypes, other.Type)
+		header = append(header, "link_"+string(other.Type))
+	}
+	layout.sheet.Rows = [][]string{header}
+	return layout
+}
+
+func (l ledgerSheetLayout) row(entry models.LedgerEntry) []string {
+	row := []string{entry.ID, entry.Name, entry.Description, strings.Join(entry.Tags, ";")}
+	for _, key := range l.keys {
+		row = append(row, entry.Attributes[key])
+	}
+	for _, other := range l.linkTypes {
+		row = append(row, strings.Join(entry.Links[other], ";"))
+	}
+	return row
+}
+
+// build lays the entries out in memory.
+func (l ledgerSheetLayout) build(entries []models.LedgerEntry) xlsx.Sheet {
+	sheet := l.sheet
+	for _, entry := range entries {
+		sheet.Rows = append(sheet.Rows, l.row(entry))
+	}
+	sheet.FitWidths(8, 60)
+	return sheet
+}
+
+// ledgerSheetLayout lays out the ledger of typ, which must exist, along with the entries view
+// leaves visible.
+func (s *Server) ledgerSheetLayout(typ models.LedgerType, view *models.Visibility) (ledgerSheetLayout, []models.LedgerEntry) {
+	def, _ := s.Store.LedgerType(typ)
+	schema, _ := s.Store.GetSchema(typ)
+	entries := view.Entries(typ, s.Store.ListEntries(typ))
+	return newLedgerSheetLayout(def, s.Store.LedgerTypes(), entries, schema), entries
+}
+
+func buildLedgerSheet(def *models.LedgerTypeDefinition, types []*models.LedgerTypeDefinition, entries []models.LedgerEntry, schema *models.LedgerSchema) xlsx.Sheet {
+	return newLedgerSheetLayout(def, types, entries, schema).build(entries)
 }
 
 func attributeKeys(entries []models.LedgerEntry) []string {
@@ -2252,27 +2613,158 @@ func attributeKeys(entries []models.LedgerEntry) []string {
 	return keys
 }
 
-func (s *Server) buildCartesianRows() [][]string {
-	ips := s.Store.ListEntries(models.LedgerTypeIP)
-	personnel := s.Store.ListEntries(models.LedgerTypePersonnel)
-	systems := s.Store.ListEntries(models.LedgerTypeSystem)
+func (s *Server) buildCartesianRows(view *models.Visibility) [][]string {
+	_, rows := s.buildLinkMatrix(view)
+	return rows
+}
 
+// buildLinkMatrix collects the whole link matrix; see linkMatrix.
+func (s *Server) buildLinkMatrix(view *models.Visibility) ([]string, [][]string) {
+	matrix := s.newLinkMatrix(view)
 	rows := [][]string{}
-	for _, system := range systems {
-		linkedIPs := uniqueOrAll(system.Links[models.LedgerTypeIP], ips)
-		linkedPersonnel := uniqueOrAll(system.Links[models.LedgerTypePersonnel], personnel)
+	_ = matrix.each(func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return matrix.header, rows
+}
+
+// linkMatrix expands every system into one row per combination of its linked IP and
+// personnel, then of each custom ledger it links to. Rows are generated lazily so the cross
+// product never has to fit in memory. Entries the view hides neither get rows nor appear as
+// links.
+type linkMatrix struct {
+	store     *models.LedgerStore
+	view      *models.Visibility
+	header    []string
+	systems   []models.LedgerEntry
+	ips       []models.LedgerEntry
+	personnel []models.LedgerEntry
+	names     map[models.LedgerType]map[string]string
+	custom    []*models.LedgerTypeDefinition
+}
+
+func (s *Server) newLinkMatrix(view *models.Visibility) *linkMatrix {
+	m := &linkMatrix{
+		store:     s.Store,
+		view:      view,
+		header:    []string{"IP", "Personnel", "System", "Role"},
+		systems:   view.Entries(models.LedgerTypeSystem, s.Store.ListEntries(models.LedgerTypeSystem)),
+		ips:       view.Entries(models.LedgerTypeIP, s.Store.ListEntries(models.LedgerTypeIP)),
+		personnel: view.Entries(models.LedgerTypePersonnel, s.Store.ListEntries(models.LedgerTypePersonnel)),
+		names:     make(map[models.LedgerType]map[string]string),
+	}
+	m.names[models.LedgerTypeIP] = entryNames(m.ips)
+	m.names[models.LedgerTypePersonnel] = entryNames(m.personnel)
+	for _, def := range s.Store.LedgerTypes() {
+		if def.BuiltIn {
+			continue
+		}
+		m.custom = append(m.custom, def)
+		m.names[def.Type] = entryNames(view.Entries(def.Type, s.Store.ListEntries(def.Type)))
+		m.header = append(m.header, def.Name)
+	}
+	return m
+}
+
+// layout returns the matrix sheet with its header row; widths follow the header since the
+// rows are not known in advance.
+func (m *linkMatrix) layout() xlsx.Sheet {
+	sheet := xlsx.Sheet{Name: models.MatrixSheetName, HeaderRows: 1, AutoFilter: true, Rows: [][]string{m.header}}
+	sheet.FitWidths(16, 40)
+	return sheet
+}
+
+// each calls fn for every matrix row, or once with a blank row when there are none. Rows are
+// not reused, so fn may keep them.
+func (m *linkMatrix) each(fn func([]string) error) error {
+	emitted := false
+	emit := func(row []string) error {
+		emitted = true
+		return fn(row)
+	}
+	for _, system := range m.systems {
+		options := make([][]string, len(m.custom))
+		for i, def := range m.custom {
+			names := []string{""}
+			if ids := m.visible(def.Type, uniqueOrAll(system.Links[def.Type], nil)); len(ids) > 0 {
+				names = names[:0]
+				for _, id := range ids {
+					names = append(names, nameOrID(m.names[def.Type], id))
+				}
+			}
+			options[i] = names
+		}
+		linkedIPs := m.visibleOrBlank(models.LedgerTypeIP, uniqueOrAll(system.Links[models.LedgerTypeIP], m.ips))
+		linkedPersonnel := m.visibleOrBlank(models.LedgerTypePersonnel, uniqueOrAll(system.Links[models.LedgerTypePersonnel], m.personnel))
+		roles := make([]string, len(linkedPersonnel))
+		for i, personID := range linkedPersonnel {
+			roles[i] = strings.Join(m.store.RelationshipRoles(models.LedgerTypePersonnel, personID, models.LedgerTypeSystem, system.ID), ";")
+		}
 		for _, ipID := range linkedIPs {
-			ipName := lookupName(ipID, ips)
-			for _, personID := range linkedPersonnel {
-				personName := lookupName(personID, personnel)
-				rows = append(rows, []string{ipName, personName, system.Name})
+			ipName := nameOrID(m.names[models.LedgerTypeIP], ipID)
+			for i, personID := range linkedPersonnel {
+				base := []string{ipName, nameOrID(m.names[models.LedgerTypePersonnel], personID), system.Name, roles[i]}
+				if err := expandMatrixRow(base, options, emit); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	if len(rows) == 0 {
-		rows = append(rows, []string{"", "", ""})
+	if !emitted {
+		return fn(make([]string, len(m.header)))
 	}
-	return rows
+	return nil
+}
+
+// visible drops the IDs of hidden entries.
+func (m *linkMatrix) visible(typ models.LedgerType, ids []string) []string {
+	if m.view == nil {
+		return ids
+	}
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !m.view.Hidden(typ, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// visibleOrBlank is visible, leaving one blank cell when every linked entry is hidden so the
+// system keeps its rows.
+func (m *linkMatrix) visibleOrBlank(typ models.LedgerType, ids []string) []string {
+	if out := m.visible(typ, ids); len(out) > 0 || len(ids) == 0 {
+		return out
+	}
+	return []string{""}
+}
+
+func expandMatrixRow(row []string, options [][]string, fn func([]string) error) error {
+	if len(options) == 0 {
+		return fn(row)
+	}
+	for _, name := range options[0] {
+		if err := expandMatrixRow(append(row[:len(row):len(row)], name), options[1:], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func entryNames(entries []models.LedgerEntry) map[string]string {
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		names[entry.ID] = entry.Name
+	}
+	return names
+}
+
+func nameOrID(names map[string]string, id string) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return id
 }
 
 func uniqueOrAll(ids []string, entries []models.LedgerEntry) []string {
@@ -2304,24 +2796,9 @@ func uniqueOrAll(ids []string, entries []models.LedgerEntry) []string {
 	return out
 }
 
-func lookupName(id string, entries []models.LedgerEntry) string {
-	for _, entry := range entries {
-		if entry.ID == id {
-			return entry.Name
-		}
-	}
-	return id
-}
-
-func sheetNameForType(typ models.LedgerType) string {
-	switch typ {
-	case models.LedgerTypeIP:
-		return "IP"
-	case models.LedgerTypePersonnel:
-		return "Personnel"
-	case models.LedgerTypeSystem:
-		return "System"
-	default:
-		return strings.Title(string(typ))
+func (s *Server) sheetNameForType(typ models.LedgerType) string {
+	if def, ok := s.Store.LedgerType(typ); ok {
+		return def.SheetName
 	}
+	return string(typ)
 }
@@ -1,8 +1,21 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"ledger/internal/auth"
+	"ledger/internal/middleware"
 	"ledger/internal/models"
 	"ledger/internal/xlsx"
 )
@@ -49,7 +62,7 @@ func TestBuildCartesianRows(t *testing.T) {
 		t.Fatalf("update system links: %v", err)
 	}
 	server := &Server{Store: store}
-	rows := server.buildCartesianRows()
+	rows := server.buildCartesianRows(nil)
 	if len(rows) != 1 {
 		t.Fatalf("expected 1 row, got %d", len(rows))
 	}
@@ -60,3 +73,733 @@ func TestBuildCartesianRows(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildWorkbookIncludesCustomLedgers(t *testing.T) {
+	store := models.NewLedgerStore()
+	def, err := store.RegisterLedgerType(models.LedgerTypeDefinition{Type: "racks", Name: "机柜", SheetName: "Racks"}, "tester")
+	if err != nil {
+		t.Fatalf("register ledger type: %v", err)
+	}
+	rack, err := store.CreateEntry(def.Type, models.LedgerEntry{Name: "A01"}, "tester")
+	if err != nil {
+		t.Fatalf("create rack: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP", Links: map[models.LedgerType][]string{def.Type: {rack.ID}}}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypeIP, models.LedgerEntry{Name: "10.0.0.1"}, "tester"); err != nil {
+		t.Fatalf("create ip: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypePersonnel, models.LedgerEntry{Name: "Alice"}, "tester"); err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	server := &Server{Store: store}
+	workbook := server.buildWorkbook(nil)
+	sheet, ok := workbook.SheetByName("Racks")
+	if !ok || len(sheet.Rows) != 2 || sheet.Rows[1][1] != "A01" {
+		t.Fatalf("expected custom ledger sheet, got %+v", sheet)
+	}
+	header, rows := server.buildLinkMatrix(nil)
+	if len(header) != 5 || header[4] != "机柜" {
+		t.Fatalf("unexpected matrix header: %v", header)
+	}
+	if len(rows) != 1 || rows[0][2] != "ERP" || rows[0][4] != "A01" {
+		t.Fatalf("unexpected matrix rows: %v", rows)
+	}
+	entries := parseLedgerSheet(def.Type, sheet)
+	if len(entries) != 1 || entries[0].Name != "A01" {
+		t.Fatalf("expected custom sheet to parse back, got %+v", entries)
+	}
+}
+
+func TestDecodeCSVDetectsEncoding(t *testing.T) {
+	text := "名称;地址;负责人\n核心交换;10.0.0.1;张三\n"
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("encode gbk: %v", err)
+	}
+	for name, raw := range map[string][]byte{
+		"gbk":      gbk,
+		"utf8-bom": append([]byte{0xEF, 0xBB, 0xBF}, text...),
+		"utf8":     []byte(text),
+	} {
+		rows, err := decodeCSV(raw, "")
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		if len(rows) != 2 || rows[0][0] != "名称" || rows[1][1] != "10.0.0.1" || rows[1][2] != "张三" {
+			t.Fatalf("%s: unexpected rows %q", name, rows)
+		}
+	}
+	if _, err := decodeCSV(gbk, "latin9"); err != errUnknownEncoding {
+		t.Fatalf("expected unknown encoding, got %v", err)
+	}
+}
+
+func TestLedgerJSONLRoundTrip(t *testing.T) {
+	entries := []models.LedgerEntry{{
+		ID:         "ip-1",
+		Name:       "10.0.0.1",
+		Tags:       []string{"核心", "生产"},
+		Attributes: map[string]string{"address": "10.0.0.1", "owner": "张三"},
+		Links:      map[models.LedgerType][]string{models.LedgerTypeSystem: {"sys-1"}},
+	}}
+	buf := new(bytes.Buffer)
+	if err := writeLedgerJSONL(buf, entries); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data := append(buf.Bytes(), []byte(`{"name":"10.0.0.2","attributes":{"vlan":20}}`+"\n")...)
+	rows, err := decodeLedgerJSONL(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	parsed := parseLedgerSheet(models.LedgerTypeIP, xlsx.Sheet{Rows: rows})
+	if len(parsed) != 2 || parsed[0].ID != "ip-1" || parsed[0].Attributes["owner"] != "张三" || len(parsed[0].Tags) != 2 {
+		t.Fatalf("unexpected entries %+v", parsed)
+	}
+	if links := parsed[0].Links[models.LedgerTypeSystem]; len(links) != 1 || links[0] != "sys-1" {
+		t.Fatalf("expected links to survive, got %+v", parsed[0].Links)
+	}
+	if parsed[1].Attributes["vlan"] != "20" {
+		t.Fatalf("expected numeric attribute as text, got %+v", parsed[1].Attributes)
+	}
+}
+
+func TestWorkspaceSheetKeepsLayout(t *testing.T) {
+	workspace := &models.Workspace{
+		Name:    "机房巡检",
+		Columns: []models.WorkspaceColumn{{ID: "c1", Title: "机柜", Width: 140}, {ID: "c2", Title: "状态"}},
+		Rows: []models.WorkspaceRow{
+			{ID: "r1", Cells: map[string]string{"c1": "A01", "c2": "正常"}},
+			{ID: "r2", Cells: map[string]string{"c1": "A02", "c2": "告警"}, Highlighted: true, Styles: map[string]string{"c2": "color:#c00000; font-weight:700"}},
+		},
+	}
+	sheet := workspaceSheetLayout(workspace)
+	if sheet.HeaderRows != 1 || !sheet.AutoFilter || sheet.Columns[0].Width != 20 || sheet.Columns[1].Width == 0 {
+		t.Fatalf("unexpected layout %+v", sheet)
+	}
+	var rowStyles []xlsx.Style
+	var cellStyles []map[int]xlsx.Style
+	_ = eachWorkspaceRow(workspace, nil, func(_ []string, style xlsx.Style, cells map[int]xlsx.Style) error {
+		rowStyles = append(rowStyles, style)
+		cellStyles = append(cellStyles, cells)
+		return nil
+	})
+	if len(rowStyles) != 2 || rowStyles[0].Bold || !rowStyles[1].Bold {
+		t.Fatalf("expected only the highlighted row to be bold, got %+v", rowStyles)
+	}
+	if style := cellStyles[1][1]; style.Color != "#c00000" || !style.Bold {
+		t.Fatalf("unexpected cell style %+v", style)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := streamWorkspace(buf, workspace, map[string]struct{}{"r2": {}}); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	workbook, err := xlsx.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	selected := workbook.Sheets[0]
+	if selected.Name != "机房巡检" || len(selected.Rows) != 2 || selected.Rows[0][0] != "机柜" || selected.Rows[1][0] != "A02" {
+		t.Fatalf("expected only the selected row, got %+v", selected)
+	}
+}
+
+func TestBuildLedgerSheetUsesSchema(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.SetSchema(models.LedgerTypeSystem, models.LedgerSchema{Fields: []models.SchemaField{
+		{Name: "level", Type: models.FieldTypeEnum, Options: []string{"核心", "一般"}},
+		{Name: "launched", Type: models.FieldTypeDate},
+	}}, "tester"); err != nil {
+		t.Fatalf("set schema: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP", Attributes: map[string]string{"level": "核心"}}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	server := &Server{Store: store}
+	sheet, ok := server.buildWorkbook(nil).SheetByName("System")
+	if !ok {
+		t.Fatalf("expected systems sheet")
+	}
+	if got := sheet.Rows[0]; got[4] != "level" || got[5] != "launched" {
+		t.Fatalf("expected schema fields as columns, got %q", got)
+	}
+	if len(sheet.Columns[4].Options) != 2 || sheet.Columns[5].Type != xlsx.CellDate || sheet.HeaderRows != 1 {
+		t.Fatalf("unexpected column layout %+v", sheet.Columns)
+	}
+}
+
+func TestStreamWorkbookMatchesLinkMatrix(t *testing.T) {
+	store := models.NewLedgerStore()
+	var ips []string
+	for _, name := range []string{"10.0.0.1", "10.0.0.2"} {
+		ip, err := store.CreateEntry(models.LedgerTypeIP, models.LedgerEntry{Name: name}, "tester")
+		if err != nil {
+			t.Fatalf("create ip: %v", err)
+		}
+		ips = append(ips, ip.ID)
+	}
+	person, err := store.CreateEntry(models.LedgerTypePersonnel, models.LedgerEntry{Name: "Alice"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP", Links: map[models.LedgerType][]string{
+		models.LedgerTypeIP:        ips,
+		models.LedgerTypePersonnel: {person.ID},
+	}}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	server := &Server{Store: store}
+	header, rows := server.buildLinkMatrix(nil)
+	if len(rows) != 2 {
+		t.Fatalf("expected one row per linked IP, got %q", rows)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := server.streamWorkbook(buf, "", nil); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	workbook, err := xlsx.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	matrix, ok := workbook.SheetByName(models.MatrixSheetName)
+	if !ok || len(matrix.Rows) != len(rows)+1 || matrix.Rows[0][0] != header[0] {
+		t.Fatalf("unexpected matrix sheet %+v", matrix)
+	}
+	for i, row := range rows {
+		// Trailing empty cells are not written, so compare the joined values.
+		got, want := strings.TrimRight(strings.Join(matrix.Rows[i+1], "|"), "|"), strings.TrimRight(strings.Join(row, "|"), "|")
+		if got != want {
+			t.Fatalf("row %d differs: %q vs %q", i, got, want)
+		}
+	}
+	if systems, ok := workbook.SheetByName("System"); !ok || len(systems.Rows) != 2 || systems.Rows[1][1] != "ERP" {
+		t.Fatalf("unexpected system sheet %+v", systems)
+	}
+}
+
+func TestReportSchedulerWritesAndPrunes(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP"}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	report, err := store.CreateReport(models.ReportDefinition{
+		Name:     "Systems",
+		Ledger:   models.LedgerTypeSystem,
+		Columns:  []models.ReportColumn{{Property: "name"}},
+		Schedule: &models.ReportSchedule{Every: models.ReportDaily, Hour: 6, Keep: 2},
+	}, "admin")
+	if err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+	scheduler := NewReportScheduler(store, t.TempDir())
+	next := report.Schedule.Next(report.UpdatedAt)
+	for day := 0; day < 3; day++ {
+		scheduler.RunDue(next.AddDate(0, 0, day))
+	}
+	files, err := os.ReadDir(scheduler.Dir)
+	if err != nil {
+		t.Fatalf("read reports dir: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected two retained files, got %d", len(files))
+	}
+	saved, _ := store.GetReport(report.ID)
+	if filepath.Base(saved.LastRunFile) != saved.LastRunFile {
+		t.Fatalf("expected only the file name to be recorded, got %q", saved.LastRunFile)
+	}
+	data, err := os.ReadFile(filepath.Join(scheduler.Dir, saved.LastRunFile))
+	if err != nil || saved.LastError != "" {
+		t.Fatalf("expected the last run to be recorded, got %+v (%v)", saved, err)
+	}
+	workbook, err := xlsx.Decode(data)
+	if err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if sheet := workbook.Sheets[0]; sheet.Name != "Systems" || len(sheet.Rows) != 2 || sheet.Rows[1][0] != "ERP" {
+		t.Fatalf("unexpected report sheet %+v", sheet)
+	}
+}
+
+func TestScheduledReportsUseTheCreatorsVisibility(t *testing.T) {
+	store := models.NewLedgerStore()
+	for _, name := range []string{"ERP", "CRM"} {
+		if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: name}, "admin"); err != nil {
+			t.Fatalf("create system: %v", err)
+		}
+	}
+	user, err := store.CreateUser("analyst", "Passw0rd!23", models.AccessEditor, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(user.ID, []string{"analysts"}, nil, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(models.VisibilityRule{Ledger: models.LedgerTypeSystem, Kind: models.VisibilityRow, Subjects: []string{"analysts"}, Filters: []models.FilterClause{{Property: "name", Op: models.FilterOpEq, Value: "CRM"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+	report, err := store.CreateReport(models.ReportDefinition{
+		Name:     "Systems",
+		Ledger:   models.LedgerTypeSystem,
+		Columns:  []models.ReportColumn{{Property: "name"}},
+		Schedule: &models.ReportSchedule{Every: models.ReportDaily, Hour: 6, Keep: 1},
+	}, "analyst")
+	if err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+	scheduler := NewReportScheduler(store, t.TempDir())
+	scheduler.RunDue(report.Schedule.Next(report.UpdatedAt))
+	saved, _ := store.GetReport(report.ID)
+	data, err := os.ReadFile(filepath.Join(scheduler.Dir, saved.LastRunFile))
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	workbook, err := xlsx.Decode(data)
+	if err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if rows := workbook.Sheets[0].Rows; len(rows) != 2 || rows[1][0] != "CRM" {
+		t.Fatalf("expected only the rows the creator sees, got %q", rows)
+	}
+}
+
+func TestRoleMiddlewareEnforcesScopedGrants(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateUser("viewer", "Passw0rd!23", models.AccessViewer, "admin"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	sessions := auth.NewManager(time.Hour)
+	session, err := sessions.Issue("viewer", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions}).RegisterRoutes(router)
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, "/api/v1/ledgers/systems", ""); code != http.StatusOK {
+		t.Fatalf("expected viewers to read ledgers, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/ledgers/systems", `{"name":"ERP"}`); code != http.StatusForbidden {
+		t.Fatalf("expected viewers to be refused edits, got %d", code)
+	}
+	audits := store.ListAudits()
+	if last := audits[len(audits)-1]; last.Action != "access_denied" || last.Actor != "viewer" {
+		t.Fatalf("expected the denial to be audited, got %+v", last)
+	}
+	if _, err := store.CreateGrant(models.PermissionGrant{Username: "viewer", Role: models.AccessEditor, Scope: models.ScopeLedger, Target: "systems"}, "admin"); err != nil {
+		t.Fatalf("create grant: %v", err)
+	}
+	if code := do(http.MethodPost, "/api/v1/ledgers/systems", `{"name":"ERP"}`); code != http.StatusOK {
+		t.Fatalf("expected the grant to allow edits, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/ledgers/ips", `{"name":"10.0.0.1"}`); code != http.StatusForbidden {
+		t.Fatalf("expected the grant to stay within its ledger, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/v1/admin/import", ""); code != http.StatusForbidden {
+		t.Fatalf("expected admin routes to be refused, got %d", code)
+	}
+}
+
+func TestVisibilityRulesApplyAcrossReadsAndExports(t *testing.T) {
+	store := models.NewLedgerStore()
+	manager, err := store.CreateUser("manager", "Passw0rd!23", models.AccessEditor, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(manager.ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	alice, err := store.CreateEntry(models.LedgerTypePersonnel, models.LedgerEntry{Name: "Alice", Attributes: map[string]string{"department": "Ops", "id_number": "110101199001011234"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	bob, err := store.CreateEntry(models.LedgerTypePersonnel, models.LedgerEntry{Name: "Bob", Attributes: map[string]string{"department": "Sales"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if _, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP", Links: map[models.LedgerType][]string{models.LedgerTypePersonnel: {alice.ID, bob.ID}}}, "admin"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(models.VisibilityRule{Ledger: models.LedgerTypePersonnel, Kind: models.VisibilityField, Field: "id_number", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(models.VisibilityRule{Ledger: models.LedgerTypePersonnel, Kind: models.VisibilityRow, Subjects: []string{"managers"}, Filters: []models.FilterClause{{Property: "attributes.department", Op: models.FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+
+	sessions := auth.NewManager(time.Hour)
+	session, err := sessions.Issue("manager", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	server := &Server{Store: store, Sessions: sessions}
+	router := gin.New()
+	server.RegisterRoutes(router)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/v1/ledgers/personnel", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Bob") || strings.Contains(rec.Body.String(), "1101011990") {
+		t.Fatalf("expected only Ops rows without id_number, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/ledgers/personnel/"+bob.ID, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected hidden rows to be missing, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/v1/ledgers/personnel/"+alice.ID, `{"name":"Alice","attributes":{"department":"Ops"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("update entry: %d %s", rec.Code, rec.Body.String())
+	}
+	if stored, _ := store.GetEntry(models.LedgerTypePersonnel, alice.ID); stored.Attributes["id_number"] != "110101199001011234" {
+		t.Fatalf("expected the masked attribute to survive the update, got %+v", stored.Attributes)
+	}
+	if rec := do(http.MethodPost, "/api/v1/ledgers/personnel/reorder", `{"ids":[]}`); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Bob") || strings.Contains(rec.Body.String(), "1101011990") {
+		t.Fatalf("expected the reorder response to apply the rules, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/search?q=Bob", ""); strings.Contains(rec.Body.String(), bob.ID) {
+		t.Fatalf("expected hidden rows to be left out of search, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/ledgers/export?type=personnel&format=jsonl", ""); strings.Contains(rec.Body.String(), "Bob") || strings.Contains(rec.Body.String(), "id_number") {
+		t.Fatalf("expected the export to apply the rules, got %s", rec.Body.String())
+	}
+	for _, row := range server.buildCartesianRows(store.VisibilityFor("manager")) {
+		if row[1] == "Bob" {
+			t.Fatalf("expected hidden personnel to be left out of the matrix, got %v", row)
+		}
+	}
+}
+
+func TestIPAllowlistGuardsLoginAndAPIBehindTrustedProxies(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateUser("ops", "Passw0rd!23", models.AccessSystemAdmin, "system"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.AppendAllowlist(&models.IPAllowlistEntry{Label: "office", CIDR: "198.51.100.0/24"}, "system", ""); err != nil {
+		t.Fatalf("append allowlist: %v", err)
+	}
+	proxies, err := middleware.ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("parse proxies: %v", err)
+	}
+	sessions := auth.NewManager(time.Hour)
+	session, err := sessions.Issue("ops", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions, TrustedProxies: proxies}).RegisterRoutes(router)
+	do := func(method, path, remote, forwarded, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, "/api/v1/ledgers/systems", "198.51.100.7:4000", "", ""); code != http.StatusOK {
+		t.Fatalf("expected the office to be admitted, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/v1/ledgers/systems", "203.0.113.5:4000", "198.51.100.7", ""); code != http.StatusForbidden {
+		t.Fatalf("expected forwarded headers from untrusted peers to be ignored, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/v1/ledgers/systems", "10.0.0.1:4000", "198.51.100.7, 203.0.113.5", ""); code != http.StatusForbidden {
+		t.Fatalf("expected the hop nearest the proxy to be the client, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/v1/ledgers/systems", "10.0.0.1:4000", "203.0.113.5, 198.51.100.7", ""); code != http.StatusOK {
+		t.Fatalf("expected the proxied office client to be admitted, got %d", code)
+	}
+	if code := do(http.MethodPost, "/auth/password-login", "203.0.113.5:4000", "", `{"username":"ops","password":"Passw0rd!23"}`); code != http.StatusForbidden {
+		t.Fatalf("expected login from outside the allowlist to be refused, got %d", code)
+	}
+
+	if _, err := store.AppendAllowlist(&models.IPAllowlistEntry{Label: "vpn", CIDR: "198.51.100.64/26", Scope: models.AllowlistScopeAdmin}, "system", ""); err != nil {
+		t.Fatalf("append admin entry: %v", err)
+	}
+	if code := do(http.MethodGet, "/api/v1/users", "198.51.100.7:4000", "", ""); code != http.StatusForbidden {
+		t.Fatalf("expected administration outside the admin network to be refused, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/v1/users", "198.51.100.70:4000", "", ""); code != http.StatusOK {
+		t.Fatalf("expected administration from the admin network, got %d", code)
+	}
+	vpn := store.ListAllowlist()[1]
+	if code := do(http.MethodDelete, "/api/v1/ip-allowlist/"+vpn.ID, "198.51.100.70:4000", "", ""); code != http.StatusNoContent {
+		t.Fatalf("expected removing the admin entry to keep the caller admitted, got %d", code)
+	}
+	office := store.ListAllowlist()[0]
+	if code := do(http.MethodPut, "/api/v1/ip-allowlist/"+office.ID, "198.51.100.70:4000", "", `{"label":"office","cidr":"192.0.2.0/24"}`); code != http.StatusConflict {
+		t.Fatalf("expected the lockout guard to refuse moving the caller's network, got %d", code)
+	}
+}
+
+func TestSessionsRefreshListAndForceLogout(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateUser("ops", "Passw0rd!23", models.AccessSystemAdmin, "system"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	viewer, err := store.CreateUser("viewer", "Passw0rd!23", models.AccessViewer, "system")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	sessions := auth.NewManager(time.Hour)
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions}).RegisterRoutes(router)
+	do := func(method, path, agent, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", agent)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(username, agent string) (string, string) {
+		rec := do(http.MethodPost, "/auth/password-login", agent, "", `{"username":"`+username+`","password":"Passw0rd!23"}`)
+		var body struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refreshToken"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.RefreshToken == "" {
+			t.Fatalf("login %s: %d %s", username, rec.Code, rec.Body.String())
+		}
+		return body.Token, body.RefreshToken
+	}
+
+	laptop, refresh := login("ops", "laptop")
+	phone, _ := login("ops", "phone")
+	if rec := do(http.MethodGet, "/api/v1/overview", "desktop", laptop, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a token used from another client to be refused, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/auth/refresh", "laptop", "", `{"refreshToken":"`+refresh+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/overview", "laptop", laptop, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the refreshed access token to be retired, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/auth/refresh", "laptop", "", `{"refreshToken":"`+refresh+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a reused refresh token to be refused, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodGet, "/api/v1/sessions", "phone", phone, "")
+	var listed struct {
+		Items []sessionResponse `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed.Items) != 1 || !listed.Items[0].Current || listed.Items[0].UserAgent != "phone" {
+		t.Fatalf("expected reuse to end the laptop session, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/api/v1/sessions/missing", "phone", phone, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown sessions to be 404, got %d", rec.Code)
+	}
+
+	viewerToken, _ := login("viewer", "kiosk")
+	if rec := do(http.MethodDelete, "/api/v1/users/"+viewer.ID+"/sessions", "phone", phone, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"revoked":1`) {
+		t.Fatalf("force logout: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/overview", "kiosk", viewerToken, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the forced logout to end the session, got %d", rec.Code)
+	}
+}
+
+func TestChangePasswordSignsOutOtherDevices(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateUser("ops", "Passw0rd!23", models.AccessViewer, "system"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	sessions := auth.NewManager(time.Hour)
+	laptop, err := sessions.Issue("ops", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	phone, err := sessions.Issue("ops", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions}).RegisterRoutes(router)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	change := `{"oldPassword":"Passw0rd!23","newPassword":"N3wPassw0rd!45"}`
+	if rec := do(http.MethodPost, "/auth/change-password", "", change); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a missing session to be refused, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/auth/change-password", laptop.Token, change); rec.Code != http.StatusOK {
+		t.Fatalf("change password: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/v1/overview", phone.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the other device to be signed out, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/v1/overview", laptop.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the current session to stay, got %d", rec.Code)
+	}
+	if _, err := store.AuthenticateUser("ops", "N3wPassw0rd!45"); err != nil {
+		t.Fatalf("expected the new password to work: %v", err)
+	}
+}
+
+func TestPasswordLoginLockoutAndAdminUnlock(t *testing.T) {
+	store := models.NewLedgerStore()
+	if _, err := store.CreateUser("ops", "Passw0rd!23", models.AccessSystemAdmin, "system"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	viewer, err := store.CreateUser("viewer", "Passw0rd!23", models.AccessViewer, "system")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	store.SetLoginPolicy(models.LoginPolicy{MaxFailures: 1}, "system")
+	sessions := auth.NewManager(time.Hour)
+	admin, err := sessions.Issue("ops", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions}).RegisterRoutes(router)
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password-login", strings.NewReader(`{"username":"viewer","password":"`+password+`"}`))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := login("wrong-password"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected invalid credentials, got %d", rec.Code)
+	}
+	rec := login("Passw0rd!23")
+	if rec.Code != http.StatusLocked || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), "account_locked") {
+		t.Fatalf("expected the account to be locked, got %d %s", rec.Code, rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/"+viewer.ID+"/unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+admin.Token)
+	unlock := httptest.NewRecorder()
+	router.ServeHTTP(unlock, req)
+	if unlock.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", unlock.Code, unlock.Body.String())
+	}
+	if rec := login("Passw0rd!23"); rec.Code != http.StatusOK {
+		t.Fatalf("expected login after unlock, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestVisibilityRulesApplyToTrashGraphAndOverview(t *testing.T) {
+	store := models.NewLedgerStore()
+	manager, err := store.CreateUser("manager", "Passw0rd!23", models.AccessEditor, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(manager.ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	people := map[string]models.LedgerEntry{}
+	for _, person := range []struct{ name, department, idNumber string }{
+		{"Alice", "Ops", ""},
+		{"Bob", "Sales", ""},
+		{"Eve", "Sales", ""},
+		{"Carol", "Sales", "220202199202022345"},
+		{"Dave", "Ops", "330303199303033456"},
+	} {
+		entry, err := store.CreateEntry(models.LedgerTypePersonnel, models.LedgerEntry{Name: person.name, Attributes: map[string]string{"department": person.department, "id_number": person.idNumber}}, "admin")
+		if err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+		people[person.name] = entry
+	}
+	erp, err := store.CreateEntry(models.LedgerTypeSystem, models.LedgerEntry{Name: "ERP", Links: map[models.LedgerType][]string{models.LedgerTypePersonnel: {people["Alice"].ID, people["Bob"].ID}}}, "admin")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	for _, name := range []string{"Carol", "Dave"} {
+		if err := store.DeleteEntry(models.LedgerTypePersonnel, people[name].ID, "admin"); err != nil {
+			t.Fatalf("delete entry: %v", err)
+		}
+	}
+	var carolTrash string
+	for _, item := range store.ListTrash(models.TrashKindEntry, "") {
+		if item.RecordID == people["Carol"].ID {
+			carolTrash = item.ID
+		}
+	}
+	if _, err := store.CreateVisibilityRule(models.VisibilityRule{Ledger: models.LedgerTypePersonnel, Kind: models.VisibilityField, Field: "id_number", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(models.VisibilityRule{Ledger: models.LedgerTypePersonnel, Kind: models.VisibilityRow, Subjects: []string{"managers"}, Filters: []models.FilterClause{{Property: "attributes.department", Op: models.FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+
+	sessions := auth.NewManager(time.Hour)
+	session, err := sessions.Issue("manager", "")
+	if err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	router := gin.New()
+	(&Server{Store: store, Sessions: sessions}).RegisterRoutes(router)
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	if body := get("/api/v1/trash"); !strings.Contains(body, "Dave") || strings.Contains(body, "Carol") || strings.Contains(body, "3303031993") {
+		t.Fatalf("expected the trash to drop hidden rows and mask the rest, got %s", body)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/trash/"+carolTrash+"/restore", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected hidden trash items to be missing, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{
+		"/api/v1/overview",
+		"/api/v1/graph/system/" + erp.ID,
+		"/api/v1/graph/system/" + erp.ID + "/impact",
+		"/api/v1/graph/orphans",
+		"/api/v1/overview/stale",
+		"/api/v1/overview/quality",
+	} {
+		if body := get(path); strings.Contains(body, people["Bob"].ID) || strings.Contains(body, people["Eve"].ID) {
+			t.Fatalf("expected %s to leave out hidden rows, got %s", path, body)
+		}
+	}
+	var overview struct {
+		Stats models.OverviewStats `json:"stats"`
+	}
+	if err := json.Unmarshal([]byte(get("/api/v1/overview")), &overview); err != nil {
+		t.Fatalf("decode overview: %v", err)
+	}
+	for _, ledger := range overview.Stats.Ledgers {
+		if ledger.Type == models.LedgerTypePersonnel && ledger.Count != 1 {
+			t.Fatalf("expected hidden rows to be left out of the counts, got %+v", ledger)
+		}
+	}
+	if body := get("/api/v1/graph/system/" + erp.ID); !strings.Contains(body, people["Alice"].ID) {
+		t.Fatalf("expected visible rows to stay in the graph, got %s", body)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/auth"
+	"ledger/internal/middleware"
+	"ledger/internal/models"
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// registerSessionRoutes attaches the device list of the signed-in user and the forced logout
+// system administrators use to end every session of another user.
+func (s *Server) registerSessionRoutes(group *gin.RouterGroup) {
+	group.GET("/sessions", s.handleListSessions)
+	group.DELETE("/sessions/:id", s.handleRevokeSession)
+	group.DELETE("/users/:id/sessions", s.require(models.AccessSystemAdmin, nil), s.handleRevokeUserSessions)
+}
+
+// issueSession signs a user in on the device making the request.
+func (s *Server) issueSession(c *gin.Context, username string) (*auth.Session, error) {
+	return s.Sessions.IssueFor(username, auth.Device{
+		ClientID:  auth.ClientFingerprint(c.Request),
+		UserAgent: c.Request.UserAgent(),
+		IP:        s.TrustedProxies.ClientIP(c.Request),
+	})
+}
+
+func (s *Server) handleRefresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	session, err := s.Sessions.Refresh(req.RefreshToken, auth.ClientFingerprint(c.Request))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshInvalid) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "session_refresh_failed"})
+		return
+	}
+	// Deleted users keep no way back in.
+	if s.Store.UserRole(session.Username) == "" {
+		_ = s.Sessions.RevokeSession(session.Username, session.ID)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": auth.ErrRefreshInvalid.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessionTokens(session))
+}
+
+func (s *Server) handleListSessions(c *gin.Context) {
+	current := contextSession(c)
+	if current == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessions := s.Sessions.List(current.Username)
+	items := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			IssuedAt:   session.IssuedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current.ID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func (s *Server) handleRevokeSession(c *gin.Context) {
+	current := contextSession(c)
+	if current == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := s.Sessions.RevokeSession(current.Username, c.Param("id")); err != nil {
+		abortWithSessionError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleRevokeUserSessions(c *gin.Context) {
+	username := s.usernameByID(c.Param("id"))
+	if username == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": models.ErrUserNotFound.Error()})
+		return
+	}
+	count, err := s.Sessions.RevokeUser(username, "")
+	if err != nil {
+		abortWithSessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": count})
+}
+
+// sessionTokens is the body returned when a session is issued or refreshed. expiresAt is when
+// the access token must be refreshed; refreshExpiresAt is when the session ends for good.
+func sessionTokens(session *auth.Session) gin.H {
+	return gin.H{
+		"token":            session.Token,
+		"refreshToken":     session.RefreshToken,
+		"sessionId":        session.ID,
+		"username":         session.Username,
+		"issuedAt":         session.IssuedAt,
+		"expiresAt":        session.AccessExpiresAt,
+		"refreshExpiresAt": session.ExpiresAt,
+	}
+}
+
+func contextSession(c *gin.Context) *auth.Session {
+	if value, ok := c.Get(middleware.ContextSessionKey); ok {
+		if session, ok := value.(*auth.Session); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+func (s *Server) usernameByID(id string) string {
+	for _, user := range s.Store.ListUsers() {
+		if user.ID == id {
+			return user.Username
+		}
+	}
+	return ""
+}
+
+func abortWithSessionError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		status = http.StatusNotFound
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+// registerTrashRoutes attaches listing, restore and purge of deleted entries and workspaces.
+// The settings routes are registered first so "settings" is not taken for a trash item ID.
+func (s *Server) registerTrashRoutes(group *gin.RouterGroup) {
+	group.GET("/trash/settings", s.handleGetTrashSettings)
+	group.PUT("/trash/settings", s.require(models.AccessLedgerAdmin, nil), s.handleUpdateTrashSettings)
+	group.GET("/trash", s.handleListTrash)
+	group.POST("/trash/:id/restore", s.require(models.AccessEditor, nil), s.handleRestoreTrash)
+	group.DELETE("/trash/:id", s.require(models.AccessLedgerAdmin, nil), s.handlePurgeTrash)
+}
+
+type trashSettingsRequest struct {
+	RetentionDays *int `json:"retentionDays"`
+}
+
+func abortWithTrashError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrTrashItemNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTrashRestoreConflict):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		abortWithLedgerError(c, err)
+	}
+}
+
+// handleListTrash lists trashed items, newest first; ?kind=entry|workspace and ?type=<ledger>
+// narrow the list.
+func (s *Server) handleListTrash(c *gin.Context) {
+	kind := strings.ToLower(strings.TrimSpace(c.Query("kind")))
+	var typ models.LedgerType
+	if raw := strings.TrimSpace(c.Query("type")); raw != "" {
+		resolved, ok := s.Store.ResolveLedgerType(raw)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_ledger"})
+			return
+		}
+		typ = resolved
+	}
+	items := s.visibility(c).Trash(s.Store.ListTrash(kind, typ))
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "retentionDays": s.Store.TrashRetentionDays()})
+}
+
+// handleRestoreTrash brings a trashed item back. Entries the caller's visibility rules hide
+// are not found, and a restored entry is returned masked.
+func (s *Server) handleRestoreTrash(c *gin.Context) {
+	actor := currentSession(c, s.Sessions)
+	id := c.Param("id")
+	view := s.visibility(c)
+	if view != nil && !trashItemListed(view.Trash(s.Store.ListTrash("", "")), id) {
+		abortWithTrashError(c, models.ErrTrashItemNotFound)
+		return
+	}
+	item, err := s.Store.RestoreTrash(id, actor)
+	if err != nil {
+		abortWithTrashError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, view.Trash([]models.TrashItem{item})[0])
+}
+
+func trashItemListed(items []models.TrashItem, id string) bool {
+	for _, item := range items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handlePurgeTrash(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	if err := s.Store.PurgeTrash(c.Param("id"), session); err != nil {
+		abortWithTrashError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleGetTrashSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"retentionDays": s.Store.TrashRetentionDays()})
+}
+
+// handleUpdateTrashSettings changes how many days trashed items are kept before automatic
+// purge; 0 keeps them until purged by hand.
+func (s *Server) handleUpdateTrashSettings(c *gin.Context) {
+	session := currentSession(c, s.Sessions)
+	var req trashSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RetentionDays == nil || *req.RetentionDays < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	s.Store.SetTrashRetentionDays(*req.RetentionDays, session)
+	c.JSON(http.StatusOK, gin.H{"retentionDays": s.Store.TrashRetentionDays()})
+}
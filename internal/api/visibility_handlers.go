@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ledger/internal/models"
+)
+
+type visibilityRuleRequest struct {
+	Name     string                `json:"name"`
+	Ledger   string                `json:"ledger"`
+	Kind     string                `json:"kind"`
+	Field    string                `json:"field"`
+	Mask     string                `json:"mask"`
+	Subjects []string              `json:"subjects"`
+	Filters  []models.FilterClause `json:"filters"`
+}
+
+func (r visibilityRuleRequest) toModel() models.VisibilityRule {
+	return models.VisibilityRule{
+		Name:     r.Name,
+		Ledger:   models.LedgerType(r.Ledger),
+		Kind:     r.Kind,
+		Field:    r.Field,
+		Mask:     r.Mask,
+		Subjects: r.Subjects,
+		Filters:  r.Filters,
+	}
+}
+
+type userProfileRequest struct {
+	Groups     []string          `json:"groups"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// registerVisibilityRoutes attaches the field masking and row filtering rules for sensitive
+// ledger data. Every session may read the rules; system administrators manage them along with
+// the user groups and attributes they match.
+func (s *Server) registerVisibilityRoutes(group *gin.RouterGroup) {
+	admin := s.require(models.AccessSystemAdmin, nil)
+	group.GET("/visibility-rules", s.handleListVisibilityRules)
+	group.POST("/visibility-rules", admin, s.handleCreateVisibilityRule)
+	group.PUT("/visibility-rules/:id", admin, s.handleUpdateVisibilityRule)
+	group.DELETE("/visibility-rules/:id", admin, s.handleDeleteVisibilityRule)
+	group.PUT("/users/:id/profile", admin, s.handleSetUserProfile)
+}
+
+func (s *Server) handleListVisibilityRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": s.Store.ListVisibilityRules()})
+}
+
+func (s *Server) handleCreateVisibilityRule(c *gin.Context) {
+	var req visibilityRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	rule, err := s.Store.CreateVisibilityRule(req.toModel(), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithVisibilityError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *Server) handleUpdateVisibilityRule(c *gin.Context) {
+	var req visibilityRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	rule, err := s.Store.UpdateVisibilityRule(c.Param("id"), req.toModel(), currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithVisibilityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *Server) handleDeleteVisibilityRule(c *gin.Context) {
+	if err := s.Store.DeleteVisibilityRule(c.Param("id"), currentSession(c, s.Sessions)); err != nil {
+		abortWithVisibilityError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleSetUserProfile(c *gin.Context) {
+	var req userProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_payload"})
+		return
+	}
+	user, err := s.Store.SetUserProfile(c.Param("id"), req.Groups, req.Attributes, currentSession(c, s.Sessions))
+	if err != nil {
+		abortWithVisibilityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": userToResponse(user)})
+}
+
+func abortWithVisibilityError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, models.ErrVisibilityRuleNotFound) || errors.Is(err, models.ErrUserNotFound) {
+		status = http.StatusNotFound
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
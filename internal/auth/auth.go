@@ -2,75 +2,382 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Session represents an issued login token.
+var (
+	// ErrSessionNotFound indicates the session does not exist or has ended.
+	ErrSessionNotFound = errors.New("session_not_found")
+	// ErrRefreshInvalid indicates an unknown, expired or already used refresh token.
+	ErrRefreshInvalid = errors.New("refresh_invalid")
+)
+
+// Default session lifetimes.
+const (
+	DefaultAccessTTL   = 15 * time.Minute
+	DefaultIdleTimeout = 2 * time.Hour
+	DefaultAbsoluteTTL = 12 * time.Hour
+)
+
+// Session represents one signed-in device. Token and RefreshToken are only filled in when the
+// session is issued or refreshed; the manager keeps their hashes, never the tokens themselves.
 type Session struct {
-	Token     string    `json:"token"`
-	Username  string    `json:"username"`
-	ClientID  string    `json:"client_id"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID              string    `json:"id"`
+	Token           string    `json:"token,omitempty"`
+	RefreshToken    string    `json:"refresh_token,omitempty"`
+	Username        string    `json:"username"`
+	ClientID        string    `json:"client_id"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	IP              string    `json:"ip,omitempty"`
+	IssuedAt        time.Time `json:"issued_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	AccessHash      string    `json:"access_hash,omitempty"`
+	RefreshHash     string    `json:"refresh_hash,omitempty"`
+	PrevRefreshHash string    `json:"prev_refresh_hash,omitempty"`
 }
 
-// Manager tracks active sessions in-memory.
+// Device describes the client that signs in: ClientID is its fingerprint (see
+// ClientFingerprint) and binds the session to it; an empty ClientID leaves it unbound.
+type Device struct {
+	ClientID  string
+	UserAgent string
+	IP        string
+}
+
+// Config sets the lifetimes of the sessions a Manager issues. Access tokens expire after
+// AccessTTL and are renewed with the refresh token; a session ends after IdleTimeout without
+// use or AbsoluteTTL after sign-in, whichever comes first. Persister, when set, keeps sessions
+// across restarts.
+type Config struct {
+	AccessTTL   time.Duration
+	IdleTimeout time.Duration
+	AbsoluteTTL time.Duration
+	Persister   Persister
+}
+
+// Manager tracks active sessions, indexed by the hashes of their tokens.
 type Manager struct {
-	mu      sync.RWMutex
-	ttl     time.Duration
-	entries map[string]*Session
+	mu        sync.RWMutex
+	cfg       Config
+	sessions  map[string]*Session
+	byAccess  map[string]string
+	byRefresh map[string]string
+	dirty     bool
+
+	saveMu sync.Mutex
 }
 
-// NewManager constructs a session manager with the provided TTL.
+// NewManager constructs a session manager whose sessions last at most ttl, with the default
+// access token lifetime and idle timeout.
 func NewManager(ttl time.Duration) *Manager {
-	if ttl <= 0 {
-		ttl = 12 * time.Hour
+	return NewManagerWithConfig(Config{AbsoluteTTL: ttl})
+}
+
+// NewManagerWithConfig constructs a session manager, filling unset lifetimes with defaults.
+// Access tokens and the idle timeout never outlast the absolute TTL.
+func NewManagerWithConfig(cfg Config) *Manager {
+	if cfg.AbsoluteTTL <= 0 {
+		cfg.AbsoluteTTL = DefaultAbsoluteTTL
+	}
+	if cfg.IdleTimeout <= 0 || cfg.IdleTimeout > cfg.AbsoluteTTL {
+		cfg.IdleTimeout = minDuration(DefaultIdleTimeout, cfg.AbsoluteTTL)
+	}
+	if cfg.AccessTTL <= 0 || cfg.AccessTTL > cfg.IdleTimeout {
+		cfg.AccessTTL = minDuration(DefaultAccessTTL, cfg.IdleTimeout)
+	}
+	return &Manager{
+		cfg:       cfg,
+		sessions:  make(map[string]*Session),
+		byAccess:  make(map[string]string),
+		byRefresh: make(map[string]string),
 	}
-	return &Manager{ttl: ttl, entries: make(map[string]*Session)}
 }
 
-// Issue creates a new session for a username and client fingerprint.
+// Issue signs a user in on a device. Sessions are persisted before Issue returns.
 func (m *Manager) Issue(username, clientID string) (*Session, error) {
-	token, err := randomToken()
+	return m.IssueFor(username, Device{ClientID: clientID})
+}
+
+// IssueFor is Issue with the full device description.
+func (m *Manager) IssueFor(username string, device Device) (*Session, error) {
+	id, err := randomToken()
 	if err != nil {
 		return nil, err
 	}
 	now := time.Now().UTC()
 	session := &Session{
-		Token:     token,
-		Username:  username,
-		ClientID:  clientID,
-		IssuedAt:  now,
-		ExpiresAt: now.Add(m.ttl),
+		ID:         id[:16],
+		Username:   username,
+		ClientID:   device.ClientID,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		IssuedAt:   now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(m.cfg.AbsoluteTTL),
 	}
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.entries[token] = session
-	return session, nil
+	issued, err := m.rotateLocked(session, now)
+	if err == nil {
+		m.sessions[session.ID] = session
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return issued, m.persist()
 }
 
-// Validate looks up a token and returns the session if still valid.
-func (m *Manager) Validate(token string) (*Session, bool) {
-	m.mu.RLock()
-	session, ok := m.entries[token]
-	m.mu.RUnlock()
-	if !ok {
+// rotateLocked gives the session new access and refresh tokens, returning a copy that carries
+// them in clear.
+func (m *Manager) rotateLocked(session *Session, now time.Time) (*Session, error) {
+	access, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	delete(m.byAccess, session.AccessHash)
+	// Only the refresh token just exchanged is remembered for reuse detection.
+	delete(m.byRefresh, session.PrevRefreshHash)
+	session.PrevRefreshHash = session.RefreshHash
+	session.AccessHash = hashToken(access)
+	session.RefreshHash = hashToken(refresh)
+	session.AccessExpiresAt = minTime(now.Add(m.cfg.AccessTTL), session.ExpiresAt)
+	m.byAccess[session.AccessHash] = session.ID
+	m.byRefresh[session.RefreshHash] = session.ID
+	if session.PrevRefreshHash != "" {
+		m.byRefresh[session.PrevRefreshHash] = session.ID
+	}
+	issued := *session
+	issued.Token = access
+	issued.RefreshToken = refresh
+	return &issued, nil
+}
+
+// Validate looks up an access token and returns its session if the token is current, the
+// session has not ended and, for bound sessions, clientID matches the device signed in with.
+// A valid token counts as activity for the idle timeout.
+func (m *Manager) Validate(token, clientID string) (*Session, bool) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[m.byAccess[hashToken(token)]]
+	if !ok || now.After(session.AccessExpiresAt) || !m.activeLocked(session, now) {
 		return nil, false
 	}
-	if time.Now().After(session.ExpiresAt) {
-		m.Revoke(token)
+	if session.ClientID != "" && session.ClientID != clientID {
 		return nil, false
 	}
-	return session, true
+	session.LastSeenAt = now
+	m.dirty = true
+	return session.public(), true
+}
+
+// Refresh exchanges a refresh token for new access and refresh tokens. Each refresh token
+// works once: presenting one that was already exchanged suggests it was stolen and ends the
+// session, as does presenting it from a different device.
+func (m *Manager) Refresh(refreshToken, clientID string) (*Session, error) {
+	now := time.Now().UTC()
+	hash := hashToken(refreshToken)
+	m.mu.Lock()
+	session, ok := m.sessions[m.byRefresh[hash]]
+	if !ok || !m.activeLocked(session, now) {
+		m.mu.Unlock()
+		return nil, ErrRefreshInvalid
+	}
+	if hash != session.RefreshHash || (session.ClientID != "" && session.ClientID != clientID) {
+		m.removeLocked(session.ID)
+		m.mu.Unlock()
+		_ = m.persist()
+		return nil, ErrRefreshInvalid
+	}
+	session.LastSeenAt = now
+	refreshed, err := m.rotateLocked(session, now)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, m.persist()
+}
+
+func (m *Manager) activeLocked(session *Session, now time.Time) bool {
+	return now.Before(session.ExpiresAt) && now.Sub(session.LastSeenAt) < m.cfg.IdleTimeout
 }
 
-// Revoke removes a token from the manager.
+// Revoke ends the session an access token belongs to.
 func (m *Manager) Revoke(token string) {
+	m.mu.Lock()
+	id, ok := m.byAccess[hashToken(token)]
+	if ok {
+		m.removeLocked(id)
+	}
+	m.mu.Unlock()
+	if ok {
+		_ = m.persist()
+	}
+}
+
+// RevokeSession ends one of a user's sessions by ID.
+func (m *Manager) RevokeSession(username, id string) error {
+	m.mu.Lock()
+	session, ok := m.sessions[id]
+	if !ok || !strings.EqualFold(session.Username, username) {
+		m.mu.Unlock()
+		return ErrSessionNotFound
+	}
+	m.removeLocked(id)
+	m.mu.Unlock()
+	return m.persist()
+}
+
+// RevokeUser ends every session of a user except the one with ID keep, returning how many
+// were ended.
+func (m *Manager) RevokeUser(username, keep string) (int, error) {
+	m.mu.Lock()
+	count := 0
+	for id, session := range m.sessions {
+		if id != keep && strings.EqualFold(session.Username, username) {
+			m.removeLocked(id)
+			count++
+		}
+	}
+	m.mu.Unlock()
+	if count == 0 {
+		return 0, nil
+	}
+	return count, m.persist()
+}
+
+// List returns a user's active sessions, most recently used first.
+func (m *Manager) List(username string) []*Session {
+	now := time.Now().UTC()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*Session, 0)
+	for _, session := range m.sessions {
+		if strings.EqualFold(session.Username, username) && m.activeLocked(session, now) {
+			out = append(out, session.public())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt.After(out[j].LastSeenAt) })
+	return out
+}
+
+// Purge drops the sessions that ended before now and persists the result, including any
+// activity recorded since the last save.
+func (m *Manager) Purge(now time.Time) (int, error) {
+	m.mu.Lock()
+	count := 0
+	for id, session := range m.sessions {
+		if !m.activeLocked(session, now) {
+			m.removeLocked(id)
+			count++
+		}
+	}
+	dirty := m.dirty || count > 0
+	m.mu.Unlock()
+	if !dirty {
+		return count, nil
+	}
+	return count, m.persist()
+}
+
+// Load restores persisted sessions, skipping those that have ended.
+func (m *Manager) Load() error {
+	if m.cfg.Persister == nil {
+		return nil
+	}
+	sessions, err := m.cfg.Persister.LoadSessions()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.entries, token)
+	for i := range sessions {
+		session := sessions[i]
+		if session.ID == "" || !m.activeLocked(&session, now) {
+			continue
+		}
+		session.Token, session.RefreshToken = "", ""
+		m.sessions[session.ID] = &session
+		m.byAccess[session.AccessHash] = session.ID
+		m.byRefresh[session.RefreshHash] = session.ID
+		if session.PrevRefreshHash != "" {
+			m.byRefresh[session.PrevRefreshHash] = session.ID
+		}
+	}
+	return nil
+}
+
+// persist saves every session through the persister. Saves are serialised so the last one
+// written always reflects the latest state; a failed save is retried by the next Purge.
+func (m *Manager) persist() error {
+	if m.cfg.Persister == nil {
+		return nil
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	m.mu.Lock()
+	sessions := make([]Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, *session)
+	}
+	m.dirty = false
+	m.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].IssuedAt.Before(sessions[j].IssuedAt) })
+	if err := m.cfg.Persister.SaveSessions(sessions); err != nil {
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) removeLocked(id string) {
+	session, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.byAccess, session.AccessHash)
+	delete(m.byRefresh, session.RefreshHash)
+	delete(m.byRefresh, session.PrevRefreshHash)
+	delete(m.sessions, id)
+}
+
+// public copies the session without its token hashes.
+func (s *Session) public() *Session {
+	copy := *s
+	copy.AccessHash, copy.RefreshHash, copy.PrevRefreshHash = "", "", ""
+	return &copy
+}
+
+// ClientFingerprint identifies the client software behind a request by its User-Agent, so a
+// token copied to another browser or tool stops working.
+func ClientFingerprint(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(r.UserAgent()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func randomToken() (string, error) {
@@ -80,3 +387,17 @@ func randomToken() (string, error) {
 	}
 	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRefreshRotatesTokensAndDetectsReuse(t *testing.T) {
+	manager := NewManagerWithConfig(Config{AccessTTL: time.Minute, IdleTimeout: time.Hour, AbsoluteTTL: 2 * time.Hour})
+	issued, err := manager.IssueFor("ops", Device{ClientID: "laptop", UserAgent: "Firefox"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if session, ok := manager.Validate(issued.Token, "laptop"); !ok || session.AccessHash != "" || session.Token != "" {
+		t.Fatalf("expected a valid session without secrets, got %+v", session)
+	}
+	if _, ok := manager.Validate(issued.Token, "phone"); ok {
+		t.Fatalf("expected the session to be bound to its client")
+	}
+	if !issued.AccessExpiresAt.Before(issued.ExpiresAt) {
+		t.Fatalf("expected access tokens to expire before the session")
+	}
+
+	refreshed, err := manager.Refresh(issued.RefreshToken, "laptop")
+	if err != nil || refreshed.ID != issued.ID || refreshed.Token == issued.Token {
+		t.Fatalf("expected new tokens for the same session, got %+v (%v)", refreshed, err)
+	}
+	if _, ok := manager.Validate(issued.Token, "laptop"); ok {
+		t.Fatalf("expected the old access token to be retired")
+	}
+	if _, err := manager.Refresh(issued.RefreshToken, "laptop"); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("expected reuse to be refused, got %v", err)
+	}
+	if _, ok := manager.Validate(refreshed.Token, "laptop"); ok {
+		t.Fatalf("expected reuse to end the session")
+	}
+}
+
+func TestIdleTimeoutAndRevocation(t *testing.T) {
+	manager := NewManagerWithConfig(Config{IdleTimeout: 30 * time.Minute, AbsoluteTTL: 8 * time.Hour})
+	first, _ := manager.Issue("ops", "")
+	second, _ := manager.Issue("ops", "")
+	if _, err := manager.Issue("viewer", ""); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if sessions := manager.List("OPS"); len(sessions) != 2 {
+		t.Fatalf("expected two devices, got %d", len(sessions))
+	}
+	if err := manager.RevokeSession("viewer", first.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected other users' sessions to be out of reach, got %v", err)
+	}
+	if count, err := manager.RevokeUser("ops", second.ID); err != nil || count != 1 {
+		t.Fatalf("expected one session revoked, got %d (%v)", count, err)
+	}
+	if _, ok := manager.Validate(second.Token, ""); !ok {
+		t.Fatalf("expected the kept session to stay valid")
+	}
+
+	if purged, _ := manager.Purge(time.Now().Add(time.Hour)); purged != 2 {
+		t.Fatalf("expected idle sessions to be purged, got %d", purged)
+	}
+	if _, ok := manager.Validate(second.Token, ""); ok {
+		t.Fatalf("expected the idle session to be gone")
+	}
+}
+
+func TestFilePersisterKeepsSessionsAcrossRestarts(t *testing.T) {
+	persister := FilePersister{Path: filepath.Join(t.TempDir(), "sessions.json")}
+	manager := NewManagerWithConfig(Config{Persister: persister})
+	if err := manager.Load(); err != nil {
+		t.Fatalf("load empty: %v", err)
+	}
+	issued, err := manager.Issue("ops", "laptop")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	revoked, _ := manager.Issue("ops", "phone")
+	manager.Revoke(revoked.Token)
+
+	stored, err := persister.LoadSessions()
+	if err != nil || len(stored) != 1 || stored[0].Token != "" || stored[0].RefreshToken != "" {
+		t.Fatalf("expected one session stored without clear tokens, got %+v (%v)", stored, err)
+	}
+	restarted := NewManagerWithConfig(Config{Persister: persister})
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := restarted.Validate(issued.Token, "laptop"); !ok {
+		t.Fatalf("expected the session to survive a restart")
+	}
+	if _, err := restarted.Refresh(issued.RefreshToken, "laptop"); err != nil {
+		t.Fatalf("expected the refresh token to survive a restart, got %v", err)
+	}
+}
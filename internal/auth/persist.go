@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Persister stores sessions between restarts. Sessions carry only the hashes of their tokens.
+type Persister interface {
+	LoadSessions() ([]Session, error)
+	SaveSessions(sessions []Session) error
+}
+
+// FilePersister keeps sessions in a JSON file, written atomically beside the snapshot.
+type FilePersister struct {
+	Path string
+}
+
+// LoadSessions reads the file, treating a missing one as no sessions.
+func (p FilePersister) LoadSessions() ([]Session, error) {
+	data, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// SaveSessions replaces the file with sessions.
+func (p FilePersister) SaveSessions(sessions []Session) error {
+	if err := os.MkdirAll(filepath.Dir(p.Path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	tmp := p.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.Path)
+}
+
+// SQLPersister keeps sessions in the sessions table of a Postgres database.
+type SQLPersister struct {
+	DB *sql.DB
+}
+
+// LoadSessions reads every stored session.
+func (p SQLPersister) LoadSessions() ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := p.DB.QueryContext(ctx, `SELECT payload FROM sessions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []Session
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var session Session
+		if err := json.Unmarshal(payload, &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// SaveSessions replaces the stored sessions in one transaction.
+func (p SQLPersister) SaveSessions(sessions []Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.ensureTable(ctx); err != nil {
+		return err
+	}
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions`); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, session := range sessions {
+		payload, err := json.Marshal(session)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO sessions (id, username, payload) VALUES ($1, $2, $3)`, session.ID, session.Username, payload); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p SQLPersister) ensureTable(ctx context.Context) error {
+	if p.DB == nil {
+		return errors.New("database_not_configured")
+	}
+	_, err := p.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			payload JSONB NOT NULL
+		)
+	`)
+	return err
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -16,38 +17,104 @@ const (
 	ContextSessionKey = "ledger/session"
 )
 
-// IPAllowlist enforces allowlist membership using the provided store.
-func IPAllowlist(store *models.LedgerStore) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if store == nil {
-			c.Next()
-			return
+// TrustedProxies lists the networks of the reverse proxies whose X-Forwarded-For headers are
+// believed. Without trusted proxies the client IP is always the connection's peer address.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses CIDRs and single addresses, ignoring blank values.
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
 		}
-		ip := clientIP(c.Request)
-		if ip == "" || !store.IsIPAllowed(ip) {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "ip_not_allowed"})
-			return
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
 		}
-		c.Next()
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		proxies = append(proxies, network)
 	}
+	return proxies, nil
 }
 
-func clientIP(r *http.Request) string {
+// Contains reports whether ip belongs to a trusted proxy.
+func (p TrustedProxies) Contains(ip net.IP) bool {
+	for _, network := range p {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the address of the client behind r. X-Forwarded-For is only consulted
+// when the peer is a trusted proxy, and is then read from the right, skipping trusted hops,
+// so that addresses a client prepends itself are never taken for its own.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
-	if v := r.Header.Get("X-Forwarded-For"); v != "" {
-		parts := strings.Split(v, ",")
-		candidate := strings.TrimSpace(parts[0])
-		if ip := net.ParseIP(candidate); ip != nil {
-			return ip.String()
-		}
-	}
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return r.RemoteAddr
+		host = strings.TrimSpace(r.RemoteAddr)
+	}
+	peer := net.ParseIP(host)
+	if peer == nil {
+		return ""
+	}
+	if !p.Contains(peer) {
+		return peer.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// A malformed hop cannot be vouched for; stop at the last address that can.
+			break
+		}
+		peer = hop
+		if !p.Contains(hop) {
+			break
+		}
+	}
+	return peer.String()
+}
+
+// IPAllowlist admits requests from addresses the allowlist lets reach endpoints of scope; see
+// models.LedgerStore.IsIPAllowed.
+func IPAllowlist(store *models.LedgerStore, proxies TrustedProxies, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CheckIPAllowlist(c, store, proxies, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckIPAllowlist is IPAllowlist for composing into other handlers: it reports whether the
+// request may continue, having answered 403 when it may not.
+func CheckIPAllowlist(c *gin.Context, store *models.LedgerStore, proxies TrustedProxies, scope string) bool {
+	if store == nil {
+		return true
 	}
-	return host
+	if !store.IsIPAllowed(proxies.ClientIP(c.Request), scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "ip_not_allowed"})
+		return false
+	}
+	return true
 }
 
 // RequireSession validates that a session token is present and valid.
@@ -69,7 +136,7 @@ func RequireSession(manager *auth.Manager) gin.HandlerFunc {
 			token = cookie.Value
 		}
 		
-		session, ok := manager.Validate(token)
+		session, ok := manager.Validate(token, auth.ClientFingerprint(c.Request))
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_session"})
 			return
@@ -103,4 +170,61 @@ func CORS() gin.HandlerFunc {
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// ScopeFunc resolves the resource a request touches for RequireRole. A nil ScopeFunc checks
+// the global role only.
+type ScopeFunc func(c *gin.Context) models.AccessScope
+
+// LedgerScope scopes a request to the ledger type named by a path parameter.
+func LedgerScope(param string) ScopeFunc {
+	return func(c *gin.Context) models.AccessScope {
+		return models.AccessScope{Kind: models.ScopeLedger, Target: c.Param(param)}
+	}
+}
+
+// WorkspaceScope scopes a request to the workspace named by a path parameter.
+func WorkspaceScope(param string) ScopeFunc {
+	return func(c *gin.Context) models.AccessScope {
+		return models.AccessScope{Kind: models.ScopeWorkspace, Target: c.Param(param)}
+	}
+}
+
+// TableScope scopes a request to the Roledger table named by a path parameter.
+func TableScope(param string) ScopeFunc {
+	return func(c *gin.Context) models.AccessScope {
+		return models.AccessScope{Kind: models.ScopeTable, Target: c.Param(param)}
+	}
+}
+
+// RequireRole admits a session only if its user holds at least role, globally or through a
+// grant on the scope resolved for the request. It runs after RequireSession; administrators
+// always pass. Refusals are answered with 403 and recorded in the audit log.
+func RequireRole(store *models.LedgerStore, role models.AccessRole, scope ScopeFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var username string
+		if value, ok := c.Get(ContextSessionKey); ok {
+			if session, ok := value.(*auth.Session); ok {
+				username = session.Username
+			}
+		}
+		if username == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing_session"})
+			return
+		}
+		if store.IsUserAdmin(username) {
+			c.Next()
+			return
+		}
+		var resolved models.AccessScope
+		if scope != nil {
+			resolved = scope(c)
+		}
+		if !store.Authorize(username, role, resolved) {
+			store.RecordAccessDenied(username, role, resolved, c.Request.Method+" "+c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "required": role})
+			return
+		}
+		c.Next()
+	}
+}
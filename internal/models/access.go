@@ -0,0 +1,329 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrGrantNotFound indicates the permission grant does not exist.
+	ErrGrantNotFound = errors.New("grant_not_found")
+	// ErrGrantInvalid indicates a permission grant with an unknown role, scope or target.
+	ErrGrantInvalid = errors.New("grant_invalid")
+	// ErrRoleInvalid indicates a role outside the known access roles.
+	ErrRoleInvalid = errors.New("role_invalid")
+	// ErrUserDemoteLastAdmin prevents the final system administrator from losing the role.
+	ErrUserDemoteLastAdmin = errors.New("cannot_demote_last_admin")
+)
+
+// AccessRole is the level of access a user holds, globally or through a scoped grant.
+type AccessRole string
+
+// Access roles from least to most privileged. Each role includes the ones before it.
+const (
+	// AccessViewer may read ledgers, workspaces, tables and reports.
+	AccessViewer AccessRole = "viewer"
+	// AccessEditor may additionally create, change and delete entries, rows and records.
+	AccessEditor AccessRole = "editor"
+	// AccessLedgerAdmin may additionally manage schemas, ledger types, imports and reports.
+	AccessLedgerAdmin AccessRole = "ledger-admin"
+	// AccessSystemAdmin may additionally manage users, grants, the allowlist and snapshots.
+	AccessSystemAdmin AccessRole = "system-admin"
+)
+
+// Valid reports whether the role is one of the known access roles.
+func (r AccessRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// Includes reports whether holding r also grants required.
+func (r AccessRole) Includes(required AccessRole) bool {
+	return r.rank() >= required.rank() && r.Valid()
+}
+
+func (r AccessRole) rank() int {
+	switch r {
+	case AccessViewer:
+		return 1
+	case AccessEditor:
+		return 2
+	case AccessLedgerAdmin:
+		return 3
+	case AccessSystemAdmin:
+		return 4
+	}
+	return 0
+}
+
+// AccessScopeKind names what a permission grant applies to.
+type AccessScopeKind string
+
+const (
+	// ScopeLedger grants access to the entries of one ledger type.
+	ScopeLedger AccessScopeKind = "ledger"
+	// ScopeWorkspace grants access to a workspace and every folder or sheet beneath it.
+	ScopeWorkspace AccessScopeKind = "workspace"
+	// ScopeTable grants access to one Roledger table.
+	ScopeTable AccessScopeKind = "table"
+)
+
+// AccessScope identifies the resource a request touches. The zero value is the global scope,
+// which only a user's own role can satisfy.
+type AccessScope struct {
+	Kind   AccessScopeKind
+	Target string
+}
+
+func (s AccessScope) String() string {
+	if s.Kind == "" {
+		return "global"
+	}
+	return fmt.Sprintf("%s:%s", s.Kind, s.Target)
+}
+
+// PermissionGrant raises a user's role within one ledger type, workspace subtree or table.
+type PermissionGrant struct {
+	ID        string          `json:"id"`
+	Username  string          `json:"username"`
+	Role      AccessRole      `json:"role"`
+	Scope     AccessScopeKind `json:"scope"`
+	Target    string          `json:"target"`
+	CreatedBy string          `json:"created_by,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// EffectiveRole is the global role of the user: system-admin for administrators, otherwise the
+// assigned role. Accounts created before roles existed default to editor, which keeps their
+// previous access.
+func (u *User) EffectiveRole() AccessRole {
+	if u == nil {
+		return ""
+	}
+	if u.Admin {
+		return AccessSystemAdmin
+	}
+	if u.Role.Valid() {
+		return u.Role
+	}
+	return AccessEditor
+}
+
+// UserRole returns the global role of the named user, or an empty role if the user is unknown.
+func (s *LedgerStore) UserRole(username string) AccessRole {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userByName[normalizeUsername(username)].EffectiveRole()
+}
+
+// SetUserRole changes the global role of a user. System administrators are flagged Admin so
+// existing administrator checks keep working; the last one cannot be demoted.
+func (s *LedgerStore) SetUserRole(id string, role AccessRole, actor string) (*User, error) {
+	if !role.Valid() {
+		return nil, ErrRoleInvalid
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[strings.TrimSpace(id)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if user.Admin && role != AccessSystemAdmin && s.adminCountLocked() <= 1 {
+		return nil, ErrUserDemoteLastAdmin
+	}
+	user.Role = role
+	user.Admin = role == AccessSystemAdmin
+	user.UpdatedAt = time.Now().UTC()
+	s.appendAuditLocked(strings.TrimSpace(actor), "user_role_update", fmt.Sprintf("%s %s", user.ID, role))
+	return user.Clone(), nil
+}
+
+func (s *LedgerStore) adminCountLocked() int {
+	count := 0
+	for _, user := range s.users {
+		if user != nil && user.Admin {
+			count++
+		}
+	}
+	return count
+}
+
+// ListGrants returns permission grants in creation order, optionally only those of one user.
+func (s *LedgerStore) ListGrants(username string) []PermissionGrant {
+	normalized := normalizeUsername(username)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]PermissionGrant, 0, len(s.grants))
+	for _, grant := range s.grants {
+		if normalized == "" || normalizeUsername(grant.Username) == normalized {
+			out = append(out, grant)
+		}
+	}
+	return out
+}
+
+// CreateGrant gives a user a role within a scope. Granting the same user the same scope again
+// replaces the earlier role. System administration cannot be scoped and is set per user instead.
+func (s *LedgerStore) CreateGrant(grant PermissionGrant, actor string) (*PermissionGrant, error) {
+	grant.Username = strings.TrimSpace(grant.Username)
+	grant.Target = strings.TrimSpace(grant.Target)
+	if !grant.Role.Valid() || grant.Role == AccessSystemAdmin {
+		return nil, fmt.Errorf("%w: role %q", ErrGrantInvalid, grant.Role)
+	}
+	if grant.Target == "" {
+		return nil, fmt.Errorf("%w: target is required", ErrGrantInvalid)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.userByName[normalizeUsername(grant.Username)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	grant.Username = user.Username
+	switch grant.Scope {
+	case ScopeLedger:
+		grant.Target = string(NormaliseLedgerType(grant.Target))
+		if _, ok := s.ledgerTypes[LedgerType(grant.Target)]; !ok {
+			return nil, fmt.Errorf("%w: unknown ledger %s", ErrGrantInvalid, grant.Target)
+		}
+	case ScopeWorkspace:
+		if _, ok := s.workspaces[grant.Target]; !ok {
+			return nil, fmt.Errorf("%w: unknown workspace %s", ErrGrantInvalid, grant.Target)
+		}
+	case ScopeTable:
+		// Roledger tables live outside the store, so the target is taken as given.
+	default:
+		return nil, fmt.Errorf("%w: scope %q", ErrGrantInvalid, grant.Scope)
+	}
+
+	details := fmt.Sprintf("%s %s %s:%s", grant.Username, grant.Role, grant.Scope, grant.Target)
+	for i, existing := range s.grants {
+		if normalizeUsername(existing.Username) == normalizeUsername(grant.Username) && existing.Scope == grant.Scope && existing.Target == grant.Target {
+			s.grants[i].Role = grant.Role
+			s.appendAuditLocked(strings.TrimSpace(actor), "grant_update", details)
+			updated := s.grants[i]
+			return &updated, nil
+		}
+	}
+	grant.ID = GenerateID("grant")
+	grant.CreatedBy = strings.TrimSpace(actor)
+	grant.CreatedAt = time.Now().UTC()
+	s.grants = append(s.grants, grant)
+	s.appendAuditLocked(grant.CreatedBy, "grant_create", details)
+	return &grant, nil
+}
+
+// DeleteGrant revokes a permission grant.
+func (s *LedgerStore) DeleteGrant(id string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, grant := range s.grants {
+		if grant.ID == strings.TrimSpace(id) {
+			s.grants = append(s.grants[:i], s.grants[i+1:]...)
+			s.appendAuditLocked(strings.TrimSpace(actor), "grant_delete", grant.ID)
+			return nil
+		}
+	}
+	return ErrGrantNotFound
+}
+
+// Authorize reports whether the user holds at least the required role within scope, either
+// through their global role or a grant on the scope. Workspace grants also cover every
+// workspace beneath the granted one.
+func (s *LedgerStore) Authorize(username string, required AccessRole, scope AccessScope) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.userByName[normalizeUsername(username)]
+	if !ok {
+		return false
+	}
+	if user.EffectiveRole().Includes(required) {
+		return true
+	}
+	if scope.Kind == "" {
+		return false
+	}
+	targets := s.scopeTargetsLocked(scope)
+	for _, grant := range s.grants {
+		if grant.Scope != scope.Kind || normalizeUsername(grant.Username) != normalizeUsername(user.Username) {
+			continue
+		}
+		if _, ok := targets[grant.Target]; ok && grant.Role.Includes(required) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeTargetsLocked lists the grant targets that cover scope: the target itself and, for
+// workspaces, each of its ancestors.
+func (s *LedgerStore) scopeTargetsLocked(scope AccessScope) map[string]struct{} {
+	target := strings.TrimSpace(scope.Target)
+	if scope.Kind == ScopeLedger {
+		target = string(NormaliseLedgerType(target))
+	}
+	targets := map[string]struct{}{target: {}}
+	if scope.Kind != ScopeWorkspace {
+		return targets
+	}
+	for id := target; ; {
+		workspace, ok := s.workspaces[id]
+		if !ok {
+			break
+		}
+		id = strings.TrimSpace(workspace.ParentID)
+		// Stop at the root, and at a cycle should a snapshot ever contain one.
+		if _, seen := targets[id]; seen || id == "" {
+			break
+		}
+		targets[id] = struct{}{}
+	}
+	return targets
+}
+
+// RecordAccessDenied audits a request refused for lacking the required role.
+func (s *LedgerStore) RecordAccessDenied(username string, required AccessRole, scope AccessScope, resource string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendAuditLocked(strings.TrimSpace(username), "access_denied", fmt.Sprintf("%s requires %s on %s", resource, required, scope))
+}
+
+// removeUserGrantsLocked drops the grants of a deleted user.
+func (s *LedgerStore) removeUserGrantsLocked(username string) {
+	filtered := s.grants[:0]
+	for _, grant := range s.grants {
+		if normalizeUsername(grant.Username) != normalizeUsername(username) {
+			filtered = append(filtered, grant)
+		}
+	}
+	s.grants = filtered
+}
+
+// mergeGrantsLocked replaces grants with matching IDs and appends the rest.
+func (s *LedgerStore) mergeGrantsLocked(grants []PermissionGrant) {
+	index := make(map[string]int, len(s.grants))
+	for i, grant := range s.grants {
+		index[grant.ID] = i
+	}
+	for _, grant := range restoreGrants(grants) {
+		if i, ok := index[grant.ID]; ok {
+			s.grants[i] = grant
+			continue
+		}
+		index[grant.ID] = len(s.grants)
+		s.grants = append(s.grants, grant)
+	}
+}
+
+// restoreGrants copies persisted grants, dropping entries without an ID.
+func restoreGrants(grants []PermissionGrant) []PermissionGrant {
+	out := make([]PermissionGrant, 0, len(grants))
+	for _, grant := range grants {
+		if strings.TrimSpace(grant.ID) == "" {
+			continue
+		}
+		out = append(out, grant)
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizeCombinesRolesAndScopedGrants(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.CreateUser("viewer", "Passw0rd!23", AccessViewer, "admin"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	legacy, err := store.CreateUser("legacy", "Passw0rd!23", "", "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if legacy.EffectiveRole() != AccessEditor {
+		t.Fatalf("expected users without a role to stay editors, got %s", legacy.EffectiveRole())
+	}
+
+	folder, err := store.CreateWorkspace("Ops", WorkspaceKindFolder, "", nil, nil, "", "admin")
+	if err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+	sheet, err := store.CreateWorkspace("Inventory", WorkspaceKindSheet, folder.ID, nil, nil, "", "admin")
+	if err != nil {
+		t.Fatalf("create sheet: %v", err)
+	}
+	other, err := store.CreateWorkspace("Finance", WorkspaceKindSheet, "", nil, nil, "", "admin")
+	if err != nil {
+		t.Fatalf("create sheet: %v", err)
+	}
+
+	if store.Authorize("viewer", AccessEditor, AccessScope{Kind: ScopeLedger, Target: "system"}) {
+		t.Fatalf("expected a viewer to be refused edits")
+	}
+	if _, err := store.CreateGrant(PermissionGrant{Username: "Viewer", Role: AccessEditor, Scope: ScopeLedger, Target: "system"}, "admin"); err != nil {
+		t.Fatalf("create ledger grant: %v", err)
+	}
+	if _, err := store.CreateGrant(PermissionGrant{Username: "viewer", Role: AccessEditor, Scope: ScopeWorkspace, Target: folder.ID}, "admin"); err != nil {
+		t.Fatalf("create workspace grant: %v", err)
+	}
+	checks := []struct {
+		role  AccessRole
+		scope AccessScope
+		want  bool
+	}{
+		{AccessEditor, AccessScope{Kind: ScopeLedger, Target: "system"}, true},
+		{AccessLedgerAdmin, AccessScope{Kind: ScopeLedger, Target: "system"}, false},
+		{AccessEditor, AccessScope{Kind: ScopeLedger, Target: "ip"}, false},
+		{AccessEditor, AccessScope{Kind: ScopeWorkspace, Target: sheet.ID}, true},
+		{AccessEditor, AccessScope{Kind: ScopeWorkspace, Target: other.ID}, false},
+		{AccessEditor, AccessScope{}, false},
+		{AccessViewer, AccessScope{}, true},
+	}
+	for _, check := range checks {
+		if got := store.Authorize("viewer", check.role, check.scope); got != check.want {
+			t.Fatalf("authorize %s on %s: expected %v, got %v", check.role, check.scope, check.want, got)
+		}
+	}
+
+	if _, err := store.CreateGrant(PermissionGrant{Username: "viewer", Role: AccessSystemAdmin, Scope: ScopeTable, Target: "t1"}, "admin"); !errors.Is(err, ErrGrantInvalid) {
+		t.Fatalf("expected scoped system administration to be refused, got %v", err)
+	}
+	if _, err := store.CreateGrant(PermissionGrant{Username: "viewer", Role: AccessEditor, Scope: ScopeWorkspace, Target: "missing"}, "admin"); !errors.Is(err, ErrGrantInvalid) {
+		t.Fatalf("expected unknown workspaces to be refused, got %v", err)
+	}
+	if err := store.DeleteUser(legacy.ID, "admin"); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if grants := store.ListGrants("viewer"); len(grants) != 2 || grants[0].Target != string(LedgerTypeSystem) {
+		t.Fatalf("unexpected grants %+v", grants)
+	}
+}
+
+func TestSetUserRoleAndGrantSnapshot(t *testing.T) {
+	store := newTestStore(t)
+	admin := store.ListUsers()[0]
+	if _, err := store.SetUserRole(admin.ID, AccessEditor, "admin"); !errors.Is(err, ErrUserDemoteLastAdmin) {
+		t.Fatalf("expected the last administrator to keep the role, got %v", err)
+	}
+	user, err := store.CreateUser("ops", "Passw0rd!23", AccessViewer, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if user, err = store.SetUserRole(user.ID, AccessSystemAdmin, "admin"); err != nil || !user.Admin || !store.IsUserAdmin("ops") {
+		t.Fatalf("expected promotion to system-admin to set admin, got %+v (%v)", user, err)
+	}
+	if _, err := store.SetUserRole(user.ID, AccessLedgerAdmin, "admin"); err != nil {
+		t.Fatalf("demote user: %v", err)
+	}
+	grant, err := store.CreateGrant(PermissionGrant{Username: "ops", Role: AccessEditor, Scope: ScopeTable, Target: "assets"}, "admin")
+	if err != nil {
+		t.Fatalf("create grant: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.WriteSnapshotJSON(&buf); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	restored := newTestStore(t)
+	if err := restored.ImportSnapshot(&snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if role := restored.UserRole("ops"); role != AccessLedgerAdmin {
+		t.Fatalf("expected role to survive the snapshot, got %s", role)
+	}
+	if !restored.Authorize("ops", AccessEditor, AccessScope{Kind: ScopeTable, Target: "assets"}) {
+		t.Fatalf("expected grant to survive the snapshot")
+	}
+	if err := restored.DeleteGrant(grant.ID, "admin"); err != nil {
+		t.Fatalf("delete grant: %v", err)
+	}
+	if err := restored.DeleteGrant(grant.ID, "admin"); !errors.Is(err, ErrGrantNotFound) {
+		t.Fatalf("expected grant to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBulkInvalid indicates a bulk request without targets or with an unknown operation.
+var ErrBulkInvalid = errors.New("bulk_invalid")
+
+// Bulk operation kinds.
+const (
+	BulkOpUpdate       = "update"
+	BulkOpDelete       = "delete"
+	BulkOpTagAdd       = "tag_add"
+	BulkOpTagRemove    = "tag_remove"
+	BulkOpLinkAdd      = "link_add"
+	BulkOpAttributeSet = "attribute_set"
+)
+
+// BulkOperation is one change applied to every targeted entry. update follows UpdateEntry:
+// non-empty name and description and non-nil attributes, tags and links replace the current
+// values. attribute_set merges Attributes, removing keys set to an empty value.
+type BulkOperation struct {
+	Op          string                  `json:"op"`
+	Name        string                  `json:"name,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Attributes  map[string]string       `json:"attributes,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Links       map[LedgerType][]string `json:"links,omitempty"`
+}
+
+// BulkRequest targets either explicit entry IDs or every entry matching Query, and applies
+// Operations to each in order. DryRun reports the outcome without changing anything.
+type BulkRequest struct {
+	IDs        []string
+	Query      *LedgerQuery
+	Operations []BulkOperation
+	DryRun     bool
+	// Visibility keeps hidden entries out of reach and masked attributes unreadable: filters
+	// see masked values, masked attributes an operation leaves out keep their stored values,
+	// and reported changes are masked.
+	Visibility *Visibility
+}
+
+// Bulk item outcomes.
+const (
+	BulkActionUpdate    = "update"
+	BulkActionDelete    = "delete"
+	BulkActionUnchanged = "unchanged"
+)
+
+// BulkItemResult describes what happened, or would happen, to one targeted entry.
+type BulkItemResult struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Action  string        `json:"action"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// BulkResult summarises a bulk request.
+type BulkResult struct {
+	Type      LedgerType       `json:"type"`
+	DryRun    bool             `json:"dryRun"`
+	Matched   int              `json:"matched"`
+	Updated   int              `json:"updated"`
+	Deleted   int              `json:"deleted"`
+	Unchanged int              `json:"unchanged"`
+	Items     []BulkItemResult `json:"items"`
+}
+
+func validBulkOp(op string) bool {
+	switch op {
+	case BulkOpUpdate, BulkOpDelete, BulkOpTagAdd, BulkOpTagRemove, BulkOpLinkAdd, BulkOpAttributeSet:
+		return true
+	}
+	return false
+}
+
+// applyBulkOperation returns the entry after op, or false when op deletes it.
+func applyBulkOperation(entry LedgerEntry, op BulkOperation) (LedgerEntry, bool) {
+	switch op.Op {
+	case BulkOpDelete:
+		return entry, false
+	case BulkOpUpdate:
+		if op.Name != "" {
+			entry.Name = op.Name
+		}
+		if op.Description != "" {
+			entry.Description = op.Description
+		}
+		if op.Attributes != nil {
+			entry.Attributes = make(map[string]string, len(op.Attributes))
+			for k, v := range op.Attributes {
+				entry.Attributes[k] = v
+			}
+		}
+		if op.Tags != nil {
+			entry.Tags = normaliseStrings(op.Tags)
+		}
+		if op.Links != nil {
+			entry.Links = make(map[LedgerType][]string, len(op.Links))
+			for target, ids := range op.Links {
+				entry.Links[target] = append([]string{}, ids...)
+			}
+		}
+	case BulkOpTagAdd:
+		entry.Tags = normaliseStrings(append(append([]string{}, entry.Tags...), op.Tags...))
+	case BulkOpTagRemove:
+		drop := make(map[string]struct{}, len(op.Tags))
+		for _, tag := range op.Tags {
+			drop[strings.ToLower(strings.TrimSpace(tag))] = struct{}{}
+		}
+		kept := make([]string, 0, len(entry.Tags))
+		for _, tag := range entry.Tags {
+			if _, ok := drop[strings.ToLower(tag)]; !ok {
+				kept = append(kept, tag)
+			}
+		}
+		entry.Tags = kept
+	case BulkOpLinkAdd:
+		if entry.Links == nil {
+			entry.Links = make(map[LedgerType][]string, len(op.Links))
+		}
+		for target, ids := range op.Links {
+			entry.Links[target] = append(entry.Links[target], ids...)
+		}
+	case BulkOpAttributeSet:
+		if entry.Attributes == nil {
+			entry.Attributes = make(map[string]string, len(op.Attributes))
+		}
+		for key, value := range op.Attributes {
+			if value == "" {
+				delete(entry.Attributes, key)
+				continue
+			}
+			entry.Attributes[key] = value
+		}
+	}
+	return entry, true
+}
+
+// bulkTargetsLocked resolves the entries a request applies to, in ledger order.
+func (s *LedgerStore) bulkTargetsLocked(typ LedgerType, req BulkRequest) ([]int, error) {
+	items := s.entries[typ]
+	targets := make([]int, 0)
+	if req.Query != nil {
+		matcher, err := compileEntryMatcher(*req.Query)
+		if err != nil {
+			return nil, err
+		}
+		for i, entry := range items {
+			if visible, ok := req.Visibility.Entry(typ, entry); ok && matcher.match(visible) {
+				targets = append(targets, i)
+			}
+		}
+		return targets, nil
+	}
+	if len(req.IDs) == 0 {
+		return nil, fmt.Errorf("%w: ids or filter required", ErrBulkInvalid)
+	}
+	wanted := make(map[string]struct{}, len(req.IDs))
+	for _, id := range req.IDs {
+		wanted[strings.TrimSpace(id)] = struct{}{}
+	}
+	for i, entry := range items {
+		if _, ok := wanted[entry.ID]; ok && !req.Visibility.Hidden(typ, entry.ID) {
+			targets = append(targets, i)
+			delete(wanted, entry.ID)
+		}
+	}
+	for id := range wanted {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	return targets, nil
+}
+
+// BulkUpdateEntries applies the request's operations to every targeted entry as one change: it
+// either succeeds as a whole or leaves the ledger untouched, and produces a single undo step and
+// audit record.
+func (s *LedgerStore) BulkUpdateEntries(typ LedgerType, req BulkRequest, actor string) (BulkResult, error) {
+	if len(req.Operations) == 0 {
+		return BulkResult{}, fmt.Errorf("%w: no operations", ErrBulkInvalid)
+	}
+	for _, op := range req.Operations {
+		if !validBulkOp(op.Op) {
+			return BulkResult{}, fmt.Errorf("%w: operation %q", ErrBulkInvalid, op.Op)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ledgerTypes[typ]; !ok {
+		return BulkResult{}, fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, typ)
+	}
+	targets, err := s.bulkTargetsLocked(typ, req)
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	items := s.entries[typ]
+	result := BulkResult{Type: typ, DryRun: req.DryRun, Matched: len(targets), Items: make([]BulkItemResult, 0, len(targets))}
+	candidates := make([]LedgerEntry, 0, len(targets))
+	positions := make([]int, 0, len(targets))
+	slots := make([]int, 0, len(targets))
+	deleted := make(map[string]struct{})
+	for _, idx := range targets {
+		original := items[idx]
+		updated, keep := original.Clone(), true
+		for _, op := range req.Operations {
+			if op.Attributes != nil {
+				op.Attributes = req.Visibility.Restore(typ, op.Attributes, updated.Attributes)
+			}
+			if updated, keep = applyBulkOperation(updated, op); !keep {
+				break
+			}
+		}
+		if !keep {
+			deleted[original.ID] = struct{}{}
+			result.Items = append(result.Items, BulkItemResult{ID: original.ID, Name: original.Name, Action: BulkActionDelete})
+			continue
+		}
+		candidates = append(candidates, updated)
+		positions = append(positions, idx)
+		slots = append(slots, len(result.Items))
+		result.Items = append(result.Items, BulkItemResult{ID: original.ID, Name: original.Name})
+	}
+	if err := s.prepareEntriesLocked(typ, candidates); err != nil {
+		return BulkResult{}, err
+	}
+
+	changed := make([]int, 0, len(candidates))
+	for i, candidate := range candidates {
+		outcome := &result.Items[slots[i]]
+		changes := diffFields(flattenEntry(items[positions[i]]), flattenEntry(candidate))
+		outcome.Changes = req.Visibility.Changes(typ, changes)
+		if len(changes) == 0 {
+			outcome.Action = BulkActionUnchanged
+			result.Unchanged++
+			continue
+		}
+		outcome.Action = BulkActionUpdate
+		result.Updated++
+		changed = append(changed, i)
+	}
+	result.Deleted = len(deleted)
+	if req.DryRun || (len(changed) == 0 && len(deleted) == 0) {
+		return result, nil
+	}
+
+	now := time.Now().UTC()
+	previous := make([]map[LedgerType][]string, len(candidates))
+	for _, i := range changed {
+		s.touchEntryLocked(typ, candidates[i].ID)
+		previous[i] = items[positions[i]].Links
+		candidates[i].UpdatedAt = now
+		items[positions[i]] = candidates[i]
+	}
+	for _, i := range changed {
+		s.syncLinksLocked(typ, candidates[i].ID, previous[i], candidates[i].Links)
+	}
+	if len(deleted) > 0 {
+		kept := make([]LedgerEntry, 0, len(items)-len(deleted))
+		for _, entry := range items {
+			if _, ok := deleted[entry.ID]; ok {
+				s.touchEntryLocked(typ, entry.ID)
+				s.trashEntryLocked(typ, entry, actor)
+				continue
+			}
+			entry.Order = len(kept)
+			kept = append(kept, entry)
+		}
+		items = kept
+	}
+	s.entries[typ] = items
+	s.reindexLedgerLocked(typ)
+	for id := range deleted {
+		s.unlinkAllLocked(typ, id)
+	}
+	s.appendAuditLocked(actor, fmt.Sprintf("bulk_%s", typ), fmt.Sprintf("matched=%d updated=%d deleted=%d", result.Matched, result.Updated, result.Deleted))
+	s.commitLocked(actor)
+	return result, nil
+}
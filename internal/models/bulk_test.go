@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBulkUpdateEntriesIsOneStep(t *testing.T) {
+	store := newTestStore(t)
+
+	ids := make([]string, 0, 3)
+	for _, name := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		entry, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: name, Tags: []string{"机房A"}}, "tester")
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	undoBefore, _ := store.HistoryDepth("tester")
+
+	preview, err := store.BulkUpdateEntries(LedgerTypeIP, BulkRequest{
+		Query:      &LedgerQuery{Filters: []FilterClause{{Property: "name", Op: FilterOpPrefix, Value: "10.0.0."}}},
+		Operations: []BulkOperation{{Op: BulkOpTagRemove, Tags: []string{"机房A"}}, {Op: BulkOpTagAdd, Tags: []string{"机房B"}}},
+		DryRun:     true,
+	}, "tester")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if preview.Matched != 3 || preview.Updated != 3 || len(preview.Items[0].Changes) != 1 || preview.Items[0].Changes[0].To != "机房B" {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+	if entry, _ := store.GetEntry(LedgerTypeIP, ids[0]); entry.Tags[0] != "机房A" {
+		t.Fatalf("dry run must not change entries, got %+v", entry.Tags)
+	}
+
+	result, err := store.BulkUpdateEntries(LedgerTypeIP, BulkRequest{
+		Query:      &LedgerQuery{Filters: []FilterClause{{Property: "name", Op: FilterOpPrefix, Value: "10.0.0."}}},
+		Operations: []BulkOperation{{Op: BulkOpTagRemove, Tags: []string{"机房A"}}, {Op: BulkOpTagAdd, Tags: []string{"机房B"}}},
+	}, "tester")
+	if err != nil || result.Updated != 3 {
+		t.Fatalf("bulk update: %+v (%v)", result, err)
+	}
+	if undoAfter, _ := store.HistoryDepth("tester"); undoAfter != undoBefore+1 {
+		t.Fatalf("expected a single undo step, got %d -> %d", undoBefore, undoAfter)
+	}
+
+	if _, err := store.BulkUpdateEntries(LedgerTypeIP, BulkRequest{
+		IDs:        ids[:2],
+		Operations: []BulkOperation{{Op: BulkOpAttributeSet, Attributes: map[string]string{IPAddressAttribute: "10.0.0.3"}}},
+	}, "tester"); err == nil {
+		t.Fatalf("expected duplicate addresses to reject the whole batch")
+	}
+	if entry, _ := store.GetEntry(LedgerTypeIP, ids[0]); entry.Attributes[IPAddressAttribute] == "10.0.0.3" {
+		t.Fatalf("failed batch must leave entries untouched")
+	}
+
+	deleted, err := store.BulkUpdateEntries(LedgerTypeIP, BulkRequest{IDs: ids[:2], Operations: []BulkOperation{{Op: BulkOpDelete}}}, "tester")
+	if err != nil || deleted.Deleted != 2 {
+		t.Fatalf("bulk delete: %+v (%v)", deleted, err)
+	}
+	if remaining := store.ListEntries(LedgerTypeIP); len(remaining) != 1 || remaining[0].Order != 0 {
+		t.Fatalf("expected one compacted entry left, got %+v", remaining)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if remaining := store.ListEntries(LedgerTypeIP); len(remaining) != 3 {
+		t.Fatalf("expected undo to restore both entries, got %d", len(remaining))
+	}
+}
+
+func TestBulkUpdateEntriesAppliesVisibility(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"department": "Ops", "id_number": "110101199001011234"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob", Attributes: map[string]string{"department": "Sales"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	user, err := store.CreateUser("manager", "Passw0rd!23", AccessEditor, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(user.ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityField, Field: "id_number", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityRow, Subjects: []string{"managers"}, Filters: []FilterClause{{Property: "attributes.department", Op: FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+	view := store.VisibilityFor("manager")
+
+	if _, err := store.BulkUpdateEntries(LedgerTypePersonnel, BulkRequest{IDs: []string{bob.ID}, Operations: []BulkOperation{{Op: BulkOpDelete}}, Visibility: view}, "manager"); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("expected hidden entries to be missing, got %v", err)
+	}
+	probe, err := store.BulkUpdateEntries(LedgerTypePersonnel, BulkRequest{
+		Query:      &LedgerQuery{Filters: []FilterClause{{Property: "attributes.id_number", Op: FilterOpEq, Value: "110101199001011234"}}},
+		Operations: []BulkOperation{{Op: BulkOpTagAdd, Tags: []string{"probe"}}},
+		DryRun:     true,
+		Visibility: view,
+	}, "manager")
+	if err != nil || probe.Matched != 0 {
+		t.Fatalf("expected masked values to be unfilterable, got %+v (%v)", probe, err)
+	}
+	preview, err := store.BulkUpdateEntries(LedgerTypePersonnel, BulkRequest{
+		Query:      &LedgerQuery{},
+		Operations: []BulkOperation{{Op: BulkOpAttributeSet, Attributes: map[string]string{"id_number": ""}}},
+		DryRun:     true,
+		Visibility: view,
+	}, "manager")
+	if err != nil || preview.Matched != 1 || len(preview.Items[0].Changes) != 0 {
+		t.Fatalf("expected one visible entry without masked changes, got %+v (%v)", preview, err)
+	}
+
+	if _, err := store.BulkUpdateEntries(LedgerTypePersonnel, BulkRequest{
+		IDs:        []string{alice.ID},
+		Operations: []BulkOperation{{Op: BulkOpUpdate, Attributes: map[string]string{"department": "Ops", "title": "Lead"}}},
+		Visibility: view,
+	}, "manager"); err != nil {
+		t.Fatalf("bulk update: %v", err)
+	}
+	if stored, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); stored.Attributes["id_number"] != "110101199001011234" || stored.Attributes["title"] != "Lead" {
+		t.Fatalf("expected the masked attribute to survive the update, got %+v", stored.Attributes)
+	}
+}
@@ -0,0 +1,332 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultGraphDepth is the traversal depth used when callers do not ask for one.
+	DefaultGraphDepth = 2
+	// MaxGraphDepth caps traversal depth so a single request cannot walk the whole store.
+	MaxGraphDepth = 6
+	// MaxGraphNodes caps the number of nodes a traversal returns; the result is marked truncated.
+	MaxGraphNodes = 1000
+)
+
+// ErrNoPath indicates two entries are not connected within the allowed depth.
+var ErrNoPath = errors.New("no_path")
+
+// GraphNode is a ledger entry reached during a traversal. Depth is the hop count from the root.
+type GraphNode struct {
+	Key   string     `json:"key"`
+	Type  LedgerType `json:"type"`
+	ID    string     `json:"id"`
+	Name  string     `json:"name"`
+	Depth int        `json:"depth"`
+}
+
+// GraphEdge is an undirected link between two nodes, annotated with the roles of any typed
+// relationships connecting them.
+type GraphEdge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Graph is the neighbourhood of a root entry.
+type Graph struct {
+	Root      string      `json:"root"`
+	Depth     int         `json:"depth"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// GraphPath is the shortest chain of links between two entries.
+type GraphPath struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// ImpactReport groups the entries reachable from a root by ledger type, answering questions
+// such as "which systems and people are affected if this IP goes down".
+type ImpactReport struct {
+	Root     GraphNode                  `json:"root"`
+	Depth    int                        `json:"depth"`
+	Affected map[LedgerType][]GraphNode `json:"affected"`
+	Total    int                        `json:"total"`
+}
+
+// GraphKey returns the node key used in graph responses ("type/id").
+func GraphKey(typ LedgerType, id string) string {
+	return string(typ) + "/" + id
+}
+
+func clampGraphDepth(depth int) int {
+	if depth <= 0 {
+		return DefaultGraphDepth
+	}
+	if depth > MaxGraphDepth {
+		return MaxGraphDepth
+	}
+	return depth
+}
+
+func (s *LedgerStore) graphNodeLocked(ref entryRef, depth int) (GraphNode, bool) {
+	idx := s.entryIndexLocked(ref.typ, ref.id)
+	if idx < 0 {
+		return GraphNode{}, false
+	}
+	return GraphNode{Key: GraphKey(ref.typ, ref.id), Type: ref.typ, ID: ref.id, Name: s.entries[ref.typ][idx].Name, Depth: depth}, true
+}
+
+// resolveGraphEntryLocked finds an entry by ID, falling back to an exact name match and, for
+// the IP ledger, to the entry's address so callers can start from "10.1.2.3". Entries the view
+// hides are not found.
+func (s *LedgerStore) resolveGraphEntryLocked(typ LedgerType, key string, view *Visibility) (entryRef, error) {
+	key = strings.TrimSpace(key)
+	if _, ok := s.ledgerTypes[typ]; !ok {
+		return entryRef{}, fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, typ)
+	}
+	if key == "" {
+		return entryRef{}, ErrEntryNotFound
+	}
+	if s.entryIndexLocked(typ, key) >= 0 && !view.Hidden(typ, key) {
+		return entryRef{typ, key}, nil
+	}
+	address, isAddress := "", false
+	if typ == LedgerTypeIP {
+		address, isAddress = NormaliseIPAddress(key)
+	}
+	for _, entry := range s.entries[typ] {
+		if view.Hidden(typ, entry.ID) {
+			continue
+		}
+		if entry.Name == key {
+			return entryRef{typ, entry.ID}, nil
+		}
+		if isAddress && entry.Attributes[IPAddressAttribute] == address {
+			return entryRef{typ, entry.ID}, nil
+		}
+	}
+	return entryRef{}, fmt.Errorf("%w: %s/%s", ErrEntryNotFound, typ, key)
+}
+
+// neighboursLocked lists the existing entries linked from ref that the view does not hide, in
+// a stable order.
+func (s *LedgerStore) neighboursLocked(ref entryRef, view *Visibility) []entryRef {
+	idx := s.entryIndexLocked(ref.typ, ref.id)
+	if idx < 0 {
+		return nil
+	}
+	links := s.entries[ref.typ][idx].Links
+	out := make([]entryRef, 0)
+	for _, target := range s.ledgerTypeOrder {
+		for _, id := range links[target] {
+			if s.entryIndexLocked(target, id) >= 0 && !view.Hidden(target, id) {
+				out = append(out, entryRef{target, id})
+			}
+		}
+	}
+	return out
+}
+
+func (s *LedgerStore) graphEdgeLocked(a, b entryRef) GraphEdge {
+	edge := GraphEdge{From: GraphKey(a.typ, a.id), To: GraphKey(b.typ, b.id)}
+	if roles := s.rolesBetweenLocked(a, b); len(roles) > 0 {
+		edge.Roles = roles
+	}
+	return edge
+}
+
+// traverseLocked walks links breadth-first from root and returns the visited entries in visit
+// order, their depths and the edges between visited entries.
+func (s *LedgerStore) traverseLocked(root entryRef, depth int, view *Visibility) ([]entryRef, map[entryRef]int, [][2]entryRef, bool) {
+	depths := map[entryRef]int{root: 0}
+	order := []entryRef{root}
+	edges := make([][2]entryRef, 0)
+	seenEdge := make(map[[2]entryRef]struct{})
+	truncated := false
+	for i := 0; i < len(order); i++ {
+		current := order[i]
+		for _, next := range s.neighboursLocked(current, view) {
+			if _, visited := depths[next]; !visited {
+				if depths[current] >= depth {
+					continue
+				}
+				if len(order) >= MaxGraphNodes {
+					truncated = true
+					continue
+				}
+				depths[next] = depths[current] + 1
+				order = append(order, next)
+			}
+			pair := [2]entryRef{current, next}
+			if _, ok := seenEdge[[2]entryRef{next, current}]; ok {
+				continue
+			}
+			if _, ok := seenEdge[pair]; ok {
+				continue
+			}
+			seenEdge[pair] = struct{}{}
+			edges = append(edges, pair)
+		}
+	}
+	return order, depths, edges, truncated
+}
+
+// Traverse returns the entries and links reachable from the entry within depth hops. The entry
+// may be given by ID, by name or, for the IP ledger, by address. Entries the view hides are
+// neither returned nor walked through.
+func (s *LedgerStore) Traverse(typ LedgerType, key string, depth int, view *Visibility) (Graph, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	root, err := s.resolveGraphEntryLocked(typ, key, view)
+	if err != nil {
+		return Graph{}, err
+	}
+	depth = clampGraphDepth(depth)
+	order, depths, pairs, truncated := s.traverseLocked(root, depth, view)
+	graph := Graph{Root: GraphKey(root.typ, root.id), Depth: depth, Truncated: truncated}
+	graph.Nodes = make([]GraphNode, 0, len(order))
+	for _, ref := range order {
+		if node, ok := s.graphNodeLocked(ref, depths[ref]); ok {
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+	graph.Edges = make([]GraphEdge, 0, len(pairs))
+	for _, pair := range pairs {
+		graph.Edges = append(graph.Edges, s.graphEdgeLocked(pair[0], pair[1]))
+	}
+	return graph, nil
+}
+
+// Impact lists every entry reachable from the given entry within depth hops, grouped by
+// ledger type. Only the types listed are reported when types is non-empty, and entries the view
+// hides are left out as in Traverse.
+func (s *LedgerStore) Impact(typ LedgerType, key string, depth int, types []LedgerType, view *Visibility) (ImpactReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	root, err := s.resolveGraphEntryLocked(typ, key, view)
+	if err != nil {
+		return ImpactReport{}, err
+	}
+	depth = clampGraphDepth(depth)
+	wanted := make(map[LedgerType]struct{}, len(types))
+	for _, t := range types {
+		wanted[NormaliseLedgerType(string(t))] = struct{}{}
+	}
+	order, depths, _, _ := s.traverseLocked(root, depth, view)
+	rootNode, _ := s.graphNodeLocked(root, 0)
+	report := ImpactReport{Root: rootNode, Depth: depth, Affected: make(map[LedgerType][]GraphNode)}
+	for _, ref := range order[1:] {
+		if _, ok := wanted[ref.typ]; len(wanted) > 0 && !ok {
+			continue
+		}
+		if node, ok := s.graphNodeLocked(ref, depths[ref]); ok {
+			report.Affected[ref.typ] = append(report.Affected[ref.typ], node)
+			report.Total++
+		}
+	}
+	return report, nil
+}
+
+// ShortestPath returns the shortest chain of links between two entries, searching at most
+// MaxGraphDepth hops through entries the view does not hide.
+func (s *LedgerStore) ShortestPath(fromType LedgerType, fromKey string, toType LedgerType, toKey string, view *Visibility) (GraphPath, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	from, err := s.resolveGraphEntryLocked(fromType, fromKey, view)
+	if err != nil {
+		return GraphPath{}, err
+	}
+	to, err := s.resolveGraphEntryLocked(toType, toKey, view)
+	if err != nil {
+		return GraphPath{}, err
+	}
+	parent := map[entryRef]entryRef{from: from}
+	depths := map[entryRef]int{from: 0}
+	queue := []entryRef{from}
+	for len(queue) > 0 && from != to {
+		current := queue[0]
+		queue = queue[1:]
+		if depths[current] >= MaxGraphDepth {
+			continue
+		}
+		for _, next := range s.neighboursLocked(current, view) {
+			if _, seen := parent[next]; seen {
+				continue
+			}
+			parent[next] = current
+			depths[next] = depths[current] + 1
+			if next == to {
+				queue = nil
+				break
+			}
+			queue = append(queue, next)
+		}
+	}
+	if _, ok := parent[to]; !ok {
+		return GraphPath{}, ErrNoPath
+	}
+	chain := []entryRef{to}
+	for ref := to; ref != from; {
+		ref = parent[ref]
+		chain = append(chain, ref)
+	}
+	path := GraphPath{Nodes: make([]GraphNode, 0, len(chain)), Edges: make([]GraphEdge, 0, len(chain)-1)}
+	for i := len(chain) - 1; i >= 0; i-- {
+		node, _ := s.graphNodeLocked(chain[i], len(chain)-1-i)
+		path.Nodes = append(path.Nodes, node)
+		if i > 0 {
+			path.Edges = append(path.Edges, s.graphEdgeLocked(chain[i], chain[i-1]))
+		}
+	}
+	return path, nil
+}
+
+// Orphans lists entries that neither link to nor are linked from any other entry. When typ is
+// empty every ledger is scanned. Entries the view hides are not listed.
+func (s *LedgerStore) Orphans(typ LedgerType, view *Visibility) []GraphNode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	referenced := make(map[entryRef]struct{})
+	for _, other := range s.ledgerTypeOrder {
+		for _, entry := range s.entries[other] {
+			for target, ids := range entry.Links {
+				for _, id := range ids {
+					referenced[entryRef{target, id}] = struct{}{}
+				}
+			}
+		}
+	}
+	out := make([]GraphNode, 0)
+	for _, other := range s.ledgerTypeOrder {
+		if typ != "" && other != typ {
+			continue
+		}
+		for _, entry := range s.entries[other] {
+			if view.Hidden(other, entry.ID) {
+				continue
+			}
+			if _, ok := referenced[entryRef{other, entry.ID}]; ok || s.linksExistingEntryLocked(entry) {
+				continue
+			}
+			out = append(out, GraphNode{Key: GraphKey(other, entry.ID), Type: other, ID: entry.ID, Name: entry.Name})
+		}
+	}
+	return out
+}
+
+func (s *LedgerStore) linksExistingEntryLocked(entry LedgerEntry) bool {
+	for target, ids := range entry.Links {
+		for _, id := range ids {
+			if s.entryIndexLocked(target, id) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGraphImpactAndPath(t *testing.T) {
+	store := newTestStore(t)
+
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "张三"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	ip, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "10.1.2.3", Links: map[LedgerType][]string{LedgerTypeSystem: {erp.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create ip: %v", err)
+	}
+	lonely, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateRelationship(Relationship{Role: RoleOwner, FromType: LedgerTypePersonnel, FromID: alice.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester"); err != nil {
+		t.Fatalf("create relationship: %v", err)
+	}
+
+	report, err := store.Impact(LedgerTypeIP, "10.1.2.3", 0, nil, nil)
+	if err != nil {
+		t.Fatalf("impact: %v", err)
+	}
+	if report.Root.ID != ip.ID || report.Total != 2 {
+		t.Fatalf("unexpected impact report: %+v", report)
+	}
+	if got := report.Affected[LedgerTypePersonnel]; len(got) != 1 || got[0].ID != alice.ID || got[0].Depth != 2 {
+		t.Fatalf("expected alice at depth 2, got %+v", got)
+	}
+
+	graph, err := store.Traverse(LedgerTypeIP, ip.ID, 1, nil)
+	if err != nil {
+		t.Fatalf("traverse: %v", err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 {
+		t.Fatalf("expected one hop neighbourhood, got %+v", graph)
+	}
+
+	path, err := store.ShortestPath(LedgerTypeIP, ip.ID, LedgerTypePersonnel, alice.ID, nil)
+	if err != nil {
+		t.Fatalf("shortest path: %v", err)
+	}
+	if len(path.Nodes) != 3 || len(path.Edges) != 2 || len(path.Edges[1].Roles) != 1 || path.Edges[1].Roles[0] != string(RoleOwner) {
+		t.Fatalf("unexpected path: %+v", path)
+	}
+	if _, err := store.ShortestPath(LedgerTypeIP, ip.ID, LedgerTypeSystem, lonely.ID, nil); !errors.Is(err, ErrNoPath) {
+		t.Fatalf("expected no path, got %v", err)
+	}
+
+	orphans := store.Orphans("", nil)
+	if len(orphans) != 1 || orphans[0].ID != lonely.ID {
+		t.Fatalf("expected OA to be the only orphan, got %+v", orphans)
+	}
+}
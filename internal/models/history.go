@@ -1,62 +1,425 @@
 package models
 
-type storeSnapshot struct {
-	entries map[LedgerType][]LedgerEntry
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUndoConflict indicates an operation cannot be undone or redone because someone changed
+// the same records afterwards.
+var ErrUndoConflict = errors.New("undo_conflict")
+
+// defaultUndoLimit is how many operations each user can step back through.
+const defaultUndoLimit = 50
+
+// UndoConflictError lists the records that changed since the operation being undone or redone.
+type UndoConflictError struct {
+	Records []string `json:"records"`
+}
+
+func (e *UndoConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrUndoConflict.Error(), strings.Join(e.Records, ", "))
+}
+
+// Unwrap allows errors.Is(err, ErrUndoConflict).
+func (e *UndoConflictError) Unwrap() error {
+	return ErrUndoConflict
+}
+
+// pendingChanges holds, for every record the mutation in progress has touched, the state it
+// had before the first touch. commitLocked turns it into the mutation's operation.
+type pendingChanges struct {
+	entries           map[entryRef]*LedgerEntry
+	entryOrder        []entryRef
+	relationships     map[string]*Relationship
+	relationshipOrder []string
 }
 
-type historyStack struct {
-	states []storeSnapshot
-	future []storeSnapshot
-	limit  int
+type entryChange struct {
+	typ    LedgerType
+	id     string
+	before *LedgerEntry
+	after  *LedgerEntry
 }
 
-func (h *historyStack) Reset(snapshot storeSnapshot) {
-	h.states = []storeSnapshot{snapshot}
-	h.future = nil
+// moved reports whether the change itself gave the entry a new position.
+func (c entryChange) moved() bool {
+	return c.before != nil && c.after != nil && c.before.Order != c.after.Order
 }
 
-func (h *historyStack) Push(snapshot storeSnapshot) {
-	h.states = append(h.states, snapshot)
-	if h.limit > 0 && len(h.states) > h.limit {
-		h.states = h.states[1:]
+// matches reports whether live still holds what the change left behind. Only content fields
+// count, plus the position when the change moved the entry: deletes renumber the rest of the
+// ledger, which must not block unrelated undos.
+func (c entryChange) matches(live LedgerEntry) bool {
+	if !reflect.DeepEqual(flattenEntry(*c.after), flattenEntry(live)) {
+		return false
 	}
-	h.future = nil
+	return !c.moved() || c.after.Order == live.Order
 }
 
-func (h *historyStack) Current() storeSnapshot {
-	if len(h.states) == 0 {
-		return storeSnapshot{}
+type relationshipChange struct {
+	id     string
+	before *Relationship
+	after  *Relationship
+}
+
+type workspaceChange struct {
+	id     string
+	before *Workspace
+	after  *Workspace
+}
+
+// operation is one undoable mutation, stored as the before and after state of every record
+// it touched so it can be inverted without rewinding anyone else's work.
+type operation struct {
+	at            time.Time
+	entries       []entryChange
+	relationships []relationshipChange
+	workspaces    []workspaceChange
+}
+
+func (op operation) empty() bool {
+	return len(op.entries) == 0 && len(op.relationships) == 0 && len(op.workspaces) == 0
+}
+
+// inverse swaps before and after so the same apply logic serves undo and redo.
+func (op operation) inverse() operation {
+	inverted := operation{at: op.at}
+	for _, change := range op.entries {
+		inverted.entries = append(inverted.entries, entryChange{typ: change.typ, id: change.id, before: change.after, after: change.before})
+	}
+	for _, change := range op.relationships {
+		inverted.relationships = append(inverted.relationships, relationshipChange{id: change.id, before: change.after, after: change.before})
 	}
-	return h.states[len(h.states)-1]
+	for _, change := range op.workspaces {
+		inverted.workspaces = append(inverted.workspaces, workspaceChange{id: change.id, before: change.after, after: change.before})
+	}
+	return inverted
+}
+
+type userHistory struct {
+	undo []operation
+	redo []operation
+}
+
+// operationJournal keeps a separate undo and redo stack per user.
+type operationJournal struct {
+	users map[string]*userHistory
+	limit int
 }
 
-func (h *historyStack) Undo() (storeSnapshot, error) {
-	if len(h.states) <= 1 {
-		return storeSnapshot{}, ErrUndoUnavailable
+func (j *operationJournal) Reset() {
+	j.users = make(map[string]*userHistory)
+}
+
+func (j *operationJournal) user(actor string) *userHistory {
+	if j.users == nil {
+		j.users = make(map[string]*userHistory)
 	}
-	current := h.states[len(h.states)-1]
-	h.states = h.states[:len(h.states)-1]
-	h.future = append([]storeSnapshot{current}, h.future...)
-	return h.states[len(h.states)-1], nil
+	history, ok := j.users[actor]
+	if !ok {
+		history = &userHistory{}
+		j.users[actor] = history
+	}
+	return history
 }
 
-func (h *historyStack) Redo() (storeSnapshot, error) {
-	if len(h.future) == 0 {
-		return storeSnapshot{}, ErrRedoUnavailable
+// Record pushes a new operation for actor and clears that user's redo stack.
+func (j *operationJournal) Record(actor string, op operation) {
+	if op.empty() {
+		return
+	}
+	history := j.user(actor)
+	history.undo = append(history.undo, op)
+	if j.limit > 0 && len(history.undo) > j.limit {
+		history.undo = history.undo[len(history.undo)-j.limit:]
 	}
-	next := h.future[0]
-	h.future = h.future[1:]
-	h.states = append(h.states, next)
-	if h.limit > 0 && len(h.states) > h.limit {
-		h.states = h.states[1:]
+	history.redo = nil
+}
+
+func (j *operationJournal) Depth(actor string) (int, int) {
+	history, ok := j.users[actor]
+	if !ok {
+		return 0, 0
 	}
-	return next, nil
+	return len(history.undo), len(history.redo)
 }
 
-func (h *historyStack) CanUndo() bool {
-	return len(h.states) > 1
+func entryPointer(entry LedgerEntry) *LedgerEntry {
+	clone := entry.Clone()
+	return &clone
 }
 
-func (h *historyStack) CanRedo() bool {
-	return len(h.future) > 0
+// touchEntryLocked remembers the entry's current state, or its absence, before a mutation
+// changes it. Only the first touch per commit counts.
+func (s *LedgerStore) touchEntryLocked(typ LedgerType, id string) {
+	ref := entryRef{typ, id}
+	if _, ok := s.pending.entries[ref]; ok {
+		return
+	}
+	if s.pending.entries == nil {
+		s.pending.entries = make(map[entryRef]*LedgerEntry)
+	}
+	var before *LedgerEntry
+	if idx := s.entryIndexLocked(typ, id); idx >= 0 {
+		before = entryPointer(s.entries[typ][idx])
+	}
+	s.pending.entries[ref] = before
+	s.pending.entryOrder = append(s.pending.entryOrder, ref)
+}
+
+// touchRelationshipLocked is touchEntryLocked for relationship edges.
+func (s *LedgerStore) touchRelationshipLocked(id string) {
+	if _, ok := s.pending.relationships[id]; ok {
+		return
+	}
+	if s.pending.relationships == nil {
+		s.pending.relationships = make(map[string]*Relationship)
+	}
+	var before *Relationship
+	if idx := s.relationshipIndexLocked(id); idx >= 0 {
+		clone := s.relationships[idx].Clone()
+		before = &clone
+	}
+	s.pending.relationships[id] = before
+	s.pending.relationshipOrder = append(s.pending.relationshipOrder, id)
+}
+
+// pendingOperationLocked pairs the touched records' earlier state with their live state,
+// leaving out those that ended up unchanged, and starts the next operation afresh.
+func (s *LedgerStore) pendingOperationLocked() operation {
+	op := operation{at: time.Now().UTC()}
+	for _, ref := range s.pending.entryOrder {
+		before := s.pending.entries[ref]
+		var after *LedgerEntry
+		if idx := s.entryIndexLocked(ref.typ, ref.id); idx >= 0 {
+			after = entryPointer(s.entries[ref.typ][idx])
+		}
+		if (before == nil && after == nil) || (before != nil && after != nil && reflect.DeepEqual(*before, *after)) {
+			continue
+		}
+		op.entries = append(op.entries, entryChange{typ: ref.typ, id: ref.id, before: before, after: after})
+	}
+	for _, id := range s.pending.relationshipOrder {
+		before := s.pending.relationships[id]
+		var after *Relationship
+		if idx := s.relationshipIndexLocked(id); idx >= 0 {
+			clone := s.relationships[idx].Clone()
+			after = &clone
+		}
+		if (before == nil && after == nil) || (before != nil && after != nil && reflect.DeepEqual(*before, *after)) {
+			continue
+		}
+		op.relationships = append(op.relationships, relationshipChange{id: id, before: before, after: after})
+	}
+	s.pending = pendingChanges{}
+	return op
+}
+
+// conflictsLocked reports records whose live state no longer matches the state the operation
+// left them in.
+func (s *LedgerStore) conflictsLocked(op operation) []string {
+	conflicts := make([]string, 0)
+	for _, change := range op.entries {
+		idx := s.entryIndexLocked(change.typ, change.id)
+		switch {
+		case change.after == nil && idx >= 0,
+			change.after != nil && idx < 0,
+			change.after != nil && !change.matches(s.entries[change.typ][idx]):
+			conflicts = append(conflicts, entryRevisionKey(change.typ, change.id))
+		}
+	}
+	for _, change := range op.relationships {
+		var current *Relationship
+		if idx := s.relationshipIndexLocked(change.id); idx >= 0 {
+			current = &s.relationships[idx]
+		}
+		if (change.after == nil) != (current == nil) || (current != nil && !reflect.DeepEqual(*change.after, *current)) {
+			conflicts = append(conflicts, "relationship:"+change.id)
+		}
+	}
+	for _, change := range op.workspaces {
+		current := s.workspaces[change.id]
+		if (change.after == nil) != (current == nil) || (current != nil && !sameWorkspaceContent(change.after, current)) {
+			conflicts = append(conflicts, workspaceRevisionKey(change.id))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// applyOperationLocked moves every record of op to its before state. Records it removes go to
+// the trash and records it brings back are taken out of it.
+func (s *LedgerStore) applyOperationLocked(op operation, actor string) {
+	reordered := make(map[LedgerType]struct{})
+	for _, change := range op.entries {
+		idx := s.entryIndexLocked(change.typ, change.id)
+		switch {
+		case change.before == nil && idx >= 0:
+			items := s.entries[change.typ]
+			s.trashEntryLocked(change.typ, items[idx], actor)
+			s.entries[change.typ] = append(items[:idx], items[idx+1:]...)
+			s.reindexLedgerLocked(change.typ)
+			reordered[change.typ] = struct{}{}
+		case change.before != nil && idx >= 0:
+			restored := change.before.Clone()
+			if change.moved() {
+				reordered[change.typ] = struct{}{}
+			} else {
+				// Keep the place later deletes compacted the entry to.
+				restored.Order = s.entries[change.typ][idx].Order
+			}
+			s.entries[change.typ][idx] = restored
+		case change.before != nil:
+			// Put the entry back where it was; the ledger is renumbered below.
+			items := s.entries[change.typ]
+			pos := change.before.Order
+			if pos < 0 || pos > len(items) {
+				pos = len(items)
+			}
+			items = append(items, LedgerEntry{})
+			copy(items[pos+1:], items[pos:])
+			items[pos] = change.before.Clone()
+			s.entries[change.typ] = items
+			s.reindexLedgerLocked(change.typ)
+			s.dropTrashLocked(TrashKindEntry, change.typ, change.id)
+			reordered[change.typ] = struct{}{}
+		}
+	}
+	for typ := range reordered {
+		items := s.entries[typ]
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Order < items[j].Order })
+		for i := range items {
+			items[i].Order = i
+		}
+		s.reindexLedgerLocked(typ)
+	}
+	for _, change := range op.relationships {
+		idx := s.relationshipIndexLocked(change.id)
+		switch {
+		case change.before == nil && idx >= 0:
+			s.relationships = append(s.relationships[:idx], s.relationships[idx+1:]...)
+		case change.before != nil && idx >= 0:
+			s.relationships[idx] = change.before.Clone()
+		case change.before != nil:
+			s.relationships = append(s.relationships, change.before.Clone())
+		}
+	}
+	for _, change := range op.workspaces {
+		current, exists := s.workspaces[change.id]
+		switch {
+		case change.before == nil && exists:
+			s.trashWorkspacesLocked([]*Workspace{current}, actor)
+		case change.before != nil && !exists:
+			s.dropTrashLocked(TrashKindWorkspace, "", change.id)
+		}
+		s.setWorkspaceLocked(change.id, change.before)
+	}
+}
+
+// setWorkspaceLocked replaces, restores or removes a single workspace, keeping the order and
+// parent/child indexes in step.
+func (s *LedgerStore) setWorkspaceLocked(id string, ws *Workspace) {
+	current, exists := s.workspaces[id]
+	if exists {
+		s.removeWorkspaceChildLocked(current.ParentID, id)
+	}
+	if ws == nil {
+		delete(s.workspaces, id)
+		delete(s.workspaceChildren, id)
+		filtered := s.workspaceOrder[:0]
+		for _, existing := range s.workspaceOrder {
+			if existing != id {
+				filtered = append(filtered, existing)
+			}
+		}
+		s.workspaceOrder = filtered
+		s.unindexWorkspacesLocked([]string{id})
+		return
+	}
+	restored := ws.Clone()
+	if exists {
+		// Keep versions moving forward so editors holding the reverted version get a conflict.
+		restored.Version = current.Version + 1
+	}
+	restored.UpdatedAt = time.Now().UTC()
+	s.workspaces[id] = restored
+	if !exists {
+		s.workspaceOrder = append(s.workspaceOrder, id)
+	}
+	s.addWorkspaceChildLocked(restored.ParentID, id)
+	s.indexWorkspaceLocked(restored)
+}
+
+// sameWorkspaceContent compares two workspaces ignoring Version and UpdatedAt, which undo and
+// redo bump when restoring content.
+func sameWorkspaceContent(a, b *Workspace) bool {
+	left, right := a.Clone(), b.Clone()
+	left.Version, right.Version = 0, 0
+	left.UpdatedAt, right.UpdatedAt = time.Time{}, time.Time{}
+	return reflect.DeepEqual(left, right)
+}
+
+// workspaceChangedLocked records a workspace mutation made by actor in the search index, the
+// revision history and the actor's undo stack. before is nil for creations and after is nil
+// for deletions.
+func (s *LedgerStore) workspaceChangedLocked(actor string, changes ...workspaceChange) {
+	op := operation{at: time.Now().UTC()}
+	for _, change := range changes {
+		if change.after == nil {
+			s.unindexWorkspacesLocked([]string{change.id})
+			s.recordWorkspaceDeletionLocked([]string{change.id}, actor)
+		} else {
+			change.after = change.after.Clone()
+			s.indexWorkspaceLocked(change.after)
+			s.recordWorkspaceRevisionLocked(change.after, actor)
+		}
+		op.workspaces = append(op.workspaces, change)
+	}
+	s.journal.Record(actor, op)
+}
+
+// stepLocked pops the newest operation from one of actor's stacks, checks nobody changed its
+// records since, applies it and pushes its inverse onto the other stack.
+func (s *LedgerStore) stepLocked(actor string, redo bool) error {
+	history := s.journal.user(actor)
+	from, to := &history.undo, &history.redo
+	unavailable := ErrUndoUnavailable
+	if redo {
+		from, to = &history.redo, &history.undo
+		unavailable = ErrRedoUnavailable
+	}
+	if len(*from) == 0 {
+		return unavailable
+	}
+	op := (*from)[len(*from)-1]
+	if conflicts := s.conflictsLocked(op); len(conflicts) > 0 {
+		return &UndoConflictError{Records: conflicts}
+	}
+	*from = (*from)[:len(*from)-1]
+	s.applyOperationLocked(op, actor)
+	*to = append(*to, op.inverse())
+
+	action := "undo"
+	if redo {
+		action = "redo"
+	}
+	for _, change := range op.workspaces {
+		if change.before == nil {
+			s.recordWorkspaceDeletionLocked([]string{change.id}, actor)
+		} else {
+			s.recordWorkspaceRevisionLocked(s.workspaces[change.id], actor)
+		}
+	}
+	s.pruneRelationshipsLocked()
+	s.indexEntriesLocked(op.entries)
+	s.recordEntryRevisionsLocked(op.entries, actor)
+	// The step is already on the other stack; edges pruned by it are not a new operation.
+	s.pending = pendingChanges{}
+	s.appendAuditLocked(actor, action, fmt.Sprintf("entries=%d workspaces=%d relationships=%d", len(op.entries), len(op.workspaces), len(op.relationships)))
+	return nil
 }
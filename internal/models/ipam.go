@@ -0,0 +1,474 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrIPAddressInvalid indicates an IP ledger entry carries an unparseable address, range or CIDR.
+	ErrIPAddressInvalid = errors.New("ip_address_invalid")
+	// ErrIPConflict indicates an address assignment duplicates or overlaps an existing one.
+	ErrIPConflict = errors.New("ip_conflict")
+	// ErrIPNotSubnet indicates the referenced IP ledger entry is not a CIDR block.
+	ErrIPNotSubnet = errors.New("ip_not_subnet")
+	// ErrIPSubnetExhausted indicates a subnet has no unassigned host addresses left.
+	ErrIPSubnetExhausted = errors.New("ip_subnet_exhausted")
+)
+
+// IPAddressAttribute is the attribute key holding the typed address of an IP ledger entry.
+const IPAddressAttribute = "address"
+
+// IPBlockKind classifies how an IP ledger entry occupies address space.
+type IPBlockKind string
+
+const (
+	// IPBlockHost is a single assigned address.
+	IPBlockHost IPBlockKind = "host"
+	// IPBlockRange is an inclusive first-last address range, typically a pool.
+	IPBlockRange IPBlockKind = "range"
+	// IPBlockSubnet is a CIDR block that contains hosts, ranges and nested subnets.
+	IPBlockSubnet IPBlockKind = "subnet"
+)
+
+type ipBlock struct {
+	kind   IPBlockKind
+	prefix netip.Prefix
+	first  netip.Addr
+	last   netip.Addr
+}
+
+// String renders the block in its canonical notation.
+func (b ipBlock) String() string {
+	switch b.kind {
+	case IPBlockSubnet:
+		return b.prefix.String()
+	case IPBlockRange:
+		return b.first.String() + "-" + b.last.String()
+	default:
+		return b.first.String()
+	}
+}
+
+func (b ipBlock) contains(other ipBlock) bool {
+	return b.first.BitLen() == other.first.BitLen() && b.first.Compare(other.first) <= 0 && b.last.Compare(other.last) >= 0
+}
+
+func (b ipBlock) overlaps(other ipBlock) bool {
+	return b.first.BitLen() == other.first.BitLen() && b.first.Compare(other.last) <= 0 && other.first.Compare(b.last) <= 0
+}
+
+// parseIPBlock accepts a single address, an inclusive "first-last" range or a CIDR block.
+// Interface notation such as 10.1.2.3/24 is treated as the host address 10.1.2.3.
+func parseIPBlock(value string) (ipBlock, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return ipBlock{}, ErrIPAddressInvalid
+	}
+	if first, last, ok := strings.Cut(trimmed, "-"); ok {
+		start, err := netip.ParseAddr(strings.TrimSpace(first))
+		if err != nil {
+			return ipBlock{}, ErrIPAddressInvalid
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(last))
+		if err != nil {
+			return ipBlock{}, ErrIPAddressInvalid
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.BitLen() != end.BitLen() || end.Less(start) {
+			return ipBlock{}, ErrIPAddressInvalid
+		}
+		if start == end {
+			return ipBlock{kind: IPBlockHost, prefix: netip.PrefixFrom(start, start.BitLen()), first: start, last: end}, nil
+		}
+		return ipBlock{kind: IPBlockRange, first: start, last: end}, nil
+	}
+	if strings.Contains(trimmed, "/") {
+		prefix, err := netip.ParsePrefix(trimmed)
+		if err != nil {
+			return ipBlock{}, ErrIPAddressInvalid
+		}
+		addr := prefix.Addr().Unmap()
+		bits := prefix.Bits()
+		if prefix.Addr().Is4In6() {
+			bits -= 96
+		}
+		prefix = netip.PrefixFrom(addr, bits)
+		if bits == addr.BitLen() || prefix.Masked().Addr() != addr {
+			return ipBlock{kind: IPBlockHost, prefix: netip.PrefixFrom(addr, addr.BitLen()), first: addr, last: addr}, nil
+		}
+		return ipBlock{kind: IPBlockSubnet, prefix: prefix, first: addr, last: lastAddr(prefix)}, nil
+	}
+	addr, err := netip.ParseAddr(trimmed)
+	if err != nil {
+		return ipBlock{}, ErrIPAddressInvalid
+	}
+	addr = addr.Unmap()
+	return ipBlock{kind: IPBlockHost, prefix: netip.PrefixFrom(addr, addr.BitLen()), first: addr, last: addr}, nil
+}
+
+// NormaliseIPAddress returns the canonical notation of an address, range or CIDR block and
+// whether the value parsed as one.
+func NormaliseIPAddress(value string) (string, bool) {
+	block, err := parseIPBlock(value)
+	if err != nil {
+		return "", false
+	}
+	return block.String(), true
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Masked().Addr().AsSlice()
+	hostBits := len(bytes)*8 - prefix.Bits()
+	for i := len(bytes) - 1; i >= 0 && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			bytes[i] = 0xff
+			hostBits -= 8
+			continue
+		}
+		bytes[i] |= byte(1<<hostBits) - 1
+		hostBits = 0
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// addrSpan returns the number of addresses in [first, last], saturating at MaxUint64.
+func addrSpan(first, last netip.Addr) uint64 {
+	a := new(big.Int).SetBytes(first.AsSlice())
+	b := new(big.Int).SetBytes(last.AsSlice())
+	diff := b.Sub(b, a)
+	diff.Add(diff, big.NewInt(1))
+	if !diff.IsUint64() {
+		return math.MaxUint64
+	}
+	return diff.Uint64()
+}
+
+// usableHosts returns the first and last assignable addresses of a subnet, skipping the
+// IPv4 network and broadcast addresses where the block is large enough to have them.
+func usableHosts(block ipBlock) (netip.Addr, netip.Addr) {
+	first, last := block.first, block.last
+	if first.Is4() && block.prefix.Bits() < 31 {
+		first = first.Next()
+		last = last.Prev()
+	}
+	return first, last
+}
+
+// entryIPBlock resolves the typed address of an IP ledger entry. The address attribute is
+// authoritative; entries without one fall back to their name when it parses as an address.
+func entryIPBlock(entry LedgerEntry) (ipBlock, bool, error) {
+	if raw, ok := entry.Attributes[IPAddressAttribute]; ok && strings.TrimSpace(raw) != "" {
+		block, err := parseIPBlock(raw)
+		if err != nil {
+			return ipBlock{}, false, fmt.Errorf("%w: %s", ErrIPAddressInvalid, raw)
+		}
+		return block, true, nil
+	}
+	if block, err := parseIPBlock(entry.Name); err == nil {
+		return block, true, nil
+	}
+	return ipBlock{}, false, nil
+}
+
+// IPEntryRef identifies an IP ledger entry involved in an allocation report.
+type IPEntryRef struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Address string      `json:"address"`
+	Kind    IPBlockKind `json:"kind"`
+}
+
+// IPConflictError describes the entries an address assignment collides with.
+type IPConflictError struct {
+	Address   string       `json:"address"`
+	Conflicts []IPEntryRef `json:"conflicts"`
+}
+
+func (e *IPConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrIPConflict.Error(), e.Address)
+}
+
+// Unwrap allows errors.Is(err, ErrIPConflict).
+func (e *IPConflictError) Unwrap() error {
+	return ErrIPConflict
+}
+
+// IPConflict reports a pair of IP ledger entries that duplicate or overlap each other.
+type IPConflict struct {
+	Reason  string       `json:"reason"`
+	Entries []IPEntryRef `json:"entries"`
+}
+
+// IPSubnetUsage summarises allocation within a CIDR block of the IP ledger.
+type IPSubnetUsage struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Subnet      string  `json:"subnet"`
+	ParentID    string  `json:"parent_id,omitempty"`
+	Capacity    uint64  `json:"capacity"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	Utilisation float64 `json:"utilisation"`
+	Hosts       int     `json:"hosts"`
+	Ranges      int     `json:"ranges"`
+	Subnets     int     `json:"subnets"`
+}
+
+type ipIndexed struct {
+	entry LedgerEntry
+	block ipBlock
+}
+
+func ipRef(item ipIndexed) IPEntryRef {
+	return IPEntryRef{ID: item.entry.ID, Name: item.entry.Name, Address: item.block.String(), Kind: item.block.kind}
+}
+
+// ipCollides reports whether two blocks cannot coexist: identical subnets, or any overlap
+// between host and range assignments. Subnets nesting inside each other, and assignments
+// inside subnets, are the normal parent/child relationship.
+func ipCollides(a, b ipBlock) (string, bool) {
+	if a.kind == IPBlockSubnet || b.kind == IPBlockSubnet {
+		if a.kind == b.kind && a.prefix == b.prefix {
+			return "duplicate", true
+		}
+		return "", false
+	}
+	if !a.overlaps(b) {
+		return "", false
+	}
+	if a.first == b.first && a.last == b.last {
+		return "duplicate", true
+	}
+	return "overlap", true
+}
+
+func (s *LedgerStore) indexIPEntriesLocked(skip map[string]struct{}) []ipIndexed {
+	items := s.entries[LedgerTypeIP]
+	out := make([]ipIndexed, 0, len(items))
+	for _, entry := range items {
+		if _, ok := skip[entry.ID]; ok {
+			continue
+		}
+		block, ok, err := entryIPBlock(entry)
+		if err != nil || !ok {
+			continue
+		}
+		out = append(out, ipIndexed{entry: entry, block: block})
+	}
+	return out
+}
+
+// prepareIPEntriesLocked canonicalises the address attribute of each candidate and rejects
+// invalid values or collisions with existing entries (other than those being replaced) and
+// with each other.
+func (s *LedgerStore) prepareIPEntriesLocked(candidates []LedgerEntry) error {
+	skip := make(map[string]struct{}, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.ID != "" {
+			skip[candidate.ID] = struct{}{}
+		}
+	}
+	return prepareIPEntries(candidates, s.indexIPEntriesLocked(skip))
+}
+
+// prepareIPEntries canonicalises the address attribute of each candidate and rejects invalid
+// values or collisions with existing or with each other.
+func prepareIPEntries(candidates []LedgerEntry, existing []ipIndexed) error {
+	for i := range candidates {
+		block, ok, err := entryIPBlock(candidates[i])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, explicit := candidates[i].Attributes[IPAddressAttribute]; explicit {
+			candidates[i].Attributes[IPAddressAttribute] = block.String()
+		}
+		var conflicts []IPEntryRef
+		for _, other := range existing {
+			if _, collides := ipCollides(block, other.block); collides {
+				conflicts = append(conflicts, ipRef(other))
+			}
+		}
+		if len(conflicts) > 0 {
+			return &IPConflictError{Address: block.String(), Conflicts: conflicts}
+		}
+		existing = append(existing, ipIndexed{entry: candidates[i], block: block})
+	}
+	return nil
+}
+
+// IPConflicts scans the IP ledger for duplicate or overlapping assignments, such as those
+// introduced by whole-ledger replacement or snapshot imports.
+func (s *LedgerStore) IPConflicts() []IPConflict {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	indexed := s.indexIPEntriesLocked(nil)
+	sortIPIndexed(indexed)
+	conflicts := make([]IPConflict, 0)
+	for i := range indexed {
+		for j := i + 1; j < len(indexed); j++ {
+			if indexed[j].block.first.BitLen() != indexed[i].block.first.BitLen() || indexed[i].block.last.Less(indexed[j].block.first) {
+				break
+			}
+			if reason, collides := ipCollides(indexed[i].block, indexed[j].block); collides {
+				conflicts = append(conflicts, IPConflict{Reason: reason, Entries: []IPEntryRef{ipRef(indexed[i]), ipRef(indexed[j])}})
+			}
+		}
+	}
+	return conflicts
+}
+
+func sortIPIndexed(items []ipIndexed) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].block, items[j].block
+		if a.first.BitLen() != b.first.BitLen() {
+			return a.first.BitLen() < b.first.BitLen()
+		}
+		if c := a.first.Compare(b.first); c != 0 {
+			return c < 0
+		}
+		return b.last.Less(a.last)
+	})
+}
+
+// IPSubnets returns utilisation for every CIDR block in the IP ledger, ordered by address,
+// with ParentID pointing at the smallest enclosing subnet.
+func (s *LedgerStore) IPSubnets() []IPSubnetUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	indexed := s.indexIPEntriesLocked(nil)
+	sortIPIndexed(indexed)
+
+	subnets := make([]ipIndexed, 0)
+	assignments := make([]ipIndexed, 0)
+	for _, item := range indexed {
+		if item.block.kind == IPBlockSubnet {
+			subnets = append(subnets, item)
+		} else {
+			assignments = append(assignments, item)
+		}
+	}
+
+	out := make([]IPSubnetUsage, 0, len(subnets))
+	for i, subnet := range subnets {
+		usage := IPSubnetUsage{ID: subnet.entry.ID, Name: subnet.entry.Name, Subnet: subnet.block.String()}
+		parentBits := -1
+		for j, candidate := range subnets {
+			if i == j || candidate.block.prefix.Bits() >= subnet.block.prefix.Bits() {
+				continue
+			}
+			if candidate.block.contains(subnet.block) && candidate.block.prefix.Bits() > parentBits {
+				parentBits = candidate.block.prefix.Bits()
+				usage.ParentID = candidate.entry.ID
+			}
+		}
+		for j, candidate := range subnets {
+			if i != j && subnet.block.contains(candidate.block) && candidate.block.prefix.Bits() > subnet.block.prefix.Bits() {
+				usage.Subnets++
+			}
+		}
+		first, last := usableHosts(subnet.block)
+		usage.Capacity = addrSpan(first, last)
+
+		var cursor netip.Addr
+		for _, assignment := range assignments {
+			if !subnet.block.overlaps(assignment.block) {
+				continue
+			}
+			if assignment.block.kind == IPBlockRange {
+				usage.Ranges++
+			} else {
+				usage.Hosts++
+			}
+			start, end := assignment.block.first, assignment.block.last
+			if start.Less(first) {
+				start = first
+			}
+			if last.Less(end) {
+				end = last
+			}
+			if cursor.IsValid() && !cursor.Less(start) {
+				start = cursor
+			}
+			if end.Less(start) {
+				continue
+			}
+			usage.Used = saturatingAdd(usage.Used, addrSpan(start, end))
+			cursor = end.Next()
+			if !cursor.IsValid() {
+				break
+			}
+		}
+		if usage.Used > usage.Capacity {
+			usage.Used = usage.Capacity
+		}
+		usage.Free = usage.Capacity - usage.Used
+		if usage.Capacity > 0 {
+			usage.Utilisation = math.Round(float64(usage.Used)/float64(usage.Capacity)*10000) / 100
+		}
+		out = append(out, usage)
+	}
+	return out
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// NextFreeIP returns the lowest host address inside the subnet entry that is not covered by
+// any host or range assignment in the IP ledger.
+func (s *LedgerStore) NextFreeIP(subnetID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var subnet *ipIndexed
+	indexed := s.indexIPEntriesLocked(nil)
+	for i := range indexed {
+		if indexed[i].entry.ID == subnetID {
+			subnet = &indexed[i]
+			break
+		}
+	}
+	if subnet == nil {
+		if s.entryIndexLocked(LedgerTypeIP, subnetID) >= 0 {
+			return "", ErrIPNotSubnet
+		}
+		return "", ErrEntryNotFound
+	}
+	if subnet.block.kind != IPBlockSubnet {
+		return "", ErrIPNotSubnet
+	}
+	sortIPIndexed(indexed)
+	first, last := usableHosts(subnet.block)
+	cursor := first
+	for _, item := range indexed {
+		if item.block.kind == IPBlockSubnet || !subnet.block.overlaps(item.block) {
+			continue
+		}
+		if item.block.last.Less(cursor) {
+			continue
+		}
+		if cursor.Less(item.block.first) {
+			break
+		}
+		cursor = item.block.last.Next()
+		if !cursor.IsValid() {
+			return "", ErrIPSubnetExhausted
+		}
+	}
+	if last.Less(cursor) {
+		return "", ErrIPSubnetExhausted
+	}
+	return cursor.String(), nil
+}
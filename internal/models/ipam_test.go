@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIPLedgerRejectsConflicts(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "办公网", Attributes: map[string]string{"address": "10.1.0.0/16"}}, "tester"); err != nil {
+		t.Fatalf("create subnet: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "服务器段", Attributes: map[string]string{"address": "10.1.2.0/24"}}, "tester"); err != nil {
+		t.Fatalf("create nested subnet: %v", err)
+	}
+	gateway, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "网关", Attributes: map[string]string{"address": " 10.1.2.1 "}}, "tester")
+	if err != nil {
+		t.Fatalf("create host: %v", err)
+	}
+	if got := gateway.Attributes["address"]; got != "10.1.2.1" {
+		t.Fatalf("expected canonical address, got %q", got)
+	}
+
+	var conflict *IPConflictError
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "重复", Attributes: map[string]string{"address": "10.1.2.1"}}, "tester"); !errors.As(err, &conflict) {
+		t.Fatalf("expected duplicate host conflict, got %v", err)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].ID != gateway.ID {
+		t.Fatalf("expected conflict to reference gateway, got %+v", conflict.Conflicts)
+	}
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "地址池", Attributes: map[string]string{"address": "10.1.2.0-10.1.2.10"}}, "tester"); !errors.Is(err, ErrIPConflict) {
+		t.Fatalf("expected range overlapping host to conflict, got %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "重复网段", Attributes: map[string]string{"address": "10.1.2.0/24"}}, "tester"); !errors.Is(err, ErrIPConflict) {
+		t.Fatalf("expected duplicate subnet conflict, got %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "错误", Attributes: map[string]string{"address": "10.1.2.300"}}, "tester"); !errors.Is(err, ErrIPAddressInvalid) {
+		t.Fatalf("expected invalid address error, got %v", err)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypeIP, gateway.ID, LedgerEntry{Description: "核心网关"}, "tester"); err != nil {
+		t.Fatalf("updating an entry must not conflict with itself: %v", err)
+	}
+	if _, err := store.AppendEntries(LedgerTypeIP, []LedgerEntry{
+		{Name: "a", Attributes: map[string]string{"address": "10.1.2.20"}},
+		{Name: "b", Attributes: map[string]string{"address": "10.1.2.20"}},
+	}, "tester"); !errors.Is(err, ErrIPConflict) {
+		t.Fatalf("expected conflict within appended batch, got %v", err)
+	}
+	if got := len(store.ListEntries(LedgerTypeIP)); got != 3 {
+		t.Fatalf("expected rejected batch to leave ledger untouched, got %d entries", got)
+	}
+
+	if err := store.ReplaceEntries(LedgerTypeIP, []LedgerEntry{
+		{ID: "ip-a", Name: "a", Attributes: map[string]string{"address": "10.2.0.1"}},
+		{ID: "ip-b", Name: "b", Attributes: map[string]string{"address": "10.2.0.0-10.2.0.9"}},
+	}, "tester"); !errors.Is(err, ErrIPConflict) {
+		t.Fatalf("expected conflict within replacement batch, got %v", err)
+	}
+	if err := store.ReplaceEntries(LedgerTypeIP, []LedgerEntry{
+		{ID: gateway.ID, Name: "网关", Attributes: map[string]string{"address": " 10.1.2.1 "}},
+		{ID: "ip-b", Name: "b", Attributes: map[string]string{"address": "10.1.2.0/24"}},
+	}, "tester"); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if entry, err := store.GetEntry(LedgerTypeIP, gateway.ID); err != nil || entry.Attributes["address"] != "10.1.2.1" {
+		t.Fatalf("expected replaced addresses to be canonical, got %+v (%v)", entry, err)
+	}
+}
+
+func TestIPSubnetUsageAndNextFree(t *testing.T) {
+	store := newTestStore(t)
+
+	parent, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "总部", Attributes: map[string]string{"address": "192.168.0.0/16"}}, "tester")
+	if err != nil {
+		t.Fatalf("create parent subnet: %v", err)
+	}
+	subnet, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "机房", Attributes: map[string]string{"address": "192.168.1.0/29"}}, "tester")
+	if err != nil {
+		t.Fatalf("create subnet: %v", err)
+	}
+	if _, err := store.AppendEntries(LedgerTypeIP, []LedgerEntry{
+		{Name: "192.168.1.1"},
+		{Name: "池", Attributes: map[string]string{"address": "192.168.1.2-192.168.1.3"}},
+		{Name: "打印机", Attributes: map[string]string{"address": "192.168.1.5"}},
+	}, "tester"); err != nil {
+		t.Fatalf("append assignments: %v", err)
+	}
+
+	next, err := store.NextFreeIP(subnet.ID)
+	if err != nil {
+		t.Fatalf("next free: %v", err)
+	}
+	if next != "192.168.1.4" {
+		t.Fatalf("expected 192.168.1.4, got %s", next)
+	}
+
+	var found bool
+	for _, usage := range store.IPSubnets() {
+		if usage.ID != subnet.ID {
+			continue
+		}
+		found = true
+		if usage.ParentID != parent.ID {
+			t.Fatalf("expected parent %s, got %s", parent.ID, usage.ParentID)
+		}
+		if usage.Capacity != 6 || usage.Used != 4 || usage.Free != 2 {
+			t.Fatalf("unexpected usage: %+v", usage)
+		}
+	}
+	if !found {
+		t.Fatalf("expected subnet usage to be reported")
+	}
+
+	for _, address := range []string{"192.168.1.4", "192.168.1.6"} {
+		if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: address}, "tester"); err != nil {
+			t.Fatalf("fill subnet with %s: %v", address, err)
+		}
+	}
+	if _, err := store.NextFreeIP(subnet.ID); !errors.Is(err, ErrIPSubnetExhausted) {
+		t.Fatalf("expected exhausted subnet, got %v", err)
+	}
+}
@@ -0,0 +1,520 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrImportEmpty indicates the uploaded sheet has no header row.
+	ErrImportEmpty = errors.New("import_empty")
+	// ErrImportMappingInvalid indicates a column is mapped to a field the ledger cannot hold.
+	ErrImportMappingInvalid = errors.New("import_mapping_invalid")
+)
+
+// Proposed import actions for a row.
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+	ImportActionSkip      = "skip"
+	ImportActionConflict  = "conflict"
+)
+
+// Import modes. Create adds rows as new entries unless they carry an existing ID; merge
+// matches rows to existing entries on the ledger's natural key.
+const (
+	ImportModeCreate = "create"
+	ImportModeMerge  = "merge"
+)
+
+// ImportOptions selects the import mode. Key overrides the ledger's natural key for a merge.
+type ImportOptions struct {
+	Mode string
+	Key  string
+	// Visibility is the caller's view: entries it hides are treated as absent, keys and names
+	// are matched against what it shows, and masked values stay masked in the reported changes.
+	Visibility *Visibility
+}
+
+// ImportColumn maps one sheet column to an entry field: id, name, description, tags,
+// links.<type> or attributes.<key>. An empty Field ignores the column. Detected is false when
+// the header matched nothing known and was kept as a free-form attribute.
+type ImportColumn struct {
+	Index    int    `json:"index"`
+	Header   string `json:"header"`
+	Field    string `json:"field"`
+	Detected bool   `json:"detected"`
+}
+
+// ImportRow is the outcome, or proposed outcome, for one data row. Row is the 1-based sheet
+// row number, so the first data row is 2.
+type ImportRow struct {
+	Row         int           `json:"row"`
+	Action      string        `json:"action"`
+	EntryID     string        `json:"entry_id,omitempty"`
+	Name        string        `json:"name"`
+	Key         string        `json:"key,omitempty"`
+	DuplicateOf string        `json:"duplicate_of,omitempty"`
+	Errors      []FieldError  `json:"errors,omitempty"`
+	Changes     []FieldChange `json:"changes,omitempty"`
+
+	entry LedgerEntry
+}
+
+// ImportSummary counts rows by action; Invalid rows are also counted as skipped.
+type ImportSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Unchanged int `json:"unchanged"`
+	Skip      int `json:"skip"`
+	Conflict  int `json:"conflict"`
+	Invalid   int `json:"invalid"`
+}
+
+// ImportPreview describes how a sheet maps onto a ledger and what importing it would do.
+type ImportPreview struct {
+	Type    LedgerType     `json:"type"`
+	Mode    string         `json:"mode"`
+	Key     string         `json:"key,omitempty"`
+	Columns []ImportColumn `json:"columns"`
+	Rows    []ImportRow    `json:"rows"`
+	Summary ImportSummary  `json:"summary"`
+}
+
+// importHeaderAliases maps common spreadsheet headers onto entry fields.
+var importHeaderAliases = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"名称":          "name",
+	"姓名":          "name",
+	"description": "description",
+	"描述":          "description",
+	"说明":          "description",
+	"备注":          "description",
+	"tags":        "tags",
+	"tag":         "tags",
+	"标签":          "tags",
+}
+
+// importIPAliases are extra headers recognised as the address column of the IP ledger.
+var importIPAliases = map[string]struct{}{
+	"ip": {}, "ip address": {}, "ip_address": {}, "ip地址": {}, "地址": {},
+}
+
+func splitImportList(value string) []string {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' || r == '；' || r == '，' })
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
+// detectImportFieldLocked guesses the field for a header; ok is false when nothing matched.
+func (s *LedgerStore) detectImportFieldLocked(typ LedgerType, header string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(header))
+	if key == "" {
+		if typ == LedgerTypeIP {
+			return "attributes." + IPAddressAttribute, false
+		}
+		return "", false
+	}
+	if field, ok := importHeaderAliases[key]; ok {
+		return field, true
+	}
+	for _, prefix := range []string{"link_", "links."} {
+		if strings.HasPrefix(key, prefix) {
+			if target := NormaliseLedgerType(strings.TrimPrefix(key, prefix)); s.ledgerTypes[target] != nil {
+				return "links." + string(target), true
+			}
+		}
+	}
+	if strings.HasPrefix(key, "attributes.") && len(key) > len("attributes.") {
+		return "attributes." + strings.TrimSpace(header)[len("attributes."):], true
+	}
+	if schema := s.schemas[typ]; schema != nil {
+		for _, field := range schema.Fields {
+			if strings.EqualFold(field.Name, key) || (field.Label != "" && strings.EqualFold(field.Label, key)) {
+				return "attributes." + field.Name, true
+			}
+		}
+	}
+	if typ == LedgerTypeIP {
+		if _, ok := importIPAliases[key]; ok || key == IPAddressAttribute {
+			return "attributes." + IPAddressAttribute, true
+		}
+	}
+	for _, other := range s.ledgerTypeOrder {
+		def := s.ledgerTypes[other]
+		if other != typ && (strings.EqualFold(def.Name, key) || strings.EqualFold(def.SheetName, key) || string(other) == key) {
+			return "links." + string(other), true
+		}
+	}
+	return "attributes." + key, false
+}
+
+func (s *LedgerStore) validImportFieldLocked(field string) bool {
+	switch field {
+	case "", "id", "name", "description", "tags":
+		return true
+	}
+	if strings.HasPrefix(field, "links.") {
+		return s.ledgerTypes[LedgerType(strings.TrimPrefix(field, "links."))] != nil
+	}
+	return strings.HasPrefix(field, "attributes.") && len(field) > len("attributes.")
+}
+
+// importColumnsLocked detects the field of every header, then applies mapping, which is keyed by
+// header text (case-insensitive) and overrides detection; "" or "ignore" drops a column.
+func (s *LedgerStore) importColumnsLocked(typ LedgerType, headers []string, mapping map[string]string) ([]ImportColumn, error) {
+	overrides := make(map[string]string, len(mapping))
+	for header, field := range mapping {
+		field = strings.TrimSpace(field)
+		if strings.EqualFold(field, "ignore") {
+			field = ""
+		}
+		if strings.HasPrefix(field, "links.") {
+			field = "links." + string(NormaliseLedgerType(strings.TrimPrefix(field, "links.")))
+		}
+		if !s.validImportFieldLocked(field) {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrImportMappingInvalid, header, field)
+		}
+		overrides[strings.ToLower(strings.TrimSpace(header))] = field
+	}
+	columns := make([]ImportColumn, len(headers))
+	for i, header := range headers {
+		column := ImportColumn{Index: i, Header: strings.TrimSpace(header)}
+		if field, ok := overrides[strings.ToLower(column.Header)]; ok {
+			column.Field, column.Detected = field, true
+		} else {
+			column.Field, column.Detected = s.detectImportFieldLocked(typ, header)
+		}
+		if column.Field == "links."+string(typ) {
+			return nil, fmt.Errorf("%w: %s links to its own ledger", ErrImportMappingInvalid, header)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// DetectImportColumns reports how the headers of a sheet would map onto the ledger's fields.
+func (s *LedgerStore) DetectImportColumns(typ LedgerType, headers []string) []ImportColumn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	columns, _ := s.importColumnsLocked(typ, headers, nil)
+	return columns
+}
+
+// applyImportRow writes the mapped cells of a row onto entry. Only mapped fields change, so
+// updates keep the attributes and links the sheet does not mention; keepBlank also leaves
+// fields alone when their cell is empty.
+func applyImportRow(typ LedgerType, entry LedgerEntry, columns []ImportColumn, row []string, keepBlank bool) LedgerEntry {
+	for _, column := range columns {
+		if column.Field == "" || column.Index >= len(row) {
+			continue
+		}
+		value := strings.TrimSpace(row[column.Index])
+		if value == "" && keepBlank {
+			continue
+		}
+		switch {
+		case column.Field == "id":
+			if value != "" {
+				entry.ID = value
+			}
+		case column.Field == "name":
+			entry.Name = value
+		case column.Field == "description":
+			entry.Description = value
+		case column.Field == "tags":
+			entry.Tags = normaliseStrings(splitImportList(value))
+		case strings.HasPrefix(column.Field, "links."):
+			if entry.Links == nil {
+				entry.Links = make(map[LedgerType][]string)
+			}
+			target := LedgerType(strings.TrimPrefix(column.Field, "links."))
+			if ids := splitImportList(value); len(ids) > 0 {
+				entry.Links[target] = ids
+			} else {
+				delete(entry.Links, target)
+			}
+		case strings.HasPrefix(column.Field, "attributes."):
+			key := strings.TrimPrefix(column.Field, "attributes.")
+			if typ == LedgerTypeIP && key == IPAddressAttribute && value != "" {
+				if address, ok := NormaliseIPAddress(value); ok {
+					value = address
+				}
+			}
+			if entry.Attributes == nil {
+				entry.Attributes = make(map[string]string)
+			}
+			if value == "" {
+				delete(entry.Attributes, key)
+			} else {
+				entry.Attributes[key] = value
+			}
+		}
+	}
+	if typ == LedgerTypeIP && entry.Name == "" {
+		entry.Name = entry.Attributes[IPAddressAttribute]
+	}
+	return entry
+}
+
+func blankImportRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// importErrors turns a write error into row-level field errors.
+func importErrors(err error) []FieldError {
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		out := make([]FieldError, len(validation.Fields))
+		for i, field := range validation.Fields {
+			field.Index = 0
+			out[i] = field
+		}
+		return out
+	}
+	var conflict *IPConflictError
+	if errors.As(err, &conflict) {
+		return []FieldError{{Field: "attributes." + IPAddressAttribute, Code: ErrIPConflict.Error(), Message: conflict.Error()}}
+	}
+	return []FieldError{{Code: err.Error(), Message: err.Error()}}
+}
+
+// previewImportLocked maps every data row and validates it against the ledger as it stands.
+// In create mode rows carrying the ID of an existing entry update it, and rows whose name (or,
+// on the IP ledger, address) matches an existing entry are reported as duplicates and skipped.
+// In merge mode rows are matched on the natural key instead, and blank cells keep the current
+// value.
+func (s *LedgerStore) previewImportLocked(typ LedgerType, rows [][]string, mapping map[string]string, opts ImportOptions) (ImportPreview, error) {
+	if _, ok := s.ledgerTypes[typ]; !ok {
+		return ImportPreview{}, fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, typ)
+	}
+	if len(rows) == 0 {
+		return ImportPreview{}, ErrImportEmpty
+	}
+	columns, err := s.importColumnsLocked(typ, rows[0], mapping)
+	if err != nil {
+		return ImportPreview{}, err
+	}
+	merge := opts.Mode == ImportModeMerge
+	key := strings.TrimSpace(opts.Key)
+	if merge && key == "" {
+		key = s.naturalKeyLocked(typ)
+	}
+	if merge && !validNaturalKey(key) {
+		return ImportPreview{}, fmt.Errorf("%w: natural key %q", ErrImportMappingInvalid, key)
+	}
+	preview := ImportPreview{Type: typ, Mode: ImportModeCreate, Columns: columns, Rows: make([]ImportRow, 0, len(rows)-1)}
+	if merge {
+		preview.Mode, preview.Key = ImportModeMerge, key
+	}
+
+	view := opts.Visibility
+	indexOf := func(id string) int {
+		if view.Hidden(typ, id) {
+			return -1
+		}
+		return s.entryIndexLocked(typ, id)
+	}
+	existing := s.entries[typ]
+	byName := make(map[string]string, len(existing))
+	byAddress := make(map[string]string)
+	byKey := make(map[string][]int)
+	for i, stored := range existing {
+		entry, visible := view.Entry(typ, stored)
+		if !visible {
+			continue
+		}
+		byName[strings.ToLower(entry.Name)] = entry.ID
+		if address := entry.Attributes[IPAddressAttribute]; typ == LedgerTypeIP && address != "" {
+			byAddress[address] = entry.ID
+		}
+		if value := naturalKeyValue(typ, key, entry); merge && value != "" {
+			byKey[value] = append(byKey[value], i)
+		}
+	}
+	seen := make(map[string]int)
+	for i, cells := range rows[1:] {
+		if blankImportRow(cells) {
+			continue
+		}
+		row := ImportRow{Row: i + 2, Action: ImportActionCreate}
+		var base LedgerEntry
+		var conflicts []FieldError
+		conflict := func(field, code, message string) {
+			conflicts = append(conflicts, FieldError{Field: field, Code: code, Message: message})
+		}
+		probe := applyImportRow(typ, LedgerEntry{}, columns, cells, false)
+		if merge {
+			row.Key = naturalKeyValue(typ, key, probe)
+			matches := byKey[row.Key]
+			switch {
+			case row.Key == "":
+				conflict(key, "key_missing", "natural key is empty")
+			case len(matches) > 1:
+				ids := make([]string, len(matches))
+				for j, idx := range matches {
+					ids[j] = existing[idx].ID
+				}
+				conflict(key, "key_ambiguous", "matches "+strings.Join(ids, ", "))
+			case len(matches) == 1:
+				base = existing[matches[0]].Clone()
+				row.Action = ImportActionUpdate
+			}
+			if probe.ID != "" && probe.ID != base.ID && (row.Action == ImportActionUpdate || indexOf(probe.ID) >= 0) {
+				conflict("id", "id_mismatch", "id belongs to a different entry")
+			}
+			if first, dup := seen["key:"+row.Key]; dup && row.Key != "" {
+				conflict(key, "duplicate_in_file", fmt.Sprintf("same as row %d", first))
+			} else if row.Key != "" {
+				seen["key:"+row.Key] = row.Row
+			}
+		} else if idx := indexOf(probe.ID); probe.ID != "" && idx >= 0 {
+			base = existing[idx].Clone()
+			row.Action = ImportActionUpdate
+		}
+		entry := applyImportRow(typ, base.Clone(), columns, cells, merge && row.Action == ImportActionUpdate)
+		if row.Action == ImportActionUpdate {
+			entry.Attributes = view.Restore(typ, entry.Attributes, base.Attributes)
+			if merge {
+				entry.ID = base.ID
+			}
+		} else if view.Hidden(typ, entry.ID) {
+			entry.ID = ""
+		}
+		row.EntryID, row.Name = entry.ID, entry.Name
+
+		if strings.TrimSpace(entry.Name) == "" {
+			row.Errors = append(row.Errors, FieldError{Field: "name", Code: "required", Message: "name is required"})
+		}
+		if !merge && row.Action == ImportActionCreate {
+			if id, ok := byName[strings.ToLower(entry.Name)]; ok && entry.Name != "" {
+				row.DuplicateOf = id
+			} else if id, ok := byAddress[entry.Attributes[IPAddressAttribute]]; ok {
+				row.DuplicateOf = id
+			}
+		}
+		if !merge {
+			for _, ref := range []string{"id:" + entry.ID, "name:" + strings.ToLower(entry.Name)} {
+				if ref == "id:" || ref == "name:" || row.DuplicateOf != "" {
+					continue
+				}
+				if first, dup := seen[ref]; dup {
+					row.Errors = append(row.Errors, FieldError{Field: strings.SplitN(ref, ":", 2)[0], Code: "duplicate_in_file", Message: fmt.Sprintf("same as row %d", first)})
+					continue
+				}
+				seen[ref] = row.Row
+			}
+		}
+		if len(conflicts) == 0 && len(row.Errors) == 0 && row.DuplicateOf == "" {
+			candidates := []LedgerEntry{entry}
+			if err := s.prepareEntriesLocked(typ, candidates); err != nil {
+				row.Errors = importErrors(err)
+			} else {
+				entry = candidates[0]
+			}
+		}
+		switch {
+		case len(conflicts) > 0:
+			row.Action = ImportActionConflict
+			row.Errors = append(conflicts, row.Errors...)
+		case len(row.Errors) > 0:
+			row.Action = ImportActionSkip
+			preview.Summary.Invalid++
+		case row.DuplicateOf != "":
+			row.Action = ImportActionSkip
+		case row.Action == ImportActionUpdate:
+			changes := diffFields(flattenEntry(base), flattenEntry(entry))
+			if len(changes) == 0 {
+				row.Action = ImportActionUnchanged
+			}
+			row.Changes = view.Changes(typ, changes)
+		}
+		switch row.Action {
+		case ImportActionCreate:
+			preview.Summary.Create++
+		case ImportActionUpdate:
+			preview.Summary.Update++
+		case ImportActionUnchanged:
+			preview.Summary.Unchanged++
+		case ImportActionConflict:
+			preview.Summary.Conflict++
+		default:
+			preview.Summary.Skip++
+		}
+		row.entry = entry
+		preview.Rows = append(preview.Rows, row)
+	}
+	return preview, nil
+}
+
+// PreviewImport reports the detected column mapping and, per row, the proposed action and any
+// validation errors, without changing the ledger. rows[0] is the header row.
+func (s *LedgerStore) PreviewImport(typ LedgerType, rows [][]string, mapping map[string]string, opts ImportOptions) (ImportPreview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.previewImportLocked(typ, rows, mapping, opts)
+}
+
+// CommitImport imports rows using mapping: rows proposed as create or update are written in one
+// change and every other row is left out. The returned preview lists what was done.
+func (s *LedgerStore) CommitImport(typ LedgerType, rows [][]string, mapping map[string]string, opts ImportOptions, actor string) (ImportPreview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	preview, err := s.previewImportLocked(typ, rows, mapping, opts)
+	if err != nil {
+		return ImportPreview{}, err
+	}
+	candidates := make([]LedgerEntry, 0, len(preview.Rows))
+	for i := range preview.Rows {
+		row := &preview.Rows[i]
+		if row.Action != ImportActionCreate && row.Action != ImportActionUpdate {
+			continue
+		}
+		if row.Action == ImportActionCreate {
+			if row.entry.ID == "" {
+				row.entry.ID = GenerateID(string(typ))
+			}
+			row.entry.CreatedAt = time.Now().UTC()
+			row.EntryID = row.entry.ID
+		}
+		candidates = append(candidates, row.entry)
+	}
+	if len(candidates) == 0 {
+		return preview, nil
+	}
+	// Rows were validated one at a time; validate them together to catch clashes between rows.
+	if err := s.prepareEntriesLocked(typ, candidates); err != nil {
+		return ImportPreview{}, err
+	}
+	now := time.Now().UTC()
+	for _, candidate := range candidates {
+		candidate.UpdatedAt = now
+		s.touchEntryLocked(typ, candidate.ID)
+		if idx := s.entryIndexLocked(typ, candidate.ID); idx >= 0 {
+			before := s.entries[typ][idx].Links
+			s.entries[typ][idx] = candidate
+			s.syncLinksLocked(typ, candidate.ID, before, candidate.Links)
+			continue
+		}
+		candidate.Order = len(s.entries[typ])
+		s.appendEntryLocked(typ, candidate)
+		s.syncLinksLocked(typ, candidate.ID, nil, candidate.Links)
+	}
+	s.appendAuditLocked(actor, fmt.Sprintf("import_%s", typ), fmt.Sprintf("mode=%s create=%d update=%d unchanged=%d conflict=%d skip=%d", preview.Mode, preview.Summary.Create, preview.Summary.Update, preview.Summary.Unchanged, preview.Summary.Conflict, preview.Summary.Skip))
+	s.commitLocked(actor)
+	return preview, nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestPreviewAndCommitLedgerImport(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.SetSchema(LedgerTypePersonnel, LedgerSchema{Fields: []SchemaField{
+		{Name: "email", Label: "邮箱", Type: FieldTypeEmail, Unique: true},
+		{Name: "desk", Type: FieldTypeText},
+	}}, "tester"); err != nil {
+		t.Fatalf("set schema: %v", err)
+	}
+	existing, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "张三", Attributes: map[string]string{"email": "zhangsan@example.com"}}, "tester")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	rows := [][]string{
+		{"ID", "姓名", "邮箱", "工位"},
+		{existing.ID, "张三", "zs@example.com", "A-101"},
+		{"", "李四", "lisi@example.com", "A-102"},
+		{"", "张三", "other@example.com", ""},
+		{"", "王五", "not-an-email", ""},
+		{"", "", "", ""},
+	}
+	preview, err := store.PreviewImport(LedgerTypePersonnel, rows, nil, ImportOptions{})
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if preview.Columns[1].Field != "name" || preview.Columns[2].Field != "attributes.email" || preview.Columns[3].Detected {
+		t.Fatalf("unexpected column detection %+v", preview.Columns)
+	}
+	if len(preview.Rows) != 4 {
+		t.Fatalf("expected blank row to be dropped, got %d rows", len(preview.Rows))
+	}
+	if row := preview.Rows[0]; row.Action != ImportActionSkip || len(row.Errors) != 1 || row.Errors[0].Code != "unknown_field" {
+		t.Fatalf("expected the undetected column to be reported, got %+v", row)
+	}
+
+	mapping := map[string]string{"工位": "attributes.desk", "邮箱": "attributes.email"}
+	preview, err = store.PreviewImport(LedgerTypePersonnel, rows, mapping, ImportOptions{})
+	if err != nil {
+		t.Fatalf("preview with mapping: %v", err)
+	}
+	if row := preview.Rows[0]; row.Action != ImportActionUpdate || row.EntryID != existing.ID || len(row.Changes) != 2 {
+		t.Fatalf("expected update of existing entry, got %+v", row)
+	}
+	if row := preview.Rows[1]; row.Action != ImportActionCreate || row.Row != 3 {
+		t.Fatalf("expected create on row 3, got %+v", row)
+	}
+	if row := preview.Rows[2]; row.Action != ImportActionSkip || row.DuplicateOf != existing.ID {
+		t.Fatalf("expected duplicate to be skipped, got %+v", row)
+	}
+	if row := preview.Rows[3]; row.Action != ImportActionSkip || len(row.Errors) != 1 || row.Errors[0].Field != "email" {
+		t.Fatalf("expected invalid email error, got %+v", row)
+	}
+	if len(store.ListEntries(LedgerTypePersonnel)) != 1 {
+		t.Fatalf("preview must not change the ledger")
+	}
+
+	result, err := store.CommitImport(LedgerTypePersonnel, rows, mapping, ImportOptions{}, "tester")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if result.Summary.Create != 1 || result.Summary.Update != 1 || result.Summary.Skip != 2 || result.Summary.Invalid != 1 {
+		t.Fatalf("unexpected summary %+v", result.Summary)
+	}
+	entries := store.ListEntries(LedgerTypePersonnel)
+	if len(entries) != 2 || entries[0].Attributes["email"] != "zs@example.com" || entries[1].Attributes["desk"] != "A-102" {
+		t.Fatalf("unexpected entries after commit %+v", entries)
+	}
+
+	if _, err := store.PreviewImport(LedgerTypePersonnel, rows, map[string]string{"工位": "links.unknown"}, ImportOptions{}); err == nil {
+		t.Fatalf("expected mapping to an unknown ledger to be rejected")
+	}
+}
+
+func TestMergeImportMatchesNaturalKey(t *testing.T) {
+	store := newTestStore(t)
+
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	ip, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "10.0.0.1", Attributes: map[string]string{"owner": "张三"}, Links: map[LedgerType][]string{LedgerTypeSystem: {erp.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create ip: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "10.0.0.2", Attributes: map[string]string{"address": "10.0.0.2", "owner": "李四"}}, "tester"); err != nil {
+		t.Fatalf("create ip: %v", err)
+	}
+	if key, _ := store.NaturalKey(LedgerTypeIP); key != "attributes.address" {
+		t.Fatalf("expected address as the IP natural key, got %q", key)
+	}
+
+	rows := [][]string{
+		{"IP地址", "owner", "System"},
+		{"10.0.0.1", "王五", ""},
+		{"10.0.0.2", "李四", ""},
+		{"10.0.0.3", "赵六", erp.ID},
+		{"", "无地址", ""},
+		{"10.0.0.3", "重复", ""},
+	}
+	result, err := store.CommitImport(LedgerTypeIP, rows, map[string]string{"owner": "attributes.owner"}, ImportOptions{Mode: ImportModeMerge}, "tester")
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if s := result.Summary; s.Create != 1 || s.Update != 1 || s.Unchanged != 1 || s.Conflict != 2 {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+	updated, err := store.GetEntry(LedgerTypeIP, ip.ID)
+	if err != nil || updated.Attributes["owner"] != "王五" || len(updated.Links[LedgerTypeSystem]) != 1 {
+		t.Fatalf("expected owner updated in place with links kept, got %+v (%v)", updated, err)
+	}
+	if len(store.ListEntries(LedgerTypeIP)) != 3 {
+		t.Fatalf("expected a single new entry")
+	}
+
+	if _, err := store.SetNaturalKey(LedgerTypeIP, "attributes.owner", "admin"); err != nil {
+		t.Fatalf("set natural key: %v", err)
+	}
+	preview, err := store.PreviewImport(LedgerTypeIP, [][]string{{"owner", "description"}, {"李四", "核心交换"}}, nil, ImportOptions{Mode: ImportModeMerge})
+	if err != nil || preview.Key != "attributes.owner" || preview.Rows[0].Action != ImportActionUpdate {
+		t.Fatalf("expected match on configured key, got %+v (%v)", preview, err)
+	}
+}
+
+func TestImportPreviewAppliesVisibility(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"department": "Ops", "id_number": "110101199001011234"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob", Attributes: map[string]string{"department": "Sales"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	user, err := store.CreateUser("manager", "Passw0rd!23", AccessEditor, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(user.ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityField, Field: "id_number", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityRow, Subjects: []string{"managers"}, Filters: []FilterClause{{Property: "attributes.department", Op: FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+	opts := ImportOptions{Visibility: store.VisibilityFor("manager")}
+
+	rows := [][]string{
+		{"ID", "姓名", "department", "id_number"},
+		{alice.ID, "Alice Chen", "Ops", ""},
+		{bob.ID, "Robert", "Sales", ""},
+		{"", "Bob", "Sales", ""},
+	}
+	mapping := map[string]string{"department": "attributes.department", "id_number": "attributes.id_number"}
+	preview, err := store.PreviewImport(LedgerTypePersonnel, rows, mapping, opts)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if row := preview.Rows[0]; row.Action != ImportActionUpdate || len(row.Changes) != 1 || row.Changes[0].Field != "name" {
+		t.Fatalf("expected only the name to change, got %+v", row)
+	}
+	if row := preview.Rows[1]; row.Action != ImportActionCreate || row.EntryID != "" {
+		t.Fatalf("expected the hidden id to be treated as absent, got %+v", row)
+	}
+	if row := preview.Rows[2]; row.Action != ImportActionCreate || row.DuplicateOf != "" {
+		t.Fatalf("expected no duplicate of a hidden entry, got %+v", row)
+	}
+
+	merge := opts
+	merge.Mode, merge.Key = ImportModeMerge, "name"
+	preview, err = store.PreviewImport(LedgerTypePersonnel, [][]string{{"姓名", "department"}, {"Bob", "Ops"}}, mapping, merge)
+	if err != nil || preview.Rows[0].Action != ImportActionCreate {
+		t.Fatalf("expected hidden entries to be unmatched by key, got %+v (%v)", preview, err)
+	}
+
+	result, err := store.CommitImport(LedgerTypePersonnel, rows, mapping, opts, "manager")
+	if err != nil || result.Summary.Create != 2 {
+		t.Fatalf("commit: %+v (%v)", result.Summary, err)
+	}
+	if stored, _ := store.GetEntry(LedgerTypePersonnel, bob.ID); stored.Name != "Bob" {
+		t.Fatalf("expected the hidden entry to be untouched, got %+v", stored)
+	}
+	if stored, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); stored.Attributes["id_number"] != "110101199001011234" {
+		t.Fatalf("expected the masked attribute to survive the import, got %+v", stored.Attributes)
+	}
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQueryInvalid indicates a ledger filter or sort clause cannot be evaluated.
+var ErrQueryInvalid = errors.New("query_invalid")
+
+// Filter operators supported by QueryEntries. eq and contains match the Roledger records API;
+// the rest are only available on the classic ledgers.
+const (
+	FilterOpEq       = "eq"
+	FilterOpContains = "contains"
+	FilterOpPrefix   = "prefix"
+	FilterOpRange    = "range"
+	FilterOpIn       = "in"
+)
+
+// LedgerQuery selects, orders and pages ledger entries. Filter and sort properties are name,
+// description, tags, links, links.<type>, attributes.<key>, order, created_at and updated_at.
+// Text is a case-insensitive free-text match over name, description, tags and attributes.
+type LedgerQuery struct {
+	Filters  []FilterClause
+	Sorts    []SortClause
+	Text     string
+	Page     int
+	PageSize int
+	// Visibility hides entries and masks attributes before filtering, so masked values can
+	// neither be read nor probed with filters or sorts.
+	Visibility *Visibility
+}
+
+type compiledFilter struct {
+	property string
+	op       string
+	values   []string
+	from     string
+	to       string
+}
+
+// entryValues returns the values of a property on an entry; multi-valued properties such as
+// tags and links match when any value matches.
+func entryValues(entry LedgerEntry, property string) []string {
+	switch {
+	case property == "name":
+		return []string{entry.Name}
+	case property == "description":
+		return []string{entry.Description}
+	case property == "tags":
+		return entry.Tags
+	case property == "order":
+		return []string{strconv.Itoa(entry.Order)}
+	case property == "created_at":
+		return []string{entry.CreatedAt.UTC().Format(time.RFC3339)}
+	case property == "updated_at":
+		return []string{entry.UpdatedAt.UTC().Format(time.RFC3339)}
+	case property == "links":
+		values := make([]string, 0)
+		for _, ids := range entry.Links {
+			values = append(values, ids...)
+		}
+		return values
+	case strings.HasPrefix(property, "links."):
+		return entry.Links[NormaliseLedgerType(strings.TrimPrefix(property, "links."))]
+	case strings.HasPrefix(property, "attributes."):
+		if value, ok := entry.Attributes[strings.TrimPrefix(property, "attributes.")]; ok {
+			return []string{value}
+		}
+	}
+	return nil
+}
+
+func validQueryProperty(property string) bool {
+	switch property {
+	case "name", "description", "tags", "links", "order", "created_at", "updated_at":
+		return true
+	}
+	for _, prefix := range []string{"links.", "attributes."} {
+		if strings.HasPrefix(property, prefix) && len(property) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func queryString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return strings.TrimSpace(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func compileFilter(clause FilterClause) (compiledFilter, error) {
+	filter := compiledFilter{
+		property: strings.ToLower(strings.TrimSpace(clause.Property)),
+		op:       strings.ToLower(strings.TrimSpace(clause.Op)),
+	}
+	if strings.HasPrefix(filter.property, "attributes.") {
+		// Attribute keys keep their original case.
+		filter.property = "attributes." + strings.TrimSpace(clause.Property)[len("attributes."):]
+	}
+	if !validQueryProperty(filter.property) {
+		return filter, fmt.Errorf("%w: property %q", ErrQueryInvalid, clause.Property)
+	}
+	switch filter.op {
+	case FilterOpEq, FilterOpContains, FilterOpPrefix:
+		value, ok := queryString(clause.Value)
+		if !ok {
+			return filter, fmt.Errorf("%w: %s expects a scalar value", ErrQueryInvalid, filter.op)
+		}
+		filter.values = []string{value}
+	case FilterOpIn:
+		items, ok := clause.Value.([]interface{})
+		if !ok {
+			return filter, fmt.Errorf("%w: in expects a list", ErrQueryInvalid)
+		}
+		for _, item := range items {
+			value, ok := queryString(item)
+			if !ok {
+				return filter, fmt.Errorf("%w: in expects scalar items", ErrQueryInvalid)
+			}
+			filter.values = append(filter.values, value)
+		}
+	case FilterOpRange:
+		var bounds []interface{}
+		switch v := clause.Value.(type) {
+		case []interface{}:
+			bounds = v
+		case map[string]interface{}:
+			bounds = []interface{}{v["from"], v["to"]}
+		}
+		if len(bounds) != 2 {
+			return filter, fmt.Errorf("%w: range expects [from, to] or {from, to}", ErrQueryInvalid)
+		}
+		from, okFrom := queryString(bounds[0])
+		to, okTo := queryString(bounds[1])
+		if !okFrom || !okTo || (from == "" && to == "") {
+			return filter, fmt.Errorf("%w: range bounds", ErrQueryInvalid)
+		}
+		filter.from, filter.to = from, to
+	default:
+		return filter, fmt.Errorf("%w: operator %q", ErrQueryInvalid, clause.Op)
+	}
+	return filter, nil
+}
+
+// compareQueryValues orders two values numerically when both are numbers, chronologically when
+// both are dates and lexically otherwise.
+func compareQueryValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := parseQueryTime(a); ok {
+		if y, ok := parseQueryTime(b); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func parseQueryTime(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (f compiledFilter) matchValue(value string) bool {
+	switch f.op {
+	case FilterOpEq:
+		return strings.EqualFold(value, f.values[0])
+	case FilterOpContains:
+		return strings.Contains(strings.ToLower(value), strings.ToLower(f.values[0]))
+	case FilterOpPrefix:
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(f.values[0]))
+	case FilterOpIn:
+		for _, candidate := range f.values {
+			if strings.EqualFold(value, candidate) {
+				return true
+			}
+		}
+		return false
+	case FilterOpRange:
+		if value == "" {
+			return false
+		}
+		if f.from != "" && compareQueryValues(value, f.from) < 0 {
+			return false
+		}
+		if f.to != "" && compareQueryValues(value, f.to) > 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func (f compiledFilter) match(entry LedgerEntry) bool {
+	values := entryValues(entry, f.property)
+	if len(values) == 0 {
+		// An empty eq matches entries without the property.
+		return f.op == FilterOpEq && f.values[0] == ""
+	}
+	for _, value := range values {
+		if f.matchValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchEntryText(entry LedgerEntry, text string) bool {
+	if text == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(entry.Name), text) || strings.Contains(strings.ToLower(entry.Description), text) {
+		return true
+	}
+	for _, tag := range entry.Tags {
+		if strings.Contains(strings.ToLower(tag), text) {
+			return true
+		}
+	}
+	for _, value := range entry.Attributes {
+		if strings.Contains(strings.ToLower(value), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryMatcher holds the compiled filters and free text of a LedgerQuery.
+type entryMatcher struct {
+	filters []compiledFilter
+	text    string
+}
+
+func (m entryMatcher) match(entry LedgerEntry) bool {
+	if !matchEntryText(entry, m.text) {
+		return false
+	}
+	for _, filter := range m.filters {
+		if !filter.match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+func compileEntryMatcher(query LedgerQuery) (entryMatcher, error) {
+	matcher := entryMatcher{
+		filters: make([]compiledFilter, 0, len(query.Filters)),
+		text:    strings.ToLower(strings.TrimSpace(query.Text)),
+	}
+	for _, clause := range query.Filters {
+		filter, err := compileFilter(clause)
+		if err != nil {
+			return matcher, err
+		}
+		matcher.filters = append(matcher.filters, filter)
+	}
+	return matcher, nil
+}
+
+// QueryEntries filters, sorts and pages a ledger. Entries are ordered by the sort clauses in
+// turn and then by their manual order. A zero PageSize returns every match.
+func (s *LedgerStore) QueryEntries(typ LedgerType, query LedgerQuery) ([]LedgerEntry, int, error) {
+	matcher, err := compileEntryMatcher(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	sorts := make([]SortClause, 0, len(query.Sorts))
+	for _, clause := range query.Sorts {
+		compiled, err := compileFilter(FilterClause{Property: clause.Property, Op: FilterOpEq})
+		if err != nil {
+			return nil, 0, err
+		}
+		sorts = append(sorts, SortClause{Property: compiled.property, Direction: strings.ToLower(clause.Direction)})
+	}
+
+	s.mu.RLock()
+	matched := make([]LedgerEntry, 0)
+	for _, entry := range s.entries[typ] {
+		visible, ok := query.Visibility.Entry(typ, entry)
+		if ok && matcher.match(visible) {
+			matched = append(matched, visible.Clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, clause := range sorts {
+			a := strings.Join(entryValues(matched[i], clause.Property), ",")
+			b := strings.Join(entryValues(matched[j], clause.Property), ",")
+			cmp := compareQueryValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if clause.Direction == "desc" {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return matched[i].Order < matched[j].Order
+	})
+
+	total := len(matched)
+	if query.PageSize <= 0 {
+		return matched, total, nil
+	}
+	page := query.Page
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * query.PageSize
+	if start >= total {
+		return []LedgerEntry{}, total, nil
+	}
+	end := start + query.PageSize
+	if end > total {
+		end = total
+	}
+	return matched[start:end], total, nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueryEntriesFiltersAndSorts(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "张三"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	seed := []LedgerEntry{
+		{Name: "ERP", Tags: []string{"core"}, Attributes: map[string]string{"cpu": "16", "owner": "财务部"}, Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID}}},
+		{Name: "OA", Tags: []string{"office"}, Attributes: map[string]string{"cpu": "4", "owner": "行政部"}},
+		{Name: "CRM", Tags: []string{"core", "sales"}, Attributes: map[string]string{"cpu": "8", "owner": "销售部"}},
+	}
+	for _, entry := range seed {
+		if _, err := store.CreateEntry(LedgerTypeSystem, entry, "tester"); err != nil {
+			t.Fatalf("create system: %v", err)
+		}
+	}
+
+	names := func(entries []LedgerEntry) []string {
+		out := make([]string, len(entries))
+		for i, entry := range entries {
+			out[i] = entry.Name
+		}
+		return out
+	}
+
+	items, total, err := store.QueryEntries(LedgerTypeSystem, LedgerQuery{
+		Filters: []FilterClause{{Property: "tags", Op: "eq", Value: "core"}},
+		Sorts:   []SortClause{{Property: "attributes.cpu", Direction: "asc"}},
+	})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := names(items); total != 2 || got[0] != "CRM" || got[1] != "ERP" {
+		t.Fatalf("expected numeric sort of core systems, got %v", got)
+	}
+
+	items, _, err = store.QueryEntries(LedgerTypeSystem, LedgerQuery{
+		Filters: []FilterClause{{Property: "attributes.cpu", Op: "range", Value: []interface{}{"5", nil}}},
+	})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("expected two systems with cpu >= 5, got %v (%v)", names(items), err)
+	}
+
+	items, _, err = store.QueryEntries(LedgerTypeSystem, LedgerQuery{
+		Filters: []FilterClause{{Property: "links.personnel", Op: "in", Value: []interface{}{alice.ID}}},
+	})
+	if err != nil || len(items) != 1 || items[0].Name != "ERP" {
+		t.Fatalf("expected ERP linked to alice, got %v (%v)", names(items), err)
+	}
+
+	items, total, err = store.QueryEntries(LedgerTypeSystem, LedgerQuery{Text: "行政", PageSize: 1, Page: 1})
+	if err != nil || total != 1 || items[0].Name != "OA" {
+		t.Fatalf("expected free-text match on OA, got %v (%v)", names(items), err)
+	}
+
+	if _, _, err := store.QueryEntries(LedgerTypeSystem, LedgerQuery{Filters: []FilterClause{{Property: "name", Op: "regex", Value: "x"}}}); !errors.Is(err, ErrQueryInvalid) {
+		t.Fatalf("expected unsupported operator to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,437 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLedgerTypeUnknown indicates the ledger type has not been registered.
+	ErrLedgerTypeUnknown = errors.New("unknown_ledger")
+	// ErrLedgerTypeInvalid indicates a ledger type definition is malformed.
+	ErrLedgerTypeInvalid = errors.New("ledger_type_invalid")
+	// ErrLedgerTypeExists indicates the ledger type key or sheet name is already taken.
+	ErrLedgerTypeExists = errors.New("ledger_type_exists")
+	// ErrLedgerTypeBuiltIn indicates the operation is not permitted on a built-in ledger type.
+	ErrLedgerTypeBuiltIn = errors.New("ledger_type_builtin")
+	// ErrLedgerTypeInUse indicates the ledger type still holds entries.
+	ErrLedgerTypeInUse = errors.New("ledger_type_in_use")
+	// ErrLinkNotAllowed indicates an entry links to a ledger its type may not reference.
+	ErrLinkNotAllowed = errors.New("link_not_allowed")
+)
+
+// defaultNaturalKeys are the fields merge imports match rows on unless an administrator chose
+// another; ledgers not listed match on name.
+var defaultNaturalKeys = map[LedgerType]string{
+	LedgerTypeIP:        "attributes." + IPAddressAttribute,
+	LedgerTypePersonnel: "attributes.employee_no",
+	LedgerTypeSystem:    "attributes.code",
+}
+
+// MatrixSheetName is the reserved workbook sheet holding the link matrix.
+const MatrixSheetName = "Matrix"
+
+var ledgerTypeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// ledgerTypeAliases maps alternative spellings accepted for the built-in ledgers.
+var ledgerTypeAliases = map[string]LedgerType{
+	"ip":     LedgerTypeIP,
+	"people": LedgerTypePersonnel,
+	"person": LedgerTypePersonnel,
+	"system": LedgerTypeSystem,
+}
+
+// LedgerTypeDefinition describes a ledger, its presentation and which ledgers its entries
+// may link to. An empty LinkTypes list allows links to every ledger.
+type LedgerTypeDefinition struct {
+	Type      LedgerType   `json:"type"`
+	Name      string       `json:"name"`
+	SheetName string       `json:"sheet_name"`
+	LinkTypes []LedgerType `json:"link_types,omitempty"`
+	BuiltIn   bool         `json:"built_in,omitempty"`
+	CreatedAt time.Time    `json:"created_at,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at,omitempty"`
+}
+
+// Clone returns a deep copy of the definition.
+func (d *LedgerTypeDefinition) Clone() *LedgerTypeDefinition {
+	if d == nil {
+		return nil
+	}
+	clone := *d
+	clone.LinkTypes = append([]LedgerType(nil), d.LinkTypes...)
+	return &clone
+}
+
+// AllowsLink reports whether entries of this ledger may link to the target ledger.
+func (d *LedgerTypeDefinition) AllowsLink(target LedgerType) bool {
+	if d == nil || len(d.LinkTypes) == 0 {
+		return true
+	}
+	for _, allowed := range d.LinkTypes {
+		if allowed == target {
+			return true
+		}
+	}
+	return false
+}
+
+func builtInLedgerTypes() []*LedgerTypeDefinition {
+	return []*LedgerTypeDefinition{
+		{Type: LedgerTypeIP, Name: "IP", SheetName: "IP", BuiltIn: true},
+		{Type: LedgerTypePersonnel, Name: "Personnel", SheetName: "Personnel", BuiltIn: true},
+		{Type: LedgerTypeSystem, Name: "System", SheetName: "System", BuiltIn: true},
+	}
+}
+
+// NormaliseLedgerType lowercases a ledger key and resolves built-in aliases such as "ip".
+func NormaliseLedgerType(value string) LedgerType {
+	key := strings.ToLower(strings.TrimSpace(value))
+	if alias, ok := ledgerTypeAliases[key]; ok {
+		return alias
+	}
+	return LedgerType(key)
+}
+
+// ledgerTypesLocked returns the registered ledger types with the built-ins first.
+func (s *LedgerStore) ledgerTypesLocked() []LedgerType {
+	return append([]LedgerType{}, s.ledgerTypeOrder...)
+}
+
+func (s *LedgerStore) resetLedgerTypesLocked() {
+	s.ledgerTypes = make(map[LedgerType]*LedgerTypeDefinition)
+	s.ledgerTypeOrder = make([]LedgerType, 0, len(AllLedgerTypes))
+	for _, def := range builtInLedgerTypes() {
+		s.ledgerTypes[def.Type] = def
+		s.ledgerTypeOrder = append(s.ledgerTypeOrder, def.Type)
+	}
+}
+
+// restoreLedgerTypesLocked registers persisted custom ledger types, skipping entries that
+// collide with built-ins. Every definition is registered before link targets are checked, so a
+// type may link to one defined after it; a definition that no longer validates is kept as
+// stored so its ledger is not lost, and only link targets that no longer exist are dropped.
+func (s *LedgerStore) restoreLedgerTypesLocked(defs []*LedgerTypeDefinition) {
+	restored := make([]*LedgerTypeDefinition, 0, len(defs))
+	links := make([][]LedgerType, 0, len(defs))
+	for _, def := range defs {
+		if def == nil || strings.TrimSpace(string(def.Type)) == "" {
+			continue
+		}
+		if existing, ok := s.ledgerTypes[def.Type]; ok && existing.BuiltIn {
+			continue
+		}
+		candidate := *def
+		candidate.LinkTypes = nil
+		normalised, err := s.normaliseLedgerTypeLocked(candidate, def.Type)
+		if err != nil {
+			normalised = candidate.Clone()
+			normalised.BuiltIn = false
+		}
+		normalised.CreatedAt = def.CreatedAt
+		normalised.UpdatedAt = def.UpdatedAt
+		if _, ok := s.ledgerTypes[normalised.Type]; !ok {
+			s.ledgerTypeOrder = append(s.ledgerTypeOrder, normalised.Type)
+		}
+		s.ledgerTypes[normalised.Type] = normalised
+		restored = append(restored, normalised)
+		links = append(links, def.LinkTypes)
+	}
+	for i, def := range restored {
+		seen := make(map[LedgerType]struct{}, len(links[i]))
+		for _, link := range links[i] {
+			target := NormaliseLedgerType(string(link))
+			if _, ok := s.ledgerTypes[target]; !ok {
+				continue
+			}
+			if _, dup := seen[target]; dup {
+				continue
+			}
+			seen[target] = struct{}{}
+			def.LinkTypes = append(def.LinkTypes, target)
+		}
+	}
+}
+
+func (s *LedgerStore) customLedgerTypesLocked() []*LedgerTypeDefinition {
+	out := make([]*LedgerTypeDefinition, 0, len(s.ledgerTypeOrder))
+	for _, typ := range s.ledgerTypeOrder {
+		if def := s.ledgerTypes[typ]; def != nil && !def.BuiltIn {
+			out = append(out, def.Clone())
+		}
+	}
+	return out
+}
+
+// normaliseLedgerTypeLocked validates a definition; replacing names the type being updated so
+// its own sheet name does not count as a collision.
+func (s *LedgerStore) normaliseLedgerTypeLocked(def LedgerTypeDefinition, replacing LedgerType) (*LedgerTypeDefinition, error) {
+	out := &LedgerTypeDefinition{
+		Type:      LedgerType(strings.ToLower(strings.TrimSpace(string(def.Type)))),
+		Name:      strings.TrimSpace(def.Name),
+		SheetName: strings.TrimSpace(def.SheetName),
+	}
+	if !ledgerTypeKeyPattern.MatchString(string(out.Type)) {
+		return nil, fmt.Errorf("%w: type must match %s", ErrLedgerTypeInvalid, ledgerTypeKeyPattern.String())
+	}
+	if _, alias := ledgerTypeAliases[string(out.Type)]; alias {
+		return nil, fmt.Errorf("%w: %s", ErrLedgerTypeExists, out.Type)
+	}
+	if out.Name == "" {
+		out.Name = string(out.Type)
+	}
+	if out.SheetName == "" {
+		out.SheetName = out.Name
+	}
+	if len([]rune(out.SheetName)) > 31 || strings.ContainsAny(out.SheetName, `[]:*?/\`) {
+		return nil, fmt.Errorf("%w: sheet name %q is not a valid worksheet name", ErrLedgerTypeInvalid, out.SheetName)
+	}
+	if strings.EqualFold(out.SheetName, MatrixSheetName) {
+		return nil, fmt.Errorf("%w: sheet name %s is reserved", ErrLedgerTypeExists, out.SheetName)
+	}
+	for typ, existing := range s.ledgerTypes {
+		if typ == replacing {
+			continue
+		}
+		if strings.EqualFold(existing.SheetName, out.SheetName) {
+			return nil, fmt.Errorf("%w: sheet name %s", ErrLedgerTypeExists, out.SheetName)
+		}
+	}
+	seen := make(map[LedgerType]struct{}, len(def.LinkTypes))
+	for _, link := range def.LinkTypes {
+		target := NormaliseLedgerType(string(link))
+		if _, ok := s.ledgerTypes[target]; !ok && target != out.Type {
+			return nil, fmt.Errorf("%w: link target %s", ErrLedgerTypeUnknown, link)
+		}
+		if _, dup := seen[target]; dup {
+			continue
+		}
+		seen[target] = struct{}{}
+		out.LinkTypes = append(out.LinkTypes, target)
+	}
+	return out, nil
+}
+
+// LedgerTypes returns every registered ledger definition, built-ins first.
+func (s *LedgerStore) LedgerTypes() []*LedgerTypeDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*LedgerTypeDefinition, 0, len(s.ledgerTypeOrder))
+	for _, typ := range s.ledgerTypeOrder {
+		out = append(out, s.ledgerTypes[typ].Clone())
+	}
+	return out
+}
+
+// LedgerTypeKeys returns the keys of every registered ledger, built-ins first.
+func (s *LedgerStore) LedgerTypeKeys() []LedgerType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ledgerTypesLocked()
+}
+
+// LedgerType returns the definition of a registered ledger type.
+func (s *LedgerStore) LedgerType(typ LedgerType) (*LedgerTypeDefinition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	def, ok := s.ledgerTypes[typ]
+	return def.Clone(), ok
+}
+
+// ResolveLedgerType maps free-form input, including built-in aliases, onto a registered type.
+func (s *LedgerStore) ResolveLedgerType(value string) (LedgerType, bool) {
+	typ := NormaliseLedgerType(value)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.ledgerTypes[typ]
+	return typ, ok
+}
+
+// RegisterLedgerType adds a custom ledger type.
+func (s *LedgerStore) RegisterLedgerType(def LedgerTypeDefinition, actor string) (*LedgerTypeDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	normalised, err := s.normaliseLedgerTypeLocked(def, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.ledgerTypes[normalised.Type]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrLedgerTypeExists, normalised.Type)
+	}
+	normalised.CreatedAt = time.Now().UTC()
+	normalised.UpdatedAt = normalised.CreatedAt
+	s.ledgerTypes[normalised.Type] = normalised
+	s.ledgerTypeOrder = append(s.ledgerTypeOrder, normalised.Type)
+	s.appendAuditLocked(actor, "ledger_type_create", string(normalised.Type))
+	return normalised.Clone(), nil
+}
+
+// UpdateLedgerType changes the display name, sheet name or link rules of a custom ledger type.
+func (s *LedgerStore) UpdateLedgerType(typ LedgerType, def LedgerTypeDefinition, actor string) (*LedgerTypeDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.ledgerTypes[typ]
+	if !ok {
+		return nil, ErrLedgerTypeUnknown
+	}
+	if existing.BuiltIn {
+		return nil, ErrLedgerTypeBuiltIn
+	}
+	def.Type = typ
+	normalised, err := s.normaliseLedgerTypeLocked(def, typ)
+	if err != nil {
+		return nil, err
+	}
+	normalised.CreatedAt = existing.CreatedAt
+	normalised.UpdatedAt = time.Now().UTC()
+	s.ledgerTypes[typ] = normalised
+	s.appendAuditLocked(actor, "ledger_type_update", string(typ))
+	return normalised.Clone(), nil
+}
+
+// DeleteLedgerType removes an empty custom ledger type together with its schema. Types still
+// named in another ledger's link rules or read by a saved report are refused.
+func (s *LedgerStore) DeleteLedgerType(typ LedgerType, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.ledgerTypes[typ]
+	if !ok {
+		return ErrLedgerTypeUnknown
+	}
+	if existing.BuiltIn {
+		return ErrLedgerTypeBuiltIn
+	}
+	if len(s.entries[typ]) > 0 {
+		return ErrLedgerTypeInUse
+	}
+	for _, other := range s.ledgerTypes {
+		if other.Type == typ || len(other.LinkTypes) == 0 {
+			continue
+		}
+		if other.AllowsLink(typ) {
+			return fmt.Errorf("%w: referenced by %s link rules", ErrLedgerTypeInUse, other.Type)
+		}
+	}
+	if reports := s.reportsReferencingLocked(typ); len(reports) > 0 {
+		return fmt.Errorf("%w: read by report %s", ErrLedgerTypeInUse, strings.Join(reports, ", "))
+	}
+	delete(s.ledgerTypes, typ)
+	delete(s.schemas, typ)
+	delete(s.naturalKeys, typ)
+	delete(s.entries, typ)
+	delete(s.entryIndex, typ)
+	for i, key := range s.ledgerTypeOrder {
+		if key == typ {
+			s.ledgerTypeOrder = append(s.ledgerTypeOrder[:i], s.ledgerTypeOrder[i+1:]...)
+			break
+		}
+	}
+	s.appendAuditLocked(actor, "ledger_type_delete", string(typ))
+	return nil
+}
+
+// checkLedgerLinksLocked verifies the ledger is registered and its candidates only link to
+// ledgers permitted by the type's link rules.
+func (s *LedgerStore) checkLedgerLinksLocked(typ LedgerType, candidates []LedgerEntry) error {
+	def, ok := s.ledgerTypes[typ]
+	if !ok {
+		return ErrLedgerTypeUnknown
+	}
+	for _, entry := range candidates {
+		for target, ids := range entry.Links {
+			if len(ids) == 0 {
+				continue
+			}
+			if _, known := s.ledgerTypes[target]; !known {
+				return fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, target)
+			}
+			if !def.AllowsLink(target) {
+				return fmt.Errorf("%w: %s -> %s", ErrLinkNotAllowed, typ, target)
+			}
+		}
+	}
+	return nil
+}
+
+// validNaturalKey reports whether key names a single-valued field: name or attributes.<key>.
+func validNaturalKey(key string) bool {
+	return key == "name" || (strings.HasPrefix(key, "attributes.") && len(key) > len("attributes."))
+}
+
+// naturalKeyValue returns the comparable natural key of an entry, or "" when it has none. IP
+// entries without an address attribute fall back to an address in their name.
+func naturalKeyValue(typ LedgerType, key string, entry LedgerEntry) string {
+	var value string
+	if values := entryValues(entry, key); len(values) > 0 {
+		value = strings.TrimSpace(values[0])
+	}
+	if value == "" && typ == LedgerTypeIP && key == "attributes."+IPAddressAttribute {
+		value, _ = NormaliseIPAddress(entry.Name)
+	}
+	return strings.ToLower(value)
+}
+
+func (s *LedgerStore) naturalKeySnapshotLocked() map[LedgerType]string {
+	out := make(map[LedgerType]string, len(s.naturalKeys))
+	for typ, key := range s.naturalKeys {
+		out[typ] = key
+	}
+	return out
+}
+
+// restoreNaturalKeysLocked applies persisted natural keys, skipping unknown ledgers and keys.
+func (s *LedgerStore) restoreNaturalKeysLocked(keys map[LedgerType]string) {
+	for typ, key := range keys {
+		if _, ok := s.ledgerTypes[typ]; ok && validNaturalKey(key) {
+			s.naturalKeys[typ] = key
+		}
+	}
+}
+
+func (s *LedgerStore) naturalKeyLocked(typ LedgerType) string {
+	if key := s.naturalKeys[typ]; key != "" {
+		return key
+	}
+	if key := defaultNaturalKeys[typ]; key != "" {
+		return key
+	}
+	return "name"
+}
+
+// NaturalKey returns the field merge imports use to match rows to entries of the ledger.
+func (s *LedgerStore) NaturalKey(typ LedgerType) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.ledgerTypes[typ]; !ok {
+		return "", ErrLedgerTypeUnknown
+	}
+	return s.naturalKeyLocked(typ), nil
+}
+
+// SetNaturalKey changes the natural key of a ledger; an empty key restores the default.
+func (s *LedgerStore) SetNaturalKey(typ LedgerType, key string, actor string) (string, error) {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(strings.ToLower(key), "attributes.") {
+		key = "attributes." + key[len("attributes."):]
+	} else {
+		key = strings.ToLower(key)
+	}
+	if key != "" && !validNaturalKey(key) {
+		return "", fmt.Errorf("%w: natural key %q", ErrLedgerTypeInvalid, key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ledgerTypes[typ]; !ok {
+		return "", ErrLedgerTypeUnknown
+	}
+	if key == "" {
+		delete(s.naturalKeys, typ)
+	} else {
+		s.naturalKeys[typ] = key
+	}
+	s.appendAuditLocked(actor, "ledger_natural_key", fmt.Sprintf("%s=%s", typ, s.naturalKeyLocked(typ)))
+	return s.naturalKeyLocked(typ), nil
+}
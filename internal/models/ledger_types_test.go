@@ -0,0 +1,120 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCustomLedgerTypeLifecycle(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.RegisterLedgerType(LedgerTypeDefinition{Type: "ip"}, "tester"); !errors.Is(err, ErrLedgerTypeExists) {
+		t.Fatalf("expected alias collision, got %v", err)
+	}
+	if _, err := store.RegisterLedgerType(LedgerTypeDefinition{Type: "racks", SheetName: "System"}, "tester"); !errors.Is(err, ErrLedgerTypeExists) {
+		t.Fatalf("expected sheet name collision, got %v", err)
+	}
+	def, err := store.RegisterLedgerType(LedgerTypeDefinition{Type: "Certificates", Name: "证书", LinkTypes: []LedgerType{"system"}}, "tester")
+	if err != nil {
+		t.Fatalf("register ledger type: %v", err)
+	}
+	if def.Type != "certificates" || def.SheetName != "证书" || len(def.LinkTypes) != 1 || def.LinkTypes[0] != LedgerTypeSystem {
+		t.Fatalf("unexpected definition: %+v", def)
+	}
+	if typ, ok := store.ResolveLedgerType(" CERTIFICATES "); !ok || typ != def.Type {
+		t.Fatalf("expected custom type to resolve, got %q %v", typ, ok)
+	}
+
+	system, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	cert, err := store.CreateEntry(def.Type, LedgerEntry{Name: "*.example.com", Links: map[LedgerType][]string{LedgerTypeSystem: {system.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	if _, err := store.CreateEntry(def.Type, LedgerEntry{Name: "bad", Links: map[LedgerType][]string{LedgerTypeIP: {"x"}}}, "tester"); !errors.Is(err, ErrLinkNotAllowed) {
+		t.Fatalf("expected link rule violation, got %v", err)
+	}
+	if _, err := store.CreateEntry("domains", LedgerEntry{Name: "example.com"}, "tester"); !errors.Is(err, ErrLedgerTypeUnknown) {
+		t.Fatalf("expected unknown ledger, got %v", err)
+	}
+
+	var found bool
+	for _, overview := range store.OverviewStats(nil).Ledgers {
+		if overview.Type == def.Type && overview.Count == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected overview to include custom ledger")
+	}
+
+	var buf bytes.Buffer
+	if err := store.WriteSnapshotJSON(&buf); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	restored := newTestStore(t)
+	if err := restored.ImportSnapshot(&snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if got, err := restored.GetEntry(def.Type, cert.ID); err != nil || got.Name != cert.Name {
+		t.Fatalf("expected custom entries to round-trip, got %+v %v", got, err)
+	}
+
+	if err := store.DeleteLedgerType(LedgerTypeSystem, "tester"); !errors.Is(err, ErrLedgerTypeBuiltIn) {
+		t.Fatalf("expected built-in types to be protected, got %v", err)
+	}
+	if err := store.DeleteLedgerType(def.Type, "tester"); !errors.Is(err, ErrLedgerTypeInUse) {
+		t.Fatalf("expected non-empty ledger to be protected, got %v", err)
+	}
+	if err := store.DeleteEntry(def.Type, cert.ID, "tester"); err != nil {
+		t.Fatalf("delete certificate: %v", err)
+	}
+	if err := store.DeleteLedgerType(def.Type, "tester"); err != nil {
+		t.Fatalf("delete ledger type: %v", err)
+	}
+	if _, ok := store.ResolveLedgerType("certificates"); ok {
+		t.Fatalf("expected deleted type to stop resolving")
+	}
+}
+
+func TestRestoreKeepsTypesLinkingToLaterTypes(t *testing.T) {
+	store := newTestStore(t)
+	racks, err := store.RegisterLedgerType(LedgerTypeDefinition{Type: "racks"}, "tester")
+	if err != nil {
+		t.Fatalf("register racks: %v", err)
+	}
+	if _, err := store.RegisterLedgerType(LedgerTypeDefinition{Type: "rooms", LinkTypes: []LedgerType{racks.Type}}, "tester"); err != nil {
+		t.Fatalf("register rooms: %v", err)
+	}
+	if _, err := store.CreateEntry("rooms", LedgerEntry{Name: "B1"}, "tester"); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+
+	// A snapshot may list a type before the type it links to.
+	snapshot := store.ExportSnapshot()
+	types := snapshot.LedgerTypes
+	for i, j := 0, len(types)-1; i < j; i, j = i+1, j-1 {
+		types[i], types[j] = types[j], types[i]
+	}
+	restored := newTestStore(t)
+	if err := restored.ImportSnapshot(snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	entries, total, err := restored.QueryEntries("rooms", LedgerQuery{})
+	if err != nil || total != 1 || entries[0].Name != "B1" {
+		t.Fatalf("expected the rooms ledger to survive, got %+v (%v)", entries, err)
+	}
+	for _, def := range restored.LedgerTypes() {
+		if def.Type == "rooms" && (len(def.LinkTypes) != 1 || def.LinkTypes[0] != racks.Type) {
+			t.Fatalf("expected the link to the later type to be kept, got %+v", def.LinkTypes)
+		}
+	}
+}
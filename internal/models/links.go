@@ -0,0 +1,357 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrLinkTargetNotFound indicates an entry links to an ID that does not exist in the target ledger.
+	ErrLinkTargetNotFound = errors.New("link_target_not_found")
+	// ErrEntryLinked indicates a restricted delete was refused because other entries link to the entry.
+	ErrEntryLinked = errors.New("entry_linked")
+)
+
+// DeleteMode selects how DeleteEntryWithMode treats links pointing at the removed entry.
+type DeleteMode string
+
+const (
+	// DeleteCascade removes the entry and unlinks it from every entry that references it.
+	DeleteCascade DeleteMode = "cascade"
+	// DeleteRestrict refuses to remove an entry that still has links.
+	DeleteRestrict DeleteMode = "restrict"
+)
+
+// Broken link reasons reported by BrokenLinks.
+const (
+	BrokenLinkMissing    = "missing_target"
+	BrokenLinkAsymmetric = "missing_reverse"
+)
+
+// BrokenLink reports a link that is dangling or lacks its reverse side.
+type BrokenLink struct {
+	Type       LedgerType `json:"type"`
+	EntryID    string     `json:"entry_id"`
+	EntryName  string     `json:"entry_name"`
+	TargetType LedgerType `json:"target_type"`
+	TargetID   string     `json:"target_id"`
+	Reason     string     `json:"reason"`
+}
+
+type entryRef struct {
+	typ LedgerType
+	id  string
+}
+
+// entryIndexLocked returns the position of an entry in its ledger, or -1 when it is missing.
+func (s *LedgerStore) entryIndexLocked(typ LedgerType, id string) int {
+	if idx, ok := s.entryIndex[typ][id]; ok {
+		return idx
+	}
+	return -1
+}
+
+// reindexLedgerLocked rebuilds the ID index of a ledger. Anything that adds, removes or moves
+// entries of typ calls it (or appendEntryLocked) before the next lookup; updating an entry in
+// place keeps its position.
+func (s *LedgerStore) reindexLedgerLocked(typ LedgerType) {
+	items, ok := s.entries[typ]
+	if !ok {
+		delete(s.entryIndex, typ)
+		return
+	}
+	index := make(map[string]int, len(items))
+	for i, entry := range items {
+		if _, dup := index[entry.ID]; !dup {
+			index[entry.ID] = i
+		}
+	}
+	s.entryIndex[typ] = index
+}
+
+// reindexEntriesLocked rebuilds the ID index of every ledger.
+func (s *LedgerStore) reindexEntriesLocked() {
+	s.entryIndex = make(map[LedgerType]map[string]int, len(s.entries))
+	for typ := range s.entries {
+		s.reindexLedgerLocked(typ)
+	}
+}
+
+// appendEntryLocked adds entry at the end of its ledger.
+func (s *LedgerStore) appendEntryLocked(typ LedgerType, entry LedgerEntry) {
+	s.entries[typ] = append(s.entries[typ], entry)
+	if s.entryIndex[typ] == nil {
+		s.entryIndex[typ] = make(map[string]int)
+	}
+	if _, dup := s.entryIndex[typ][entry.ID]; !dup {
+		s.entryIndex[typ][entry.ID] = len(s.entries[typ]) - 1
+	}
+}
+
+// normaliseLinksLocked trims and de-duplicates the link IDs of each candidate and verifies
+// every target exists and accepts links back from typ.
+func (s *LedgerStore) normaliseLinksLocked(typ LedgerType, candidates []LedgerEntry) error {
+	for i := range candidates {
+		entry := &candidates[i]
+		if len(entry.Links) == 0 {
+			continue
+		}
+		links := make(map[LedgerType][]string, len(entry.Links))
+		for target, ids := range entry.Links {
+			cleaned := make([]string, 0, len(ids))
+			seen := make(map[string]struct{}, len(ids))
+			for _, id := range ids {
+				id = strings.TrimSpace(id)
+				if id == "" || (target == typ && id == entry.ID) {
+					continue
+				}
+				if _, dup := seen[id]; dup {
+					continue
+				}
+				seen[id] = struct{}{}
+				cleaned = append(cleaned, id)
+			}
+			if len(cleaned) == 0 {
+				continue
+			}
+			if def := s.ledgerTypes[target]; !def.AllowsLink(typ) {
+				return fmt.Errorf("%w: %s -> %s", ErrLinkNotAllowed, target, typ)
+			}
+			for _, id := range cleaned {
+				if s.entryIndexLocked(target, id) < 0 {
+					return fmt.Errorf("%w: %s/%s", ErrLinkTargetNotFound, target, id)
+				}
+			}
+			links[target] = cleaned
+		}
+		entry.Links = links
+	}
+	return nil
+}
+
+func (s *LedgerStore) addLinkLocked(typ LedgerType, id string, target LedgerType, targetID string) {
+	idx := s.entryIndexLocked(typ, id)
+	if idx < 0 {
+		return
+	}
+	entry := &s.entries[typ][idx]
+	for _, existing := range entry.Links[target] {
+		if existing == targetID {
+			return
+		}
+	}
+	s.touchEntryLocked(typ, id)
+	if entry.Links == nil {
+		entry.Links = make(map[LedgerType][]string)
+	}
+	entry.Links[target] = append(entry.Links[target], targetID)
+}
+
+func (s *LedgerStore) removeLinkLocked(typ LedgerType, id string, target LedgerType, targetID string) {
+	idx := s.entryIndexLocked(typ, id)
+	if idx < 0 {
+		return
+	}
+	entry := &s.entries[typ][idx]
+	ids := entry.Links[target]
+	if !containsString(ids, targetID) {
+		return
+	}
+	s.touchEntryLocked(typ, id)
+	filtered := make([]string, 0, len(ids))
+	for _, existing := range ids {
+		if existing != targetID {
+			filtered = append(filtered, existing)
+		}
+	}
+	if len(filtered) == 0 {
+		delete(entry.Links, target)
+		return
+	}
+	entry.Links[target] = filtered
+}
+
+// syncLinksLocked mirrors the link changes between before and after onto the linked entries.
+// Either side may be the zero entry for creations and deletions.
+func (s *LedgerStore) syncLinksLocked(typ LedgerType, id string, before, after map[LedgerType][]string) {
+	previous := make(map[entryRef]struct{})
+	for target, ids := range before {
+		for _, targetID := range ids {
+			previous[entryRef{target, targetID}] = struct{}{}
+		}
+	}
+	for target, ids := range after {
+		for _, targetID := range ids {
+			ref := entryRef{target, targetID}
+			if _, ok := previous[ref]; ok {
+				delete(previous, ref)
+				continue
+			}
+			s.addLinkLocked(target, targetID, typ, id)
+		}
+	}
+	for ref := range previous {
+		s.removeLinkLocked(ref.typ, ref.id, typ, id)
+	}
+}
+
+// unlinkAllLocked removes every reference to the entry from the rest of the store.
+func (s *LedgerStore) unlinkAllLocked(typ LedgerType, id string) {
+	for _, other := range s.ledgerTypeOrder {
+		items := s.entries[other]
+		for i := range items {
+			ids := items[i].Links[typ]
+			if len(ids) == 0 {
+				continue
+			}
+			s.removeLinkLocked(other, items[i].ID, typ, id)
+		}
+	}
+}
+
+// isReferencedLocked reports whether the entry has links or any other entry links to it.
+func (s *LedgerStore) isReferencedLocked(typ LedgerType, entry LedgerEntry) bool {
+	for _, ids := range entry.Links {
+		if len(ids) > 0 {
+			return true
+		}
+	}
+	for _, other := range s.ledgerTypeOrder {
+		for _, item := range s.entries[other] {
+			for _, linked := range item.Links[typ] {
+				if linked == entry.ID {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// relinkLedgerLocked makes the links between typ and the rest of the store symmetric after the
+// ledger has been replaced wholesale. The replaced ledger is authoritative: other entries keep
+// a link to typ only when the new entry links back. Links within typ are mirrored as a union.
+func (s *LedgerStore) relinkLedgerLocked(typ LedgerType) {
+	wanted := make(map[entryRef]map[string]struct{})
+	for _, entry := range s.entries[typ] {
+		for target, ids := range entry.Links {
+			for _, targetID := range ids {
+				ref := entryRef{target, targetID}
+				if wanted[ref] == nil {
+					wanted[ref] = make(map[string]struct{})
+				}
+				wanted[ref][entry.ID] = struct{}{}
+			}
+		}
+	}
+	for _, other := range s.ledgerTypeOrder {
+		items := s.entries[other]
+		for i := range items {
+			ref := entryRef{other, items[i].ID}
+			if len(wanted[ref]) > 0 || len(items[i].Links[typ]) > 0 {
+				s.touchEntryLocked(other, items[i].ID)
+			}
+			if other == typ {
+				for id := range wanted[ref] {
+					if !containsString(items[i].Links[typ], id) {
+						if items[i].Links == nil {
+							items[i].Links = make(map[LedgerType][]string)
+						}
+						items[i].Links[typ] = append(items[i].Links[typ], id)
+					}
+				}
+				continue
+			}
+			ids := make([]string, 0, len(wanted[ref]))
+			for _, existing := range items[i].Links[typ] {
+				if _, ok := wanted[ref][existing]; ok {
+					ids = append(ids, existing)
+					delete(wanted[ref], existing)
+				}
+			}
+			added := make([]string, 0, len(wanted[ref]))
+			for id := range wanted[ref] {
+				added = append(added, id)
+			}
+			sort.Strings(added)
+			ids = append(ids, added...)
+			if len(ids) == 0 {
+				delete(items[i].Links, typ)
+				continue
+			}
+			if items[i].Links == nil {
+				items[i].Links = make(map[LedgerType][]string)
+			}
+			items[i].Links[typ] = ids
+		}
+	}
+}
+
+// BrokenLinks lists links whose target no longer exists or whose target does not link back,
+// typically left behind by merged snapshot imports.
+func (s *LedgerStore) BrokenLinks() []BrokenLink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.brokenLinksLocked()
+}
+
+func (s *LedgerStore) brokenLinksLocked() []BrokenLink {
+	broken := make([]BrokenLink, 0)
+	for _, typ := range s.ledgerTypeOrder {
+		for _, entry := range s.entries[typ] {
+			targets := make([]LedgerType, 0, len(entry.Links))
+			for target := range entry.Links {
+				targets = append(targets, target)
+			}
+			sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+			for _, target := range targets {
+				for _, targetID := range entry.Links[target] {
+					link := BrokenLink{Type: typ, EntryID: entry.ID, EntryName: entry.Name, TargetType: target, TargetID: targetID}
+					idx := s.entryIndexLocked(target, targetID)
+					if idx < 0 {
+						link.Reason = BrokenLinkMissing
+						broken = append(broken, link)
+						continue
+					}
+					if !containsString(s.entries[target][idx].Links[typ], entry.ID) {
+						link.Reason = BrokenLinkAsymmetric
+						broken = append(broken, link)
+					}
+				}
+			}
+		}
+	}
+	return broken
+}
+
+// RepairLinks drops dangling links and adds missing reverse links, returning what was fixed.
+func (s *LedgerStore) RepairLinks(actor string) []BrokenLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	broken := s.brokenLinksLocked()
+	if len(broken) == 0 {
+		return broken
+	}
+	for _, link := range broken {
+		switch link.Reason {
+		case BrokenLinkMissing:
+			s.removeLinkLocked(link.Type, link.EntryID, link.TargetType, link.TargetID)
+		case BrokenLinkAsymmetric:
+			s.addLinkLocked(link.TargetType, link.TargetID, link.Type, link.EntryID)
+		}
+	}
+	s.appendAuditLocked(actor, "repair_links", fmt.Sprintf("count=%d", len(broken)))
+	s.commitLocked(actor)
+	return broken
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLedgerLinksStaySymmetric(t *testing.T) {
+	store := newTestStore(t)
+
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {"personnel-missing"}}}, "tester"); !errors.Is(err, ErrLinkTargetNotFound) {
+		t.Fatalf("expected dangling link to be rejected, got %v", err)
+	}
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID, " " + alice.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if got := erp.Links[LedgerTypePersonnel]; len(got) != 1 {
+		t.Fatalf("expected de-duplicated links, got %v", got)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); !containsString(got.Links[LedgerTypeSystem], erp.ID) {
+		t.Fatalf("expected reverse link on alice, got %v", got.Links)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypeSystem, erp.ID, LedgerEntry{Links: map[LedgerType][]string{LedgerTypePersonnel: {bob.ID}}}, "tester"); err != nil {
+		t.Fatalf("relink system: %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); len(got.Links[LedgerTypeSystem]) != 0 {
+		t.Fatalf("expected alice to be unlinked, got %v", got.Links)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, bob.ID); !containsString(got.Links[LedgerTypeSystem], erp.ID) {
+		t.Fatalf("expected reverse link on bob, got %v", got.Links)
+	}
+
+	if err := store.DeleteEntryWithMode(LedgerTypePersonnel, bob.ID, DeleteRestrict, "tester"); !errors.Is(err, ErrEntryLinked) {
+		t.Fatalf("expected restricted delete to be refused, got %v", err)
+	}
+	if err := store.DeleteEntry(LedgerTypePersonnel, bob.ID, "tester"); err != nil {
+		t.Fatalf("cascade delete: %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypeSystem, erp.ID); len(got.Links[LedgerTypePersonnel]) != 0 {
+		t.Fatalf("expected cascade to remove dangling link, got %v", got.Links)
+	}
+	if broken := store.BrokenLinks(); len(broken) != 0 {
+		t.Fatalf("expected no broken links, got %+v", broken)
+	}
+}
+
+func TestBrokenLinksAfterMerge(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+
+	err = store.ImportSnapshotMerge(&Snapshot{Entries: map[LedgerType][]LedgerEntry{
+		LedgerTypeSystem: {{ID: "systems-imported", Name: "CRM", Links: map[LedgerType][]string{
+			LedgerTypePersonnel: {alice.ID, "personnel-gone"},
+		}}},
+	}})
+	if err != nil {
+		t.Fatalf("merge snapshot: %v", err)
+	}
+	broken := store.BrokenLinks()
+	reasons := map[string]string{}
+	for _, link := range broken {
+		reasons[link.TargetID] = link.Reason
+	}
+	if len(broken) != 2 || reasons[alice.ID] != BrokenLinkAsymmetric || reasons["personnel-gone"] != BrokenLinkMissing {
+		t.Fatalf("unexpected broken links: %+v", broken)
+	}
+
+	store.RepairLinks("tester")
+	if remaining := store.BrokenLinks(); len(remaining) != 0 {
+		t.Fatalf("expected repair to fix all links, got %+v", remaining)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); !containsString(got.Links[LedgerTypeSystem], "systems-imported") {
+		t.Fatalf("expected repair to add reverse link, got %v", got.Links)
+	}
+}
+
+func TestEntryIndexFollowsStructuralChanges(t *testing.T) {
+	store := newTestStore(t)
+	check := func(step string) {
+		t.Helper()
+		for _, typ := range store.ledgerTypeOrder {
+			items := store.entries[typ]
+			if len(store.entryIndex[typ]) != len(items) {
+				t.Fatalf("%s: index of %s has %d ids for %d entries", step, typ, len(store.entryIndex[typ]), len(items))
+			}
+			for i, entry := range items {
+				if got := store.entryIndexLocked(typ, entry.ID); got != i {
+					t.Fatalf("%s: expected %s at %d, got %d", step, entry.ID, i, got)
+				}
+			}
+		}
+	}
+	var ids []string
+	for _, name := range []string{"ERP", "OA", "CRM"} {
+		entry, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: name}, "tester")
+		if err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	check("create")
+	if _, err := store.AppendEntries(LedgerTypeSystem, []LedgerEntry{{Name: "HR"}}, "tester"); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	check("append")
+	if err := store.DeleteEntry(LedgerTypeSystem, ids[0], "tester"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	check("delete")
+	if _, err := store.GetEntry(LedgerTypeSystem, ids[0]); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("expected the deleted entry to be gone, got %v", err)
+	}
+	if _, err := store.ReorderEntries(LedgerTypeSystem, []string{ids[2], ids[1]}, "tester"); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	check("reorder")
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo reorder: %v", err)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo delete: %v", err)
+	}
+	check("undo")
+	if entry, err := store.GetEntry(LedgerTypeSystem, ids[0]); err != nil || entry.Name != "ERP" {
+		t.Fatalf("expected the entry back, got %+v (%v)", entry, err)
+	}
+	if _, err := store.BulkUpdateEntries(LedgerTypeSystem, BulkRequest{IDs: []string{ids[1]}, Operations: []BulkOperation{{Op: BulkOpDelete}}}, "tester"); err != nil {
+		t.Fatalf("bulk delete: %v", err)
+	}
+	check("bulk delete")
+	if _, err := store.RestoreTrash(store.ListTrash(TrashKindEntry, LedgerTypeSystem)[0].ID, "tester"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	check("restore")
+	if err := store.ReplaceEntries(LedgerTypeSystem, []LedgerEntry{{ID: ids[1], Name: "OA"}}, "tester"); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	check("replace")
+	if err := store.ImportSnapshot(store.ExportSnapshot()); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	check("import")
+}
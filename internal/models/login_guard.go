@@ -0,0 +1,331 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLoginThrottled indicates too many recent failures for the username or address.
+	ErrLoginThrottled = errors.New("login_throttled")
+	// ErrAccountLocked indicates the account is locked after repeated failures.
+	ErrAccountLocked = errors.New("account_locked")
+	// ErrLoginBlockNotFound indicates the address is not blocked.
+	ErrLoginBlockNotFound = errors.New("login_block_not_found")
+)
+
+// LoginPolicy sets how failed sign-ins are throttled. After each failure a username must wait
+// BaseDelay, doubling per further failure up to MaxDelay; MaxFailures in a row lock the account
+// for Lockout. An address is blocked for Lockout after IPMaxFailures failures across any
+// usernames. Failures older than Window are forgotten.
+type LoginPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Lockout       time.Duration
+	Window        time.Duration
+}
+
+// DefaultLoginPolicy is used unless StoreConfig or SetLoginPolicy changes it.
+var DefaultLoginPolicy = LoginPolicy{
+	MaxFailures:   5,
+	IPMaxFailures: 20,
+	BaseDelay:     time.Second,
+	MaxDelay:      time.Minute,
+	Lockout:       15 * time.Minute,
+	Window:        time.Hour,
+}
+
+// LoginBlockedError reports a refused sign-in and when it may be tried again.
+type LoginBlockedError struct {
+	Reason error
+	Until  time.Time
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%s: until %s", e.Reason.Error(), e.Until.Format(time.RFC3339))
+}
+
+// Unwrap allows errors.Is(err, ErrLoginThrottled) and errors.Is(err, ErrAccountLocked).
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Reason
+}
+
+// LoginBlock describes a username or address currently refused sign-in.
+type LoginBlock struct {
+	Kind     string    `json:"kind"`
+	Value    string    `json:"value"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// Kinds of login blocks.
+const (
+	LoginBlockUser = "user"
+	LoginBlockIP   = "ip"
+)
+
+// loginAttempts tracks recent failures of one username or address, and the sign-ins still
+// checking a password. Only account locks are persisted, on the user; the rest starts afresh
+// with the process.
+type loginAttempts struct {
+	failures     int
+	pending      int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// SetLoginPolicy replaces the login throttling policy, keeping defaults for unset fields.
+func (s *LedgerStore) SetLoginPolicy(policy LoginPolicy, actor string) {
+	policy = policy.withDefaults()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginPolicy = policy
+	s.appendAuditLocked(actor, "login_policy", fmt.Sprintf("max_failures=%d ip_max_failures=%d lockout=%s", policy.MaxFailures, policy.IPMaxFailures, policy.Lockout))
+}
+
+// withDefaults fills the unset fields of the policy from DefaultLoginPolicy.
+func (p LoginPolicy) withDefaults() LoginPolicy {
+	if p.MaxFailures <= 0 {
+		p.MaxFailures = DefaultLoginPolicy.MaxFailures
+	}
+	if p.IPMaxFailures <= 0 {
+		p.IPMaxFailures = DefaultLoginPolicy.IPMaxFailures
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultLoginPolicy.BaseDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = maxDuration(DefaultLoginPolicy.MaxDelay, p.BaseDelay)
+	}
+	if p.Lockout <= 0 {
+		p.Lockout = DefaultLoginPolicy.Lockout
+	}
+	if p.Window <= 0 {
+		p.Window = DefaultLoginPolicy.Window
+	}
+	return p
+}
+
+// Login authenticates a sign-in from ip, refusing it while the username or address is
+// throttled or the account is locked. Failed passwords are counted and audited.
+func (s *LedgerStore) Login(username, password, ip string) (*User, error) {
+	normalized := normalizeUsername(username)
+	ip = strings.TrimSpace(ip)
+	now := time.Now().UTC()
+	s.mu.Lock()
+	if err := s.loginBlockedLocked(normalized, ip, now); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	// The attempt is reserved before the lock is released so concurrent guesses are refused
+	// instead of all being checked against the same failure count.
+	s.reserveLoginLocked(normalized, ip, 1)
+	s.mu.Unlock()
+
+	// Password hashing is slow, so it runs outside the lock.
+	user, err := s.AuthenticateUser(username, password)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserveLoginLocked(normalized, ip, -1)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) && normalized != "" {
+			s.recordLoginFailureLocked(normalized, ip, now)
+		}
+		return nil, err
+	}
+	delete(s.loginAttempts, loginKey(LoginBlockUser, normalized))
+	if stored, ok := s.userByName[normalized]; ok {
+		stored.LockedUntil = nil
+	}
+	return user, nil
+}
+
+func (s *LedgerStore) loginBlockedLocked(username, ip string, now time.Time) error {
+	if user, ok := s.userByName[username]; ok && user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return &LoginBlockedError{Reason: ErrAccountLocked, Until: *user.LockedUntil}
+	}
+	if attempts, ok := s.loginAttempts[loginKey(LoginBlockUser, username)]; ok {
+		if now.Before(attempts.blockedUntil) {
+			return &LoginBlockedError{Reason: ErrAccountLocked, Until: attempts.blockedUntil}
+		}
+		if until := attempts.last.Add(s.loginDelayLocked(attempts.failures)); attempts.failures > 0 && now.Before(until) {
+			return &LoginBlockedError{Reason: ErrLoginThrottled, Until: until}
+		}
+		// One password at a time per username, so the delay applies between guesses.
+		if attempts.pending > 0 {
+			return &LoginBlockedError{Reason: ErrLoginThrottled, Until: now.Add(s.loginPolicy.BaseDelay)}
+		}
+	}
+	if attempts, ok := s.loginAttempts[loginKey(LoginBlockIP, ip)]; ok && ip != "" {
+		if now.Before(attempts.blockedUntil) {
+			return &LoginBlockedError{Reason: ErrLoginThrottled, Until: attempts.blockedUntil}
+		}
+		failures := attempts.failures
+		if now.Sub(attempts.last) > s.loginPolicy.Window {
+			failures = 0
+		}
+		if failures+attempts.pending >= s.loginPolicy.IPMaxFailures {
+			return &LoginBlockedError{Reason: ErrLoginThrottled, Until: now.Add(s.loginPolicy.BaseDelay)}
+		}
+	}
+	return nil
+}
+
+// reserveLoginLocked adds delta to the sign-ins in progress for the username and address,
+// forgetting entries left with nothing to track.
+func (s *LedgerStore) reserveLoginLocked(username, ip string, delta int) {
+	var keys []string
+	if username != "" {
+		keys = append(keys, loginKey(LoginBlockUser, username))
+	}
+	if ip != "" {
+		keys = append(keys, loginKey(LoginBlockIP, ip))
+	}
+	for _, key := range keys {
+		attempts, ok := s.loginAttempts[key]
+		if !ok {
+			if delta < 0 {
+				continue
+			}
+			attempts = &loginAttempts{}
+			s.loginAttempts[key] = attempts
+		}
+		attempts.pending += delta
+		if attempts.pending < 0 {
+			attempts.pending = 0
+		}
+		if attempts.pending == 0 && attempts.failures == 0 && attempts.blockedUntil.IsZero() {
+			delete(s.loginAttempts, key)
+		}
+	}
+}
+
+// loginDelayLocked is how long a username waits after its nth consecutive failure.
+func (s *LedgerStore) loginDelayLocked(failures int) time.Duration {
+	delay := s.loginPolicy.BaseDelay
+	for i := 1; i < failures && delay < s.loginPolicy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.loginPolicy.MaxDelay {
+		delay = s.loginPolicy.MaxDelay
+	}
+	return delay
+}
+
+func (s *LedgerStore) recordLoginFailureLocked(username, ip string, now time.Time) {
+	s.pruneLoginAttemptsLocked(now)
+	s.appendAuditLocked("anonymous", "login_failed", fmt.Sprintf("username=%s ip=%s", username, ip))
+
+	attempts := s.loginAttemptsLocked(loginKey(LoginBlockUser, username), now)
+	if attempts.failures >= s.loginPolicy.MaxFailures {
+		until := now.Add(s.loginPolicy.Lockout)
+		attempts.failures = 0
+		// Unknown usernames are refused the same way so the lock does not reveal which exist.
+		if user, ok := s.userByName[username]; ok {
+			user.LockedUntil = &until
+			s.appendAuditLocked("system", "user_locked", fmt.Sprintf("%s until=%s", user.ID, until.Format(time.RFC3339)))
+		} else {
+			attempts.blockedUntil = until
+		}
+	}
+	if ip == "" {
+		return
+	}
+	attempts = s.loginAttemptsLocked(loginKey(LoginBlockIP, ip), now)
+	if attempts.failures >= s.loginPolicy.IPMaxFailures {
+		attempts.failures = 0
+		attempts.blockedUntil = now.Add(s.loginPolicy.Lockout)
+		s.appendAuditLocked("system", "login_ip_blocked", fmt.Sprintf("%s until=%s", ip, attempts.blockedUntil.Format(time.RFC3339)))
+	}
+}
+
+// loginAttemptsLocked counts one more failure for key, starting over once the last one is
+// older than the policy window.
+func (s *LedgerStore) loginAttemptsLocked(key string, now time.Time) *loginAttempts {
+	attempts, ok := s.loginAttempts[key]
+	if !ok {
+		attempts = &loginAttempts{}
+		s.loginAttempts[key] = attempts
+	}
+	if now.Sub(attempts.last) > s.loginPolicy.Window {
+		attempts.failures = 0
+	}
+	attempts.failures++
+	attempts.last = now
+	return attempts
+}
+
+func (s *LedgerStore) pruneLoginAttemptsLocked(now time.Time) {
+	for key, attempts := range s.loginAttempts {
+		if now.Sub(attempts.last) > s.loginPolicy.Window && !now.Before(attempts.blockedUntil) && attempts.pending == 0 {
+			delete(s.loginAttempts, key)
+		}
+	}
+}
+
+// ListLoginBlocks returns the locked accounts and blocked addresses, soonest released first.
+func (s *LedgerStore) ListLoginBlocks() []LoginBlock {
+	now := time.Now().UTC()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]LoginBlock, 0)
+	for _, id := range s.userOrder {
+		user, ok := s.users[id]
+		if ok && user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+			out = append(out, LoginBlock{Kind: LoginBlockUser, Value: user.Username, Until: *user.LockedUntil})
+		}
+	}
+	for key, attempts := range s.loginAttempts {
+		kind, value, _ := strings.Cut(key, ":")
+		if kind == LoginBlockIP && now.Before(attempts.blockedUntil) {
+			out = append(out, LoginBlock{Kind: kind, Value: value, Failures: attempts.failures, Until: attempts.blockedUntil})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// UnlockUser lifts a lockout and forgets the user's failed attempts.
+func (s *LedgerStore) UnlockUser(id, actor string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[strings.TrimSpace(id)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.LockedUntil = nil
+	user.UpdatedAt = time.Now().UTC()
+	delete(s.loginAttempts, loginKey(LoginBlockUser, normalizeUsername(user.Username)))
+	s.appendAuditLocked(strings.TrimSpace(actor), "user_unlock", user.ID)
+	return user.Clone(), nil
+}
+
+// UnblockLoginIP lifts the block on an address and forgets its failed attempts.
+func (s *LedgerStore) UnblockLoginIP(ip, actor string) error {
+	key := loginKey(LoginBlockIP, strings.TrimSpace(ip))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.loginAttempts[key]; !ok {
+		return ErrLoginBlockNotFound
+	}
+	delete(s.loginAttempts, key)
+	s.appendAuditLocked(strings.TrimSpace(actor), "login_ip_unblock", strings.TrimSpace(ip))
+	return nil
+}
+
+func loginKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
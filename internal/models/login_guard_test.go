@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginBacksOffAndLocksAccounts(t *testing.T) {
+	store := newTestStore(t)
+	user, err := store.CreateUser("ops", "Passw0rd!23", AccessViewer, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.Login("ops", "wrong-password", "198.51.100.7"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	var blocked *LoginBlockedError
+	if _, err := store.Login("ops", "Passw0rd!23", "198.51.100.7"); !errors.As(err, &blocked) || !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected an immediate retry to be throttled, got %v", err)
+	}
+
+	store.SetLoginPolicy(LoginPolicy{MaxFailures: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, "admin")
+	store.UnlockUser(user.ID, "admin")
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := store.Login("ops", "wrong-password", ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected invalid credentials, got %v", i, err)
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := store.Login("OPS", "Passw0rd!23", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+	if blocks := store.ListLoginBlocks(); len(blocks) != 1 || blocks[0].Kind != LoginBlockUser || blocks[0].Value != "ops" {
+		t.Fatalf("expected the lock to be listed, got %+v", blocks)
+	}
+
+	restored := newTestStore(t)
+	if err := restored.ImportSnapshot(store.ExportSnapshot()); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if _, err := restored.Login("ops", "Passw0rd!23", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected the lock to survive the snapshot, got %v", err)
+	}
+
+	if _, err := store.UnlockUser(user.ID, "admin"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, err := store.Login("ops", "Passw0rd!23", ""); err != nil {
+		t.Fatalf("expected login after unlock, got %v", err)
+	}
+	failed := 0
+	for _, audit := range store.ListAudits() {
+		if audit.Action == "login_failed" {
+			failed++
+		}
+	}
+	if failed != 4 {
+		t.Fatalf("expected every failed password in the audit chain, got %d", failed)
+	}
+}
+
+func TestConfiguredLoginPolicyIsNotAudited(t *testing.T) {
+	t.Setenv(adminPasswordEnv, testAdminPassword)
+	store := NewLedgerStoreWithConfig(StoreConfig{LoginPolicy: LoginPolicy{MaxFailures: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}})
+	if _, err := store.CreateUser("ops", "Passw0rd!23", AccessViewer, "admin"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.Login("ops", "wrong-password", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := store.Login("ops", "Passw0rd!23", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected the configured policy to lock the account, got %v", err)
+	}
+	for _, audit := range store.ListAudits() {
+		if audit.Action == "login_policy" {
+			t.Fatalf("configuration must not be audited: %+v", audit)
+		}
+	}
+}
+
+func TestLoginBlocksAddressesAcrossUsernames(t *testing.T) {
+	store := newTestStore(t)
+	store.SetLoginPolicy(LoginPolicy{IPMaxFailures: 2}, "admin")
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := store.Login(name, "wrong-password", "203.0.113.5"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected invalid credentials, got %v", err)
+		}
+	}
+	if _, err := store.Login("carol", "wrong-password", "203.0.113.5"); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected the address to be blocked, got %v", err)
+	}
+	if _, err := store.Login("carol", "wrong-password", "198.51.100.7"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected other addresses to be unaffected, got %v", err)
+	}
+	if err := store.UnblockLoginIP("203.0.113.5", "admin"); err != nil {
+		t.Fatalf("unblock: %v", err)
+	}
+	if err := store.UnblockLoginIP("203.0.113.5", "admin"); !errors.Is(err, ErrLoginBlockNotFound) {
+		t.Fatalf("expected the block to be gone, got %v", err)
+	}
+}
+
+func TestLoginCountsConcurrentGuesses(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.CreateUser("ops", "Passw0rd!23", AccessViewer, "admin"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	store.SetLoginPolicy(LoginPolicy{MaxFailures: 5, BaseDelay: time.Nanosecond, MaxDelay: time.Nanosecond}, "admin")
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		evaluated int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Retry while throttled, as a guesser would, until the password is checked or the
+			// account locks.
+			for {
+				_, err := store.Login("ops", "wrong-password", "198.51.100.7")
+				if errors.Is(err, ErrLoginThrottled) {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					mu.Lock()
+					evaluated++
+					mu.Unlock()
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	if evaluated != 5 {
+		t.Fatalf("expected MaxFailures guesses to be checked, got %d", evaluated)
+	}
+	if _, err := store.Login("ops", "Passw0rd!23", "198.51.100.7"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+}
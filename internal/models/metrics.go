@@ -0,0 +1,264 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Data quality issue kinds reported by DataQuality.
+const (
+	QualityMissingRequired = "missing_required"
+	QualityUnlinked        = "unlinked"
+	QualityDuplicateName   = "duplicate_name"
+)
+
+// maxQualityIssues bounds the issues listed per ledger; counts always cover every entry.
+const maxQualityIssues = 50
+
+// maxStaleListed bounds the oldest entries listed per ledger by StaleEntries.
+const maxStaleListed = 10
+
+// ActivityPoint counts the entries of a ledger created, updated and deleted on one day.
+type ActivityPoint struct {
+	Date    string `json:"date"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	Deleted int    `json:"deleted"`
+}
+
+// LedgerActivity is the daily activity of one ledger, oldest day first.
+type LedgerActivity struct {
+	Type LedgerType      `json:"type"`
+	Days []ActivityPoint `json:"days"`
+}
+
+// StaleEntry is an entry that has not been updated within the staleness threshold.
+type StaleEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+	AgeDays   int       `json:"age_days"`
+}
+
+// LedgerStaleness counts the stale entries of a ledger and lists the oldest.
+type LedgerStaleness struct {
+	Type   LedgerType   `json:"type"`
+	Total  int          `json:"total"`
+	Stale  int          `json:"stale"`
+	Oldest []StaleEntry `json:"oldest"`
+}
+
+// QualityIssue describes one problem found on an entry.
+type QualityIssue struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// LedgerQuality scores a ledger by the share of its entries without issues, from 0 to 100.
+type LedgerQuality struct {
+	Type            LedgerType     `json:"type"`
+	Total           int            `json:"total"`
+	MissingRequired int            `json:"missing_required"`
+	Unlinked        int            `json:"unlinked"`
+	DuplicateNames  int            `json:"duplicate_names"`
+	Score           float64        `json:"score"`
+	Issues          []QualityIssue `json:"issues"`
+}
+
+// ActivityTrends counts entry revisions per ledger per day over the days ending with now,
+// in the location of now. Days without activity are included so the series are contiguous.
+func (s *LedgerStore) ActivityTrends(days int, now time.Time) []LedgerActivity {
+	if days <= 0 {
+		days = 1
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := end.AddDate(0, 0, -(days - 1))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]LedgerActivity, 0, len(s.ledgerTypeOrder))
+	index := make(map[LedgerType]int, len(s.ledgerTypeOrder))
+	for _, typ := range s.ledgerTypeOrder {
+		activity := LedgerActivity{Type: typ, Days: make([]ActivityPoint, days)}
+		for i := range activity.Days {
+			activity.Days[i].Date = start.AddDate(0, 0, i).Format("2006-01-02")
+		}
+		index[typ] = len(out)
+		out = append(out, activity)
+	}
+	for _, revisions := range s.revisions {
+		for _, rev := range revisions {
+			if rev.Kind != RevisionKindEntry {
+				continue
+			}
+			ledger, ok := index[rev.Type]
+			if !ok {
+				continue
+			}
+			at := rev.At.In(now.Location())
+			day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, now.Location())
+			if day.Before(start) || day.After(end) {
+				continue
+			}
+			// Count calendar days rather than 24 hour spans so DST changes do not shift buckets.
+			offset := int(math.Round(day.Sub(start).Hours() / 24))
+			point := &out[ledger].Days[offset]
+			switch rev.Action {
+			case RevisionCreate:
+				point.Created++
+			case RevisionDelete:
+				point.Deleted++
+			default:
+				point.Updated++
+			}
+		}
+	}
+	return out
+}
+
+// StaleEntries reports entries whose content has not changed in the given number of days
+// before now. The last change comes from the entry's revision history, so reordering and the
+// renumbering deletes cause do not count as activity. Entries the view hides are left out.
+func (s *LedgerStore) StaleEntries(days int, now time.Time, view *Visibility) []LedgerStaleness {
+	cutoff := now.AddDate(0, 0, -days)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]LedgerStaleness, 0, len(s.ledgerTypeOrder))
+	for _, typ := range s.ledgerTypeOrder {
+		staleness := LedgerStaleness{Type: typ, Oldest: []StaleEntry{}}
+		for _, entry := range s.entries[typ] {
+			if view.Hidden(typ, entry.ID) {
+				continue
+			}
+			staleness.Total++
+			updated := s.lastContentChangeLocked(typ, entry)
+			if !updated.Before(cutoff) {
+				continue
+			}
+			staleness.Stale++
+			staleness.Oldest = append(staleness.Oldest, StaleEntry{
+				ID:        entry.ID,
+				Name:      entry.Name,
+				UpdatedAt: updated,
+				AgeDays:   int(now.Sub(updated).Hours() / 24),
+			})
+		}
+		sort.SliceStable(staleness.Oldest, func(i, j int) bool {
+			return staleness.Oldest[i].UpdatedAt.Before(staleness.Oldest[j].UpdatedAt)
+		})
+		if len(staleness.Oldest) > maxStaleListed {
+			staleness.Oldest = staleness.Oldest[:maxStaleListed]
+		}
+		out = append(out, staleness)
+	}
+	return out
+}
+
+// lastContentChangeLocked is when the entry's content last changed according to its revisions,
+// falling back to its timestamps for entries recorded before revisions were kept.
+func (s *LedgerStore) lastContentChangeLocked(typ LedgerType, entry LedgerEntry) time.Time {
+	if history := s.revisions[entryRevisionKey(typ, entry.ID)]; len(history) > 0 {
+		return history[len(history)-1].At
+	}
+	if entry.UpdatedAt.IsZero() {
+		return entry.CreatedAt
+	}
+	return entry.UpdatedAt
+}
+
+// DataQuality checks every ledger for entries missing required schema fields, entries with
+// neither links nor relationships, and names shared by several entries (ignoring case). Only
+// the entries the view does not hide are checked.
+func (s *LedgerStore) DataQuality(view *Visibility) []LedgerQuality {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	related := make(map[entryRef]struct{}, len(s.relationships)*2)
+	for _, rel := range s.relationships {
+		related[entryRef{typ: rel.FromType, id: rel.FromID}] = struct{}{}
+		related[entryRef{typ: rel.ToType, id: rel.ToID}] = struct{}{}
+	}
+
+	out := make([]LedgerQuality, 0, len(s.ledgerTypeOrder))
+	for _, typ := range s.ledgerTypeOrder {
+		entries := s.entries[typ]
+		if view != nil {
+			entries = make([]LedgerEntry, 0, len(s.entries[typ]))
+			for _, entry := range s.entries[typ] {
+				if !view.Hidden(typ, entry.ID) {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		quality := LedgerQuality{Type: typ, Total: len(entries), Score: 100, Issues: []QualityIssue{}}
+		report := func(kind string, entry LedgerEntry, detail string) {
+			if len(quality.Issues) < maxQualityIssues {
+				quality.Issues = append(quality.Issues, QualityIssue{Kind: kind, ID: entry.ID, Name: entry.Name, Detail: detail})
+			}
+		}
+
+		names := make(map[string]int, len(entries))
+		for _, entry := range entries {
+			if name := strings.ToLower(strings.TrimSpace(entry.Name)); name != "" {
+				names[name]++
+			}
+		}
+		var required []string
+		if schema := s.schemas[typ]; schema != nil {
+			for _, field := range schema.Fields {
+				if field.Required {
+					required = append(required, field.Name)
+				}
+			}
+		}
+
+		healthy := 0
+		for _, entry := range entries {
+			clean := true
+			var missing []string
+			for _, field := range required {
+				if strings.TrimSpace(entry.Attributes[field]) == "" {
+					missing = append(missing, field)
+				}
+			}
+			if len(missing) > 0 {
+				quality.MissingRequired++
+				report(QualityMissingRequired, entry, strings.Join(missing, ", "))
+				clean = false
+			}
+			if !entryHasLinks(entry) {
+				if _, ok := related[entryRef{typ: typ, id: entry.ID}]; !ok {
+					quality.Unlinked++
+					report(QualityUnlinked, entry, "")
+					clean = false
+				}
+			}
+			if names[strings.ToLower(strings.TrimSpace(entry.Name))] > 1 {
+				quality.DuplicateNames++
+				report(QualityDuplicateName, entry, "")
+				clean = false
+			}
+			if clean {
+				healthy++
+			}
+		}
+		if quality.Total > 0 {
+			quality.Score = math.Round(float64(healthy)*1000/float64(quality.Total)) / 10
+		}
+		out = append(out, quality)
+	}
+	return out
+}
+
+func entryHasLinks(entry LedgerEntry) bool {
+	for _, ids := range entry.Links {
+		if len(ids) > 0 {
+			return true
+		}
+	}
+	return false
+}
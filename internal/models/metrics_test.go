@@ -0,0 +1,96 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityTrendsCountRevisionsPerDay(t *testing.T) {
+	store := newTestStore(t)
+	entry, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "tester")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if _, err := store.UpdateEntry(LedgerTypeSystem, entry.ID, LedgerEntry{Name: "ERP 2"}, "tester"); err != nil {
+		t.Fatalf("update entry: %v", err)
+	}
+	if err := store.DeleteEntry(LedgerTypeSystem, entry.ID, "tester"); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+
+	now := time.Now()
+	trends := store.ActivityTrends(7, now)
+	for _, ledger := range trends {
+		if len(ledger.Days) != 7 || ledger.Days[6].Date != now.Format("2006-01-02") {
+			t.Fatalf("expected seven days ending today, got %+v", ledger.Days)
+		}
+		today := ledger.Days[6]
+		if ledger.Type != LedgerTypeSystem {
+			if today.Created+today.Updated+today.Deleted != 0 {
+				t.Fatalf("unexpected activity on %s: %+v", ledger.Type, today)
+			}
+			continue
+		}
+		if today.Created != 1 || today.Updated != 1 || today.Deleted != 1 {
+			t.Fatalf("unexpected system activity %+v", today)
+		}
+	}
+	if later := store.ActivityTrends(7, now.AddDate(0, 0, 10)); later[0].Days[6].Created != 0 {
+		t.Fatalf("expected activity outside the window to be ignored")
+	}
+}
+
+func TestStaleEntriesAndDataQuality(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.SetSchema(LedgerTypePersonnel, LedgerSchema{Fields: []SchemaField{{Name: "employee_no", Type: FieldTypeText}}}, "tester"); err != nil {
+		t.Fatalf("set schema: %v", err)
+	}
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"employee_no": "E1"}}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	second, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "alice "}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID}}}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	// Require the field after the fact so existing entries can fall short of it.
+	store.mu.Lock()
+	store.schemas[LedgerTypePersonnel].Fields[0].Required = true
+	history := store.revisions[entryRevisionKey(LedgerTypePersonnel, alice.ID)]
+	history[len(history)-1].At = time.Now().AddDate(0, 0, -200)
+	store.mu.Unlock()
+
+	var personnel LedgerQuality
+	for _, quality := range store.DataQuality(nil) {
+		if quality.Type == LedgerTypePersonnel {
+			personnel = quality
+		}
+	}
+	// Alice is linked but shares her name; the second entry is also unlinked and lacks employee_no.
+	if personnel.Total != 2 || personnel.DuplicateNames != 2 || personnel.Unlinked != 1 || personnel.MissingRequired != 1 || personnel.Score != 0 {
+		t.Fatalf("unexpected personnel quality %+v", personnel)
+	}
+
+	// Deleting an entry renumbers the rest of the ledger without touching its content.
+	if err := store.DeleteEntry(LedgerTypePersonnel, second.ID, "tester"); err != nil {
+		t.Fatalf("delete personnel: %v", err)
+	}
+	if _, err := store.ReorderEntries(LedgerTypePersonnel, []string{alice.ID}, "tester"); err != nil {
+		t.Fatalf("reorder personnel: %v", err)
+	}
+	for _, staleness := range store.StaleEntries(90, time.Now(), nil) {
+		switch staleness.Type {
+		case LedgerTypePersonnel:
+			if staleness.Stale != 1 || staleness.Oldest[0].ID != alice.ID || staleness.Oldest[0].AgeDays < 199 {
+				t.Fatalf("unexpected personnel staleness %+v", staleness)
+			}
+		default:
+			if staleness.Stale != 0 {
+				t.Fatalf("unexpected staleness %+v", staleness)
+			}
+		}
+	}
+}
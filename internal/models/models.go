@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net"
 	"strings"
 	"time"
 )
@@ -14,7 +15,8 @@ const (
 	LedgerTypeSystem    LedgerType = "systems"
 )
 
-// AllLedgerTypes lists the supported ledgers in a stable order.
+// AllLedgerTypes lists the built-in ledgers in a stable order. Custom ledgers registered at
+// runtime are reported by LedgerStore.LedgerTypes.
 var AllLedgerTypes = []LedgerType{LedgerTypeIP, LedgerTypePersonnel, LedgerTypeSystem}
 
 // LedgerEntry describes a single item within a ledger.
@@ -167,16 +169,44 @@ func WorkspaceKindSupportsDocument(kind WorkspaceKind) bool {
 	return normalized == WorkspaceKindSheet || normalized == WorkspaceKindDocument
 }
 
+// Allowlist entry scopes.
+const (
+	// AllowlistScopeAll restricts login and every API endpoint to the entry's network.
+	AllowlistScopeAll = "all"
+	// AllowlistScopeAdmin restricts only the system administration endpoints.
+	AllowlistScopeAdmin = "admin"
+)
+
 // IPAllowlistEntry represents a single CIDR or address allowed to access the system.
 type IPAllowlistEntry struct {
 	ID          string    `json:"id"`
 	Label       string    `json:"label"`
 	CIDR        string    `json:"cidr"`
+	Scope       string    `json:"scope,omitempty"`
 	Description string    `json:"description,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// EffectiveScope is the entry's scope, treating entries saved before scopes existed as all.
+func (e *IPAllowlistEntry) EffectiveScope() string {
+	if e == nil || e.Scope == "" {
+		return AllowlistScopeAll
+	}
+	return e.Scope
+}
+
+// Contains reports whether ip falls within the entry's network or equals its address.
+func (e *IPAllowlistEntry) Contains(ip net.IP) bool {
+	if e == nil || ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(e.CIDR); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(e.CIDR))
+}
+
 // AuditLogEntry represents a tamper evident log item.
 type AuditLogEntry struct {
 	ID        string    `json:"id"`
@@ -197,12 +227,16 @@ type LoginChallenge struct {
 
 // User represents an operator who can access the admin console.
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	Admin        bool      `json:"admin"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string            `json:"id"`
+	Username     string            `json:"username"`
+	Admin        bool              `json:"admin"`
+	Role         AccessRole        `json:"role,omitempty"`
+	Groups       []string          `json:"groups,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	PasswordHash string            `json:"-"`
+	LockedUntil  *time.Time        `json:"locked_until,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
 }
 
 // Clone returns a copy of the user omitting the password hash for safe sharing.
@@ -212,5 +246,16 @@ func (u *User) Clone() *User {
 	}
 	clone := *u
 	clone.PasswordHash = ""
+	clone.Groups = append([]string(nil), u.Groups...)
+	if u.LockedUntil != nil {
+		until := *u.LockedUntil
+		clone.LockedUntil = &until
+	}
+	if u.Attributes != nil {
+		clone.Attributes = make(map[string]string, len(u.Attributes))
+		for key, value := range u.Attributes {
+			clone.Attributes[key] = value
+		}
+	}
 	return &clone
 }
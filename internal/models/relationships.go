@@ -0,0 +1,326 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRelationshipNotFound indicates the relationship edge cannot be located.
+	ErrRelationshipNotFound = errors.New("relationship_not_found")
+	// ErrRelationshipInvalid indicates a relationship edge is malformed.
+	ErrRelationshipInvalid = errors.New("relationship_invalid")
+	// ErrRelationshipExists indicates an identical edge between the same entries already exists.
+	ErrRelationshipExists = errors.New("relationship_exists")
+)
+
+// RelationshipRole names what the source entry is to the target entry.
+type RelationshipRole string
+
+const (
+	RoleOwner      RelationshipRole = "owner"
+	RoleMaintainer RelationshipRole = "maintainer"
+	RoleHostedOn   RelationshipRole = "hosted-on"
+	RoleDependsOn  RelationshipRole = "depends-on"
+	RoleRelated    RelationshipRole = "related"
+)
+
+var relationshipRolePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Relationship is a typed, directed edge between two ledger entries, read as
+// "From is Role of To" (for example alice is owner of ERP). Every edge is backed by the
+// symmetric link between both entries in LedgerEntry.Links, which remains the untyped
+// adjacency view used by exports and older clients.
+type Relationship struct {
+	ID         string            `json:"id"`
+	Role       RelationshipRole  `json:"role"`
+	FromType   LedgerType        `json:"from_type"`
+	FromID     string            `json:"from_id"`
+	ToType     LedgerType        `json:"to_type"`
+	ToID       string            `json:"to_id"`
+	Since      string            `json:"since,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// OwnsLink records that the edge created its backing link, which it then removes with it.
+	OwnsLink  bool      `json:"owns_link,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Clone returns a deep copy of the relationship.
+func (r Relationship) Clone() Relationship {
+	clone := r
+	if r.Attributes != nil {
+		clone.Attributes = make(map[string]string, len(r.Attributes))
+		for k, v := range r.Attributes {
+			clone.Attributes[k] = v
+		}
+	}
+	return clone
+}
+
+// Involves reports whether the entry is either endpoint of the edge.
+func (r Relationship) Involves(typ LedgerType, id string) bool {
+	return (r.FromType == typ && r.FromID == id) || (r.ToType == typ && r.ToID == id)
+}
+
+// RelationshipFilter narrows ListRelationships. EntryType/EntryID select edges touching an
+// entry, RelatedType restricts the opposite endpoint, and Direction ("from" or "to") pins the
+// selected entry to one end of the edge.
+type RelationshipFilter struct {
+	Role        RelationshipRole
+	EntryType   LedgerType
+	EntryID     string
+	RelatedType LedgerType
+	Direction   string
+}
+
+func cloneRelationships(items []Relationship) []Relationship {
+	out := make([]Relationship, len(items))
+	for i, item := range items {
+		out[i] = item.Clone()
+	}
+	return out
+}
+
+func normaliseRole(role RelationshipRole) (RelationshipRole, error) {
+	normalised := RelationshipRole(strings.ToLower(strings.TrimSpace(string(role))))
+	if normalised == "" {
+		return RoleRelated, nil
+	}
+	if !relationshipRolePattern.MatchString(string(normalised)) {
+		return "", fmt.Errorf("%w: role %q", ErrRelationshipInvalid, role)
+	}
+	return normalised, nil
+}
+
+// prepareRelationshipLocked validates endpoints, role and since-date of an edge in place.
+func (s *LedgerStore) prepareRelationshipLocked(rel *Relationship) error {
+	role, err := normaliseRole(rel.Role)
+	if err != nil {
+		return err
+	}
+	rel.Role = role
+	rel.FromType = NormaliseLedgerType(string(rel.FromType))
+	rel.ToType = NormaliseLedgerType(string(rel.ToType))
+	rel.FromID = strings.TrimSpace(rel.FromID)
+	rel.ToID = strings.TrimSpace(rel.ToID)
+	rel.Notes = strings.TrimSpace(rel.Notes)
+	if rel.FromType == rel.ToType && rel.FromID == rel.ToID {
+		return fmt.Errorf("%w: self relationship", ErrRelationshipInvalid)
+	}
+	for _, end := range []entryRef{{rel.FromType, rel.FromID}, {rel.ToType, rel.ToID}} {
+		if _, ok := s.ledgerTypes[end.typ]; !ok {
+			return fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, end.typ)
+		}
+		if s.entryIndexLocked(end.typ, end.id) < 0 {
+			return fmt.Errorf("%w: %s/%s", ErrEntryNotFound, end.typ, end.id)
+		}
+	}
+	if !s.ledgerTypes[rel.FromType].AllowsLink(rel.ToType) || !s.ledgerTypes[rel.ToType].AllowsLink(rel.FromType) {
+		return fmt.Errorf("%w: %s <-> %s", ErrLinkNotAllowed, rel.FromType, rel.ToType)
+	}
+	if since := strings.TrimSpace(rel.Since); since != "" {
+		canonical, code := coerceFieldValue(SchemaField{Type: FieldTypeDate}, since)
+		if code != "" {
+			return fmt.Errorf("%w: since %q is not a date", ErrRelationshipInvalid, since)
+		}
+		rel.Since = canonical
+	} else {
+		rel.Since = ""
+	}
+	for _, existing := range s.relationships {
+		if existing.ID != rel.ID && existing.Role == rel.Role &&
+			existing.FromType == rel.FromType && existing.FromID == rel.FromID &&
+			existing.ToType == rel.ToType && existing.ToID == rel.ToID {
+			return ErrRelationshipExists
+		}
+	}
+	return nil
+}
+
+// linkRelationshipLocked ensures the symmetric link backing the edge exists.
+func (s *LedgerStore) linkRelationshipLocked(rel Relationship) {
+	s.addLinkLocked(rel.FromType, rel.FromID, rel.ToType, rel.ToID)
+	s.addLinkLocked(rel.ToType, rel.ToID, rel.FromType, rel.FromID)
+}
+
+func (s *LedgerStore) relationshipIndexLocked(id string) int {
+	for i := range s.relationships {
+		if s.relationships[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *LedgerStore) linkedLocked(typ LedgerType, id string, target LedgerType, targetID string) bool {
+	idx := s.entryIndexLocked(typ, id)
+	return idx >= 0 && containsString(s.entries[typ][idx].Links[target], targetID)
+}
+
+// pruneRelationshipsLocked drops edges whose backing link no longer exists, for example after
+// an entry was deleted or its links were edited.
+func (s *LedgerStore) pruneRelationshipsLocked() {
+	if len(s.relationships) == 0 {
+		return
+	}
+	kept := make([]Relationship, 0, len(s.relationships))
+	for _, rel := range s.relationships {
+		if s.linkedLocked(rel.FromType, rel.FromID, rel.ToType, rel.ToID) {
+			kept = append(kept, rel)
+			continue
+		}
+		s.touchRelationshipLocked(rel.ID)
+	}
+	s.relationships = kept
+}
+
+// ListRelationships returns edges matching the filter, newest first.
+func (s *LedgerStore) ListRelationships(filter RelationshipFilter) []Relationship {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, _ := normaliseRole(filter.Role)
+	if strings.TrimSpace(string(filter.Role)) == "" {
+		role = ""
+	}
+	entryType := NormaliseLedgerType(string(filter.EntryType))
+	relatedType := NormaliseLedgerType(string(filter.RelatedType))
+	out := make([]Relationship, 0)
+	for _, rel := range s.relationships {
+		if role != "" && rel.Role != role {
+			continue
+		}
+		matchFrom := (entryType == "" || rel.FromType == entryType) && (filter.EntryID == "" || rel.FromID == filter.EntryID) && (relatedType == "" || rel.ToType == relatedType)
+		matchTo := (entryType == "" || rel.ToType == entryType) && (filter.EntryID == "" || rel.ToID == filter.EntryID) && (relatedType == "" || rel.FromType == relatedType)
+		switch strings.ToLower(strings.TrimSpace(filter.Direction)) {
+		case "from":
+			matchTo = false
+		case "to":
+			matchFrom = false
+		}
+		if matchFrom || matchTo {
+			out = append(out, rel.Clone())
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// GetRelationship returns a single edge by ID.
+func (s *LedgerStore) GetRelationship(id string) (Relationship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rel := range s.relationships {
+		if rel.ID == id {
+			return rel.Clone(), nil
+		}
+	}
+	return Relationship{}, ErrRelationshipNotFound
+}
+
+// CreateRelationship records a typed edge and links both entries.
+func (s *LedgerStore) CreateRelationship(rel Relationship, actor string) (Relationship, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rel = rel.Clone()
+	rel.ID = GenerateID("rel")
+	if err := s.prepareRelationshipLocked(&rel); err != nil {
+		return Relationship{}, err
+	}
+	rel.CreatedAt = time.Now().UTC()
+	rel.UpdatedAt = rel.CreatedAt
+	rel.OwnsLink = !s.linkedLocked(rel.FromType, rel.FromID, rel.ToType, rel.ToID)
+	s.touchRelationshipLocked(rel.ID)
+	s.relationships = append(s.relationships, rel)
+	s.linkRelationshipLocked(rel)
+	s.appendAuditLocked(actor, "create_relationship", fmt.Sprintf("%s %s/%s -> %s/%s", rel.Role, rel.FromType, rel.FromID, rel.ToType, rel.ToID))
+	s.commitLocked(actor)
+	return rel.Clone(), nil
+}
+
+// UpdateRelationship changes the role and metadata of an edge; its endpoints are fixed.
+func (s *LedgerStore) UpdateRelationship(id string, updates Relationship, actor string) (Relationship, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.relationships {
+		if existing.ID != id {
+			continue
+		}
+		updated := existing.Clone()
+		if strings.TrimSpace(string(updates.Role)) != "" {
+			updated.Role = updates.Role
+		}
+		updated.Since = updates.Since
+		updated.Notes = updates.Notes
+		if updates.Attributes != nil {
+			updated.Attributes = updates.Clone().Attributes
+		}
+		if err := s.prepareRelationshipLocked(&updated); err != nil {
+			return Relationship{}, err
+		}
+		updated.UpdatedAt = time.Now().UTC()
+		s.touchRelationshipLocked(id)
+		s.relationships[i] = updated
+		s.appendAuditLocked(actor, "update_relationship", id)
+		s.commitLocked(actor)
+		return updated.Clone(), nil
+	}
+	return Relationship{}, ErrRelationshipNotFound
+}
+
+// DeleteRelationship removes an edge. A backing link the edge created is removed too once no
+// other edge connects the two entries, otherwise it passes to one of those edges; links that
+// existed before the edge are left alone.
+func (s *LedgerStore) DeleteRelationship(id string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.relationships {
+		if existing.ID != id {
+			continue
+		}
+		s.touchRelationshipLocked(id)
+		s.relationships = append(s.relationships[:i], s.relationships[i+1:]...)
+		shared := false
+		for j, other := range s.relationships {
+			if other.Involves(existing.FromType, existing.FromID) && other.Involves(existing.ToType, existing.ToID) {
+				if existing.OwnsLink {
+					s.touchRelationshipLocked(other.ID)
+					s.relationships[j].OwnsLink = true
+				}
+				shared = true
+				break
+			}
+		}
+		if existing.OwnsLink && !shared {
+			s.removeLinkLocked(existing.FromType, existing.FromID, existing.ToType, existing.ToID)
+			s.removeLinkLocked(existing.ToType, existing.ToID, existing.FromType, existing.FromID)
+		}
+		s.appendAuditLocked(actor, "delete_relationship", id)
+		s.commitLocked(actor)
+		return nil
+	}
+	return ErrRelationshipNotFound
+}
+
+// rolesBetweenLocked lists the roles of edges connecting two entries in either direction.
+func (s *LedgerStore) rolesBetweenLocked(a entryRef, b entryRef) []string {
+	roles := make([]string, 0)
+	for _, rel := range s.relationships {
+		if rel.Involves(a.typ, a.id) && rel.Involves(b.typ, b.id) {
+			roles = append(roles, string(rel.Role))
+		}
+	}
+	return normaliseStrings(roles)
+}
+
+// RelationshipRoles returns the roles of the edges between two entries.
+func (s *LedgerStore) RelationshipRoles(typ LedgerType, id string, otherType LedgerType, otherID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rolesBetweenLocked(entryRef{typ, id}, entryRef{otherType, otherID})
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRelationshipLifecycle(t *testing.T) {
+	store := newTestStore(t)
+
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	crm, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "CRM"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+
+	owner, err := store.CreateRelationship(Relationship{Role: "Owner", FromType: "person", FromID: alice.ID, ToType: LedgerTypeSystem, ToID: erp.ID, Since: "2023/05/01", Notes: "primary"}, "tester")
+	if err != nil {
+		t.Fatalf("create relationship: %v", err)
+	}
+	if owner.Role != RoleOwner || owner.FromType != LedgerTypePersonnel || owner.Since != "2023-05-01" {
+		t.Fatalf("expected normalised relationship, got %+v", owner)
+	}
+	if _, err := store.CreateRelationship(Relationship{Role: RoleMaintainer, FromType: LedgerTypePersonnel, FromID: alice.ID, ToType: LedgerTypeSystem, ToID: crm.ID}, "tester"); err != nil {
+		t.Fatalf("create maintainer: %v", err)
+	}
+	if _, err := store.CreateRelationship(Relationship{Role: RoleOwner, FromType: LedgerTypePersonnel, FromID: alice.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester"); !errors.Is(err, ErrRelationshipExists) {
+		t.Fatalf("expected duplicate edge to be refused, got %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypeSystem, erp.ID); !containsString(got.Links[LedgerTypePersonnel], alice.ID) {
+		t.Fatalf("expected edge to link entries, got %v", got.Links)
+	}
+
+	owned := store.ListRelationships(RelationshipFilter{Role: RoleOwner, EntryType: LedgerTypePersonnel, EntryID: alice.ID, RelatedType: LedgerTypeSystem})
+	if len(owned) != 1 || owned[0].ToID != erp.ID {
+		t.Fatalf("expected alice to own only ERP, got %+v", owned)
+	}
+	if stats := store.OverviewStats(nil); stats.Relationships.ByRole[RoleOwner] != 1 || stats.Relationships.ByRole[RoleMaintainer] != 1 {
+		t.Fatalf("unexpected role stats: %+v", stats.Relationships.ByRole)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypeSystem, crm.ID, LedgerEntry{Links: map[LedgerType][]string{}}, "tester"); err != nil {
+		t.Fatalf("unlink crm: %v", err)
+	}
+	if got := store.ListRelationships(RelationshipFilter{Role: RoleMaintainer}); len(got) != 0 {
+		t.Fatalf("expected edge to follow removed link, got %+v", got)
+	}
+
+	if err := store.DeleteRelationship(owner.ID, "tester"); err != nil {
+		t.Fatalf("delete relationship: %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); len(got.Links[LedgerTypeSystem]) != 0 {
+		t.Fatalf("expected last edge removal to unlink, got %v", got.Links)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if _, err := store.GetRelationship(owner.ID); err != nil {
+		t.Fatalf("expected undo to restore edge: %v", err)
+	}
+}
+
+func TestDeleteRelationshipKeepsExistingLinks(t *testing.T) {
+	store := newTestStore(t)
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Links: map[LedgerType][]string{LedgerTypeSystem: {erp.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	edge, err := store.CreateRelationship(Relationship{Role: RoleOwner, FromType: LedgerTypePersonnel, FromID: alice.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester")
+	if err != nil {
+		t.Fatalf("create relationship: %v", err)
+	}
+	if edge.OwnsLink {
+		t.Fatalf("expected an edge over an existing link not to own it")
+	}
+	if err := store.DeleteRelationship(edge.ID, "tester"); err != nil {
+		t.Fatalf("delete relationship: %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, alice.ID); !containsString(got.Links[LedgerTypeSystem], erp.ID) {
+		t.Fatalf("expected the existing link to survive, got %v", got.Links)
+	}
+
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob"}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	owner, _ := store.CreateRelationship(Relationship{Role: RoleOwner, FromType: LedgerTypePersonnel, FromID: bob.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester")
+	maintainer, _ := store.CreateRelationship(Relationship{Role: RoleMaintainer, FromType: LedgerTypePersonnel, FromID: bob.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester")
+	if err := store.DeleteRelationship(owner.ID, "tester"); err != nil {
+		t.Fatalf("delete owner: %v", err)
+	}
+	if err := store.DeleteRelationship(maintainer.ID, "tester"); err != nil {
+		t.Fatalf("delete maintainer: %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypePersonnel, bob.ID); len(got.Links[LedgerTypeSystem]) != 0 {
+		t.Fatalf("expected the link the edges created to go with the last one, got %v", got.Links)
+	}
+}
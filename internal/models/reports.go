@@ -0,0 +1,628 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReportNotFound indicates the report definition does not exist.
+	ErrReportNotFound = errors.New("report_not_found")
+	// ErrReportInvalid indicates a report definition is malformed or refers to unknown ledgers.
+	ErrReportInvalid = errors.New("report_invalid")
+	// ErrReportTooLarge indicates the joins of a report expand beyond maxReportRows.
+	ErrReportTooLarge = errors.New("report_too_large")
+)
+
+// Output formats of saved reports.
+const (
+	ReportFormatJSON = "json"
+	ReportFormatXLSX = "xlsx"
+	ReportFormatCSV  = "csv"
+)
+
+// Report schedule frequencies.
+const (
+	ReportDaily  = "daily"
+	ReportWeekly = "weekly"
+)
+
+// DefaultReportKeep is how many generated files a schedule retains unless it says otherwise.
+const DefaultReportKeep = 10
+
+// maxReportRows bounds the rows a single run may produce before grouping.
+const maxReportRows = 200000
+
+// ReportJoin adds the entries of Ledger linked from the entries of From, the report's root
+// ledger when empty, to each row. A row is repeated once per linked entry; rows without one keep
+// blank columns unless Required is set or the joined ledger has filters.
+type ReportJoin struct {
+	Ledger   LedgerType `json:"ledger"`
+	From     LedgerType `json:"from,omitempty"`
+	Required bool       `json:"required,omitempty"`
+}
+
+// ReportColumn selects a property of one of the report's ledgers. Properties are id plus those
+// accepted by ledger queries: name, description, tags, links.<type>, attributes.<key>, order,
+// created_at and updated_at. Multi-valued properties are joined with "; ".
+type ReportColumn struct {
+	Ledger   LedgerType `json:"ledger"`
+	Property string     `json:"property"`
+	Label    string     `json:"label"`
+}
+
+// ReportFilter restricts the entries of one ledger using the ledger query operators.
+type ReportFilter struct {
+	Ledger   LedgerType  `json:"ledger"`
+	Property string      `json:"property"`
+	Op       string      `json:"op"`
+	Value    interface{} `json:"value"`
+}
+
+// ReportSchedule runs a report every day, or every week on Weekday, at Hour in the server's
+// local time and keeps the newest Keep files.
+type ReportSchedule struct {
+	Every   string       `json:"every"`
+	Weekday time.Weekday `json:"weekday"`
+	Hour    int          `json:"hour"`
+	Format  string       `json:"format"`
+	Keep    int          `json:"keep"`
+}
+
+// Next returns the first run strictly after t, in the location of t.
+func (s ReportSchedule) Next(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), s.Hour, 0, 0, 0, t.Location())
+	step := 1
+	if s.Every == ReportWeekly {
+		step = 7
+		next = next.AddDate(0, 0, (int(s.Weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(t) {
+		next = next.AddDate(0, 0, step)
+	}
+	return next
+}
+
+// ReportDefinition is a saved report: the entries of Ledger joined through their links to
+// further ledgers, reduced to Columns and optionally grouped by the labels in GroupBy. Grouped
+// rows list the distinct values of the remaining columns and end with a Count column.
+type ReportDefinition struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Ledger      LedgerType      `json:"ledger"`
+	Joins       []ReportJoin    `json:"joins,omitempty"`
+	Columns     []ReportColumn  `json:"columns"`
+	Filters     []ReportFilter  `json:"filters,omitempty"`
+	GroupBy     []string        `json:"group_by,omitempty"`
+	Schedule    *ReportSchedule `json:"schedule,omitempty"`
+	CreatedBy   string          `json:"created_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	LastRunAt   time.Time       `json:"last_run_at,omitempty"`
+	LastRunFile string          `json:"last_run_file,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Clone returns a deep copy of the definition.
+func (d *ReportDefinition) Clone() *ReportDefinition {
+	if d == nil {
+		return nil
+	}
+	clone := *d
+	clone.Joins = append([]ReportJoin(nil), d.Joins...)
+	clone.Columns = append([]ReportColumn(nil), d.Columns...)
+	clone.Filters = append([]ReportFilter(nil), d.Filters...)
+	clone.GroupBy = append([]string(nil), d.GroupBy...)
+	if d.Schedule != nil {
+		schedule := *d.Schedule
+		clone.Schedule = &schedule
+	}
+	return &clone
+}
+
+// ledgers returns the root ledger followed by the joined ones.
+func (d *ReportDefinition) ledgers() []LedgerType {
+	out := []LedgerType{d.Ledger}
+	for _, join := range d.Joins {
+		out = append(out, join.Ledger)
+	}
+	return out
+}
+
+// ReportResult is the output of a report run.
+type ReportResult struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+func (s *LedgerStore) normaliseReportLocked(def ReportDefinition) (*ReportDefinition, error) {
+	out := &ReportDefinition{
+		Name:        strings.TrimSpace(def.Name),
+		Description: strings.TrimSpace(def.Description),
+		Ledger:      NormaliseLedgerType(string(def.Ledger)),
+	}
+	if out.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrReportInvalid)
+	}
+	defs := make(map[LedgerType]*LedgerTypeDefinition)
+	if root, ok := s.ledgerTypes[out.Ledger]; ok {
+		defs[out.Ledger] = root
+	} else {
+		return nil, fmt.Errorf("%w: unknown ledger %q", ErrReportInvalid, def.Ledger)
+	}
+	// resolve maps an optional ledger reference onto one already part of the report.
+	resolve := func(value LedgerType) (LedgerType, error) {
+		if strings.TrimSpace(string(value)) == "" {
+			return out.Ledger, nil
+		}
+		typ := NormaliseLedgerType(string(value))
+		if _, ok := defs[typ]; !ok {
+			return "", fmt.Errorf("%w: ledger %q is not part of the report", ErrReportInvalid, value)
+		}
+		return typ, nil
+	}
+
+	for _, join := range def.Joins {
+		typ := NormaliseLedgerType(string(join.Ledger))
+		target, ok := s.ledgerTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown ledger %q", ErrReportInvalid, join.Ledger)
+		}
+		if _, dup := defs[typ]; dup {
+			return nil, fmt.Errorf("%w: ledger %s is joined twice", ErrReportInvalid, typ)
+		}
+		from, err := resolve(join.From)
+		if err != nil {
+			return nil, err
+		}
+		if !defs[from].AllowsLink(typ) {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrLinkNotAllowed, from, typ)
+		}
+		defs[typ] = target
+		out.Joins = append(out.Joins, ReportJoin{Ledger: typ, From: from, Required: join.Required})
+	}
+
+	labels := make(map[string]struct{}, len(def.Columns))
+	for _, column := range def.Columns {
+		typ, err := resolve(column.Ledger)
+		if err != nil {
+			return nil, err
+		}
+		property, err := reportProperty(column.Property)
+		if err != nil {
+			return nil, err
+		}
+		label := strings.TrimSpace(column.Label)
+		if label == "" {
+			label = strings.TrimPrefix(property, "attributes.")
+			if typ != out.Ledger {
+				label = defs[typ].Name + " " + label
+			}
+		}
+		if _, dup := labels[label]; dup {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrReportInvalid, label)
+		}
+		labels[label] = struct{}{}
+		out.Columns = append(out.Columns, ReportColumn{Ledger: typ, Property: property, Label: label})
+	}
+	if len(out.Columns) == 0 {
+		return nil, fmt.Errorf("%w: at least one column is required", ErrReportInvalid)
+	}
+
+	for _, filter := range def.Filters {
+		typ, err := resolve(filter.Ledger)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := compileFilter(FilterClause{Property: filter.Property, Op: filter.Op, Value: filter.Value})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrReportInvalid, err)
+		}
+		out.Filters = append(out.Filters, ReportFilter{Ledger: typ, Property: compiled.property, Op: compiled.op, Value: filter.Value})
+	}
+
+	for _, label := range def.GroupBy {
+		label = strings.TrimSpace(label)
+		if _, ok := labels[label]; !ok {
+			return nil, fmt.Errorf("%w: group by unknown column %q", ErrReportInvalid, label)
+		}
+		out.GroupBy = append(out.GroupBy, label)
+	}
+
+	if def.Schedule != nil {
+		schedule := *def.Schedule
+		schedule.Every = strings.ToLower(strings.TrimSpace(schedule.Every))
+		schedule.Format = strings.ToLower(strings.TrimSpace(schedule.Format))
+		if schedule.Every != ReportDaily && schedule.Every != ReportWeekly {
+			return nil, fmt.Errorf("%w: schedule must run daily or weekly", ErrReportInvalid)
+		}
+		if schedule.Hour < 0 || schedule.Hour > 23 || schedule.Weekday < time.Sunday || schedule.Weekday > time.Saturday {
+			return nil, fmt.Errorf("%w: schedule time out of range", ErrReportInvalid)
+		}
+		switch schedule.Format {
+		case "":
+			schedule.Format = ReportFormatXLSX
+		case ReportFormatXLSX, ReportFormatCSV, ReportFormatJSON:
+		default:
+			return nil, fmt.Errorf("%w: unsupported format %q", ErrReportInvalid, schedule.Format)
+		}
+		if schedule.Keep <= 0 {
+			schedule.Keep = DefaultReportKeep
+		}
+		out.Schedule = &schedule
+	}
+	return out, nil
+}
+
+// reportProperty validates and normalises a column property.
+func reportProperty(property string) (string, error) {
+	if strings.EqualFold(strings.TrimSpace(property), "id") {
+		return "id", nil
+	}
+	compiled, err := compileFilter(FilterClause{Property: property, Op: FilterOpEq})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrReportInvalid, err)
+	}
+	return compiled.property, nil
+}
+
+func reportValues(entry *LedgerEntry, property string) []string {
+	if entry == nil {
+		return nil
+	}
+	if property == "id" {
+		return []string{entry.ID}
+	}
+	return entryValues(*entry, property)
+}
+
+// ListReports returns every saved report definition in creation order.
+func (s *LedgerStore) ListReports() []*ReportDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneReports(s.reports)
+}
+
+// GetReport returns a saved report definition.
+func (s *LedgerStore) GetReport(id string) (*ReportDefinition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.reportIndexLocked(id); i >= 0 {
+		return s.reports[i].Clone(), nil
+	}
+	return nil, ErrReportNotFound
+}
+
+// CreateReport validates and saves a new report definition.
+func (s *LedgerStore) CreateReport(def ReportDefinition, actor string) (*ReportDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, err := s.normaliseReportLocked(def)
+	if err != nil {
+		return nil, err
+	}
+	report.ID = GenerateID("report")
+	report.CreatedBy = actor
+	report.CreatedAt = time.Now().UTC()
+	report.UpdatedAt = report.CreatedAt
+	s.reports = append(s.reports, report)
+	s.appendAuditLocked(actor, "report_create", report.ID)
+	return report.Clone(), nil
+}
+
+// UpdateReport replaces the definition of a saved report, keeping its run history.
+func (s *LedgerStore) UpdateReport(id string, def ReportDefinition, actor string) (*ReportDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.reportIndexLocked(id)
+	if i < 0 {
+		return nil, ErrReportNotFound
+	}
+	report, err := s.normaliseReportLocked(def)
+	if err != nil {
+		return nil, err
+	}
+	existing := s.reports[i]
+	report.ID = existing.ID
+	report.CreatedBy = existing.CreatedBy
+	report.CreatedAt = existing.CreatedAt
+	report.UpdatedAt = time.Now().UTC()
+	report.LastRunAt = existing.LastRunAt
+	report.LastRunFile = existing.LastRunFile
+	report.LastError = existing.LastError
+	s.reports[i] = report
+	s.appendAuditLocked(actor, "report_update", report.ID)
+	return report.Clone(), nil
+}
+
+// DeleteReport removes a saved report. Files already generated are left in place.
+func (s *LedgerStore) DeleteReport(id string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.reportIndexLocked(id)
+	if i < 0 {
+		return ErrReportNotFound
+	}
+	s.reports = append(s.reports[:i], s.reports[i+1:]...)
+	s.appendAuditLocked(actor, "report_delete", id)
+	return nil
+}
+
+// DueReports returns the scheduled reports whose next run, counted from their last run or
+// last change, is at or before now.
+func (s *LedgerStore) DueReports(now time.Time) []*ReportDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	due := make([]*ReportDefinition, 0)
+	for _, report := range s.reports {
+		if report.Schedule == nil {
+			continue
+		}
+		since := report.UpdatedAt
+		if report.LastRunAt.After(since) {
+			since = report.LastRunAt
+		}
+		if !report.Schedule.Next(since.In(now.Location())).After(now) {
+			due = append(due, report.Clone())
+		}
+	}
+	return due
+}
+
+// RecordReportRun notes the outcome of a scheduled run. Only the name of the generated file is
+// kept, so report listings do not reveal where the server stores them.
+func (s *LedgerStore) RecordReportRun(id string, at time.Time, file string, runErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.reportIndexLocked(id)
+	if i < 0 {
+		return ErrReportNotFound
+	}
+	report := s.reports[i]
+	report.LastRunAt = at.UTC()
+	report.LastRunFile = reportFileName(file)
+	report.LastError = ""
+	if runErr != nil {
+		report.LastError = runErr.Error()
+	}
+	return nil
+}
+
+// RunReport evaluates a saved report against the current ledgers as view lets its user see
+// them: hidden rows of every joined ledger are left out and masked attributes are masked
+// before filters run. A nil view sees everything.
+func (s *LedgerStore) RunReport(id string, view *Visibility) (*ReportResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.reportIndexLocked(id)
+	if i < 0 {
+		return nil, ErrReportNotFound
+	}
+	return s.runReportLocked(s.reports[i], view)
+}
+
+func (s *LedgerStore) runReportLocked(report *ReportDefinition, view *Visibility) (*ReportResult, error) {
+	ledgers := report.ledgers()
+	position := make(map[LedgerType]int, len(ledgers))
+	for i, typ := range ledgers {
+		if _, ok := s.ledgerTypes[typ]; !ok {
+			return nil, fmt.Errorf("%w: unknown ledger %s", ErrReportInvalid, typ)
+		}
+		position[typ] = i
+	}
+	filters := make([][]compiledFilter, len(ledgers))
+	for _, filter := range report.Filters {
+		compiled, err := compileFilter(FilterClause{Property: filter.Property, Op: filter.Op, Value: filter.Value})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrReportInvalid, err)
+		}
+		filters[position[filter.Ledger]] = append(filters[position[filter.Ledger]], compiled)
+	}
+	matches := func(at int, entry *LedgerEntry) bool {
+		for _, filter := range filters[at] {
+			if !filter.match(*entry) {
+				return false
+			}
+		}
+		return true
+	}
+	visible := make([][]LedgerEntry, len(ledgers))
+	byID := make([]map[string]*LedgerEntry, len(ledgers))
+	for i, typ := range ledgers {
+		visible[i] = view.Entries(typ, s.entries[typ])
+		if i == 0 {
+			continue
+		}
+		index := make(map[string]*LedgerEntry, len(visible[i]))
+		for j := range visible[i] {
+			index[visible[i][j].ID] = &visible[i][j]
+		}
+		byID[i] = index
+	}
+
+	result := &ReportResult{Columns: make([]string, len(report.Columns)), Rows: [][]string{}}
+	for i, column := range report.Columns {
+		result.Columns[i] = column.Label
+	}
+	bound := make([]*LedgerEntry, len(ledgers))
+	var expand func(join int) error
+	expand = func(join int) error {
+		if join == len(report.Joins) {
+			if len(result.Rows) >= maxReportRows {
+				return ErrReportTooLarge
+			}
+			row := make([]string, len(report.Columns))
+			for i, column := range report.Columns {
+				row[i] = strings.Join(reportValues(bound[position[column.Ledger]], column.Property), "; ")
+			}
+			result.Rows = append(result.Rows, row)
+			return nil
+		}
+		spec := report.Joins[join]
+		at := join + 1
+		linked := 0
+		if from := bound[position[spec.From]]; from != nil {
+			for _, id := range from.Links[spec.Ledger] {
+				entry, ok := byID[at][id]
+				if !ok || !matches(at, entry) {
+					continue
+				}
+				linked++
+				bound[at] = entry
+				if err := expand(join + 1); err != nil {
+					return err
+				}
+			}
+		}
+		bound[at] = nil
+		if linked == 0 && !spec.Required && len(filters[at]) == 0 {
+			return expand(join + 1)
+		}
+		return nil
+	}
+	for i := range visible[0] {
+		root := &visible[0][i]
+		if !matches(0, root) {
+			continue
+		}
+		bound[0] = root
+		if err := expand(0); err != nil {
+			return nil, err
+		}
+	}
+	if len(report.GroupBy) > 0 {
+		groupReportRows(result, report.GroupBy)
+	}
+	return result, nil
+}
+
+// groupReportRows collapses rows sharing the GroupBy columns, in order of first appearance.
+// Other columns keep their distinct values joined with "; " and a Count column is appended.
+func groupReportRows(result *ReportResult, groupBy []string) {
+	grouped := make(map[int]bool, len(groupBy))
+	for _, label := range groupBy {
+		for i, column := range result.Columns {
+			if column == label {
+				grouped[i] = true
+			}
+		}
+	}
+	type group struct {
+		row    []string
+		values []map[string]struct{}
+		count  int
+	}
+	index := make(map[string]*group)
+	order := make([]*group, 0)
+	for _, row := range result.Rows {
+		var key strings.Builder
+		for i, value := range row {
+			if grouped[i] {
+				key.WriteString(value)
+				key.WriteByte(0)
+			}
+		}
+		g, ok := index[key.String()]
+		if !ok {
+			g = &group{row: make([]string, len(row)), values: make([]map[string]struct{}, len(row))}
+			index[key.String()] = g
+			order = append(order, g)
+		}
+		g.count++
+		for i, value := range row {
+			if grouped[i] {
+				g.row[i] = value
+				continue
+			}
+			if value == "" {
+				continue
+			}
+			if g.values[i] == nil {
+				g.values[i] = make(map[string]struct{})
+			}
+			if _, seen := g.values[i][value]; seen {
+				continue
+			}
+			g.values[i][value] = struct{}{}
+			if g.row[i] != "" {
+				g.row[i] += "; "
+			}
+			g.row[i] += value
+		}
+	}
+	result.Columns = append(result.Columns, "Count")
+	result.Rows = make([][]string, 0, len(order))
+	for _, g := range order {
+		result.Rows = append(result.Rows, append(g.row, strconv.Itoa(g.count)))
+	}
+}
+
+func (s *LedgerStore) reportIndexLocked(id string) int {
+	for i, report := range s.reports {
+		if report.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// reportsReferencingLocked returns the IDs of reports that read from typ.
+func (s *LedgerStore) reportsReferencingLocked(typ LedgerType) []string {
+	var ids []string
+	for _, report := range s.reports {
+		for _, ledger := range report.ledgers() {
+			if ledger == typ {
+				ids = append(ids, report.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// mergeReportsLocked replaces reports with matching IDs and appends the rest.
+func (s *LedgerStore) mergeReportsLocked(reports []*ReportDefinition) {
+	for _, report := range restoreReports(reports) {
+		if i := s.reportIndexLocked(report.ID); i >= 0 {
+			s.reports[i] = report
+			continue
+		}
+		s.reports = append(s.reports, report)
+	}
+}
+
+// restoreReports clones persisted reports, dropping entries without an ID.
+func restoreReports(reports []*ReportDefinition) []*ReportDefinition {
+	out := make([]*ReportDefinition, 0, len(reports))
+	for _, report := range reports {
+		if report == nil || strings.TrimSpace(report.ID) == "" {
+			continue
+		}
+		restored := report.Clone()
+		restored.LastRunFile = reportFileName(restored.LastRunFile)
+		out = append(out, restored)
+	}
+	return out
+}
+
+// reportFileName strips the directories from a recorded report file; snapshots written before
+// only the name was kept still carry the full server path.
+func reportFileName(file string) string {
+	if file == "" {
+		return ""
+	}
+	return filepath.Base(file)
+}
+
+func cloneReports(reports []*ReportDefinition) []*ReportDefinition {
+	out := make([]*ReportDefinition, 0, len(reports))
+	for _, report := range reports {
+		out = append(out, report.Clone())
+	}
+	return out
+}
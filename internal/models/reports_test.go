@@ -0,0 +1,208 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportJoinsFiltersAndGroups(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"dept": "运维"}}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob", Attributes: map[string]string{"dept": "研发"}}, "tester")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	var ips []string
+	for _, name := range []string{"10.0.0.1", "10.0.0.2"} {
+		ip, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: name}, "tester")
+		if err != nil {
+			t.Fatalf("create ip: %v", err)
+		}
+		ips = append(ips, ip.ID)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{
+		LedgerTypePersonnel: {alice.ID, bob.ID},
+		LedgerTypeIP:        ips,
+	}}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA"}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+
+	if _, err := store.CreateReport(ReportDefinition{Name: "bad", Ledger: LedgerTypeSystem, Columns: []ReportColumn{{Ledger: LedgerTypeIP, Property: "name"}}}, "tester"); !errors.Is(err, ErrReportInvalid) {
+		t.Fatalf("expected columns of unjoined ledgers to be refused, got %v", err)
+	}
+	report, err := store.CreateReport(ReportDefinition{
+		Name:   "Systems with owners and IPs",
+		Ledger: "system",
+		Joins:  []ReportJoin{{Ledger: "people"}, {Ledger: "ip"}},
+		Columns: []ReportColumn{
+			{Property: "name", Label: "System"},
+			{Ledger: "people", Property: "name"},
+			{Ledger: "ip", Property: "name", Label: "IP"},
+		},
+		Filters: []ReportFilter{{Ledger: "people", Property: "attributes.dept", Op: FilterOpEq, Value: "运维"}},
+	}, "admin")
+	if err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+	if report.Columns[1].Label != "Personnel name" || report.Joins[0].From != LedgerTypeSystem {
+		t.Fatalf("expected defaults to be filled in, got %+v", report)
+	}
+	result, err := store.RunReport(report.ID, nil)
+	if err != nil {
+		t.Fatalf("run report: %v", err)
+	}
+	// The personnel filter drops Bob and OA, leaving Alice once per IP.
+	if len(result.Rows) != 2 || result.Rows[0][1] != "Alice" || result.Rows[1][2] != "10.0.0.2" {
+		t.Fatalf("unexpected rows %q", result.Rows)
+	}
+
+	def := *report
+	def.Filters = nil
+	def.GroupBy = []string{"System"}
+	if report, err = store.UpdateReport(report.ID, def, "admin"); err != nil {
+		t.Fatalf("update report: %v", err)
+	}
+	result, err = store.RunReport(report.ID, nil)
+	if err != nil {
+		t.Fatalf("run report: %v", err)
+	}
+	want := [][]string{{"ERP", "Alice; Bob", "10.0.0.1; 10.0.0.2", "4"}, {"OA", "", "", "1"}}
+	if len(result.Columns) != 4 || result.Columns[3] != "Count" || len(result.Rows) != len(want) {
+		t.Fatalf("unexpected grouped result %+v", result)
+	}
+	for i, row := range want {
+		for j, value := range row {
+			if result.Rows[i][j] != value {
+				t.Fatalf("row %d: expected %q, got %q", i, row, result.Rows[i])
+			}
+		}
+	}
+}
+
+func TestReportScheduleAndSnapshot(t *testing.T) {
+	store := newTestStore(t)
+	report, err := store.CreateReport(ReportDefinition{
+		Name:     "Weekly systems",
+		Ledger:   LedgerTypeSystem,
+		Columns:  []ReportColumn{{Property: "name"}},
+		Schedule: &ReportSchedule{Every: "Weekly", Weekday: time.Monday, Hour: 8},
+	}, "admin")
+	if err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+	if report.Schedule.Format != ReportFormatXLSX || report.Schedule.Keep != DefaultReportKeep {
+		t.Fatalf("expected schedule defaults, got %+v", report.Schedule)
+	}
+
+	// 2024-03-06 is a Wednesday; the next Monday 08:00 is the 11th.
+	wednesday := time.Date(2024, 3, 6, 9, 30, 0, 0, time.UTC)
+	if next := report.Schedule.Next(wednesday); !next.Equal(time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next run %s", next)
+	}
+	if next := report.Schedule.Next(time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)); next.Day() != 18 {
+		t.Fatalf("expected a run at the scheduled time to move a week on, got %s", next)
+	}
+	runAt := report.Schedule.Next(report.UpdatedAt)
+	if due := store.DueReports(runAt.Add(-time.Minute)); len(due) != 0 {
+		t.Fatalf("expected nothing due before the scheduled time, got %d", len(due))
+	}
+	if due := store.DueReports(runAt); len(due) != 1 {
+		t.Fatalf("expected the report to be due, got %d", len(due))
+	}
+	if err := store.RecordReportRun(report.ID, runAt, "reports/out.xlsx", nil); err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	if due := store.DueReports(runAt.Add(time.Hour)); len(due) != 0 {
+		t.Fatalf("expected the run to be recorded, got %d due", len(due))
+	}
+
+	var buf bytes.Buffer
+	if err := store.WriteSnapshotJSON(&buf); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	restored := newTestStore(t)
+	if err := restored.ImportSnapshot(&snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	loaded, err := restored.GetReport(report.ID)
+	if err != nil || loaded.LastRunFile != "out.xlsx" || loaded.Schedule.Weekday != time.Monday {
+		t.Fatalf("expected report to survive the snapshot, got %+v (%v)", loaded, err)
+	}
+	if err := restored.DeleteReport(report.ID, "admin"); err != nil {
+		t.Fatalf("delete report: %v", err)
+	}
+	if _, err := restored.GetReport(report.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("expected report to be gone, got %v", err)
+	}
+}
+
+func TestReportRunAppliesVisibility(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"department": "Ops", "phone": "13800000001"}}, "admin")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob", Attributes: map[string]string{"department": "Sales", "phone": "13800000002"}}, "admin")
+	if err != nil {
+		t.Fatalf("create personnel: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID, bob.ID}}}, "admin"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	user, err := store.CreateUser("manager", "Passw0rd!23", AccessViewer, "admin")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := store.SetUserProfile(user.ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityField, Field: "attributes.phone", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityRow, Subjects: []string{"managers"}, Filters: []FilterClause{{Property: "attributes.department", Op: FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+	report, err := store.CreateReport(ReportDefinition{
+		Name:    "Owners",
+		Ledger:  LedgerTypeSystem,
+		Joins:   []ReportJoin{{Ledger: LedgerTypePersonnel}},
+		Columns: []ReportColumn{{Property: "name"}, {Ledger: LedgerTypePersonnel, Property: "name"}, {Ledger: LedgerTypePersonnel, Property: "attributes.phone"}},
+	}, "admin")
+	if err != nil {
+		t.Fatalf("create report: %v", err)
+	}
+
+	view := store.VisibilityFor("manager")
+	result, err := store.RunReport(report.ID, view)
+	if err != nil {
+		t.Fatalf("run report: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != "Alice" || result.Rows[0][2] == alice.Attributes["phone"] {
+		t.Fatalf("expected only Alice with a masked phone, got %q", result.Rows)
+	}
+
+	def := *report
+	def.Filters = []ReportFilter{{Ledger: LedgerTypePersonnel, Property: "attributes.phone", Op: FilterOpEq, Value: alice.Attributes["phone"]}}
+	if _, err := store.UpdateReport(report.ID, def, "admin"); err != nil {
+		t.Fatalf("update report: %v", err)
+	}
+	if result, _ := store.RunReport(report.ID, view); len(result.Rows) != 0 {
+		t.Fatalf("expected masked values to be unfilterable, got %q", result.Rows)
+	}
+	if result, _ := store.RunReport(report.ID, nil); len(result.Rows) != 1 {
+		t.Fatalf("expected the unrestricted run to match, got %q", result.Rows)
+	}
+}
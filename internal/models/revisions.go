@@ -0,0 +1,500 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrRevisionNotFound indicates the requested revision does not exist for the record.
+var ErrRevisionNotFound = errors.New("revision_not_found")
+
+// Revision kinds and actions.
+const (
+	RevisionKindEntry     = "entry"
+	RevisionKindWorkspace = "workspace"
+
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+)
+
+// MaxRevisionsPerRecord bounds the history kept for one entry or workspace. Older revisions are
+// folded into the oldest retained one so replaying history still yields the right state.
+const MaxRevisionsPerRecord = 500
+
+// FieldChange records one field moving from one value to another. Entry fields are name,
+// description, tags, attributes.<key> and links.<type>; workspace fields are name, kind,
+// parent_id, document, columns, rows and cells.<row>.<column>.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Revision is one numbered change to a ledger entry or workspace.
+type Revision struct {
+	Kind    string        `json:"kind"`
+	Type    LedgerType    `json:"type,omitempty"`
+	ID      string        `json:"id"`
+	Number  int           `json:"number"`
+	Actor   string        `json:"actor"`
+	Action  string        `json:"action"`
+	At      time.Time     `json:"at"`
+	Changes []FieldChange `json:"changes"`
+}
+
+func (r Revision) clone() Revision {
+	clone := r
+	clone.Changes = append([]FieldChange(nil), r.Changes...)
+	return clone
+}
+
+func entryRevisionKey(typ LedgerType, id string) string {
+	return RevisionKindEntry + ":" + string(typ) + ":" + id
+}
+
+func workspaceRevisionKey(id string) string {
+	return RevisionKindWorkspace + ":" + id
+}
+
+func (r Revision) key() string {
+	if r.Kind == RevisionKindWorkspace {
+		return workspaceRevisionKey(r.ID)
+	}
+	return entryRevisionKey(r.Type, r.ID)
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+func splitJoined(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ", ")
+}
+
+func flattenEntry(entry LedgerEntry) map[string]string {
+	fields := map[string]string{"name": entry.Name}
+	if entry.Description != "" {
+		fields["description"] = entry.Description
+	}
+	if len(entry.Tags) > 0 {
+		fields["tags"] = strings.Join(entry.Tags, ", ")
+	}
+	for key, value := range entry.Attributes {
+		if value != "" {
+			fields["attributes."+key] = value
+		}
+	}
+	for target, ids := range entry.Links {
+		if len(ids) > 0 {
+			fields["links."+string(target)] = joinSorted(ids)
+		}
+	}
+	return fields
+}
+
+func unflattenEntry(id string, fields map[string]string) LedgerEntry {
+	entry := LedgerEntry{ID: id, Name: fields["name"], Description: fields["description"], Tags: splitJoined(fields["tags"])}
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, "attributes."):
+			if entry.Attributes == nil {
+				entry.Attributes = make(map[string]string)
+			}
+			entry.Attributes[strings.TrimPrefix(field, "attributes.")] = value
+		case strings.HasPrefix(field, "links."):
+			if entry.Links == nil {
+				entry.Links = make(map[LedgerType][]string)
+			}
+			entry.Links[LedgerType(strings.TrimPrefix(field, "links."))] = splitJoined(value)
+		}
+	}
+	return entry
+}
+
+func flattenWorkspace(ws *Workspace) map[string]string {
+	fields := map[string]string{"name": ws.Name, "kind": string(ws.Kind)}
+	if ws.ParentID != "" {
+		fields["parent_id"] = ws.ParentID
+	}
+	if ws.Document != "" {
+		fields["document"] = ws.Document
+	}
+	if len(ws.Columns) > 0 {
+		if data, err := json.Marshal(ws.Columns); err == nil {
+			fields["columns"] = string(data)
+		}
+	}
+	rowIDs := make([]string, 0, len(ws.Rows))
+	for _, row := range ws.Rows {
+		rowIDs = append(rowIDs, row.ID)
+		for column, value := range row.Cells {
+			if value != "" {
+				fields["cells."+row.ID+"."+column] = value
+			}
+		}
+	}
+	if len(rowIDs) > 0 {
+		fields["rows"] = strings.Join(rowIDs, ", ")
+	}
+	return fields
+}
+
+// unflattenWorkspace rebuilds a workspace from its tracked fields. Row styles and highlights
+// are not tracked and come back empty.
+func unflattenWorkspace(id string, fields map[string]string) *Workspace {
+	ws := &Workspace{ID: id, Name: fields["name"], Kind: WorkspaceKind(fields["kind"]), ParentID: fields["parent_id"], Document: fields["document"]}
+	ws.Columns = []WorkspaceColumn{}
+	if raw := fields["columns"]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &ws.Columns)
+	}
+	ws.Rows = []WorkspaceRow{}
+	for _, rowID := range splitJoined(fields["rows"]) {
+		row := WorkspaceRow{ID: rowID, Cells: make(map[string]string)}
+		prefix := "cells." + rowID + "."
+		for field, value := range fields {
+			if strings.HasPrefix(field, prefix) {
+				row.Cells[strings.TrimPrefix(field, prefix)] = value
+			}
+		}
+		ws.Rows = append(ws.Rows, row)
+	}
+	return ws
+}
+
+// diffFields lists the changes turning before into after, sorted by field.
+func diffFields(before, after map[string]string) []FieldChange {
+	changes := make([]FieldChange, 0)
+	for field, value := range after {
+		if previous, ok := before[field]; !ok || previous != value {
+			changes = append(changes, FieldChange{Field: field, From: before[field], To: value})
+		}
+	}
+	for field, value := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, From: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// applyChanges replays a revision onto a flattened state. A delete revision clears the state.
+func applyChanges(state map[string]string, rev Revision) map[string]string {
+	if rev.Action == RevisionDelete {
+		return nil
+	}
+	next := make(map[string]string, len(state)+len(rev.Changes))
+	for field, value := range state {
+		next[field] = value
+	}
+	for _, change := range rev.Changes {
+		if change.To == "" {
+			delete(next, change.Field)
+			continue
+		}
+		next[change.Field] = change.To
+	}
+	return next
+}
+
+// foldRevisions merges newer into older so that replaying the result equals replaying both.
+func foldRevisions(older, newer Revision) Revision {
+	merged := newer.clone()
+	if newer.Action == RevisionDelete || older.Action == RevisionDelete {
+		return merged
+	}
+	if older.Action == RevisionCreate {
+		merged.Action = RevisionCreate
+	}
+	byField := make(map[string]FieldChange, len(older.Changes)+len(newer.Changes))
+	for _, change := range older.Changes {
+		byField[change.Field] = change
+	}
+	for _, change := range newer.Changes {
+		if previous, ok := byField[change.Field]; ok {
+			change.From = previous.From
+		}
+		byField[change.Field] = change
+	}
+	merged.Changes = make([]FieldChange, 0, len(byField))
+	for _, change := range byField {
+		if change.From != change.To {
+			merged.Changes = append(merged.Changes, change)
+		}
+	}
+	sort.Slice(merged.Changes, func(i, j int) bool { return merged.Changes[i].Field < merged.Changes[j].Field })
+	return merged
+}
+
+// recordRevisionLocked appends a revision when after differs from the last recorded state of
+// the record. A nil after marks the record as deleted.
+func (s *LedgerStore) recordRevisionLocked(template Revision, after map[string]string, actor string) {
+	if s.revisions == nil {
+		s.revisions = make(map[string][]Revision)
+		s.revisionState = make(map[string]map[string]string)
+	}
+	key := template.key()
+	before, known := s.revisionState[key]
+	rev := template
+	rev.Actor = actor
+	rev.At = time.Now().UTC()
+	switch {
+	case after == nil:
+		if before == nil {
+			return
+		}
+		rev.Action = RevisionDelete
+		rev.Changes = diffFields(before, nil)
+	case !known || before == nil:
+		rev.Action = RevisionCreate
+		rev.Changes = diffFields(nil, after)
+	default:
+		rev.Action = RevisionUpdate
+		rev.Changes = diffFields(before, after)
+		if len(rev.Changes) == 0 {
+			return
+		}
+	}
+	history := s.revisions[key]
+	rev.Number = 1
+	if n := len(history); n > 0 {
+		rev.Number = history[n-1].Number + 1
+	}
+	history = append(history, rev)
+	if len(history) > MaxRevisionsPerRecord {
+		history = append([]Revision{foldRevisions(history[0], history[1])}, history[2:]...)
+	}
+	s.revisions[key] = history
+	s.revisionState[key] = after
+}
+
+// recordEntryRevisionsLocked records a revision for each entry an operation changed, reverse
+// links and cascaded deletions included, from the entry's live state.
+func (s *LedgerStore) recordEntryRevisionsLocked(changes []entryChange, actor string) {
+	for _, change := range changes {
+		var after map[string]string
+		if idx := s.entryIndexLocked(change.typ, change.id); idx >= 0 {
+			after = flattenEntry(s.entries[change.typ][idx])
+		}
+		s.recordRevisionLocked(Revision{Kind: RevisionKindEntry, Type: change.typ, ID: change.id}, after, actor)
+	}
+}
+
+// syncEntryRevisionsLocked records a revision for every ledger entry whose tracked fields
+// differ from its last revision, and a deletion for every recorded entry that is gone. It is
+// used when restoring, where no operation says what changed.
+func (s *LedgerStore) syncEntryRevisionsLocked(actor string) {
+	live := make(map[string]struct{})
+	for _, typ := range s.ledgerTypeOrder {
+		for _, entry := range s.entries[typ] {
+			template := Revision{Kind: RevisionKindEntry, Type: typ, ID: entry.ID}
+			live[template.key()] = struct{}{}
+			s.recordRevisionLocked(template, flattenEntry(entry), actor)
+		}
+	}
+	for key, state := range s.revisionState {
+		if _, ok := live[key]; ok || state == nil || !strings.HasPrefix(key, RevisionKindEntry+":") {
+			continue
+		}
+		history := s.revisions[key]
+		last := history[len(history)-1]
+		s.recordRevisionLocked(Revision{Kind: RevisionKindEntry, Type: last.Type, ID: last.ID}, nil, actor)
+	}
+}
+
+func (s *LedgerStore) recordWorkspaceRevisionLocked(ws *Workspace, actor string) {
+	s.recordRevisionLocked(Revision{Kind: RevisionKindWorkspace, ID: ws.ID}, flattenWorkspace(ws), actor)
+}
+
+func (s *LedgerStore) recordWorkspaceDeletionLocked(ids []string, actor string) {
+	for _, id := range ids {
+		s.recordRevisionLocked(Revision{Kind: RevisionKindWorkspace, ID: id}, nil, actor)
+	}
+}
+
+// restoreRevisionsLocked loads persisted revisions, replays them to rebuild the last known
+// state of every record and then records whatever differs from the live data.
+func (s *LedgerStore) restoreRevisionsLocked(revisions []Revision, actor string) {
+	s.revisions = make(map[string][]Revision)
+	s.revisionState = make(map[string]map[string]string)
+	for _, rev := range revisions {
+		key := rev.key()
+		s.revisions[key] = append(s.revisions[key], rev.clone())
+	}
+	for key, history := range s.revisions {
+		sort.SliceStable(history, func(i, j int) bool { return history[i].Number < history[j].Number })
+		var state map[string]string
+		for _, rev := range history {
+			state = applyChanges(state, rev)
+		}
+		s.revisionState[key] = state
+	}
+	s.syncEntryRevisionsLocked(actor)
+	for _, id := range s.workspaceOrder {
+		if ws, ok := s.workspaces[id]; ok {
+			s.recordWorkspaceRevisionLocked(ws, actor)
+		}
+	}
+	for key, state := range s.revisionState {
+		if state == nil || !strings.HasPrefix(key, RevisionKindWorkspace+":") {
+			continue
+		}
+		id := strings.TrimPrefix(key, RevisionKindWorkspace+":")
+		if _, ok := s.workspaces[id]; !ok {
+			s.recordWorkspaceDeletionLocked([]string{id}, actor)
+		}
+	}
+}
+
+// mergeRevisionsLocked combines local history with revisions from a merged snapshot. A record
+// keeps its local history when it has one; otherwise the incoming history is adopted.
+func (s *LedgerStore) mergeRevisionsLocked(incoming []Revision) []Revision {
+	merged := s.revisionSliceLocked()
+	for _, rev := range incoming {
+		if _, ok := s.revisions[rev.key()]; !ok {
+			merged = append(merged, rev.clone())
+		}
+	}
+	return merged
+}
+
+// revisionSliceLocked flattens all revisions for persistence in a stable order.
+func (s *LedgerStore) revisionSliceLocked() []Revision {
+	keys := make([]string, 0, len(s.revisions))
+	for key := range s.revisions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]Revision, 0)
+	for _, key := range keys {
+		for _, rev := range s.revisions[key] {
+			out = append(out, rev.clone())
+		}
+	}
+	return out
+}
+
+func (s *LedgerStore) listRevisionsLocked(key string, field string) ([]Revision, error) {
+	history, ok := s.revisions[key]
+	if !ok {
+		return nil, ErrRevisionNotFound
+	}
+	out := make([]Revision, 0, len(history))
+	for _, rev := range history {
+		if field != "" {
+			touched := false
+			for _, change := range rev.Changes {
+				if change.Field == field {
+					touched = true
+					break
+				}
+			}
+			if !touched {
+				continue
+			}
+		}
+		out = append(out, rev.clone())
+	}
+	return out, nil
+}
+
+// stateAtLocked replays the record's history up to and including the last revision accepted
+// by keep, returning that revision and the resulting state.
+func (s *LedgerStore) stateAtLocked(key string, keep func(Revision) bool) (map[string]string, Revision, bool) {
+	var state map[string]string
+	var last Revision
+	found := false
+	for _, rev := range s.revisions[key] {
+		if !keep(rev) {
+			break
+		}
+		state = applyChanges(state, rev)
+		last = rev
+		found = true
+	}
+	return state, last, found
+}
+
+func (s *LedgerStore) diffRevisionsLocked(key string, from, to int) ([]FieldChange, error) {
+	var states [2]map[string]string
+	for i, number := range []int{from, to} {
+		exists := false
+		for _, rev := range s.revisions[key] {
+			if rev.Number == number {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			return nil, ErrRevisionNotFound
+		}
+		states[i], _, _ = s.stateAtLocked(key, func(rev Revision) bool { return rev.Number <= number })
+	}
+	return diffFields(states[0], states[1]), nil
+}
+
+// EntryRevisions lists the revisions of a ledger entry, oldest first. When field is set only
+// revisions touching that field are returned, e.g. "attributes.owner". Deleted entries keep
+// their history.
+func (s *LedgerStore) EntryRevisions(typ LedgerType, id string, field string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listRevisionsLocked(entryRevisionKey(typ, id), field)
+}
+
+// EntryAsOf reconstructs a ledger entry as it was at the given time.
+func (s *LedgerStore) EntryAsOf(typ LedgerType, id string, at time.Time) (LedgerEntry, Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, rev, ok := s.stateAtLocked(entryRevisionKey(typ, id), func(rev Revision) bool { return !rev.At.After(at) })
+	if !ok || state == nil {
+		return LedgerEntry{}, Revision{}, ErrEntryNotFound
+	}
+	entry := unflattenEntry(id, state)
+	entry.UpdatedAt = rev.At
+	return entry, rev.clone(), nil
+}
+
+// DiffEntryRevisions compares an entry between two revision numbers.
+func (s *LedgerStore) DiffEntryRevisions(typ LedgerType, id string, from, to int) ([]FieldChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.diffRevisionsLocked(entryRevisionKey(typ, id), from, to)
+}
+
+// WorkspaceRevisions lists the revisions of a workspace, oldest first, optionally only those
+// touching field.
+func (s *LedgerStore) WorkspaceRevisions(id string, field string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listRevisionsLocked(workspaceRevisionKey(id), field)
+}
+
+// WorkspaceAsOf reconstructs a workspace as it was at the given time.
+func (s *LedgerStore) WorkspaceAsOf(id string, at time.Time) (*Workspace, Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, rev, ok := s.stateAtLocked(workspaceRevisionKey(id), func(rev Revision) bool { return !rev.At.After(at) })
+	if !ok || state == nil {
+		return nil, Revision{}, ErrWorkspaceNotFound
+	}
+	ws := unflattenWorkspace(id, state)
+	ws.UpdatedAt = rev.At
+	return ws, rev.clone(), nil
+}
+
+// DiffWorkspaceRevisions compares a workspace between two revision numbers.
+func (s *LedgerStore) DiffWorkspaceRevisions(id string, from, to int) ([]FieldChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.diffRevisionsLocked(workspaceRevisionKey(id), from, to)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntryRevisionsAndPointInTime(t *testing.T) {
+	store := newTestStore(t)
+
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "alice")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	ip, err := store.CreateEntry(LedgerTypeIP, LedgerEntry{Name: "10.1.2.3", Attributes: map[string]string{"owner": "张三"}}, "alice")
+	if err != nil {
+		t.Fatalf("create ip: %v", err)
+	}
+	created := time.Now().UTC()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.UpdateEntry(LedgerTypeIP, ip.ID, LedgerEntry{Name: "10.1.2.3", Attributes: map[string]string{"owner": "李四"}, Links: map[LedgerType][]string{LedgerTypeSystem: {erp.ID}}}, "bob"); err != nil {
+		t.Fatalf("update ip: %v", err)
+	}
+
+	owners, err := store.EntryRevisions(LedgerTypeIP, ip.ID, "attributes.owner")
+	if err != nil {
+		t.Fatalf("revisions: %v", err)
+	}
+	if len(owners) != 2 || owners[1].Actor != "bob" || owners[1].Action != RevisionUpdate {
+		t.Fatalf("expected bob's owner change as second revision, got %+v", owners)
+	}
+	systemHistory, _ := store.EntryRevisions(LedgerTypeSystem, erp.ID, "links.ips")
+	if len(systemHistory) != 1 || systemHistory[0].Actor != "bob" {
+		t.Fatalf("expected reverse link to be recorded on the system, got %+v", systemHistory)
+	}
+
+	past, rev, err := store.EntryAsOf(LedgerTypeIP, ip.ID, created)
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	if past.Attributes["owner"] != "张三" || len(past.Links) != 0 || rev.Number != 1 {
+		t.Fatalf("expected original owner at revision 1, got %+v (rev %d)", past, rev.Number)
+	}
+	if _, _, err := store.EntryAsOf(LedgerTypeIP, ip.ID, created.Add(-time.Hour)); err == nil {
+		t.Fatalf("expected entry to be missing before creation")
+	}
+
+	changes, err := store.DiffEntryRevisions(LedgerTypeIP, ip.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "attributes.owner" || changes[0].From != "张三" || changes[0].To != "李四" {
+		t.Fatalf("unexpected diff %+v", changes)
+	}
+
+	if err := store.DeleteEntry(LedgerTypeIP, ip.ID, "carol"); err != nil {
+		t.Fatalf("delete ip: %v", err)
+	}
+	history, _ := store.EntryRevisions(LedgerTypeIP, ip.ID, "")
+	if last := history[len(history)-1]; last.Action != RevisionDelete || last.Actor != "carol" {
+		t.Fatalf("expected delete revision, got %+v", last)
+	}
+	if systemHistory, _ := store.EntryRevisions(LedgerTypeSystem, erp.ID, "links.ips"); len(systemHistory) != 2 || systemHistory[1].Actor != "carol" {
+		t.Fatalf("expected the cascaded unlink to be recorded on the system, got %+v", systemHistory)
+	}
+
+	restored := NewLedgerStore()
+	if err := restored.ImportSnapshot(store.ExportSnapshot()); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if again, _ := restored.EntryRevisions(LedgerTypeIP, ip.ID, ""); len(again) != len(history) {
+		t.Fatalf("expected revisions to survive a snapshot round trip, got %d want %d", len(again), len(history))
+	}
+}
+
+func TestWorkspaceRevisions(t *testing.T) {
+	store := newTestStore(t)
+	ws, err := store.CreateWorkspace("值班表", WorkspaceKindSheet, "", []WorkspaceColumn{{ID: "c1", Title: "姓名"}}, []WorkspaceRow{{ID: "r1", Cells: map[string]string{"c1": "张三"}}}, "", "alice")
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if _, err := store.UpdateWorkspace(ws.ID, WorkspaceUpdate{SetRows: true, Rows: []WorkspaceRow{{ID: "r1", Cells: map[string]string{"c1": "李四"}}}}, "bob"); err != nil {
+		t.Fatalf("update workspace: %v", err)
+	}
+	changes, err := store.DiffWorkspaceRevisions(ws.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Field != "cells.r1.c1" || changes[0].To != "李四" {
+		t.Fatalf("unexpected workspace diff %+v", changes)
+	}
+	past, _, err := store.WorkspaceAsOf(ws.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	if len(past.Rows) != 1 || past.Rows[0].Cells["c1"] != "李四" || len(past.Columns) != 1 {
+		t.Fatalf("unexpected reconstructed workspace %+v", past)
+	}
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSchemaInvalid indicates a ledger schema definition is malformed.
+	ErrSchemaInvalid = errors.New("schema_invalid")
+	// ErrSchemaNotFound indicates no schema has been defined for the ledger.
+	ErrSchemaNotFound = errors.New("schema_not_found")
+	// ErrValidationFailed indicates one or more entry attributes violate the ledger schema.
+	ErrValidationFailed = errors.New("validation_failed")
+)
+
+// FieldType enumerates the value types a schema field can enforce.
+type FieldType string
+
+const (
+	FieldTypeText   FieldType = "text"
+	FieldTypeNumber FieldType = "number"
+	FieldTypeDate   FieldType = "date"
+	FieldTypeEnum   FieldType = "enum"
+	FieldTypeIP     FieldType = "ip"
+	FieldTypeEmail  FieldType = "email"
+	FieldTypePhone  FieldType = "phone"
+)
+
+// Field validation error codes reported in FieldError.Code.
+const (
+	FieldErrorRequired  = "required"
+	FieldErrorType      = "invalid_type"
+	FieldErrorOption    = "invalid_option"
+	FieldErrorDuplicate = "duplicate"
+	FieldErrorUnknown   = "unknown_field"
+)
+
+// dateLayouts lists accepted spellings for date fields; values are stored as the first layout.
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "2006.01.02", time.RFC3339}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{4,24}$`)
+
+// numberPattern accepts plain decimal numbers only; strconv.ParseFloat alone would also take
+// NaN, Inf and hexadecimal floats.
+var numberPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// SchemaField declares a single typed attribute of a ledger.
+type SchemaField struct {
+	Name     string    `json:"name"`
+	Label    string    `json:"label,omitempty"`
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required,omitempty"`
+	Unique   bool      `json:"unique,omitempty"`
+	Default  string    `json:"default,omitempty"`
+	Options  []string  `json:"options,omitempty"`
+}
+
+// LedgerSchema describes the attributes accepted by a ledger type.
+type LedgerSchema struct {
+	Type      LedgerType    `json:"type"`
+	Fields    []SchemaField `json:"fields"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Clone returns a deep copy of the schema.
+func (s *LedgerSchema) Clone() *LedgerSchema {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	clone.Fields = make([]SchemaField, len(s.Fields))
+	for i, field := range s.Fields {
+		field.Options = append([]string(nil), field.Options...)
+		clone.Fields[i] = field
+	}
+	return &clone
+}
+
+// Field returns the declared field with the given name.
+func (s *LedgerSchema) Field(name string) (SchemaField, bool) {
+	if s == nil {
+		return SchemaField{}, false
+	}
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return SchemaField{}, false
+}
+
+// FieldError reports a single attribute that failed schema validation. Index is the
+// position of the offending entry within the submitted batch.
+type FieldError struct {
+	Index   int    `json:"index"`
+	EntryID string `json:"entry_id,omitempty"`
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError aggregates the field errors of a rejected write.
+type ValidationError struct {
+	Type   LedgerType   `json:"type"`
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return ErrValidationFailed.Error()
+	}
+	first := e.Fields[0]
+	return fmt.Sprintf("%s: %s %s", ErrValidationFailed.Error(), first.Field, first.Code)
+}
+
+// Unwrap allows errors.Is(err, ErrValidationFailed).
+func (e *ValidationError) Unwrap() error {
+	return ErrValidationFailed
+}
+
+// normaliseSchema validates a schema definition and returns a canonical copy.
+func normaliseSchema(typ LedgerType, schema LedgerSchema) (*LedgerSchema, error) {
+	out := &LedgerSchema{Type: typ, Fields: make([]SchemaField, 0, len(schema.Fields))}
+	seen := make(map[string]struct{}, len(schema.Fields))
+	for _, field := range schema.Fields {
+		field.Name = strings.ToLower(strings.TrimSpace(field.Name))
+		field.Label = strings.TrimSpace(field.Label)
+		field.Type = FieldType(strings.ToLower(strings.TrimSpace(string(field.Type))))
+		if field.Type == "" {
+			field.Type = FieldTypeText
+		}
+		if field.Name == "" {
+			return nil, fmt.Errorf("%w: field name required", ErrSchemaInvalid)
+		}
+		switch field.Name {
+		case "id", "name", "description", "tags":
+			return nil, fmt.Errorf("%w: %s is a reserved column", ErrSchemaInvalid, field.Name)
+		}
+		if _, dup := seen[field.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate field %s", ErrSchemaInvalid, field.Name)
+		}
+		seen[field.Name] = struct{}{}
+		switch field.Type {
+		case FieldTypeText, FieldTypeNumber, FieldTypeDate, FieldTypeIP, FieldTypeEmail, FieldTypePhone:
+			field.Options = nil
+		case FieldTypeEnum:
+			field.Options = normaliseStrings(field.Options)
+			if len(field.Options) == 0 {
+				return nil, fmt.Errorf("%w: enum field %s needs options", ErrSchemaInvalid, field.Name)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported type %s", ErrSchemaInvalid, field.Type)
+		}
+		field.Default = strings.TrimSpace(field.Default)
+		if field.Default != "" {
+			value, code := coerceFieldValue(field, field.Default)
+			if code != "" {
+				return nil, fmt.Errorf("%w: default for %s is %s", ErrSchemaInvalid, field.Name, code)
+			}
+			field.Default = value
+		}
+		out.Fields = append(out.Fields, field)
+	}
+	return out, nil
+}
+
+// coerceFieldValue converts a raw value into the field's canonical representation and
+// returns a FieldError code when the value does not fit the type.
+func coerceFieldValue(field SchemaField, raw string) (string, string) {
+	value := strings.TrimSpace(raw)
+	switch field.Type {
+	case FieldTypeNumber:
+		digits := strings.ReplaceAll(value, ",", "")
+		if !numberPattern.MatchString(digits) {
+			return value, FieldErrorType
+		}
+		number, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return value, FieldErrorType
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), ""
+	case FieldTypeDate:
+		for _, layout := range dateLayouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed.Format(dateLayouts[0]), ""
+			}
+		}
+		return value, FieldErrorType
+	case FieldTypeEnum:
+		for _, option := range field.Options {
+			if strings.EqualFold(option, value) {
+				return option, ""
+			}
+		}
+		return value, FieldErrorOption
+	case FieldTypeIP:
+		address, ok := NormaliseIPAddress(value)
+		if !ok {
+			return value, FieldErrorType
+		}
+		return address, ""
+	case FieldTypeEmail:
+		parsed, err := mail.ParseAddress(value)
+		if err != nil || parsed.Address != value {
+			return value, FieldErrorType
+		}
+		return strings.ToLower(value), ""
+	case FieldTypePhone:
+		if !phonePattern.MatchString(value) {
+			return value, FieldErrorType
+		}
+		return value, ""
+	default:
+		return value, ""
+	}
+}
+
+// applySchemaLocked fills defaults, canonicalises typed attributes and checks required,
+// unknown and unique constraints for the candidates against the rest of the ledger. Entries
+// whose IDs appear among the candidates are treated as being replaced.
+func (s *LedgerStore) applySchemaLocked(typ LedgerType, schema *LedgerSchema, candidates []LedgerEntry, existing []LedgerEntry) error {
+	if schema == nil {
+		return nil
+	}
+	replaced := make(map[string]struct{}, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.ID != "" {
+			replaced[candidate.ID] = struct{}{}
+		}
+	}
+	taken := make(map[string]map[string]string)
+	for _, field := range schema.Fields {
+		if field.Unique {
+			taken[field.Name] = make(map[string]string)
+		}
+	}
+	for _, entry := range existing {
+		if _, ok := replaced[entry.ID]; ok {
+			continue
+		}
+		for name, values := range taken {
+			if value := entry.Attributes[name]; value != "" {
+				values[strings.ToLower(value)] = entry.ID
+			}
+		}
+	}
+
+	var failures []FieldError
+	fail := func(index int, entry LedgerEntry, field, code, message string) {
+		failures = append(failures, FieldError{Index: index, EntryID: entry.ID, Field: field, Code: code, Message: message})
+	}
+	for i := range candidates {
+		entry := &candidates[i]
+		if entry.Attributes == nil {
+			entry.Attributes = make(map[string]string)
+		}
+		keys := make([]string, 0, len(entry.Attributes))
+		for key := range entry.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := schema.Field(key); ok {
+				continue
+			}
+			if typ == LedgerTypeIP && key == IPAddressAttribute {
+				continue
+			}
+			fail(i, *entry, key, FieldErrorUnknown, fmt.Sprintf("%s is not defined in the %s schema", key, typ))
+		}
+		for _, field := range schema.Fields {
+			value := strings.TrimSpace(entry.Attributes[field.Name])
+			if value == "" && field.Default != "" {
+				value = field.Default
+			}
+			if value == "" {
+				delete(entry.Attributes, field.Name)
+				if field.Required {
+					fail(i, *entry, field.Name, FieldErrorRequired, fmt.Sprintf("%s is required", field.Name))
+				}
+				continue
+			}
+			canonical, code := coerceFieldValue(field, value)
+			if code != "" {
+				fail(i, *entry, field.Name, code, fmt.Sprintf("%q is not a valid %s", value, field.Type))
+				continue
+			}
+			entry.Attributes[field.Name] = canonical
+			if values, ok := taken[field.Name]; ok {
+				key := strings.ToLower(canonical)
+				if owner, dup := values[key]; dup && owner != entry.ID {
+					fail(i, *entry, field.Name, FieldErrorDuplicate, fmt.Sprintf("%s %q is already used by %s", field.Name, canonical, owner))
+					continue
+				}
+				values[key] = entry.ID
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return &ValidationError{Type: typ, Fields: failures}
+	}
+	return nil
+}
+
+// ListSchemas returns the defined ledger schemas in ledger order.
+func (s *LedgerStore) ListSchemas() []*LedgerSchema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*LedgerSchema, 0, len(s.schemas))
+	for _, typ := range s.ledgerTypeOrder {
+		if schema, ok := s.schemas[typ]; ok {
+			out = append(out, schema.Clone())
+		}
+	}
+	return out
+}
+
+// GetSchema returns the schema of a ledger type.
+func (s *LedgerStore) GetSchema(typ LedgerType) (*LedgerSchema, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schema, ok := s.schemas[typ]
+	if !ok {
+		return nil, ErrSchemaNotFound
+	}
+	return schema.Clone(), nil
+}
+
+// SetSchema installs or replaces the schema of a ledger type. Existing entries must already
+// satisfy the new schema; they are normalised to its canonical values.
+func (s *LedgerStore) SetSchema(typ LedgerType, schema LedgerSchema, actor string) (*LedgerSchema, error) {
+	normalised, err := normaliseSchema(typ, schema)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := cloneEntrySlice(s.entries[typ])
+	if err := s.applySchemaLocked(typ, normalised, entries, nil); err != nil {
+		return nil, err
+	}
+	normalised.UpdatedAt = time.Now().UTC()
+	s.schemas[typ] = normalised
+	if len(entries) > 0 {
+		for _, entry := range entries {
+			s.touchEntryLocked(typ, entry.ID)
+		}
+		s.entries[typ] = entries
+	}
+	s.appendAuditLocked(actor, "schema_set", string(typ))
+	s.commitLocked(actor)
+	return normalised.Clone(), nil
+}
+
+// DeleteSchema removes the schema of a ledger type, returning it to free-form attributes.
+func (s *LedgerStore) DeleteSchema(typ LedgerType, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schemas[typ]; !ok {
+		return ErrSchemaNotFound
+	}
+	delete(s.schemas, typ)
+	s.appendAuditLocked(actor, "schema_delete", string(typ))
+	return nil
+}
+
+func cloneSchemas(schemas map[LedgerType]*LedgerSchema) map[LedgerType]*LedgerSchema {
+	cloned := make(map[LedgerType]*LedgerSchema, len(schemas))
+	for typ, schema := range schemas {
+		cloned[typ] = schema.Clone()
+	}
+	return cloned
+}
+
+func schemaMapFromSlice(schemas []*LedgerSchema) map[LedgerType]*LedgerSchema {
+	out := make(map[LedgerType]*LedgerSchema, len(schemas))
+	for _, schema := range schemas {
+		if schema == nil || strings.TrimSpace(string(schema.Type)) == "" {
+			continue
+		}
+		out[schema.Type] = schema.Clone()
+	}
+	return out
+}
+
+func schemaSlice(schemas map[LedgerType]*LedgerSchema) []*LedgerSchema {
+	out := make([]*LedgerSchema, 0, len(schemas))
+	for _, schema := range schemas {
+		out = append(out, schema.Clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// validateSnapshotEntries checks snapshot ledgers against the given schemas before import.
+func (s *LedgerStore) validateSnapshotEntries(entries map[LedgerType][]LedgerEntry, schemas map[LedgerType]*LedgerSchema) error {
+	for typ, list := range entries {
+		schema := schemas[typ]
+		if schema == nil {
+			continue
+		}
+		if err := s.applySchemaLocked(typ, schema, list, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
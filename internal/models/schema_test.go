@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLedgerSchemaValidatesEntries(t *testing.T) {
+	store := newTestStore(t)
+
+	_, err := store.SetSchema(LedgerTypePersonnel, LedgerSchema{Fields: []SchemaField{
+		{Name: "Email", Type: FieldTypeEmail, Required: true, Unique: true},
+		{Name: "joined", Type: FieldTypeDate},
+		{Name: "level", Type: FieldTypeEnum, Options: []string{"P1", "P2"}, Default: "p1"},
+		{Name: "phone", Type: FieldTypePhone},
+	}}, "tester")
+	if err != nil {
+		t.Fatalf("set schema: %v", err)
+	}
+
+	created, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "张三", Attributes: map[string]string{
+		"email":  "zhangsan@example.com",
+		"joined": "2024/03/01",
+	}}, "tester")
+	if err != nil {
+		t.Fatalf("create valid entry: %v", err)
+	}
+	if created.Attributes["joined"] != "2024-03-01" || created.Attributes["level"] != "P1" {
+		t.Fatalf("expected canonical date and default enum, got %+v", created.Attributes)
+	}
+
+	_, err = store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "李四", Attributes: map[string]string{
+		"email":  "ZhangSan@example.com",
+		"joined": "yesterday",
+		"emial":  "typo",
+	}}, "tester")
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	codes := map[string]string{}
+	for _, field := range validation.Fields {
+		codes[field.Field] = field.Code
+	}
+	if codes["email"] != FieldErrorDuplicate || codes["joined"] != FieldErrorType || codes["emial"] != FieldErrorUnknown {
+		t.Fatalf("unexpected field errors: %+v", validation.Fields)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypePersonnel, created.ID, LedgerEntry{Attributes: map[string]string{"level": "P3", "email": "zhangsan@example.com"}}, "tester"); !errors.Is(err, ErrValidationFailed) {
+		t.Fatalf("expected enum violation on update, got %v", err)
+	}
+	if err := store.ReplaceEntries(LedgerTypePersonnel, []LedgerEntry{{Name: "王五"}}, "tester"); !errors.Is(err, ErrValidationFailed) {
+		t.Fatalf("expected missing required field on replace, got %v", err)
+	}
+	if got := len(store.ListEntries(LedgerTypePersonnel)); got != 1 {
+		t.Fatalf("expected rejected writes to leave ledger untouched, got %d entries", got)
+	}
+
+	snapshot := store.ExportSnapshot()
+	snapshot.Entries[LedgerTypePersonnel] = append(snapshot.Entries[LedgerTypePersonnel], LedgerEntry{ID: "personnel-bad", Name: "赵六"})
+	if err := store.ImportSnapshot(snapshot); !errors.Is(err, ErrValidationFailed) {
+		t.Fatalf("expected snapshot import to enforce schema, got %v", err)
+	}
+	if _, err := store.GetSchema(LedgerTypePersonnel); err != nil {
+		t.Fatalf("expected schema to survive rejected import: %v", err)
+	}
+}
+
+func TestLedgerSchemaRejectsInvalidDefinitions(t *testing.T) {
+	store := newTestStore(t)
+
+	cases := []LedgerSchema{
+		{Fields: []SchemaField{{Name: "name", Type: FieldTypeText}}},
+		{Fields: []SchemaField{{Name: "os", Type: FieldTypeEnum}}},
+		{Fields: []SchemaField{{Name: "port", Type: FieldTypeNumber, Default: "eighty"}}},
+		{Fields: []SchemaField{{Name: "a"}, {Name: "A"}}},
+	}
+	for i, schema := range cases {
+		if _, err := store.SetSchema(LedgerTypeSystem, schema, "tester"); !errors.Is(err, ErrSchemaInvalid) {
+			t.Fatalf("case %d: expected invalid schema, got %v", i, err)
+		}
+	}
+
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA", Attributes: map[string]string{"port": "8080"}}, "tester"); err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if _, err := store.SetSchema(LedgerTypeSystem, LedgerSchema{Fields: []SchemaField{{Name: "port", Type: FieldTypeNumber, Required: true}, {Name: "owner", Type: FieldTypeText, Required: true}}}, "tester"); !errors.Is(err, ErrValidationFailed) {
+		t.Fatalf("expected schema incompatible with existing entries to be refused, got %v", err)
+	}
+}
+
+func TestNumberFieldsAcceptFiniteDecimalsOnly(t *testing.T) {
+	field := SchemaField{Name: "port", Type: FieldTypeNumber}
+	for raw, want := range map[string]string{"8080": "8080", " 1,024.50 ": "1024.5", "-.5": "-0.5", "1e3": "1000"} {
+		if got, code := coerceFieldValue(field, raw); code != "" || got != want {
+			t.Fatalf("%q: expected %q, got %q (%s)", raw, want, got, code)
+		}
+	}
+	for _, raw := range []string{"NaN", "inf", "-Infinity", "0x1p4", "0x10", "1e400", "1_000", "."} {
+		if _, code := coerceFieldValue(field, raw); code != FieldErrorType {
+			t.Fatalf("%q: expected a type error, got %q", raw, code)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package models
+
+import (
+	"hash/fnv"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Search hit kinds.
+const (
+	SearchKindEntry     = "entry"
+	SearchKindWorkspace = "workspace"
+)
+
+const (
+	searchSnippetRadius = 30
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 200
+)
+
+var (
+	searchBlockTagPattern = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr|/h[1-6])[^>]*>`)
+	searchTagPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// SearchHighlight marks a matched range in a snippet, as rune offsets.
+type SearchHighlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SearchHit is one ranked search result.
+type SearchHit struct {
+	Kind       string            `json:"kind"`
+	Type       LedgerType        `json:"type,omitempty"`
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Field      string            `json:"field"`
+	Snippet    string            `json:"snippet"`
+	Highlights []SearchHighlight `json:"highlights"`
+	Score      float64           `json:"score"`
+}
+
+type searchField struct {
+	name   string
+	text   string
+	weight float64
+}
+
+type searchDoc struct {
+	kind        string
+	typ         LedgerType
+	id          string
+	title       string
+	fields      []searchField
+	fingerprint uint64
+}
+
+// searchIndex is an in-memory inverted index over ledger entries and workspaces. Postings map
+// a token to the weighted term frequency of every document containing it.
+type searchIndex struct {
+	docs     map[string]*searchDoc
+	postings map[string]map[string]float64
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{docs: make(map[string]*searchDoc), postings: make(map[string]map[string]float64)}
+}
+
+func entrySearchKey(typ LedgerType, id string) string {
+	return SearchKindEntry + ":" + string(typ) + ":" + id
+}
+
+func workspaceSearchKey(id string) string {
+	return SearchKindWorkspace + ":" + id
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// tokenize lower-cases text and splits it into words. Runs of CJK characters, which carry no
+// spaces, are emitted as overlapping bigrams; a lone CJK character is its own token.
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+		case 1:
+			tokens = append(tokens, string(cjk))
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// htmlText strips markup from a workspace document, keeping block boundaries as line breaks.
+func htmlText(document string) string {
+	text := searchBlockTagPattern.ReplaceAllString(document, "\n")
+	text = searchTagPattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+func fingerprintFields(fields []searchField) uint64 {
+	h := fnv.New64a()
+	for _, field := range fields {
+		h.Write([]byte(field.name))
+		h.Write([]byte{0})
+		h.Write([]byte(field.text))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+func entrySearchDoc(typ LedgerType, entry LedgerEntry) *searchDoc {
+	fields := []searchField{{name: "name", text: entry.Name, weight: 3}}
+	if entry.Description != "" {
+		fields = append(fields, searchField{name: "description", text: entry.Description, weight: 1})
+	}
+	if len(entry.Tags) > 0 {
+		fields = append(fields, searchField{name: "tags", text: strings.Join(entry.Tags, " "), weight: 2})
+	}
+	keys := make([]string, 0, len(entry.Attributes))
+	for key := range entry.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := entry.Attributes[key]; value != "" {
+			fields = append(fields, searchField{name: "attributes." + key, text: value, weight: 1})
+		}
+	}
+	return &searchDoc{kind: SearchKindEntry, typ: typ, id: entry.ID, title: entry.Name, fields: fields, fingerprint: fingerprintFields(fields)}
+}
+
+func workspaceSearchDoc(ws *Workspace) *searchDoc {
+	fields := []searchField{{name: "name", text: ws.Name, weight: 3}}
+	for _, row := range ws.Rows {
+		for _, column := range ws.Columns {
+			if value := row.Cells[column.ID]; value != "" {
+				fields = append(fields, searchField{name: "cells." + row.ID + "." + column.ID, text: value, weight: 1})
+			}
+		}
+	}
+	if text := htmlText(ws.Document); text != "" {
+		fields = append(fields, searchField{name: "document", text: text, weight: 1})
+	}
+	return &searchDoc{kind: SearchKindWorkspace, id: ws.ID, title: ws.Name, fields: fields, fingerprint: fingerprintFields(fields)}
+}
+
+func (idx *searchIndex) remove(key string) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for _, field := range doc.fields {
+		for _, token := range tokenize(field.text) {
+			if postings := idx.postings[token]; postings != nil {
+				delete(postings, key)
+				if len(postings) == 0 {
+					delete(idx.postings, token)
+				}
+			}
+		}
+	}
+	delete(idx.docs, key)
+}
+
+func (idx *searchIndex) put(key string, doc *searchDoc) {
+	if existing, ok := idx.docs[key]; ok {
+		if existing.fingerprint == doc.fingerprint {
+			existing.title = doc.title
+			return
+		}
+		idx.remove(key)
+	}
+	idx.docs[key] = doc
+	for _, field := range doc.fields {
+		for _, token := range tokenize(field.text) {
+			postings := idx.postings[token]
+			if postings == nil {
+				postings = make(map[string]float64)
+				idx.postings[token] = postings
+			}
+			postings[key] += field.weight
+		}
+	}
+}
+
+// syncSearchIndexLocked rebuilds the index from every entry and workspace, re-tokenising only
+// documents whose content changed. It runs when a store is created or a snapshot imported;
+// commits and undo/redo re-index just the entries they touched.
+func (s *LedgerStore) syncSearchIndexLocked() {
+	if s.search == nil {
+		s.search = newSearchIndex()
+	}
+	live := make(map[string]struct{}, len(s.search.docs))
+	for _, typ := range s.ledgerTypeOrder {
+		for _, entry := range s.entries[typ] {
+			key := entrySearchKey(typ, entry.ID)
+			live[key] = struct{}{}
+			s.search.put(key, entrySearchDoc(typ, entry))
+		}
+	}
+	for id, ws := range s.workspaces {
+		key := workspaceSearchKey(id)
+		live[key] = struct{}{}
+		s.search.put(key, workspaceSearchDoc(ws))
+	}
+	for key := range s.search.docs {
+		if _, ok := live[key]; !ok {
+			s.search.remove(key)
+		}
+	}
+}
+
+// indexEntriesLocked refreshes the entries a change set touched, dropping those that no longer
+// exist.
+func (s *LedgerStore) indexEntriesLocked(changes []entryChange) {
+	if s.search == nil {
+		s.syncSearchIndexLocked()
+		return
+	}
+	for _, change := range changes {
+		key := entrySearchKey(change.typ, change.id)
+		if idx := s.entryIndexLocked(change.typ, change.id); idx >= 0 {
+			s.search.put(key, entrySearchDoc(change.typ, s.entries[change.typ][idx]))
+		} else {
+			s.search.remove(key)
+		}
+	}
+}
+
+// indexWorkspaceLocked refreshes a single workspace after an edit.
+func (s *LedgerStore) indexWorkspaceLocked(ws *Workspace) {
+	if s.search == nil {
+		s.syncSearchIndexLocked()
+		return
+	}
+	s.search.put(workspaceSearchKey(ws.ID), workspaceSearchDoc(ws))
+}
+
+// unindexWorkspacesLocked drops deleted workspaces from the index.
+func (s *LedgerStore) unindexWorkspacesLocked(ids []string) {
+	if s.search == nil {
+		return
+	}
+	for _, id := range ids {
+		s.search.remove(workspaceSearchKey(id))
+	}
+}
+
+// snippetFor cuts a window of text around the first matched term and reports every matched
+// range within it. Line breaks are flattened rune-for-rune so offsets stay valid.
+func snippetFor(text string, terms []string) (string, []SearchHighlight) {
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, text))
+	first := -1
+	for _, term := range terms {
+		if at := runeIndexFold(runes, term, 0); at >= 0 && (first < 0 || at < first) {
+			first = at
+		}
+	}
+	start, end := 0, 2*searchSnippetRadius
+	if first >= 0 {
+		start, end = first-searchSnippetRadius, first+searchSnippetRadius
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	window := runes[start:end]
+	offset := 0
+	snippet := string(window)
+	if start > 0 {
+		snippet = "…" + snippet
+		offset = 1
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	covered := make([]bool, len(window))
+	for _, term := range terms {
+		length := utf8.RuneCountInString(term)
+		for at := runeIndexFold(window, term, 0); at >= 0; at = runeIndexFold(window, term, at+length) {
+			for i := at; i < at+length; i++ {
+				covered[i] = true
+			}
+		}
+	}
+	highlights := make([]SearchHighlight, 0)
+	for i := 0; i < len(covered); i++ {
+		if !covered[i] {
+			continue
+		}
+		j := i
+		for j < len(covered) && covered[j] {
+			j++
+		}
+		highlights = append(highlights, SearchHighlight{Start: i + offset, End: j + offset})
+		i = j
+	}
+	return snippet, highlights
+}
+
+// runeIndexFold finds term (already lower-case) in runes at or after from, ignoring case.
+func runeIndexFold(runes []rune, term string, from int) int {
+	needle := []rune(term)
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(runes); i++ {
+		matched := true
+		for j, r := range needle {
+			if unicode.ToLower(runes[i+j]) != r {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
+
+// highlightTerms returns the whole query words to highlight; CJK runs are highlighted as typed.
+func highlightTerms(query string) []string {
+	terms := make([]string, 0)
+	for _, part := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(isCJK(r) || unicode.IsLetter(r) || unicode.IsDigit(r))
+	}) {
+		terms = append(terms, part)
+	}
+	return terms
+}
+
+// Search returns documents containing every token of the query, ranked by weighted term
+// frequency scaled by token rarity. kinds restricts results to entries or workspaces.
+func (s *LedgerStore) Search(query string, kinds []string, limit int) ([]SearchHit, int) {
+	return s.SearchVisible(query, kinds, limit, nil)
+}
+
+// SearchVisible is Search as seen through view: hidden entries are left out and masked
+// attributes neither match, score nor appear in snippets.
+func (s *LedgerStore) SearchVisible(query string, kinds []string, limit int, view *Visibility) ([]SearchHit, int) {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return []SearchHit{}, 0
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	wantKind := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		wantKind[strings.ToLower(strings.TrimSpace(kind))] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.search
+	if idx == nil {
+		return []SearchHit{}, 0
+	}
+	scores := make(map[string]float64)
+	tokens = normaliseStrings(tokens)
+	rarities := make([]float64, len(tokens))
+	for i, token := range tokens {
+		postings := idx.postings[token]
+		if len(postings) == 0 {
+			return []SearchHit{}, 0
+		}
+		rarity := 1 + float64(len(idx.docs))/float64(len(postings))
+		rarities[i] = rarity
+		next := make(map[string]float64, len(postings))
+		for key, weight := range postings {
+			if i > 0 {
+				if _, ok := scores[key]; !ok {
+					continue
+				}
+			}
+			next[key] = scores[key] + weight*rarity
+		}
+		scores = next
+	}
+
+	terms := highlightTerms(query)
+	hits := make([]SearchHit, 0, len(scores))
+	for key, score := range scores {
+		doc := idx.docs[key]
+		if doc == nil || (len(wantKind) > 0 && !wantKind[doc.kind]) {
+			continue
+		}
+		fields := doc.fields
+		if doc.kind == SearchKindEntry {
+			if view.Hidden(doc.typ, doc.id) {
+				continue
+			}
+			if visible := visibleSearchFields(doc, view); len(visible) < len(fields) {
+				var ok bool
+				if score, ok = rescoreFields(visible, tokens, rarities); !ok {
+					continue
+				}
+				fields = visible
+			}
+		}
+		hit := SearchHit{Kind: doc.kind, Type: doc.typ, ID: doc.id, Title: doc.title, Score: score}
+		best := -1
+		for i, field := range fields {
+			if strings.Contains(strings.ToLower(field.text), strings.ToLower(strings.TrimSpace(query))) {
+				best = i
+				hit.Score += field.weight
+				break
+			}
+			if best < 0 && containsAnyToken(field.text, tokens) {
+				best = i
+			}
+		}
+		if best < 0 {
+			best = 0
+		}
+		hit.Field = fields[best].name
+		hit.Snippet, hit.Highlights = snippetFor(fields[best].text, terms)
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Title < hits[j].Title
+	})
+	total := len(hits)
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, total
+}
+
+// visibleSearchFields drops the fields of an entry document that view masks.
+func visibleSearchFields(doc *searchDoc, view *Visibility) []searchField {
+	if view == nil {
+		return doc.fields
+	}
+	fields := make([]searchField, 0, len(doc.fields))
+	for _, field := range doc.fields {
+		if key := strings.TrimPrefix(field.name, "attributes."); key == field.name || !view.Masked(doc.typ, key) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// rescoreFields scores a document from some of its fields the way the index scores whole
+// documents, reporting false when a token is missing from them.
+func rescoreFields(fields []searchField, tokens []string, rarities []float64) (float64, bool) {
+	score := 0.0
+	for i, token := range tokens {
+		weight := 0.0
+		for _, field := range fields {
+			for _, candidate := range tokenize(field.text) {
+				if candidate == token {
+					weight += field.weight
+				}
+			}
+		}
+		if weight == 0 {
+			return 0, false
+		}
+		score += weight * rarities[i]
+	}
+	return score, true
+}
+
+func containsAnyToken(text string, tokens []string) bool {
+	for _, token := range tokenize(text) {
+		if containsString(tokens, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package models
+
+import "testing"
+
+func TestSearchIndexTracksMutations(t *testing.T) {
+	store := newTestStore(t)
+
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "财务核算系统", Tags: []string{"核心"}, Attributes: map[string]string{"vendor": "Kingdee"}}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	ws, err := store.CreateWorkspace("运维手册", WorkspaceKindDocument, "", nil, nil, "<p>财务系统每日<b>备份</b>到异地机房</p>", "tester")
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+
+	hits, total := store.Search("财务", nil, 0)
+	if total != 2 {
+		t.Fatalf("expected entry and workspace hits, got %+v", hits)
+	}
+	if hits[0].ID != erp.ID || hits[0].Field != "name" {
+		t.Fatalf("expected the entry name match to rank first, got %+v", hits[0])
+	}
+	if len(hits[0].Highlights) != 1 || hits[0].Highlights[0] != (SearchHighlight{Start: 0, End: 2}) {
+		t.Fatalf("unexpected highlights %+v", hits[0].Highlights)
+	}
+	if hits[1].ID != ws.ID || hits[1].Field != "document" || hits[1].Snippet != "财务系统每日 备份 到异地机房" {
+		t.Fatalf("unexpected document hit %+v", hits[1])
+	}
+
+	if hits, _ := store.Search("kingdee", []string{SearchKindEntry}, 0); len(hits) != 1 || hits[0].Field != "attributes.vendor" {
+		t.Fatalf("expected attribute match, got %+v", hits)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypeSystem, erp.ID, LedgerEntry{Name: "人事系统"}, "tester"); err != nil {
+		t.Fatalf("update system: %v", err)
+	}
+	if hits, _ := store.Search("财务", []string{SearchKindEntry}, 0); len(hits) != 0 {
+		t.Fatalf("expected renamed entry to drop out, got %+v", hits)
+	}
+	if err := store.DeleteWorkspace(ws.ID, "tester"); err != nil {
+		t.Fatalf("delete workspace: %v", err)
+	}
+	if hits, total := store.Search("备份", nil, 0); total != 0 {
+		t.Fatalf("expected deleted workspace to drop out, got %+v", hits)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo delete: %v", err)
+	}
+	if hits, _ := store.Search("备份", nil, 0); len(hits) != 1 || hits[0].ID != ws.ID {
+		t.Fatalf("expected restored workspace to be indexed again, got %+v", hits)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo rename: %v", err)
+	}
+	if hits, _ := store.Search("财务核算", nil, 0); len(hits) != 1 || hits[0].ID != erp.ID {
+		t.Fatalf("expected undo to restore the indexed name, got %+v", hits)
+	}
+}
+
+func TestSearchIndexFollowsEntryDeleteAndUndo(t *testing.T) {
+	store := newTestStore(t)
+	crm, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "客户关系管理"}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA"}, "tester"); err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if err := store.DeleteEntry(LedgerTypeSystem, crm.ID, "tester"); err != nil {
+		t.Fatalf("delete system: %v", err)
+	}
+	if hits, _ := store.Search("客户", nil, 0); len(hits) != 0 {
+		t.Fatalf("expected deleted entry to drop out, got %+v", hits)
+	}
+	if hits, _ := store.Search("oa", nil, 0); len(hits) != 1 {
+		t.Fatalf("expected untouched entries to stay indexed, got %+v", hits)
+	}
+	if err := store.Undo("tester"); err != nil {
+		t.Fatalf("undo delete: %v", err)
+	}
+	if hits, _ := store.Search("客户", nil, 0); len(hits) != 1 || hits[0].ID != crm.ID {
+		t.Fatalf("expected restored entry to be indexed again, got %+v", hits)
+	}
+}
@@ -59,6 +59,12 @@ var (
 	ErrUserExists = errors.New("user_exists")
 	// ErrUserNotFound indicates the requested user cannot be located.
 	ErrUserNotFound = errors.New("user_not_found")
+	// ErrAllowlistNotFound indicates the allowlist entry does not exist.
+	ErrAllowlistNotFound = errors.New("allowlist_not_found")
+	// ErrAllowlistInvalid indicates an allowlist entry with a malformed address or unknown scope.
+	ErrAllowlistInvalid = errors.New("allowlist_invalid")
+	// ErrAllowlistLockout prevents an allowlist change that would shut out the administrator making it.
+	ErrAllowlistLockout = errors.New("allowlist_lockout")
 	// ErrInvalidCredentials indicates username or password validation failed.
 	ErrInvalidCredentials = errors.New("invalid_credentials")
 	// ErrUserDeleteLastAdmin prevents removal of the final administrator account.
@@ -95,6 +101,21 @@ type LedgerStore struct {
 	mu sync.RWMutex
 
 	entries             map[LedgerType][]LedgerEntry
+	entryIndex          map[LedgerType]map[string]int
+	schemas             map[LedgerType]*LedgerSchema
+	ledgerTypes         map[LedgerType]*LedgerTypeDefinition
+	ledgerTypeOrder     []LedgerType
+	naturalKeys         map[LedgerType]string
+	reports             []*ReportDefinition
+	grants              []PermissionGrant
+	visibilityRules     []*VisibilityRule
+	search              *searchIndex
+	revisions           map[string][]Revision
+	revisionState       map[string]map[string]string
+	relationships       []Relationship
+	trash               []TrashItem
+	trashRetentionDays  int
+	defaultRetention    int
 	workspaces          map[string]*Workspace
 	workspaceOrder      []string
 	workspaceChildren   map[string][]string
@@ -106,12 +127,15 @@ type LedgerStore struct {
 	approvalByApplicant map[string]*IdentityApproval
 
 	loginChallenges map[string]*LoginChallenge
+	loginPolicy     LoginPolicy
+	loginAttempts   map[string]*loginAttempts
 
 	users      map[string]*User
 	userByName map[string]*User
 	userOrder  []string
 
-	history historyStack
+	pending pendingChanges
+	journal operationJournal
 }
 
 // SnapshotVersion represents the current serialization format for persisted snapshots.
@@ -119,16 +143,26 @@ const SnapshotVersion = 2
 
 // Snapshot captures all persisted state required to rebuild the in-memory store.
 type Snapshot struct {
-	Version        int                          `json:"version"`
-	Entries        map[LedgerType][]LedgerEntry `json:"entries"`
-	Workspaces     []*Workspace                 `json:"workspaces"`
-	WorkspaceOrder []string                     `json:"workspace_order,omitempty"`
-	Allowlist      []*IPAllowlistEntry          `json:"allowlist"`
-	Audits         []*AuditLogEntry             `json:"audits"`
-	Users          []*User                      `json:"users"`
-	UserOrder      []string                     `json:"user_order,omitempty"`
-	Profiles       []IdentityProfile            `json:"profiles,omitempty"`
-	Approvals      []*IdentityApproval          `json:"approvals,omitempty"`
+	Version         int                          `json:"version"`
+	Entries         map[LedgerType][]LedgerEntry `json:"entries"`
+	Schemas         []*LedgerSchema              `json:"schemas,omitempty"`
+	LedgerTypes     []*LedgerTypeDefinition      `json:"ledger_types,omitempty"`
+	NaturalKeys     map[LedgerType]string        `json:"natural_keys,omitempty"`
+	Reports         []*ReportDefinition          `json:"reports,omitempty"`
+	Grants          []PermissionGrant            `json:"grants,omitempty"`
+	VisibilityRules []*VisibilityRule            `json:"visibility_rules,omitempty"`
+	Relationships   []Relationship               `json:"relationships,omitempty"`
+	Revisions       []Revision                   `json:"revisions,omitempty"`
+	Trash           []TrashItem                  `json:"trash,omitempty"`
+	TrashRetention  *int                         `json:"trash_retention_days,omitempty"`
+	Workspaces      []*Workspace                 `json:"workspaces"`
+	WorkspaceOrder  []string                     `json:"workspace_order,omitempty"`
+	Allowlist       []*IPAllowlistEntry          `json:"allowlist"`
+	Audits          []*AuditLogEntry             `json:"audits"`
+	Users           []*User                      `json:"users"`
+	UserOrder       []string                     `json:"user_order,omitempty"`
+	Profiles        []IdentityProfile            `json:"profiles,omitempty"`
+	Approvals       []*IdentityApproval          `json:"approvals,omitempty"`
 }
 
 // OverviewStats summarizes ledger contents for the overview page.
@@ -152,10 +186,11 @@ type TagCount struct {
 	Count int    `json:"count"`
 }
 
-// RelationshipStats reports link counts between ledger entries.
+// RelationshipStats reports link counts between ledger entries and typed edges per role.
 type RelationshipStats struct {
-	Total    int                `json:"total"`
-	ByLedger map[LedgerType]int `json:"by_ledger"`
+	Total    int                      `json:"total"`
+	ByLedger map[LedgerType]int       `json:"by_ledger"`
+	ByRole   map[RelationshipRole]int `json:"by_role"`
 }
 
 // RecentEntry highlights the latest updates across all ledgers.
@@ -180,6 +215,17 @@ func (s *LedgerStore) ExportSnapshot() *Snapshot {
 	for typ, list := range s.entries {
 		snapshot.Entries[typ] = cloneEntrySlice(list)
 	}
+	snapshot.Schemas = schemaSlice(s.schemas)
+	snapshot.LedgerTypes = s.customLedgerTypesLocked()
+	snapshot.NaturalKeys = s.naturalKeySnapshotLocked()
+	snapshot.Reports = cloneReports(s.reports)
+	snapshot.Grants = append([]PermissionGrant(nil), s.grants...)
+	snapshot.VisibilityRules = cloneVisibilityRules(s.visibilityRules)
+	snapshot.Relationships = cloneRelationships(s.relationships)
+	snapshot.Revisions = s.revisionSliceLocked()
+	snapshot.Trash = cloneTrash(s.trash)
+	retention := s.trashRetentionDays
+	snapshot.TrashRetention = &retention
 
 	snapshot.WorkspaceOrder = append([]string{}, s.workspaceOrder...)
 	snapshot.Workspaces = make([]*Workspace, 0, len(s.workspaces))
@@ -281,7 +327,7 @@ func (s *LedgerStore) WriteSnapshotJSON(w io.Writer) error {
 		return err
 	}
 	writtenEntries := false
-	for _, typ := range AllLedgerTypes {
+	for _, typ := range s.ledgerTypeOrder {
 		entries, ok := s.entries[typ]
 		if !ok {
 			continue
@@ -320,6 +366,66 @@ func (s *LedgerStore) WriteSnapshotJSON(w io.Writer) error {
 	if err := writeString("}"); err != nil {
 		return err
 	}
+	if err := writeString(`,"schemas":`); err != nil {
+		return err
+	}
+	if err := writeJSON(schemaSlice(s.schemas)); err != nil {
+		return err
+	}
+	if err := writeString(`,"ledger_types":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.customLedgerTypesLocked()); err != nil {
+		return err
+	}
+	if err := writeString(`,"natural_keys":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.naturalKeySnapshotLocked()); err != nil {
+		return err
+	}
+	if err := writeString(`,"reports":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.reports); err != nil {
+		return err
+	}
+	if err := writeString(`,"grants":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.grants); err != nil {
+		return err
+	}
+	if err := writeString(`,"visibility_rules":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.visibilityRules); err != nil {
+		return err
+	}
+	if err := writeString(`,"relationships":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.relationships); err != nil {
+		return err
+	}
+	if err := writeString(`,"revisions":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.revisionSliceLocked()); err != nil {
+		return err
+	}
+	if err := writeString(`,"trash":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.trash); err != nil {
+		return err
+	}
+	if err := writeString(`,"trash_retention_days":`); err != nil {
+		return err
+	}
+	if err := writeJSON(s.trashRetentionDays); err != nil {
+		return err
+	}
 	if err := writeString(`,"workspace_order":`); err != nil {
 		return err
 	}
@@ -479,10 +585,26 @@ func (s *LedgerStore) ImportSnapshot(snapshot *Snapshot) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.entries = make(map[LedgerType][]LedgerEntry, len(snapshot.Entries))
+	prevTypes, prevOrder := s.ledgerTypes, s.ledgerTypeOrder
+	s.resetLedgerTypesLocked()
+	s.restoreLedgerTypesLocked(snapshot.LedgerTypes)
+	entries := make(map[LedgerType][]LedgerEntry, len(snapshot.Entries))
 	for typ, list := range snapshot.Entries {
-		s.entries[typ] = cloneEntrySlice(list)
+		if _, ok := s.ledgerTypes[typ]; !ok {
+			continue
+		}
+		entries[typ] = cloneEntrySlice(list)
+	}
+	schemas := schemaMapFromSlice(snapshot.Schemas)
+	if err := s.validateSnapshotEntries(entries, schemas); err != nil {
+		s.ledgerTypes, s.ledgerTypeOrder = prevTypes, prevOrder
+		return err
 	}
+	s.entries = entries
+	s.reindexEntriesLocked()
+	s.schemas = schemas
+	s.relationships = cloneRelationships(snapshot.Relationships)
+	s.pruneRelationshipsLocked()
 
 	s.workspaces = make(map[string]*Workspace)
 	s.workspaceChildren = make(map[string][]string)
@@ -619,7 +741,20 @@ func (s *LedgerStore) ImportSnapshot(snapshot *Snapshot) error {
 		return err
 	}
 
-	s.history.Reset(s.snapshotLocked())
+	s.restoreRevisionsLocked(snapshot.Revisions, "system")
+	s.trash = cloneTrash(snapshot.Trash)
+	s.naturalKeys = make(map[LedgerType]string)
+	s.restoreNaturalKeysLocked(snapshot.NaturalKeys)
+	s.reports = restoreReports(snapshot.Reports)
+	s.grants = restoreGrants(snapshot.Grants)
+	s.visibilityRules = restoreVisibilityRules(snapshot.VisibilityRules)
+	s.trashRetentionDays = s.defaultRetention
+	if snapshot.TrashRetention != nil {
+		s.trashRetentionDays = *snapshot.TrashRetention
+	}
+	s.journal.Reset()
+	s.pending = pendingChanges{}
+	s.syncSearchIndexLocked()
 	return nil
 }
 
@@ -631,8 +766,25 @@ func (s *LedgerStore) ImportSnapshotMerge(snapshot *Snapshot) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Merge ledger types and schemas, then validate merged ledgers before touching state
+	prevTypes, prevOrder := s.ledgerTypes, s.ledgerTypeOrder
+	s.ledgerTypes = make(map[LedgerType]*LedgerTypeDefinition, len(prevTypes))
+	for typ, def := range prevTypes {
+		s.ledgerTypes[typ] = def.Clone()
+	}
+	s.ledgerTypeOrder = append([]LedgerType{}, prevOrder...)
+	s.restoreLedgerTypesLocked(snapshot.LedgerTypes)
+	schemas := cloneSchemas(s.schemas)
+	for typ, schema := range schemaMapFromSlice(snapshot.Schemas) {
+		schemas[typ] = schema
+	}
+	mergedEntries := make(map[LedgerType][]LedgerEntry, len(snapshot.Entries))
+
 	// Merge ledger entries
 	for typ, list := range snapshot.Entries {
+		if _, ok := s.ledgerTypes[typ]; !ok {
+			continue
+		}
 		existing := s.entries[typ]
 		index := make(map[string]LedgerEntry, len(existing))
 		for _, e := range existing {
@@ -656,8 +808,33 @@ func (s *LedgerStore) ImportSnapshotMerge(snapshot *Snapshot) error {
 			}
 		}
 		sort.Slice(merged, func(i, j int) bool { return merged[i].Order < merged[j].Order })
+		mergedEntries[typ] = cloneEntrySlice(merged)
+	}
+	if err := s.validateSnapshotEntries(mergedEntries, schemas); err != nil {
+		s.ledgerTypes, s.ledgerTypeOrder = prevTypes, prevOrder
+		return err
+	}
+	for typ, merged := range mergedEntries {
 		s.entries[typ] = merged
+		s.reindexLedgerLocked(typ)
+	}
+	s.schemas = schemas
+
+	// Merge relationships by ID, dropping edges whose entries are not linked
+	for _, incoming := range snapshot.Relationships {
+		replaced := false
+		for i := range s.relationships {
+			if s.relationships[i].ID == incoming.ID {
+				s.relationships[i] = incoming.Clone()
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.relationships = append(s.relationships, incoming.Clone())
+		}
 	}
+	s.pruneRelationshipsLocked()
 
 	// Merge workspaces by ID
 	for _, ws := range snapshot.Workspaces {
@@ -759,7 +936,15 @@ func (s *LedgerStore) ImportSnapshotMerge(snapshot *Snapshot) error {
 	}
 	sort.Slice(s.approvalOrder, func(i, j int) bool { return s.approvalOrder[i].CreatedAt.Before(s.approvalOrder[j].CreatedAt) })
 
-	s.history.Reset(s.snapshotLocked())
+	s.restoreRevisionsLocked(s.mergeRevisionsLocked(snapshot.Revisions), "system")
+	s.mergeTrashLocked(snapshot.Trash)
+	s.restoreNaturalKeysLocked(snapshot.NaturalKeys)
+	s.mergeReportsLocked(snapshot.Reports)
+	s.mergeGrantsLocked(snapshot.Grants)
+	s.mergeVisibilityRulesLocked(snapshot.VisibilityRules)
+	s.journal.Reset()
+	s.pending = pendingChanges{}
+	s.syncSearchIndexLocked()
 	return nil
 }
 
@@ -1009,10 +1194,31 @@ const (
 	ApprovalStatusMissing = "missing"
 )
 
-// NewLedgerStore constructs a ledger store.
+// StoreConfig holds deployment settings applied when a store is constructed. They are not
+// audited and are not written to snapshots.
+type StoreConfig struct {
+	// TrashRetentionDays is the trash retention used until an administrator changes it, and
+	// for snapshots that do not record one. Nil keeps DefaultTrashRetentionDays.
+	TrashRetentionDays *int
+	// LoginPolicy throttles sign-ins; unset fields keep the DefaultLoginPolicy values.
+	LoginPolicy LoginPolicy
+}
+
+// NewLedgerStore constructs a ledger store with the default configuration.
 func NewLedgerStore() *LedgerStore {
+	return NewLedgerStoreWithConfig(StoreConfig{})
+}
+
+// NewLedgerStoreWithConfig constructs a ledger store, filling unset settings with defaults.
+func NewLedgerStoreWithConfig(cfg StoreConfig) *LedgerStore {
+	retention := DefaultTrashRetentionDays
+	if cfg.TrashRetentionDays != nil && *cfg.TrashRetentionDays >= 0 {
+		retention = *cfg.TrashRetentionDays
+	}
 	store := &LedgerStore{
 		entries:             make(map[LedgerType][]LedgerEntry),
+		entryIndex:          make(map[LedgerType]map[string]int),
+		schemas:             make(map[LedgerType]*LedgerSchema),
 		workspaces:          make(map[string]*Workspace),
 		workspaceChildren:   make(map[string][]string),
 		allow:               make(map[string]*IPAllowlistEntry),
@@ -1020,11 +1226,18 @@ func NewLedgerStore() *LedgerStore {
 		approvals:           make(map[string]*IdentityApproval),
 		approvalByApplicant: make(map[string]*IdentityApproval),
 		loginChallenges:     make(map[string]*LoginChallenge),
+		loginPolicy:         cfg.LoginPolicy.withDefaults(),
+		loginAttempts:       make(map[string]*loginAttempts),
 		users:               make(map[string]*User),
 		userByName:          make(map[string]*User),
-	}
-	store.history.limit = 11
-	store.history.Reset(store.snapshotLocked())
+		naturalKeys:         make(map[LedgerType]string),
+		trashRetentionDays:  retention,
+		defaultRetention:    retention,
+	}
+	store.resetLedgerTypesLocked()
+	store.journal.limit = defaultUndoLimit
+	store.journal.Reset()
+	store.syncSearchIndexLocked()
 	if err := store.ensureDefaultAdmin(); err != nil {
 		panic(fmt.Sprintf("failed to seed default admin: %v", err))
 	}
@@ -1060,6 +1273,7 @@ func (s *LedgerStore) ensureDefaultAdminLocked() error {
 		ID:           GenerateID("user"),
 		Username:     defaultAdminUsername,
 		Admin:        true,
+		Role:         AccessSystemAdmin,
 		PasswordHash: hash,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -1093,12 +1307,18 @@ func (s *LedgerStore) ListUsers() []*User {
 	return out
 }
 
-// CreateUser registers a new operator account.
-func (s *LedgerStore) CreateUser(username, password string, admin bool, actor string) (*User, error) {
+// CreateUser registers a new operator account with the given global role, editor if empty.
+func (s *LedgerStore) CreateUser(username, password string, role AccessRole, actor string) (*User, error) {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return nil, ErrUsernameInvalid
 	}
+	if role == "" {
+		role = AccessEditor
+	}
+	if !role.Valid() {
+		return nil, ErrRoleInvalid
+	}
 	normalized := normalizeUsername(username)
 	if normalized == "" {
 		return nil, ErrUsernameInvalid
@@ -1119,7 +1339,8 @@ func (s *LedgerStore) CreateUser(username, password string, admin bool, actor st
 	user := &User{
 		ID:           GenerateID("user"),
 		Username:     username,
-		Admin:        admin,
+		Admin:        role == AccessSystemAdmin,
+		Role:         role,
 		PasswordHash: hash,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -1156,6 +1377,7 @@ func (s *LedgerStore) DeleteUser(id string, actor string) error {
 	}
 	delete(s.userByName, normalizeUsername(user.Username))
 	delete(s.users, trimmed)
+	s.removeUserGrantsLocked(user.Username)
 	filtered := s.userOrder[:0]
 	for _, existing := range s.userOrder {
 		if existing != trimmed {
@@ -1215,7 +1437,7 @@ func (s *LedgerStore) AuthenticateUser(username, password string) (*User, error)
 	return user.Clone(), nil
 }
 
-// IsUserAdmin reports whether the provided username maps to an administrator.
+// IsUserAdmin reports whether the provided username maps to a system administrator.
 func (s *LedgerStore) IsUserAdmin(username string) bool {
 	normalized := normalizeUsername(username)
 	if normalized == "" {
@@ -1419,24 +1641,15 @@ func cloneEntrySlice(entries []LedgerEntry) []LedgerEntry {
 	return cloned
 }
 
-// recordSnapshotLocked must be called with the mutex locked.
-func (s *LedgerStore) snapshotLocked() storeSnapshot {
-	snapshot := storeSnapshot{entries: make(map[LedgerType][]LedgerEntry)}
-	for _, typ := range AllLedgerTypes {
-		if items, ok := s.entries[typ]; ok {
-			snapshot.entries[typ] = cloneEntrySlice(items)
-		}
-	}
-	return snapshot
-}
-
-func (s *LedgerStore) commitLocked() {
-	snapshot := s.snapshotLocked()
-	if len(s.history.states) == 0 {
-		s.history.Reset(snapshot)
-		return
-	}
-	s.history.Push(snapshot)
+// commitLocked finishes a ledger mutation by actor: relationship edges that lost their backing
+// link are dropped, the search index and per-entry revisions are refreshed and the touched
+// records are pushed onto actor's undo stack.
+func (s *LedgerStore) commitLocked(actor string) {
+	s.pruneRelationshipsLocked()
+	op := s.pendingOperationLocked()
+	s.indexEntriesLocked(op.entries)
+	s.recordEntryRevisionsLocked(op.entries, actor)
+	s.journal.Record(actor, op)
 }
 
 // ListEntries returns ordered entries for a ledger.
@@ -1481,26 +1694,31 @@ func (s *LedgerStore) ListEntriesPaged(typ LedgerType, page, pageSize int) ([]Le
 	return cloned, total
 }
 
-// OverviewStats aggregates counts, tags, links, and recents for dashboards.
-func (s *LedgerStore) OverviewStats() OverviewStats {
+// OverviewStats aggregates counts, tags, links, and recents for dashboards. Entries the view
+// hides, and links and relationships involving them, are left out.
+func (s *LedgerStore) OverviewStats(view *Visibility) OverviewStats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	stats := OverviewStats{
 		Relationships: RelationshipStats{
 			ByLedger: make(map[LedgerType]int),
+			ByRole:   make(map[RelationshipRole]int),
 		},
 	}
 
 	tagCounts := make(map[string]int)
 	recents := make([]RecentEntry, 0, 16)
 
-	for _, typ := range AllLedgerTypes {
-		entries := s.entries[typ]
-		overview := LedgerOverview{Type: typ, Count: len(entries)}
+	for _, typ := range s.ledgerTypeOrder {
+		overview := LedgerOverview{Type: typ}
 		var newest time.Time
 
-		for _, entry := range entries {
+		for _, entry := range s.entries[typ] {
+			if view.Hidden(typ, entry.ID) {
+				continue
+			}
+			overview.Count++
 			if entry.UpdatedAt.After(newest) {
 				newest = entry.UpdatedAt
 			}
@@ -1512,8 +1730,13 @@ func (s *LedgerStore) OverviewStats() OverviewStats {
 				tagCounts[normalized]++
 			}
 			for linkType, ids := range entry.Links {
-				stats.Relationships.ByLedger[linkType] += len(ids)
-				stats.Relationships.Total += len(ids)
+				for _, id := range ids {
+					if view.Hidden(linkType, id) {
+						continue
+					}
+					stats.Relationships.ByLedger[linkType]++
+					stats.Relationships.Total++
+				}
 			}
 			recents = append(recents, RecentEntry{
 				ID:        entry.ID,
@@ -1530,6 +1753,13 @@ func (s *LedgerStore) OverviewStats() OverviewStats {
 		stats.Ledgers = append(stats.Ledgers, overview)
 	}
 
+	for _, rel := range s.relationships {
+		if view.Hidden(rel.FromType, rel.FromID) || view.Hidden(rel.ToType, rel.ToID) {
+			continue
+		}
+		stats.Relationships.ByRole[rel.Role]++
+	}
+
 	tagList := make([]TagCount, 0, len(tagCounts))
 	for tag, count := range tagCounts {
 		tagList = append(tagList, TagCount{Tag: tag, Count: count})
@@ -1560,12 +1790,11 @@ func (s *LedgerStore) OverviewStats() OverviewStats {
 func (s *LedgerStore) GetEntry(typ LedgerType, id string) (LedgerEntry, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for _, e := range s.entries[typ] {
-		if e.ID == id {
-			return e.Clone(), nil
-		}
+	idx := s.entryIndexLocked(typ, id)
+	if idx < 0 {
+		return LedgerEntry{}, ErrEntryNotFound
 	}
-	return LedgerEntry{}, ErrEntryNotFound
+	return s.entries[typ][idx].Clone(), nil
 }
 
 // CreateEntry appends a new entry to the ledger.
@@ -1573,14 +1802,22 @@ func (s *LedgerStore) CreateEntry(typ LedgerType, entry LedgerEntry, actor strin
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	entry = entry.Clone()
 	entry.ID = GenerateID(string(typ))
 	entry.CreatedAt = time.Now().UTC()
 	entry.UpdatedAt = entry.CreatedAt
 	entry.Order = len(s.entries[typ])
 	entry.Tags = normaliseStrings(entry.Tags)
-	s.entries[typ] = append(s.entries[typ], entry.Clone())
+	candidates := []LedgerEntry{entry}
+	if err := s.prepareEntriesLocked(typ, candidates); err != nil {
+		return LedgerEntry{}, err
+	}
+	entry = candidates[0]
+	s.touchEntryLocked(typ, entry.ID)
+	s.appendEntryLocked(typ, entry.Clone())
+	s.syncLinksLocked(typ, entry.ID, nil, entry.Links)
 	s.appendAuditLocked(actor, fmt.Sprintf("create_%s", typ), entry.ID)
-	s.commitLocked()
+	s.commitLocked(actor)
 	return entry, nil
 }
 
@@ -1588,61 +1825,81 @@ func (s *LedgerStore) CreateEntry(typ LedgerType, entry LedgerEntry, actor strin
 func (s *LedgerStore) UpdateEntry(typ LedgerType, id string, updates LedgerEntry, actor string) (LedgerEntry, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	i := s.entryIndexLocked(typ, id)
+	if i < 0 {
+		return LedgerEntry{}, ErrEntryNotFound
+	}
 	items := s.entries[typ]
-	for i, e := range items {
-		if e.ID == id {
-			updated := e.Clone()
-			if updates.Name != "" {
-				updated.Name = updates.Name
-			}
-			if updates.Description != "" {
-				updated.Description = updates.Description
-			}
-			if updates.Attributes != nil {
-				updated.Attributes = make(map[string]string, len(updates.Attributes))
-				for k, v := range updates.Attributes {
-					updated.Attributes[k] = v
-				}
-			}
-			if updates.Tags != nil {
-				updated.Tags = normaliseStrings(updates.Tags)
-			}
-			if updates.Links != nil {
-				updated.Links = make(map[LedgerType][]string, len(updates.Links))
-				for lt, ids := range updates.Links {
-					updated.Links[lt] = append([]string{}, ids...)
-				}
-			}
-			updated.UpdatedAt = time.Now().UTC()
-			items[i] = updated
-			s.entries[typ] = items
-			s.appendAuditLocked(actor, fmt.Sprintf("update_%s", typ), id)
-			s.commitLocked()
-			return updated.Clone(), nil
+	e := items[i]
+	updated := e.Clone()
+	if updates.Name != "" {
+		updated.Name = updates.Name
+	}
+	if updates.Description != "" {
+		updated.Description = updates.Description
+	}
+	if updates.Attributes != nil {
+		updated.Attributes = make(map[string]string, len(updates.Attributes))
+		for k, v := range updates.Attributes {
+			updated.Attributes[k] = v
+		}
+	}
+	if updates.Tags != nil {
+		updated.Tags = normaliseStrings(updates.Tags)
+	}
+	if updates.Links != nil {
+		updated.Links = make(map[LedgerType][]string, len(updates.Links))
+		for lt, ids := range updates.Links {
+			updated.Links[lt] = append([]string{}, ids...)
 		}
 	}
-	return LedgerEntry{}, ErrEntryNotFound
+	candidates := []LedgerEntry{updated}
+	if err := s.prepareEntriesLocked(typ, candidates); err != nil {
+		return LedgerEntry{}, err
+	}
+	updated = candidates[0]
+	updated.UpdatedAt = time.Now().UTC()
+	s.touchEntryLocked(typ, id)
+	items[i] = updated
+	s.syncLinksLocked(typ, id, e.Links, updated.Links)
+	s.appendAuditLocked(actor, fmt.Sprintf("update_%s", typ), id)
+	s.commitLocked(actor)
+	return updated.Clone(), nil
 }
 
-// DeleteEntry removes an entry and compacts ordering.
+// DeleteEntry moves an entry to the trash, unlinks it from every entry that references it and
+// compacts ordering.
 func (s *LedgerStore) DeleteEntry(typ LedgerType, id string, actor string) error {
+	return s.DeleteEntryWithMode(typ, id, DeleteCascade, actor)
+}
+
+// DeleteEntryWithMode removes an entry; DeleteRestrict refuses with ErrEntryLinked while the
+// entry still has links in either direction.
+func (s *LedgerStore) DeleteEntryWithMode(typ LedgerType, id string, mode DeleteMode, actor string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	items := s.entries[typ]
-	for i, e := range items {
-		if e.ID == id {
-			items = append(items[:i], items[i+1:]...)
-			for idx := range items {
-				items[idx].Order = idx
-				items[idx].UpdatedAt = time.Now().UTC()
-			}
-			s.entries[typ] = items
-			s.appendAuditLocked(actor, fmt.Sprintf("delete_%s", typ), id)
-			s.commitLocked()
-			return nil
-		}
+	i := s.entryIndexLocked(typ, id)
+	if i < 0 {
+		return ErrEntryNotFound
 	}
-	return ErrEntryNotFound
+	items := s.entries[typ]
+	e := items[i]
+	if mode == DeleteRestrict && s.isReferencedLocked(typ, e) {
+		return ErrEntryLinked
+	}
+	s.touchEntryLocked(typ, id)
+	items = append(items[:i], items[i+1:]...)
+	// Compaction only renumbers; the entries' content is unchanged.
+	for idx := range items {
+		items[idx].Order = idx
+	}
+	s.trashEntryLocked(typ, e, actor)
+	s.entries[typ] = items
+	s.reindexLedgerLocked(typ)
+	s.unlinkAllLocked(typ, id)
+	s.appendAuditLocked(actor, fmt.Sprintf("delete_%s", typ), id)
+	s.commitLocked(actor)
+	return nil
 }
 
 // ReorderEntries sets the ordering based on provided IDs. IDs not listed retain current order at end.
@@ -1673,12 +1930,14 @@ func (s *LedgerStore) ReorderEntries(typ LedgerType, orderedIDs []string, actor
 		result = append(result, item)
 	}
 	for i := range result {
+		s.touchEntryLocked(typ, result[i].ID)
 		result[i].Order = i
 		result[i].UpdatedAt = time.Now().UTC()
 	}
 	s.entries[typ] = result
+	s.reindexLedgerLocked(typ)
 	s.appendAuditLocked(actor, fmt.Sprintf("reorder_%s", typ), strings.Join(orderedIDs, ","))
-	s.commitLocked()
+	s.commitLocked(actor)
 	out := make([]LedgerEntry, len(result))
 	for i, item := range result {
 		out[i] = item.Clone()
@@ -1686,100 +1945,131 @@ func (s *LedgerStore) ReorderEntries(typ LedgerType, orderedIDs []string, actor
 	return out, nil
 }
 
-// ReplaceEntries overwrites the ledger with provided entries.
-func (s *LedgerStore) ReplaceEntries(typ LedgerType, entries []LedgerEntry, actor string) {
+// ReplaceEntries overwrites the ledger with provided entries. The ledger is left untouched
+// when the entries violate its schema or, on the IP ledger, collide with each other. Links are
+// not required to resolve yet, so workbooks can be imported one sheet at a time; the other
+// ledgers are re-linked to mirror the new entries.
+func (s *LedgerStore) ReplaceEntries(typ LedgerType, entries []LedgerEntry, actor string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	normalized := make([]LedgerEntry, len(entries))
 	for i, entry := range entries {
+		entry = entry.Clone()
 		entry.Order = i
 		entry.Tags = normaliseStrings(entry.Tags)
 		entry.CreatedAt = entry.CreatedAt.UTC()
 		entry.UpdatedAt = time.Now().UTC()
-		normalized[i] = entry.Clone()
+		normalized[i] = entry
+	}
+	if err := s.checkLedgerLinksLocked(typ, normalized); err != nil {
+		return err
+	}
+	if err := s.applySchemaLocked(typ, s.schemas[typ], normalized, nil); err != nil {
+		return err
+	}
+	// The batch replaces the whole ledger, so addresses only have to be unique within it.
+	if typ == LedgerTypeIP {
+		if err := prepareIPEntries(normalized, nil); err != nil {
+			return err
+		}
+	}
+	for _, entry := range s.entries[typ] {
+		s.touchEntryLocked(typ, entry.ID)
+	}
+	for _, entry := range normalized {
+		s.touchEntryLocked(typ, entry.ID)
 	}
 	s.entries[typ] = normalized
+	s.reindexLedgerLocked(typ)
+	s.relinkLedgerLocked(typ)
 	s.appendAuditLocked(actor, fmt.Sprintf("replace_%s", typ), fmt.Sprintf("count=%d", len(entries)))
-	s.commitLocked()
+	s.commitLocked(actor)
+	return nil
+}
+
+// prepareEntriesLocked runs the ledger's write-time validation over candidates about to be
+// stored, canonicalising their attributes in place.
+func (s *LedgerStore) prepareEntriesLocked(typ LedgerType, candidates []LedgerEntry) error {
+	if err := s.checkLedgerLinksLocked(typ, candidates); err != nil {
+		return err
+	}
+	if err := s.normaliseLinksLocked(typ, candidates); err != nil {
+		return err
+	}
+	if err := s.applySchemaLocked(typ, s.schemas[typ], candidates, s.entries[typ]); err != nil {
+		return err
+	}
+	if typ == LedgerTypeIP {
+		return s.prepareIPEntriesLocked(candidates)
+	}
+	return nil
 }
 
-// AppendEntries appends entries with new IDs and timestamps.
-func (s *LedgerStore) AppendEntries(typ LedgerType, entries []LedgerEntry, actor string) []LedgerEntry {
+// AppendEntries appends entries with new IDs and timestamps. The batch is rejected as a
+// whole when any entry fails validation.
+func (s *LedgerStore) AppendEntries(typ LedgerType, entries []LedgerEntry, actor string) ([]LedgerEntry, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	start := len(s.entries[typ])
 	now := time.Now().UTC()
 	added := make([]LedgerEntry, len(entries))
 	for i, entry := range entries {
+		entry = entry.Clone()
 		entry.ID = GenerateID(string(typ))
 		entry.Order = start + i
 		entry.Tags = normaliseStrings(entry.Tags)
 		entry.CreatedAt = now
 		entry.UpdatedAt = now
-		added[i] = entry.Clone()
-		s.entries[typ] = append(s.entries[typ], added[i])
+		added[i] = entry
+	}
+	if err := s.prepareEntriesLocked(typ, added); err != nil {
+		return nil, err
+	}
+	for _, entry := range added {
+		s.touchEntryLocked(typ, entry.ID)
+		s.appendEntryLocked(typ, entry.Clone())
+	}
+	for _, entry := range added {
+		s.syncLinksLocked(typ, entry.ID, nil, entry.Links)
 	}
 	s.appendAuditLocked(actor, fmt.Sprintf("append_%s", typ), fmt.Sprintf("count=%d", len(entries)))
-	s.commitLocked()
-	return added
+	s.commitLocked(actor)
+	return added, nil
 }
 
-// Undo reverts the store to the previous snapshot.
-func (s *LedgerStore) Undo() error {
+// Undo reverts the latest operation made by actor. Operations by other users are left alone;
+// if someone has since changed a record the operation touched, an *UndoConflictError is
+// returned and nothing is reverted.
+func (s *LedgerStore) Undo(actor string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	snapshot, err := s.history.Undo()
-	if err != nil {
-		return err
-	}
-	s.entries = cloneSnapshot(snapshot)
-	return nil
+	return s.stepLocked(actor, false)
 }
 
-// Redo reapplies the next snapshot from history.
-func (s *LedgerStore) Redo() error {
+// Redo reapplies the operation actor most recently undid, with the same conflict check.
+func (s *LedgerStore) Redo(actor string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	snapshot, err := s.history.Redo()
-	if err != nil {
-		return err
-	}
-	s.entries = cloneSnapshot(snapshot)
-	return nil
+	return s.stepLocked(actor, true)
 }
 
-// CanUndo reports whether history contains a previous snapshot.
-func (s *LedgerStore) CanUndo() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.history.CanUndo()
+// CanUndo reports whether actor has an operation to undo.
+func (s *LedgerStore) CanUndo(actor string) bool {
+	undo, _ := s.HistoryDepth(actor)
+	return undo > 0
 }
 
-// CanRedo reports whether history contains a forward snapshot.
-func (s *LedgerStore) CanRedo() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.history.CanRedo()
+// CanRedo reports whether actor has an undone operation to redo.
+func (s *LedgerStore) CanRedo(actor string) bool {
+	_, redo := s.HistoryDepth(actor)
+	return redo > 0
 }
 
-// HistoryDepth returns the counts of undo and redo steps currently available.
-func (s *LedgerStore) HistoryDepth() (int, int) {
+// HistoryDepth returns the counts of undo and redo steps available to actor.
+func (s *LedgerStore) HistoryDepth(actor string) (int, int) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	undo := 0
-	if len(s.history.states) > 0 {
-		undo = len(s.history.states) - 1
-	}
-	redo := len(s.history.future)
-	return undo, redo
-}
-
-func cloneSnapshot(snapshot storeSnapshot) map[LedgerType][]LedgerEntry {
-	cloned := make(map[LedgerType][]LedgerEntry, len(snapshot.entries))
-	for typ, items := range snapshot.entries {
-		cloned[typ] = cloneEntrySlice(items)
-	}
-	return cloned
+	return s.journal.Depth(actor)
 }
 
 // WorkspaceUpdate contains optional updates applied to a workspace.
@@ -1871,6 +2161,7 @@ func (s *LedgerStore) CreateWorkspace(name string, kind WorkspaceKind, parentID
 	s.workspaces[workspace.ID] = workspace
 	s.workspaceOrder = append(s.workspaceOrder, workspace.ID)
 	s.addWorkspaceChildLocked(parent, workspace.ID)
+	s.workspaceChangedLocked(actor, workspaceChange{id: workspace.ID, after: workspace})
 	s.appendAuditLocked(actor, "workspace_create", workspace.ID)
 	return workspace.Clone(), nil
 }
@@ -1884,6 +2175,7 @@ func (s *LedgerStore) UpdateWorkspace(id string, update WorkspaceUpdate, actor s
 	if !ok {
 		return nil, ErrWorkspaceNotFound
 	}
+	before := workspace.Clone()
 	if update.ExpectedVersion > 0 && workspace.Version != update.ExpectedVersion {
 		return nil, ErrWorkspaceVersionConflict
 	}
@@ -1929,6 +2221,7 @@ func (s *LedgerStore) UpdateWorkspace(id string, update WorkspaceUpdate, actor s
 	workspace.Version++
 	workspace.UpdatedAt = now
 	s.workspaces[workspace.ID] = workspace
+	s.workspaceChangedLocked(actor, workspaceChange{id: workspace.ID, before: before, after: workspace})
 	s.appendAuditLocked(actor, "workspace_update", workspace.ID)
 	return workspace.Clone(), nil
 }
@@ -1992,7 +2285,7 @@ func (s *LedgerStore) ReorderWorkspaces(parentID string, orderedIDs []string, ac
 	return nil
 }
 
-// DeleteWorkspace removes a workspace and its data.
+// DeleteWorkspace moves a workspace and its descendants to the trash.
 func (s *LedgerStore) DeleteWorkspace(id string, actor string) error {
 	trimmed := strings.TrimSpace(id)
 	if trimmed == "" {
@@ -2007,10 +2300,12 @@ func (s *LedgerStore) DeleteWorkspace(id string, actor string) error {
 	idsToRemove := make([]string, 0, 1)
 	s.collectWorkspaceDescendantsLocked(trimmed, &idsToRemove)
 	removalSet := make(map[string]struct{}, len(idsToRemove))
+	removed := make([]workspaceChange, 0, len(idsToRemove))
 	for _, removeID := range idsToRemove {
 		removalSet[removeID] = struct{}{}
 		ws := s.workspaces[removeID]
 		if ws != nil {
+			removed = append(removed, workspaceChange{id: removeID, before: ws.Clone()})
 			s.removeWorkspaceChildLocked(ws.ParentID, removeID)
 		}
 		delete(s.workspaceChildren, removeID)
@@ -2024,6 +2319,12 @@ func (s *LedgerStore) DeleteWorkspace(id string, actor string) error {
 		filtered = append(filtered, existing)
 	}
 	s.workspaceOrder = filtered
+	trashed := make([]*Workspace, len(removed))
+	for i, change := range removed {
+		trashed[i] = change.before
+	}
+	s.trashWorkspacesLocked(trashed, actor)
+	s.workspaceChangedLocked(actor, removed...)
 	s.appendAuditLocked(actor, "workspace_delete", trimmed)
 	return nil
 }
@@ -2037,6 +2338,7 @@ func (s *LedgerStore) ReplaceWorkspaceData(id string, headers []string, records
 	if !ok {
 		return nil, ErrWorkspaceNotFound
 	}
+	before := workspace.Clone()
 	if !WorkspaceKindSupportsTable(workspace.Kind) {
 		return nil, ErrWorkspaceKindUnsupported
 	}
@@ -2075,6 +2377,7 @@ func (s *LedgerStore) ReplaceWorkspaceData(id string, headers []string, records
 	workspace.UpdatedAt = now
 
 	s.workspaces[workspace.ID] = workspace
+	s.workspaceChangedLocked(actor, workspaceChange{id: workspace.ID, before: before, after: workspace})
 	s.appendAuditLocked(actor, "workspace_import", workspace.ID)
 	return workspace.Clone(), nil
 }
@@ -2088,6 +2391,7 @@ func (s *LedgerStore) AppendWorkspaceData(id string, headers []string, records [
 	if !ok {
 		return nil, ErrWorkspaceNotFound
 	}
+	before := workspace.Clone()
 	if !WorkspaceKindSupportsTable(workspace.Kind) {
 		return nil, ErrWorkspaceKindUnsupported
 	}
@@ -2153,6 +2457,7 @@ func (s *LedgerStore) AppendWorkspaceData(id string, headers []string, records [
 	workspace.Version++
 	workspace.UpdatedAt = now
 	s.workspaces[workspace.ID] = workspace
+	s.workspaceChangedLocked(actor, workspaceChange{id: workspace.ID, before: before, after: workspace})
 	s.appendAuditLocked(actor, "workspace_import_append", workspace.ID)
 	return workspace.Clone(), nil
 }
@@ -2166,6 +2471,7 @@ func (s *LedgerStore) ReplaceWorkspaceDocument(id string, document string, actor
 	if !ok {
 		return nil, ErrWorkspaceNotFound
 	}
+	before := workspace.Clone()
 	if !WorkspaceKindSupportsDocument(workspace.Kind) {
 		return nil, ErrWorkspaceKindUnsupported
 	}
@@ -2177,6 +2483,7 @@ func (s *LedgerStore) ReplaceWorkspaceDocument(id string, document string, actor
 	workspace.Version++
 	workspace.UpdatedAt = time.Now().UTC()
 	s.workspaces[workspace.ID] = workspace
+	s.workspaceChangedLocked(actor, workspaceChange{id: workspace.ID, before: before, after: workspace})
 	s.appendAuditLocked(actor, "workspace_document_import", workspace.ID)
 	return workspace.Clone(), nil
 }
@@ -2355,40 +2662,96 @@ func hasID(seen map[string]struct{}, id string) bool {
 	return ok
 }
 
-// AppendAllowlist inserts or updates an allowlist entry.
-func (s *LedgerStore) AppendAllowlist(entry *IPAllowlistEntry, actor string) (*IPAllowlistEntry, error) {
+// AppendAllowlist inserts or updates an allowlist entry. When guardIP is set, the change is
+// refused with ErrAllowlistLockout if guardIP could no longer reach the administration
+// endpoints afterwards, so administrators cannot lock out their own network.
+func (s *LedgerStore) AppendAllowlist(entry *IPAllowlistEntry, actor, guardIP string) (*IPAllowlistEntry, error) {
 	if entry == nil {
-		return nil, errors.New("allowlist entry cannot be nil")
+		return nil, fmt.Errorf("%w: entry is required", ErrAllowlistInvalid)
 	}
+	entry.CIDR = strings.TrimSpace(entry.CIDR)
 	if _, _, err := net.ParseCIDR(entry.CIDR); err != nil {
 		if ip := net.ParseIP(entry.CIDR); ip == nil {
-			return nil, fmt.Errorf("invalid CIDR or IP: %w", err)
+			return nil, fmt.Errorf("%w: invalid CIDR or IP %q", ErrAllowlistInvalid, entry.CIDR)
 		}
 	}
+	entry.Scope = strings.ToLower(strings.TrimSpace(entry.Scope))
+	if entry.Scope == "" {
+		entry.Scope = AllowlistScopeAll
+	}
+	if entry.Scope != AllowlistScopeAll && entry.Scope != AllowlistScopeAdmin {
+		return nil, fmt.Errorf("%w: scope %q", ErrAllowlistInvalid, entry.Scope)
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	now := time.Now().UTC()
-	if entry.ID == "" {
-		entry.ID = GenerateID("allow")
-		entry.CreatedAt = now
-	}
-	entry.UpdatedAt = now
 	copied := *entry
+	if existing, ok := s.allow[copied.ID]; ok && copied.ID != "" {
+		copied.CreatedAt = existing.CreatedAt
+	} else {
+		if copied.ID == "" {
+			copied.ID = GenerateID("allow")
+		}
+		copied.CreatedAt = now
+	}
+	copied.UpdatedAt = now
+	if err := s.guardAllowlistLocked(guardIP, func(entries []*IPAllowlistEntry) []*IPAllowlistEntry {
+		out := []*IPAllowlistEntry{&copied}
+		for _, existing := range entries {
+			if existing.ID != copied.ID {
+				out = append(out, existing)
+			}
+		}
+		return out
+	}); err != nil {
+		return nil, err
+	}
 	s.allow[copied.ID] = &copied
 	s.appendAuditLocked(actor, "allowlist_upsert", copied.ID)
-	return &copied, nil
+	result := copied
+	return &result, nil
 }
 
-// RemoveAllowlist deletes an entry.
-func (s *LedgerStore) RemoveAllowlist(id string, actor string) bool {
+// RemoveAllowlist deletes an entry, guarding guardIP as AppendAllowlist does.
+func (s *LedgerStore) RemoveAllowlist(id string, actor, guardIP string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.allow[id]; ok {
-		delete(s.allow, id)
-		s.appendAuditLocked(actor, "allowlist_delete", id)
-		return true
+	if _, ok := s.allow[id]; !ok {
+		return ErrAllowlistNotFound
+	}
+	if err := s.guardAllowlistLocked(guardIP, func(entries []*IPAllowlistEntry) []*IPAllowlistEntry {
+		out := make([]*IPAllowlistEntry, 0, len(entries))
+		for _, existing := range entries {
+			if existing.ID != id {
+				out = append(out, existing)
+			}
+		}
+		return out
+	}); err != nil {
+		return err
 	}
-	return false
+	delete(s.allow, id)
+	s.appendAuditLocked(actor, "allowlist_delete", id)
+	return nil
+}
+
+// guardAllowlistLocked refuses a change when guardIP can reach the administration endpoints
+// now but could not under the allowlist change produces. A guardIP the current allowlist
+// already shuts out is not guarded, so a locked-out address cannot block repairs made from
+// elsewhere.
+func (s *LedgerStore) guardAllowlistLocked(guardIP string, change func([]*IPAllowlistEntry) []*IPAllowlistEntry) error {
+	ip := net.ParseIP(strings.TrimSpace(guardIP))
+	if ip == nil {
+		return nil
+	}
+	current := make([]*IPAllowlistEntry, 0, len(s.allow))
+	for _, entry := range s.allow {
+		current = append(current, entry)
+	}
+	if allowlistAdmits(current, ip, AllowlistScopeAdmin) && !allowlistAdmits(change(current), ip, AllowlistScopeAdmin) {
+		return fmt.Errorf("%w: %s would lose access", ErrAllowlistLockout, ip)
+	}
+	return nil
 }
 
 // ListAllowlist returns allow entries ordered by creation time.
@@ -2404,29 +2767,36 @@ func (s *LedgerStore) ListAllowlist() []*IPAllowlistEntry {
 	return out
 }
 
-// IsIPAllowed checks whether ipStr is within the allowlist. Empty allowlist permits all.
-func (s *LedgerStore) IsIPAllowed(ipStr string) bool {
+// IsIPAllowed checks whether ipStr may reach endpoints of the given allowlist scope. Entries
+// scoped to all restrict every endpoint and admin entries additionally restrict the
+// administration endpoints; a scope without entries permits every address.
+func (s *LedgerStore) IsIPAllowed(ipStr string, scope string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if len(s.allow) == 0 {
-		return true
+	entries := make([]*IPAllowlistEntry, 0, len(s.allow))
+	for _, entry := range s.allow {
+		entries = append(entries, entry)
 	}
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
+	return allowlistAdmits(entries, net.ParseIP(strings.TrimSpace(ipStr)), scope)
+}
+
+func allowlistAdmits(entries []*IPAllowlistEntry, ip net.IP, scope string) bool {
+	restricted := make(map[string]bool, 2)
+	matched := make(map[string]bool, 2)
+	for _, entry := range entries {
+		entryScope := entry.EffectiveScope()
+		restricted[entryScope] = true
+		if entry.Contains(ip) {
+			matched[entryScope] = true
+		}
+	}
+	if restricted[AllowlistScopeAll] && !matched[AllowlistScopeAll] {
 		return false
 	}
-	for _, entry := range s.allow {
-		if _, network, err := net.ParseCIDR(entry.CIDR); err == nil {
-			if network.Contains(ip) {
-				return true
-			}
-			continue
-		}
-		if ip.Equal(net.ParseIP(entry.CIDR)) {
-			return true
-		}
+	if scope == AllowlistScopeAdmin && restricted[AllowlistScopeAdmin] && !matched[AllowlistScopeAdmin] {
+		return false
 	}
-	return false
+	return true
 }
 
 // RecordLogin appends an audit entry for a successful SDID login.
@@ -18,30 +18,30 @@ func newTestStore(t *testing.T) *LedgerStore {
 func TestLedgerStoreUndoRedo(t *testing.T) {
 	store := newTestStore(t)
 
-	if store.CanUndo() {
+	if store.CanUndo("tester") {
 		t.Fatalf("expected no undo available initially")
 	}
 
 	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "审批平台"}, "tester"); err != nil {
 		t.Fatalf("create entry failed: %v", err)
 	}
-	if !store.CanUndo() {
+	if !store.CanUndo("tester") {
 		t.Fatalf("expected undo available after create")
 	}
 	if got := len(store.ListEntries(LedgerTypeSystem)); got != 1 {
 		t.Fatalf("expected 1 entry, got %d", got)
 	}
 
-	if err := store.Undo(); err != nil {
+	if err := store.Undo("tester"); err != nil {
 		t.Fatalf("undo failed: %v", err)
 	}
-	if store.CanRedo() == false {
+	if store.CanRedo("tester") == false {
 		t.Fatalf("expected redo available after undo")
 	}
 	if got := len(store.ListEntries(LedgerTypeSystem)); got != 0 {
 		t.Fatalf("expected entries cleared after undo, got %d", got)
 	}
-	if err := store.Redo(); err != nil {
+	if err := store.Redo("tester"); err != nil {
 		t.Fatalf("redo failed: %v", err)
 	}
 	if got := len(store.ListEntries(LedgerTypeSystem)); got != 1 {
@@ -49,6 +49,57 @@ func TestLedgerStoreUndoRedo(t *testing.T) {
 	}
 }
 
+func TestUndoIsScopedPerUser(t *testing.T) {
+	store := newTestStore(t)
+
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP"}, "alice")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "OA"}, "bob"); err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if err := store.Undo("alice"); err != nil {
+		t.Fatalf("undo alice: %v", err)
+	}
+	entries := store.ListEntries(LedgerTypeSystem)
+	if len(entries) != 1 || entries[0].Name != "OA" {
+		t.Fatalf("expected only bob's entry to remain, got %+v", entries)
+	}
+	if err := store.Redo("alice"); err != nil {
+		t.Fatalf("redo alice: %v", err)
+	}
+
+	if _, err := store.UpdateEntry(LedgerTypeSystem, erp.ID, LedgerEntry{Name: "ERP-2"}, "alice"); err != nil {
+		t.Fatalf("update entry: %v", err)
+	}
+	if _, err := store.UpdateEntry(LedgerTypeSystem, erp.ID, LedgerEntry{Name: "ERP-3"}, "bob"); err != nil {
+		t.Fatalf("update entry: %v", err)
+	}
+	var conflict *UndoConflictError
+	if err := store.Undo("alice"); !errors.As(err, &conflict) || len(conflict.Records) != 1 {
+		t.Fatalf("expected undo conflict on the shared entry, got %v", err)
+	}
+	if got, _ := store.GetEntry(LedgerTypeSystem, erp.ID); got.Name != "ERP-3" {
+		t.Fatalf("expected conflicting undo to leave bob's edit, got %q", got.Name)
+	}
+
+	ws, err := store.CreateWorkspace("周报", WorkspaceKindDocument, "", nil, nil, "<p>v1</p>", "alice")
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if _, err := store.UpdateWorkspace(ws.ID, WorkspaceUpdate{SetDocument: true, Document: "<p>v2</p>"}, "alice"); err != nil {
+		t.Fatalf("update workspace: %v", err)
+	}
+	if err := store.Undo("alice"); err != nil {
+		t.Fatalf("undo workspace: %v", err)
+	}
+	restored, _ := store.GetWorkspace(ws.ID)
+	if restored.Document != "<p>v1</p>" || restored.Version <= 2 {
+		t.Fatalf("expected document reverted with a newer version, got %+v", restored)
+	}
+}
+
 func TestLedgerStoreLoginChallengeLifecycle(t *testing.T) {
 	store := newTestStore(t)
 	challenge := store.CreateLoginChallenge()
@@ -292,7 +343,7 @@ func TestWriteSnapshotJSONRoundTrip(t *testing.T) {
 	if _, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "日志平台", Description: "集中收集日志"}, "tester"); err != nil {
 		t.Fatalf("create entry: %v", err)
 	}
-	if _, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "总部办公网", CIDR: "192.168.0.0/24"}, "tester"); err != nil {
+	if _, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "总部办公网", CIDR: "192.168.0.0/24"}, "tester", ""); err != nil {
 		t.Fatalf("append allowlist: %v", err)
 	}
 	columns := []WorkspaceColumn{{ID: "col_task", Title: "任务"}, {ID: "col_owner", Title: "负责人"}}
@@ -326,3 +377,120 @@ func marshalSnapshot(t *testing.T, snap *Snapshot) string {
 	}
 	return string(data)
 }
+
+func TestAllowlistScopesAndLockoutGuard(t *testing.T) {
+	store := newTestStore(t)
+	if !store.IsIPAllowed("203.0.113.9", AllowlistScopeAdmin) {
+		t.Fatalf("expected an empty allowlist to admit everyone")
+	}
+	if _, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "office", CIDR: "10.0.0.0/8"}, "admin", "203.0.113.9"); !errors.Is(err, ErrAllowlistLockout) {
+		t.Fatalf("expected the first entry to be refused when it excludes the caller, got %v", err)
+	}
+	office, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "office", CIDR: "10.0.0.0/8"}, "admin", "10.1.2.3")
+	if err != nil {
+		t.Fatalf("append allowlist: %v", err)
+	}
+	if office.Scope != AllowlistScopeAll {
+		t.Fatalf("expected entries to default to all, got %q", office.Scope)
+	}
+	if _, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "vpn", CIDR: "10.9.0.0/16", Scope: "admin"}, "admin", "10.9.0.5"); err != nil {
+		t.Fatalf("append admin entry: %v", err)
+	}
+	if _, err := store.AppendAllowlist(&IPAllowlistEntry{Label: "bad", CIDR: "10.0.0.1", Scope: "public"}, "admin", ""); !errors.Is(err, ErrAllowlistInvalid) {
+		t.Fatalf("expected unknown scopes to be refused, got %v", err)
+	}
+
+	checks := []struct {
+		ip    string
+		scope string
+		want  bool
+	}{
+		{"10.1.2.3", AllowlistScopeAll, true},
+		{"10.1.2.3", AllowlistScopeAdmin, false},
+		{"10.9.0.5", AllowlistScopeAdmin, true},
+		{"192.168.1.1", AllowlistScopeAll, false},
+		{"", AllowlistScopeAll, false},
+	}
+	for _, check := range checks {
+		if got := store.IsIPAllowed(check.ip, check.scope); got != check.want {
+			t.Fatalf("%s on %s: expected %v, got %v", check.ip, check.scope, check.want, got)
+		}
+	}
+
+	if err := store.RemoveAllowlist(office.ID, "admin", "10.9.0.5"); err != nil {
+		t.Fatalf("expected removal to leave the VPN admitted: %v", err)
+	}
+	vpn := store.ListAllowlist()[0]
+	if err := store.RemoveAllowlist(vpn.ID, "admin", "10.9.0.5"); err != nil {
+		t.Fatalf("expected removing the last entry to reopen access: %v", err)
+	}
+	if err := store.RemoveAllowlist(vpn.ID, "admin", ""); !errors.Is(err, ErrAllowlistNotFound) {
+		t.Fatalf("expected entry to be gone, got %v", err)
+	}
+}
+
+func TestUndoSurvivesAnotherUsersDelete(t *testing.T) {
+	store := newTestStore(t)
+	var ids []string
+	for _, name := range []string{"ERP", "OA", "CRM"} {
+		entry, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: name}, "alice")
+		if err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if _, err := store.UpdateEntry(LedgerTypeSystem, ids[2], LedgerEntry{Name: "CRM-2"}, "alice"); err != nil {
+		t.Fatalf("update entry: %v", err)
+	}
+	// Deleting the first entry renumbers the rest of the ledger.
+	if err := store.DeleteEntry(LedgerTypeSystem, ids[0], "bob"); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+	if err := store.Undo("alice"); err != nil {
+		t.Fatalf("expected alice's undo to ignore bob's delete, got %v", err)
+	}
+	entries := store.ListEntries(LedgerTypeSystem)
+	if len(entries) != 2 || entries[1].Name != "CRM" || entries[1].Order != 1 {
+		t.Fatalf("expected the rename undone in the compacted position, got %+v", entries)
+	}
+}
+
+func TestUndoRestoresDeletedEntriesInPlace(t *testing.T) {
+	store := newTestStore(t)
+	var ids []string
+	for _, name := range []string{"ERP", "OA", "CRM"} {
+		entry, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: name}, "alice")
+		if err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if err := store.DeleteEntry(LedgerTypeSystem, ids[1], "alice"); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+	if _, err := store.ReorderEntries(LedgerTypeSystem, []string{ids[2], ids[0]}, "bob"); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if err := store.Undo("alice"); err != nil {
+		t.Fatalf("undo delete: %v", err)
+	}
+	names := func() []string {
+		var out []string
+		for i, entry := range store.ListEntries(LedgerTypeSystem) {
+			if entry.Order != i {
+				t.Fatalf("expected contiguous ordering, got %+v", store.ListEntries(LedgerTypeSystem))
+			}
+			out = append(out, entry.Name)
+		}
+		return out
+	}
+	if got := names(); len(got) != 3 || got[0] != "CRM" || got[1] != "OA" || got[2] != "ERP" {
+		t.Fatalf("expected OA back at its old position, got %v", got)
+	}
+	if err := store.Redo("alice"); err != nil {
+		t.Fatalf("redo delete: %v", err)
+	}
+	if got := names(); len(got) != 2 || got[0] != "CRM" || got[1] != "ERP" {
+		t.Fatalf("expected the delete redone, got %v", got)
+	}
+}
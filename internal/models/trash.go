@@ -0,0 +1,314 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTrashItemNotFound indicates the trash item does not exist or was purged.
+	ErrTrashItemNotFound = errors.New("trash_item_not_found")
+	// ErrTrashRestoreConflict indicates a record with the same ID is live again.
+	ErrTrashRestoreConflict = errors.New("trash_restore_conflict")
+)
+
+// Trash item kinds.
+const (
+	TrashKindEntry     = "entry"
+	TrashKindWorkspace = "workspace"
+)
+
+// DefaultTrashRetentionDays is how long trashed items are kept before automatic purge.
+const DefaultTrashRetentionDays = 30
+
+// TrashItem holds a deleted ledger entry, or a deleted workspace together with its
+// descendants, until it is restored or purged. Relationships lists the typed edges the entry
+// had when it was deleted so they can come back with it.
+type TrashItem struct {
+	ID            string         `json:"id"`
+	Kind          string         `json:"kind"`
+	Type          LedgerType     `json:"type,omitempty"`
+	RecordID      string         `json:"record_id"`
+	Name          string         `json:"name"`
+	Entry         *LedgerEntry   `json:"entry,omitempty"`
+	Workspaces    []*Workspace   `json:"workspaces,omitempty"`
+	Relationships []Relationship `json:"relationships,omitempty"`
+	TrashedAt     time.Time      `json:"trashed_at"`
+	TrashedBy     string         `json:"trashed_by"`
+}
+
+// Clone returns a deep copy of the trash item.
+func (t TrashItem) Clone() TrashItem {
+	clone := t
+	if t.Entry != nil {
+		entry := t.Entry.Clone()
+		clone.Entry = &entry
+	}
+	if t.Workspaces != nil {
+		clone.Workspaces = make([]*Workspace, len(t.Workspaces))
+		for i, ws := range t.Workspaces {
+			clone.Workspaces[i] = ws.Clone()
+		}
+	}
+	clone.Relationships = cloneRelationships(t.Relationships)
+	return clone
+}
+
+func cloneTrash(items []TrashItem) []TrashItem {
+	out := make([]TrashItem, len(items))
+	for i, item := range items {
+		out[i] = item.Clone()
+	}
+	return out
+}
+
+// trashEntryLocked moves a copy of an entry that is being removed into the trash.
+func (s *LedgerStore) trashEntryLocked(typ LedgerType, entry LedgerEntry, actor string) {
+	clone := entry.Clone()
+	item := TrashItem{
+		ID:        GenerateID("trash"),
+		Kind:      TrashKindEntry,
+		Type:      typ,
+		RecordID:  entry.ID,
+		Name:      entry.Name,
+		Entry:     &clone,
+		TrashedAt: time.Now().UTC(),
+		TrashedBy: actor,
+	}
+	for _, rel := range s.relationships {
+		if rel.Involves(typ, entry.ID) {
+			item.Relationships = append(item.Relationships, rel.Clone())
+		}
+	}
+	s.trash = append(s.trash, item)
+}
+
+// trashWorkspacesLocked moves a removed workspace subtree into the trash; the first workspace
+// is the root of the subtree.
+func (s *LedgerStore) trashWorkspacesLocked(workspaces []*Workspace, actor string) {
+	if len(workspaces) == 0 {
+		return
+	}
+	item := TrashItem{
+		ID:         GenerateID("trash"),
+		Kind:       TrashKindWorkspace,
+		RecordID:   workspaces[0].ID,
+		Name:       workspaces[0].Name,
+		TrashedAt:  time.Now().UTC(),
+		TrashedBy:  actor,
+		Workspaces: make([]*Workspace, len(workspaces)),
+	}
+	for i, ws := range workspaces {
+		item.Workspaces[i] = ws.Clone()
+	}
+	s.trash = append(s.trash, item)
+}
+
+// dropTrashLocked forgets trash items holding a record that became live again through undo.
+// A workspace subtree is dropped once its root is back; undo restores the rest with it.
+func (s *LedgerStore) dropTrashLocked(kind string, typ LedgerType, id string) {
+	kept := s.trash[:0]
+	for _, item := range s.trash {
+		if item.Kind == kind && item.Type == typ && item.RecordID == id {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	s.trash = kept
+}
+
+func (s *LedgerStore) trashIndexLocked(id string) int {
+	for i, item := range s.trash {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListTrash returns trashed items, newest first, optionally narrowed by kind and ledger type.
+func (s *LedgerStore) ListTrash(kind string, typ LedgerType) []TrashItem {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]TrashItem, 0, len(s.trash))
+	for _, item := range s.trash {
+		if kind != "" && item.Kind != kind {
+			continue
+		}
+		if typ != "" && item.Type != typ {
+			continue
+		}
+		out = append(out, item.Clone())
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].TrashedAt.After(out[j].TrashedAt) })
+	return out
+}
+
+// RestoreTrash brings a trashed entry or workspace subtree back. Links to entries that no
+// longer exist are dropped; a workspace whose parent folder is gone is restored at the root.
+func (s *LedgerStore) RestoreTrash(id string, actor string) (TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.trashIndexLocked(id)
+	if idx < 0 {
+		return TrashItem{}, ErrTrashItemNotFound
+	}
+	item := s.trash[idx]
+	var err error
+	switch item.Kind {
+	case TrashKindEntry:
+		err = s.restoreTrashedEntryLocked(item, actor)
+	case TrashKindWorkspace:
+		err = s.restoreTrashedWorkspacesLocked(item, actor)
+	default:
+		err = fmt.Errorf("%w: kind %q", ErrTrashItemNotFound, item.Kind)
+	}
+	if err != nil {
+		return TrashItem{}, err
+	}
+	s.trash = append(s.trash[:idx], s.trash[idx+1:]...)
+	return item.Clone(), nil
+}
+
+func (s *LedgerStore) restoreTrashedEntryLocked(item TrashItem, actor string) error {
+	if _, ok := s.ledgerTypes[item.Type]; !ok {
+		return fmt.Errorf("%w: %s", ErrLedgerTypeUnknown, item.Type)
+	}
+	if s.entryIndexLocked(item.Type, item.RecordID) >= 0 {
+		return ErrTrashRestoreConflict
+	}
+	entry := item.Entry.Clone()
+	links := make(map[LedgerType][]string, len(entry.Links))
+	for target, ids := range entry.Links {
+		for _, targetID := range ids {
+			if s.entryIndexLocked(target, targetID) >= 0 && s.ledgerTypes[item.Type].AllowsLink(target) {
+				links[target] = append(links[target], targetID)
+			}
+		}
+	}
+	entry.Links = links
+	entry.Order = len(s.entries[item.Type])
+	entry.UpdatedAt = time.Now().UTC()
+	candidates := []LedgerEntry{entry}
+	if err := s.prepareEntriesLocked(item.Type, candidates); err != nil {
+		return err
+	}
+	entry = candidates[0]
+	s.touchEntryLocked(item.Type, entry.ID)
+	s.appendEntryLocked(item.Type, entry.Clone())
+	s.syncLinksLocked(item.Type, entry.ID, nil, entry.Links)
+	live := make(map[string]struct{}, len(s.relationships))
+	for _, rel := range s.relationships {
+		live[rel.ID] = struct{}{}
+	}
+	for _, rel := range item.Relationships {
+		if _, ok := live[rel.ID]; ok {
+			continue
+		}
+		if s.entryIndexLocked(rel.FromType, rel.FromID) < 0 || s.entryIndexLocked(rel.ToType, rel.ToID) < 0 {
+			continue
+		}
+		s.touchRelationshipLocked(rel.ID)
+		s.relationships = append(s.relationships, rel.Clone())
+		s.linkRelationshipLocked(rel)
+	}
+	s.appendAuditLocked(actor, "restore_"+string(item.Type), entry.ID)
+	s.commitLocked(actor)
+	return nil
+}
+
+func (s *LedgerStore) restoreTrashedWorkspacesLocked(item TrashItem, actor string) error {
+	for _, ws := range item.Workspaces {
+		if _, exists := s.workspaces[ws.ID]; exists {
+			return ErrTrashRestoreConflict
+		}
+	}
+	changes := make([]workspaceChange, 0, len(item.Workspaces))
+	for i, ws := range item.Workspaces {
+		restored := ws.Clone()
+		if i == 0 && s.validateWorkspaceParentLocked(restored.ParentID, restored.ID) != nil {
+			restored.ParentID = ""
+		}
+		s.workspaces[restored.ID] = restored
+		s.workspaceOrder = append(s.workspaceOrder, restored.ID)
+		s.addWorkspaceChildLocked(restored.ParentID, restored.ID)
+		changes = append(changes, workspaceChange{id: restored.ID, after: restored})
+	}
+	s.workspaceChangedLocked(actor, changes...)
+	s.appendAuditLocked(actor, "workspace_restore", item.RecordID)
+	return nil
+}
+
+// PurgeTrash permanently removes one trashed item.
+func (s *LedgerStore) PurgeTrash(id string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.trashIndexLocked(id)
+	if idx < 0 {
+		return ErrTrashItemNotFound
+	}
+	item := s.trash[idx]
+	s.trash = append(s.trash[:idx], s.trash[idx+1:]...)
+	s.appendAuditLocked(actor, "trash_purge", fmt.Sprintf("%s %s/%s", item.Kind, item.Type, item.RecordID))
+	return nil
+}
+
+// PurgeExpiredTrash permanently removes items trashed longer than the retention period ago
+// and returns how many were removed. A retention of zero days keeps items forever.
+func (s *LedgerStore) PurgeExpiredTrash(now time.Time, actor string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trashRetentionDays <= 0 {
+		return 0
+	}
+	cutoff := now.AddDate(0, 0, -s.trashRetentionDays)
+	kept := s.trash[:0]
+	purged := 0
+	for _, item := range s.trash {
+		if item.TrashedAt.Before(cutoff) {
+			purged++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	s.trash = kept
+	if purged > 0 {
+		s.appendAuditLocked(actor, "trash_purge_expired", fmt.Sprintf("count=%d", purged))
+	}
+	return purged
+}
+
+// TrashRetentionDays returns how many days trashed items are kept; zero disables auto purge.
+func (s *LedgerStore) TrashRetentionDays() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trashRetentionDays
+}
+
+// SetTrashRetentionDays changes how long trashed items are kept; zero disables auto purge.
+func (s *LedgerStore) SetTrashRetentionDays(days int, actor string) {
+	if days < 0 {
+		days = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trashRetentionDays = days
+	s.appendAuditLocked(actor, "trash_retention", fmt.Sprintf("days=%d", days))
+}
+
+// mergeTrashLocked adds incoming trash items that are not known locally.
+func (s *LedgerStore) mergeTrashLocked(items []TrashItem) {
+	known := make(map[string]struct{}, len(s.trash))
+	for _, item := range s.trash {
+		known[item.ID] = struct{}{}
+	}
+	for _, item := range items {
+		if _, ok := known[item.ID]; ok || strings.TrimSpace(item.ID) == "" {
+			continue
+		}
+		s.trash = append(s.trash, item.Clone())
+	}
+}
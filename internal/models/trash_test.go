@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeletedEntryCanBeRestoredFromTrash(t *testing.T) {
+	store := newTestStore(t)
+
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "张三"}, "tester")
+	if err != nil {
+		t.Fatalf("create person: %v", err)
+	}
+	erp, err := store.CreateEntry(LedgerTypeSystem, LedgerEntry{Name: "ERP", Links: map[LedgerType][]string{LedgerTypePersonnel: {alice.ID}}}, "tester")
+	if err != nil {
+		t.Fatalf("create system: %v", err)
+	}
+	if _, err := store.CreateRelationship(Relationship{Role: RoleOwner, FromType: LedgerTypePersonnel, FromID: alice.ID, ToType: LedgerTypeSystem, ToID: erp.ID}, "tester"); err != nil {
+		t.Fatalf("create relationship: %v", err)
+	}
+
+	if err := store.DeleteEntry(LedgerTypeSystem, erp.ID, "bob"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	items := store.ListTrash(TrashKindEntry, LedgerTypeSystem)
+	if len(items) != 1 || items[0].RecordID != erp.ID || items[0].TrashedBy != "bob" || items[0].TrashedAt.IsZero() {
+		t.Fatalf("expected ERP in trash, got %+v", items)
+	}
+	if len(items[0].Relationships) != 1 {
+		t.Fatalf("expected owner relationship kept with the trashed entry, got %+v", items[0].Relationships)
+	}
+
+	if _, err := store.RestoreTrash(items[0].ID, "bob"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	restored, err := store.GetEntry(LedgerTypeSystem, erp.ID)
+	if err != nil || len(restored.Links[LedgerTypePersonnel]) != 1 {
+		t.Fatalf("expected ERP restored with its link, got %+v (%v)", restored, err)
+	}
+	person, _ := store.GetEntry(LedgerTypePersonnel, alice.ID)
+	if len(person.Links[LedgerTypeSystem]) != 1 {
+		t.Fatalf("expected reverse link restored, got %+v", person.Links)
+	}
+	if rels := store.ListRelationships(RelationshipFilter{EntryType: LedgerTypeSystem, EntryID: erp.ID}); len(rels) != 1 {
+		t.Fatalf("expected relationship restored, got %+v", rels)
+	}
+	if len(store.ListTrash("", "")) != 0 {
+		t.Fatalf("expected trash to be empty after restore")
+	}
+	if _, err := store.RestoreTrash(items[0].ID, "bob"); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Fatalf("expected restored item to be gone, got %v", err)
+	}
+}
+
+func TestTrashedWorkspaceSubtreeRestoreAndPurge(t *testing.T) {
+	store := newTestStore(t)
+
+	folder, err := store.CreateWorkspace("运维", WorkspaceKindFolder, "", nil, nil, "", "tester")
+	if err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+	doc, err := store.CreateWorkspace("值班手册", WorkspaceKindDocument, folder.ID, nil, nil, "<p>v1</p>", "tester")
+	if err != nil {
+		t.Fatalf("create doc: %v", err)
+	}
+	if err := store.DeleteWorkspace(folder.ID, "tester"); err != nil {
+		t.Fatalf("delete folder: %v", err)
+	}
+	items := store.ListTrash(TrashKindWorkspace, "")
+	if len(items) != 1 || len(items[0].Workspaces) != 2 {
+		t.Fatalf("expected folder and child in one trash item, got %+v", items)
+	}
+	if _, err := store.RestoreTrash(items[0].ID, "tester"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	restored, err := store.GetWorkspace(doc.ID)
+	if err != nil || restored.ParentID != folder.ID || restored.Document != "<p>v1</p>" {
+		t.Fatalf("expected document restored under its folder, got %+v (%v)", restored, err)
+	}
+
+	if err := store.DeleteWorkspace(doc.ID, "tester"); err != nil {
+		t.Fatalf("delete doc: %v", err)
+	}
+	if purged := store.PurgeExpiredTrash(time.Now().UTC(), "system"); purged != 0 {
+		t.Fatalf("expected fresh items to be kept, purged %d", purged)
+	}
+	if purged := store.PurgeExpiredTrash(time.Now().UTC().AddDate(0, 0, DefaultTrashRetentionDays+1), "system"); purged != 1 {
+		t.Fatalf("expected expired item to be purged, purged %d", purged)
+	}
+	if len(store.ListTrash("", "")) != 0 {
+		t.Fatalf("expected empty trash after purge")
+	}
+}
+
+func TestConfiguredTrashRetentionIsOnlyADefault(t *testing.T) {
+	t.Setenv(adminPasswordEnv, testAdminPassword)
+	days := 7
+	store := NewLedgerStoreWithConfig(StoreConfig{TrashRetentionDays: &days})
+	if got := store.TrashRetentionDays(); got != 7 {
+		t.Fatalf("expected the configured retention, got %d", got)
+	}
+	snapshot := store.ExportSnapshot()
+	snapshot.TrashRetention = nil
+	if err := store.ImportSnapshot(snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if got := store.TrashRetentionDays(); got != 7 {
+		t.Fatalf("expected the configured retention for a snapshot without one, got %d", got)
+	}
+	saved := 90
+	snapshot.TrashRetention = &saved
+	if err := store.ImportSnapshot(snapshot); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if got := store.TrashRetentionDays(); got != 90 {
+		t.Fatalf("expected the administrator's retention to win, got %d", got)
+	}
+	for _, audit := range store.ListAudits() {
+		if audit.Action == "trash_retention" {
+			t.Fatalf("configuration must not be audited: %+v", audit)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrVisibilityRuleNotFound indicates the visibility rule does not exist.
+	ErrVisibilityRuleNotFound = errors.New("visibility_rule_not_found")
+	// ErrVisibilityRuleInvalid indicates a visibility rule is malformed or names an unknown ledger.
+	ErrVisibilityRuleInvalid = errors.New("visibility_rule_invalid")
+)
+
+// Kinds of visibility rules.
+const (
+	// VisibilityField masks one attribute from everyone outside the rule's subjects.
+	VisibilityField = "field"
+	// VisibilityRow limits the rule's subjects to the entries matching its filters.
+	VisibilityRow = "row"
+)
+
+// Ways a field rule masks an attribute.
+const (
+	// MaskHide removes the attribute altogether.
+	MaskHide = "hide"
+	// MaskPartial keeps the first three and last four characters of values of eight or more
+	// characters and stars out the rest, or the whole of shorter values.
+	MaskPartial = "partial"
+)
+
+// VisibilityRule restricts what users see of a ledger. Subjects are access roles such as viewer
+// or user groups such as hr. A field rule shows Field in clear only to its subjects; a row rule
+// shows its subjects only the entries matching every filter, and when several row rules apply
+// to a user an entry matching any of them is visible. String filter values may refer to the
+// user with {user.username} or {user.<attribute>}, so a rule for department managers can match
+// attributes.department against {user.department}; a rule whose placeholders the user lacks
+// matches nothing.
+type VisibilityRule struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Ledger    LedgerType     `json:"ledger"`
+	Kind      string         `json:"kind"`
+	Field     string         `json:"field,omitempty"`
+	Mask      string         `json:"mask,omitempty"`
+	Subjects  []string       `json:"subjects"`
+	Filters   []FilterClause `json:"filters,omitempty"`
+	CreatedBy string         `json:"created_by,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Clone returns a deep copy of the rule.
+func (r *VisibilityRule) Clone() *VisibilityRule {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	clone.Subjects = append([]string(nil), r.Subjects...)
+	clone.Filters = append([]FilterClause(nil), r.Filters...)
+	return &clone
+}
+
+func (s *LedgerStore) normaliseVisibilityRuleLocked(rule VisibilityRule) (*VisibilityRule, error) {
+	out := &VisibilityRule{
+		Name:   strings.TrimSpace(rule.Name),
+		Ledger: NormaliseLedgerType(string(rule.Ledger)),
+		Kind:   strings.ToLower(strings.TrimSpace(rule.Kind)),
+	}
+	if _, ok := s.ledgerTypes[out.Ledger]; !ok {
+		return nil, fmt.Errorf("%w: unknown ledger %q", ErrVisibilityRuleInvalid, rule.Ledger)
+	}
+	for _, subject := range rule.Subjects {
+		if subject = strings.ToLower(strings.TrimSpace(subject)); subject != "" && !containsString(out.Subjects, subject) {
+			out.Subjects = append(out.Subjects, subject)
+		}
+	}
+	switch out.Kind {
+	case VisibilityField:
+		out.Field = strings.TrimPrefix(strings.TrimSpace(rule.Field), "attributes.")
+		if out.Field == "" {
+			return nil, fmt.Errorf("%w: field is required", ErrVisibilityRuleInvalid)
+		}
+		out.Mask = strings.ToLower(strings.TrimSpace(rule.Mask))
+		if out.Mask == "" {
+			out.Mask = MaskHide
+		}
+		if out.Mask != MaskHide && out.Mask != MaskPartial {
+			return nil, fmt.Errorf("%w: mask %q", ErrVisibilityRuleInvalid, rule.Mask)
+		}
+	case VisibilityRow:
+		if len(out.Subjects) == 0 {
+			return nil, fmt.Errorf("%w: row rules need subjects", ErrVisibilityRuleInvalid)
+		}
+		if len(rule.Filters) == 0 {
+			return nil, fmt.Errorf("%w: row rules need filters", ErrVisibilityRuleInvalid)
+		}
+		for _, clause := range rule.Filters {
+			if _, err := compileFilter(clause); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrVisibilityRuleInvalid, err)
+			}
+		}
+		out.Filters = append([]FilterClause(nil), rule.Filters...)
+	default:
+		return nil, fmt.Errorf("%w: kind %q", ErrVisibilityRuleInvalid, rule.Kind)
+	}
+	if out.Name == "" {
+		out.Name = fmt.Sprintf("%s %s", out.Ledger, out.Kind)
+	}
+	return out, nil
+}
+
+func (s *LedgerStore) visibilityRuleIndexLocked(id string) int {
+	for i, rule := range s.visibilityRules {
+		if rule.ID == strings.TrimSpace(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListVisibilityRules returns the visibility rules in creation order.
+func (s *LedgerStore) ListVisibilityRules() []*VisibilityRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneVisibilityRules(s.visibilityRules)
+}
+
+// CreateVisibilityRule validates and stores a visibility rule.
+func (s *LedgerStore) CreateVisibilityRule(rule VisibilityRule, actor string) (*VisibilityRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, err := s.normaliseVisibilityRuleLocked(rule)
+	if err != nil {
+		return nil, err
+	}
+	out.ID = GenerateID("visibility")
+	out.CreatedBy = actor
+	out.CreatedAt = time.Now().UTC()
+	out.UpdatedAt = out.CreatedAt
+	s.visibilityRules = append(s.visibilityRules, out)
+	s.appendAuditLocked(actor, "visibility_rule_create", out.ID)
+	return out.Clone(), nil
+}
+
+// UpdateVisibilityRule replaces a visibility rule.
+func (s *LedgerStore) UpdateVisibilityRule(id string, rule VisibilityRule, actor string) (*VisibilityRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.visibilityRuleIndexLocked(id)
+	if i < 0 {
+		return nil, ErrVisibilityRuleNotFound
+	}
+	out, err := s.normaliseVisibilityRuleLocked(rule)
+	if err != nil {
+		return nil, err
+	}
+	existing := s.visibilityRules[i]
+	out.ID = existing.ID
+	out.CreatedBy = existing.CreatedBy
+	out.CreatedAt = existing.CreatedAt
+	out.UpdatedAt = time.Now().UTC()
+	s.visibilityRules[i] = out
+	s.appendAuditLocked(actor, "visibility_rule_update", out.ID)
+	return out.Clone(), nil
+}
+
+// DeleteVisibilityRule removes a visibility rule.
+func (s *LedgerStore) DeleteVisibilityRule(id string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.visibilityRuleIndexLocked(id)
+	if i < 0 {
+		return ErrVisibilityRuleNotFound
+	}
+	s.visibilityRules = append(s.visibilityRules[:i], s.visibilityRules[i+1:]...)
+	s.appendAuditLocked(actor, "visibility_rule_delete", id)
+	return nil
+}
+
+// SetUserProfile replaces the groups visibility rules match a user by and the attributes their
+// filters may refer to.
+func (s *LedgerStore) SetUserProfile(id string, groups []string, attributes map[string]string, actor string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[strings.TrimSpace(id)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.Groups = nil
+	for _, group := range groups {
+		if group = strings.ToLower(strings.TrimSpace(group)); group != "" && !containsString(user.Groups, group) {
+			user.Groups = append(user.Groups, group)
+		}
+	}
+	user.Attributes = nil
+	for key, value := range attributes {
+		if key = strings.TrimSpace(key); key != "" {
+			if user.Attributes == nil {
+				user.Attributes = make(map[string]string, len(attributes))
+			}
+			user.Attributes[key] = strings.TrimSpace(value)
+		}
+	}
+	user.UpdatedAt = time.Now().UTC()
+	s.appendAuditLocked(strings.TrimSpace(actor), "user_profile_update", user.ID)
+	return user.Clone(), nil
+}
+
+// Visibility is what the visibility rules leave one user to see. A nil Visibility hides
+// nothing, and every method accepts one.
+type Visibility struct {
+	masks  map[LedgerType]map[string]string
+	hidden map[LedgerType]map[string]struct{}
+}
+
+// VisibilityFor evaluates the visibility rules for a user, returning nil when none restrict
+// them. Row rules are evaluated against the entries as they are now, so the result should not
+// outlive the request it was made for.
+func (s *LedgerStore) VisibilityFor(username string) *Visibility {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.visibilityRules) == 0 {
+		return nil
+	}
+	user := s.userByName[normalizeUsername(username)]
+	subjects := map[string]struct{}{}
+	if user != nil {
+		subjects[string(user.EffectiveRole())] = struct{}{}
+		for _, group := range user.Groups {
+			subjects[group] = struct{}{}
+		}
+	}
+	applies := func(rule *VisibilityRule) bool {
+		for _, subject := range rule.Subjects {
+			if _, ok := subjects[subject]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	view := &Visibility{masks: make(map[LedgerType]map[string]string), hidden: make(map[LedgerType]map[string]struct{})}
+	rows := make(map[LedgerType][][]compiledFilter)
+	for _, rule := range s.visibilityRules {
+		switch rule.Kind {
+		case VisibilityField:
+			if applies(rule) {
+				continue
+			}
+			if view.masks[rule.Ledger] == nil {
+				view.masks[rule.Ledger] = make(map[string]string)
+			}
+			// Hiding wins over partial masking when two rules cover the same field.
+			if view.masks[rule.Ledger][rule.Field] != MaskHide {
+				view.masks[rule.Ledger][rule.Field] = rule.Mask
+			}
+		case VisibilityRow:
+			if !applies(rule) {
+				continue
+			}
+			filters, ok := compileRowFilters(rule.Filters, user)
+			if !ok {
+				// Keep the ledger restricted even though this rule admits nothing.
+				filters = nil
+			}
+			rows[rule.Ledger] = append(rows[rule.Ledger], filters)
+		}
+	}
+	for typ, rules := range rows {
+		hidden := make(map[string]struct{})
+		for _, entry := range s.entries[typ] {
+			if !matchAnyRowRule(entry, rules) {
+				hidden[entry.ID] = struct{}{}
+			}
+		}
+		// Trashed entries are judged as they were deleted so the trash does not show them either.
+		for _, item := range s.trash {
+			if item.Entry != nil && item.Type == typ && !matchAnyRowRule(*item.Entry, rules) {
+				hidden[item.Entry.ID] = struct{}{}
+			}
+		}
+		view.hidden[typ] = hidden
+	}
+	if len(view.masks) == 0 && len(view.hidden) == 0 {
+		return nil
+	}
+	return view
+}
+
+// compileRowFilters substitutes user placeholders into the filters of a row rule. It reports
+// false when the user lacks a placeholder or a filter no longer compiles.
+func compileRowFilters(clauses []FilterClause, user *User) ([]compiledFilter, bool) {
+	filters := make([]compiledFilter, 0, len(clauses))
+	for _, clause := range clauses {
+		value, ok := substituteUserValue(clause.Value, user)
+		if !ok {
+			return nil, false
+		}
+		clause.Value = value
+		filter, err := compileFilter(clause)
+		if err != nil {
+			return nil, false
+		}
+		filters = append(filters, filter)
+	}
+	return filters, true
+}
+
+func substituteUserValue(value interface{}, user *User) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return substituteUserPlaceholders(v, user)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			substituted, ok := substituteUserValue(item, user)
+			if !ok {
+				return nil, false
+			}
+			out[i] = substituted
+		}
+		return out, true
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			substituted, ok := substituteUserValue(item, user)
+			if !ok {
+				return nil, false
+			}
+			out[key] = substituted
+		}
+		return out, true
+	}
+	return value, true
+}
+
+func substituteUserPlaceholders(value string, user *User) (string, bool) {
+	var out strings.Builder
+	for {
+		start := strings.Index(value, "{user.")
+		if start < 0 {
+			out.WriteString(value)
+			return out.String(), true
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			out.WriteString(value)
+			return out.String(), true
+		}
+		if user == nil {
+			return "", false
+		}
+		name := value[start+len("{user.") : start+end]
+		resolved := user.Attributes[name]
+		if name == "username" {
+			resolved = user.Username
+		}
+		if strings.TrimSpace(resolved) == "" {
+			return "", false
+		}
+		out.WriteString(value[:start])
+		out.WriteString(resolved)
+		value = value[start+end+1:]
+	}
+}
+
+func matchAnyRowRule(entry LedgerEntry, rules [][]compiledFilter) bool {
+	for _, filters := range rules {
+		if filters == nil {
+			continue
+		}
+		matched := true
+		for _, filter := range filters {
+			if !filter.match(entry) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Hidden reports whether a row rule hides the entry.
+func (v *Visibility) Hidden(typ LedgerType, id string) bool {
+	if v == nil {
+		return false
+	}
+	_, hidden := v.hidden[typ][id]
+	return hidden
+}
+
+// Masked reports whether an attribute of the ledger is masked.
+func (v *Visibility) Masked(typ LedgerType, key string) bool {
+	if v == nil {
+		return false
+	}
+	_, masked := v.masks[typ][key]
+	return masked
+}
+
+// Mask returns the entry with its masked attributes hidden or starred out. The entry's
+// attribute map is not modified.
+func (v *Visibility) Mask(typ LedgerType, entry LedgerEntry) LedgerEntry {
+	if v == nil || len(v.masks[typ]) == 0 || len(entry.Attributes) == 0 {
+		return entry
+	}
+	attributes := make(map[string]string, len(entry.Attributes))
+	for key, value := range entry.Attributes {
+		mode, masked := v.masks[typ][key]
+		switch {
+		case !masked:
+			attributes[key] = value
+		case mode == MaskPartial:
+			attributes[key] = maskPartial(value)
+		}
+	}
+	entry.Attributes = attributes
+	return entry
+}
+
+// Entry masks an entry, reporting false when it is hidden.
+func (v *Visibility) Entry(typ LedgerType, entry LedgerEntry) (LedgerEntry, bool) {
+	if v.Hidden(typ, entry.ID) {
+		return LedgerEntry{}, false
+	}
+	return v.Mask(typ, entry), true
+}
+
+// Entries drops the hidden entries and masks the rest.
+func (v *Visibility) Entries(typ LedgerType, entries []LedgerEntry) []LedgerEntry {
+	if v == nil {
+		return entries
+	}
+	out := make([]LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		if masked, ok := v.Entry(typ, entry); ok {
+			out = append(out, masked)
+		}
+	}
+	return out
+}
+
+// Revisions drops the revisions of hidden entries and masks changes to masked attributes.
+func (v *Visibility) Revisions(revisions []Revision) []Revision {
+	if v == nil {
+		return revisions
+	}
+	out := make([]Revision, 0, len(revisions))
+	for _, rev := range revisions {
+		if rev.Kind != RevisionKindEntry {
+			out = append(out, rev)
+			continue
+		}
+		if v.Hidden(rev.Type, rev.ID) {
+			continue
+		}
+		rev.Changes = v.Changes(rev.Type, rev.Changes)
+		out = append(out, rev)
+	}
+	return out
+}
+
+// Changes masks the changes of an entry's masked attributes, dropping those it hides.
+func (v *Visibility) Changes(typ LedgerType, changes []FieldChange) []FieldChange {
+	if v == nil || len(v.masks[typ]) == 0 {
+		return changes
+	}
+	out := make([]FieldChange, 0, len(changes))
+	for _, change := range changes {
+		key := strings.TrimPrefix(change.Field, "attributes.")
+		mode, masked := v.masks[typ][key]
+		switch {
+		case key == change.Field || !masked:
+			out = append(out, change)
+		case mode == MaskPartial:
+			change.From, change.To = maskPartial(change.From), maskPartial(change.To)
+			out = append(out, change)
+		}
+	}
+	return out
+}
+
+// Restore puts back the stored values of masked attributes that an update left out or sent
+// back masked, so saving an entry read through the mask does not overwrite what it hid.
+func (v *Visibility) Restore(typ LedgerType, submitted, stored map[string]string) map[string]string {
+	if v == nil || submitted == nil || len(v.masks[typ]) == 0 {
+		return submitted
+	}
+	out := make(map[string]string, len(submitted))
+	for key, value := range submitted {
+		out[key] = value
+	}
+	for key, mode := range v.masks[typ] {
+		current, ok := stored[key]
+		if !ok {
+			continue
+		}
+		value, sent := out[key]
+		if !sent || (mode == MaskPartial && value == maskPartial(current)) {
+			out[key] = current
+		}
+	}
+	return out
+}
+
+// Redact applies the visibility to the ledger data of a snapshot in place: entries, entry
+// revisions and trashed entries.
+func (v *Visibility) Redact(snapshot *Snapshot) {
+	if v == nil || snapshot == nil {
+		return
+	}
+	for typ, entries := range snapshot.Entries {
+		snapshot.Entries[typ] = v.Entries(typ, entries)
+	}
+	snapshot.Revisions = v.Revisions(snapshot.Revisions)
+	snapshot.Trash = v.Trash(snapshot.Trash)
+}
+
+// Trash drops the trashed entries the view hides and masks the rest. Trashed workspaces are
+// kept as they are.
+func (v *Visibility) Trash(items []TrashItem) []TrashItem {
+	if v == nil {
+		return items
+	}
+	out := make([]TrashItem, 0, len(items))
+	for _, item := range items {
+		if item.Entry != nil {
+			if v.Hidden(item.Type, item.Entry.ID) {
+				continue
+			}
+			masked := v.Mask(item.Type, *item.Entry)
+			item.Entry = &masked
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+func maskPartial(value string) string {
+	runes := []rune(value)
+	if len(runes) < 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:3]) + strings.Repeat("*", len(runes)-7) + string(runes[len(runes)-4:])
+}
+
+func restoreVisibilityRules(rules []*VisibilityRule) []*VisibilityRule {
+	out := make([]*VisibilityRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule == nil || strings.TrimSpace(rule.ID) == "" {
+			continue
+		}
+		out = append(out, rule.Clone())
+	}
+	return out
+}
+
+// mergeVisibilityRulesLocked replaces rules with matching IDs and appends the rest.
+func (s *LedgerStore) mergeVisibilityRulesLocked(rules []*VisibilityRule) {
+	for _, rule := range restoreVisibilityRules(rules) {
+		if i := s.visibilityRuleIndexLocked(rule.ID); i >= 0 {
+			s.visibilityRules[i] = rule
+			continue
+		}
+		s.visibilityRules = append(s.visibilityRules, rule)
+	}
+}
+
+func cloneVisibilityRules(rules []*VisibilityRule) []*VisibilityRule {
+	out := make([]*VisibilityRule, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, rule.Clone())
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVisibilityMasksFieldsAndFiltersRows(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Alice", Attributes: map[string]string{"department": "Ops", "id_number": "110101199001011234"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	bob, err := store.CreateEntry(LedgerTypePersonnel, LedgerEntry{Name: "Bob", Attributes: map[string]string{"department": "Sales", "id_number": "220202199202022345"}}, "admin")
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	for _, name := range []string{"hr", "manager", "clerk"} {
+		if _, err := store.CreateUser(name, "Passw0rd!23", AccessViewer, "admin"); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	users := store.ListUsers()
+	if _, err := store.SetUserProfile(users[1].ID, []string{"HR"}, nil, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if _, err := store.SetUserProfile(users[2].ID, []string{"managers"}, map[string]string{"department": "Ops"}, "admin"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+
+	if store.VisibilityFor("clerk") != nil {
+		t.Fatalf("expected no restrictions without rules")
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: "people", Kind: VisibilityField, Field: "attributes.id_number", Subjects: []string{"hr"}}, "admin"); err != nil {
+		t.Fatalf("create field rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityRow, Subjects: []string{"managers"}, Filters: []FilterClause{{Property: "attributes.department", Op: FilterOpEq, Value: "{user.department}"}}}, "admin"); err != nil {
+		t.Fatalf("create row rule: %v", err)
+	}
+	if _, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityRow, Subjects: []string{"clerk"}}, "admin"); !errors.Is(err, ErrVisibilityRuleInvalid) {
+		t.Fatalf("expected row rules without filters to be refused, got %v", err)
+	}
+
+	if view := store.VisibilityFor("hr"); view.Masked(LedgerTypePersonnel, "id_number") || view.Hidden(LedgerTypePersonnel, bob.ID) {
+		t.Fatalf("expected HR to see everything")
+	}
+	clerk := store.VisibilityFor("clerk")
+	entries, total, err := store.QueryEntries(LedgerTypePersonnel, LedgerQuery{Visibility: clerk})
+	if err != nil || total != 2 {
+		t.Fatalf("expected the clerk to list both entries, got %d (%v)", total, err)
+	}
+	if _, ok := entries[0].Attributes["id_number"]; ok {
+		t.Fatalf("expected id_number to be hidden, got %+v", entries[0].Attributes)
+	}
+	if _, total, _ := store.QueryEntries(LedgerTypePersonnel, LedgerQuery{Text: "1234", Visibility: clerk}); total != 0 {
+		t.Fatalf("expected masked values to be unsearchable by filter, got %d", total)
+	}
+	if hits, _ := store.SearchVisible("110101199001011234", nil, 0, clerk); len(hits) != 0 {
+		t.Fatalf("expected masked values to be unsearchable, got %+v", hits)
+	}
+
+	manager := store.VisibilityFor("manager")
+	if entries, total, _ := store.QueryEntries(LedgerTypePersonnel, LedgerQuery{Visibility: manager}); total != 1 || entries[0].ID != alice.ID {
+		t.Fatalf("expected the manager to see only Ops, got %+v", entries)
+	}
+	if hits, _ := store.SearchVisible("Bob", nil, 0, manager); len(hits) != 0 {
+		t.Fatalf("expected hidden rows to be left out of search, got %+v", hits)
+	}
+
+	// Saving an entry read through the mask keeps the hidden value.
+	restored := clerk.Restore(LedgerTypePersonnel, map[string]string{"department": "Ops"}, alice.Attributes)
+	if restored["id_number"] != alice.Attributes["id_number"] {
+		t.Fatalf("expected hidden attribute to be restored, got %+v", restored)
+	}
+
+	snapshot := store.ExportSnapshot()
+	manager.Redact(snapshot)
+	if len(snapshot.Entries[LedgerTypePersonnel]) != 1 {
+		t.Fatalf("expected the snapshot to drop hidden rows, got %+v", snapshot.Entries[LedgerTypePersonnel])
+	}
+	for _, rev := range snapshot.Revisions {
+		if rev.ID == bob.ID {
+			t.Fatalf("expected revisions of hidden rows to be dropped")
+		}
+		for _, change := range rev.Changes {
+			if change.Field == "attributes.id_number" {
+				t.Fatalf("expected masked attribute changes to be dropped")
+			}
+		}
+	}
+}
+
+func TestVisibilityPartialMaskAndSnapshot(t *testing.T) {
+	store := newTestStore(t)
+	rule, err := store.CreateVisibilityRule(VisibilityRule{Ledger: LedgerTypePersonnel, Kind: VisibilityField, Field: "id_number", Mask: MaskPartial, Subjects: []string{"hr"}}, "admin")
+	if err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if _, err := store.CreateUser("viewer", "Passw0rd!23", AccessViewer, "admin"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	view := store.VisibilityFor("viewer")
+	masked := view.Mask(LedgerTypePersonnel, LedgerEntry{Attributes: map[string]string{"id_number": "110101199001011234", "pin": "1234"}})
+	if masked.Attributes["id_number"] != "110***********1234" || masked.Attributes["pin"] != "1234" {
+		t.Fatalf("unexpected mask %+v", masked.Attributes)
+	}
+	// A partially masked value sent back unchanged keeps the stored value.
+	stored := map[string]string{"id_number": "110101199001011234"}
+	if restored := view.Restore(LedgerTypePersonnel, masked.Attributes, stored); restored["id_number"] != stored["id_number"] {
+		t.Fatalf("expected masked value to be restored, got %+v", restored)
+	}
+
+	restoredStore := newTestStore(t)
+	if err := restoredStore.ImportSnapshot(store.ExportSnapshot()); err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if rules := restoredStore.ListVisibilityRules(); len(rules) != 1 || rules[0].ID != rule.ID {
+		t.Fatalf("expected rule to survive the snapshot, got %+v", rules)
+	}
+	if err := restoredStore.DeleteVisibilityRule(rule.ID, "admin"); err != nil {
+		t.Fatalf("delete rule: %v", err)
+	}
+	if _, err := restoredStore.UpdateVisibilityRule(rule.ID, *rule, "admin"); !errors.Is(err, ErrVisibilityRuleNotFound) {
+		t.Fatalf("expected rule to be gone, got %v", err)
+	}
+}
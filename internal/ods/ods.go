@@ -0,0 +1,268 @@
+package ods
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"ledger/internal/xlsx"
+)
+
+// MimeType is the media type of OpenDocument spreadsheets.
+const MimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// maxRepeat bounds how far repeated rows and cells are expanded; spreadsheet applications pad
+// sheets with repeats of up to a million empty cells.
+const maxRepeat = 4096
+
+// Encode produces an OpenDocument spreadsheet with string cells.
+func Encode(wb xlsx.Workbook) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	// The mimetype entry must come first and be stored uncompressed.
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, MimeType); err != nil {
+		return nil, err
+	}
+	if err := writeFile(zw, "META-INF/manifest.xml", manifestXML); err != nil {
+		return nil, err
+	}
+	if err := writeFile(zw, "content.xml", contentXML(wb)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+var manifestXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+	`<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">` +
+	`<manifest:file-entry manifest:full-path="/" manifest:media-type="` + MimeType + `"/>` +
+	`<manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>` +
+	`</manifest:manifest>`)
+
+func contentXML(wb xlsx.Workbook) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" `)
+	b.WriteString(`xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" `)
+	b.WriteString(`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" office:version="1.2">`)
+	b.WriteString(`<office:body><office:spreadsheet>`)
+	for _, sheet := range wb.Sheets {
+		b.WriteString(`<table:table table:name="` + escapeXML(sheet.Name) + `">`)
+		for _, row := range sheet.Rows {
+			b.WriteString(`<table:table-row>`)
+			for _, value := range row {
+				if value == "" {
+					b.WriteString(`<table:table-cell/>`)
+					continue
+				}
+				b.WriteString(`<table:table-cell office:value-type="string">`)
+				for _, line := range strings.Split(value, "\n") {
+					b.WriteString(`<text:p>` + escapeXML(line) + `</text:p>`)
+				}
+				b.WriteString(`</table:table-cell>`)
+			}
+			b.WriteString(`</table:table-row>`)
+		}
+		b.WriteString(`</table:table>`)
+	}
+	b.WriteString(`</office:spreadsheet></office:body></office:document-content>`)
+	return []byte(b.String())
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// Decode parses the sheets of an OpenDocument spreadsheet. Dates, numbers and booleans are read
+// from their typed value attributes so they are not affected by display formats.
+func Decode(data []byte) (xlsx.Workbook, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return xlsx.Workbook{}, err
+	}
+	var content *zip.File
+	for _, f := range reader.File {
+		if f.Name == "content.xml" {
+			content = f
+			break
+		}
+	}
+	if content == nil {
+		return xlsx.Workbook{}, fmt.Errorf("content.xml missing")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return xlsx.Workbook{}, err
+	}
+	defer rc.Close()
+	return parseContent(xml.NewDecoder(rc))
+}
+
+const (
+	tableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	officeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	textNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+func attr(attrs []xml.Attr, space, name string) string {
+	for _, a := range attrs {
+		if a.Name.Local == name && a.Name.Space == space {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func repeatCount(attrs []xml.Attr, name string) int {
+	var n int
+	if _, err := fmt.Sscanf(attr(attrs, tableNS, name), "%d", &n); err != nil || n < 1 {
+		return 1
+	}
+	if n > maxRepeat {
+		return maxRepeat
+	}
+	return n
+}
+
+// parseContent walks content.xml. Empty rows and cells are buffered and only emitted when
+// followed by content, so trailing padding never reaches the result.
+func parseContent(decoder *xml.Decoder) (xlsx.Workbook, error) {
+	var (
+		wb           xlsx.Workbook
+		sheet        *xlsx.Sheet
+		row          []string
+		pendingCells int
+		pendingRows  int
+		rowRepeat    int
+		cell         strings.Builder
+		cellValue    string
+		cellRepeat   int
+		inCell       bool
+		paragraphs   int
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return xlsx.Workbook{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == tableNS && t.Name.Local == "table":
+				wb.Sheets = append(wb.Sheets, xlsx.Sheet{Name: attr(t.Attr, tableNS, "name")})
+				sheet = &wb.Sheets[len(wb.Sheets)-1]
+				pendingRows = 0
+			case t.Name.Space == tableNS && t.Name.Local == "table-row":
+				row, pendingCells = nil, 0
+				rowRepeat = repeatCount(t.Attr, "number-rows-repeated")
+			case t.Name.Space == tableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell, paragraphs = true, 0
+				cell.Reset()
+				cellRepeat = repeatCount(t.Attr, "number-columns-repeated")
+				cellValue = typedValue(t.Attr)
+			case t.Name.Space == textNS && t.Name.Local == "p" && inCell:
+				if paragraphs > 0 {
+					cell.WriteByte('\n')
+				}
+				paragraphs++
+			case t.Name.Space == textNS && t.Name.Local == "s" && inCell:
+				cell.WriteString(strings.Repeat(" ", repeatSpaces(t.Attr)))
+			case t.Name.Space == textNS && t.Name.Local == "tab" && inCell:
+				cell.WriteByte('\t')
+			case t.Name.Space == textNS && t.Name.Local == "line-break" && inCell:
+				cell.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inCell && paragraphs > 0 {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == tableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				value := cellValue
+				if value == "" {
+					value = cell.String()
+				}
+				if value == "" {
+					pendingCells += cellRepeat
+				} else {
+					for ; pendingCells > 0; pendingCells-- {
+						row = append(row, "")
+					}
+					for i := 0; i < cellRepeat; i++ {
+						row = append(row, value)
+					}
+				}
+				inCell = false
+			case t.Name.Space == tableNS && t.Name.Local == "table-row" && sheet != nil:
+				if len(row) == 0 {
+					pendingRows += rowRepeat
+					continue
+				}
+				for ; pendingRows > 0; pendingRows-- {
+					sheet.Rows = append(sheet.Rows, []string{})
+				}
+				for i := 0; i < rowRepeat; i++ {
+					sheet.Rows = append(sheet.Rows, append([]string(nil), row...))
+				}
+			case t.Name.Space == tableNS && t.Name.Local == "table":
+				sheet = nil
+			}
+		}
+	}
+	return wb, nil
+}
+
+func repeatSpaces(attrs []xml.Attr) int {
+	var n int
+	if _, err := fmt.Sscanf(attr(attrs, textNS, "c"), "%d", &n); err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// typedValue returns the machine-readable value of typed cells; string cells return "" and
+// are read from their text.
+func typedValue(attrs []xml.Attr) string {
+	switch attr(attrs, officeNS, "value-type") {
+	case "float", "percentage", "currency":
+		return attr(attrs, officeNS, "value")
+	case "date":
+		value := attr(attrs, officeNS, "date-value")
+		if strings.HasSuffix(value, "T00:00:00") {
+			value = strings.TrimSuffix(value, "T00:00:00")
+		}
+		return value
+	case "time":
+		return attr(attrs, officeNS, "time-value")
+	case "boolean":
+		return attr(attrs, officeNS, "boolean-value")
+	}
+	return ""
+}
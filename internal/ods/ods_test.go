@@ -0,0 +1,57 @@
+package ods
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"ledger/internal/xlsx"
+)
+
+func TestEncodeDecodeWorkbook(t *testing.T) {
+	wb := xlsx.Workbook{Sheets: []xlsx.Sheet{{Name: "IP", Rows: [][]string{{"ID", "Name", "", "Notes"}, {"1", "10.0.0.1", "", "核心\n交换"}}}}}
+	data, err := Encode(wb)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(decoded.Sheets) != 1 || decoded.Sheets[0].Name != "IP" {
+		t.Fatalf("unexpected sheets %+v", decoded.Sheets)
+	}
+	if got := decoded.Sheets[0].Rows[1]; len(got) != 4 || got[1] != "10.0.0.1" || got[3] != "核心\n交换" {
+		t.Fatalf("unexpected row %q", got)
+	}
+}
+
+func TestDecodeTypedAndRepeatedCells(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet><table:table table:name="Sheet1">
+<table:table-row><table:table-cell office:value-type="date" office:date-value="2024-03-01"><text:p>01/03/24</text:p></table:table-cell><table:table-cell office:value-type="float" office:value="1234.5"><text:p>1,234.50</text:p></table:table-cell><table:table-cell table:number-columns-repeated="1020"/></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="2"><text:p>x</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table></office:spreadsheet></office:body></office:document-content>`
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, _ := zw.Create("content.xml")
+	_, _ = w.Write([]byte(content))
+	_ = zw.Close()
+
+	decoded, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	rows := decoded.Sheets[0].Rows
+	if len(rows) != 3 {
+		t.Fatalf("expected trailing padding to be dropped, got %d rows", len(rows))
+	}
+	if rows[0][0] != "2024-03-01" || rows[0][1] != "1234.5" || len(rows[0]) != 2 {
+		t.Fatalf("expected typed values, got %q", rows[0])
+	}
+	if rows[2][1] != "x" {
+		t.Fatalf("expected repeated cells and rows to expand, got %q", rows[2])
+	}
+}
@@ -0,0 +1,606 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader gives streaming access to the sheets of a workbook. Shared strings and styles are held
+// in memory; sheet rows are decoded one at a time.
+type Reader struct {
+	files         map[string]*zip.File
+	sheets        []sheetRef
+	sharedStrings []string
+	dateStyles    []bool
+	date1904      bool
+}
+
+type sheetRef struct {
+	name string
+	path string
+}
+
+// Decode parses a workbook into memory.
+func Decode(data []byte) (Workbook, error) {
+	reader, err := OpenReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Workbook{}, err
+	}
+	workbook := Workbook{}
+	for _, name := range reader.SheetNames() {
+		rows, err := reader.Rows(name)
+		if err != nil {
+			return Workbook{}, err
+		}
+		sheet := Sheet{Name: name, Rows: [][]string{}}
+		for rows.Next() {
+			sheet.Rows = append(sheet.Rows, rows.Row())
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return Workbook{}, err
+		}
+		workbook.Sheets = append(workbook.Sheets, sheet)
+	}
+	return workbook, nil
+}
+
+// OpenReader reads the workbook parts of an XLSX file.
+func OpenReader(r io.ReaderAt, size int64) (*Reader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	reader := &Reader{files: make(map[string]*zip.File)}
+	for _, f := range archive.File {
+		reader.files[path.Clean(strings.TrimPrefix(f.Name, "/"))] = f
+	}
+
+	workbookFile, ok := reader.files["xl/workbook.xml"]
+	if !ok {
+		return nil, fmt.Errorf("workbook.xml missing")
+	}
+	workbookData, err := readZipFile(workbookFile)
+	if err != nil {
+		return nil, err
+	}
+	rels := map[string]string{}
+	if relFile, ok := reader.files["xl/_rels/workbook.xml.rels"]; ok {
+		relData, err := readZipFile(relFile)
+		if err != nil {
+			return nil, err
+		}
+		rels = parseRelationships(relData)
+	}
+	if ssFile, ok := reader.files["xl/sharedStrings.xml"]; ok {
+		ssData, err := readZipFile(ssFile)
+		if err != nil {
+			return nil, err
+		}
+		reader.sharedStrings = parseSharedStrings(ssData)
+	}
+	if stylesFile, ok := reader.files["xl/styles.xml"]; ok {
+		stylesData, err := readZipFile(stylesFile)
+		if err != nil {
+			return nil, err
+		}
+		reader.dateStyles = parseDateStyles(stylesData)
+	}
+
+	type sheetInfo struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"sheetId,attr"`
+		RID  string `xml:"id,attr"`
+	}
+	type workbookDef struct {
+		Properties struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []sheetInfo `xml:"sheets>sheet"`
+	}
+	var wbDef workbookDef
+	if err := xml.Unmarshal(workbookData, &wbDef); err != nil {
+		return nil, err
+	}
+	reader.date1904 = wbDef.Properties.Date1904 == "1" || wbDef.Properties.Date1904 == "true"
+	for _, info := range wbDef.Sheets {
+		target := rels[info.RID]
+		if target == "" {
+			target = fmt.Sprintf("worksheets/sheet%s.xml", info.ID)
+		}
+		if strings.HasPrefix(target, "/") {
+			target = path.Clean(strings.TrimPrefix(target, "/"))
+		} else {
+			target = path.Clean("xl/" + target)
+		}
+		if _, ok := reader.files[target]; !ok {
+			continue
+		}
+		reader.sheets = append(reader.sheets, sheetRef{name: info.Name, path: target})
+	}
+	return reader, nil
+}
+
+// SheetNames lists the sheets in workbook order.
+func (r *Reader) SheetNames() []string {
+	names := make([]string, len(r.sheets))
+	for i, sheet := range r.sheets {
+		names[i] = sheet.name
+	}
+	return names
+}
+
+// Rows opens a row iterator over the named sheet, matched case-insensitively.
+func (r *Reader) Rows(name string) (*Rows, error) {
+	for _, sheet := range r.sheets {
+		if !strings.EqualFold(sheet.name, name) {
+			continue
+		}
+		file := r.files[sheet.path]
+		merges, err := scanMerges(file)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		return &Rows{reader: r, closer: rc, decoder: xml.NewDecoder(rc), merges: merges}, nil
+	}
+	return nil, fmt.Errorf("sheet %q not found", name)
+}
+
+// Rows iterates over the rows of a sheet. Gaps in row numbering yield empty rows, so the
+// index of a row always matches its position in the sheet.
+type Rows struct {
+	reader  *Reader
+	closer  io.Closer
+	decoder *xml.Decoder
+	merges  []mergeRange
+
+	index   int
+	next    int
+	pending []string
+	current []string
+	done    bool
+	err     error
+}
+
+// Next advances to the next row and reports whether there is one.
+func (rows *Rows) Next() bool {
+	if rows.err != nil {
+		return false
+	}
+	if rows.pending == nil && !rows.done {
+		rows.readRow()
+		if rows.err != nil {
+			return false
+		}
+	}
+	if rows.pending == nil {
+		return false
+	}
+	if rows.index < rows.next {
+		rows.current = rows.applyMerges(rows.index, nil)
+	} else {
+		rows.current = rows.applyMerges(rows.index, rows.pending)
+		rows.pending = nil
+	}
+	rows.index++
+	return true
+}
+
+// Row returns the current row with trailing empty cells trimmed.
+func (rows *Rows) Row() []string {
+	return rows.current
+}
+
+// Index returns the zero-based position of the current row.
+func (rows *Rows) Index() int {
+	return rows.index - 1
+}
+
+// Err reports the first error met while reading.
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+// Close releases the underlying sheet stream.
+func (rows *Rows) Close() error {
+	return rows.closer.Close()
+}
+
+// readRow decodes the next <row> element into pending, recording its position in next.
+func (rows *Rows) readRow() {
+	for {
+		token, err := rows.decoder.Token()
+		if err == io.EOF {
+			rows.done = true
+			return
+		}
+		if err != nil {
+			rows.err = err
+			return
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "sheetData" {
+			continue
+		}
+		if start.Name.Local != "row" {
+			if start.Name.Local != "worksheet" {
+				if err := rows.decoder.Skip(); err != nil {
+					rows.err = err
+					return
+				}
+			}
+			continue
+		}
+		rows.next = rows.index
+		if n, err := strconv.Atoi(attr(start.Attr, "r")); err == nil && n-1 >= rows.index {
+			rows.next = n - 1
+		}
+		row, err := rows.parseRow()
+		if err != nil {
+			rows.err = err
+			return
+		}
+		rows.pending = row
+		return
+	}
+}
+
+func (rows *Rows) parseRow() ([]string, error) {
+	row := []string{}
+	col := 0
+	for {
+		token, err := rows.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if elem.Name.Local != "c" {
+				if err := rows.decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if ref := attr(elem.Attr, "r"); ref != "" {
+				col = columnIndex(ref)
+			}
+			value, err := rows.parseCell(elem)
+			if err != nil {
+				return nil, err
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			row[col] = value
+			col++
+		case xml.EndElement:
+			if elem.Name.Local == "row" {
+				return row, nil
+			}
+		}
+	}
+}
+
+// parseCell reads one <c> element: shared and inline strings (including rich text runs),
+// cached formula results, booleans and numbers, converting date-formatted numbers to dates.
+func (rows *Rows) parseCell(start xml.StartElement) (string, error) {
+	var cell struct {
+		Value  string   `xml:"v"`
+		Inline richText `xml:"is"`
+	}
+	if err := rows.decoder.DecodeElement(&cell, &start); err != nil {
+		return "", err
+	}
+	value := cell.Value
+	switch attr(start.Attr, "t") {
+	case "s":
+		idx, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || idx < 0 || idx >= len(rows.reader.sharedStrings) {
+			return "", nil
+		}
+		return rows.reader.sharedStrings[idx], nil
+	case "inlineStr":
+		return cell.Inline.String(), nil
+	case "str", "e":
+		return value, nil
+	case "b":
+		if strings.TrimSpace(value) == "1" {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	if value == "" {
+		return "", nil
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value, nil
+	}
+	if style, err := strconv.Atoi(attr(start.Attr, "s")); err == nil && style >= 0 && style < len(rows.reader.dateStyles) && rows.reader.dateStyles[style] {
+		return formatSerial(number, rows.reader.date1904), nil
+	}
+	return formatNumber(number), nil
+}
+
+// applyMerges copies the value of each merged range's top-left cell across the range.
+func (rows *Rows) applyMerges(index int, row []string) []string {
+	for i := range rows.merges {
+		merge := &rows.merges[i]
+		if index < merge.top || index > merge.bottom {
+			continue
+		}
+		if index == merge.top {
+			if merge.left < len(row) {
+				merge.value = row[merge.left]
+			}
+		}
+		if merge.value == "" {
+			continue
+		}
+		for len(row) <= merge.right {
+			row = append(row, "")
+		}
+		for col := merge.left; col <= merge.right; col++ {
+			row[col] = merge.value
+		}
+	}
+	trim := len(row)
+	for trim > 0 && row[trim-1] == "" {
+		trim--
+	}
+	if row == nil {
+		return []string{}
+	}
+	return row[:trim]
+}
+
+type mergeRange struct {
+	top, left, bottom, right int
+	value                    string
+}
+
+// scanMerges collects the merged ranges of a sheet. They follow sheetData in the file, so the
+// sheet is streamed once up front without keeping its rows.
+func scanMerges(file *zip.File) ([]mergeRange, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(rc)
+	var merges []mergeRange
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return merges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "sheetData":
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+		case "mergeCell":
+			from, to, ok := strings.Cut(attr(start.Attr, "ref"), ":")
+			if !ok {
+				continue
+			}
+			merge := mergeRange{top: rowIndex(from), left: columnIndex(from), bottom: rowIndex(to), right: columnIndex(to)}
+			if merge.top >= 0 && merge.bottom >= merge.top && merge.right >= merge.left {
+				merges = append(merges, merge)
+			}
+		}
+	}
+}
+
+// richText is the content of a shared or inline string: either a plain <t> or formatted runs.
+// Phonetic guides (rPh) are not part of the text.
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+func parseSharedStrings(data []byte) []string {
+	type sst struct {
+		Items []richText `xml:"si"`
+	}
+	var doc sst
+	_ = xml.Unmarshal(data, &doc)
+	out := make([]string, len(doc.Items))
+	for i, item := range doc.Items {
+		out[i] = item.String()
+	}
+	return out
+}
+
+// parseDateStyles reports, per cellXfs index, whether the number format displays a date or time.
+func parseDateStyles(data []byte) []bool {
+	type styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	var doc styles
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	custom := make(map[int]string, len(doc.NumFmts))
+	for _, format := range doc.NumFmts {
+		custom[format.ID] = format.Code
+	}
+	out := make([]bool, len(doc.CellXfs))
+	for i, xf := range doc.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			out[i] = isDateFormat(code)
+			continue
+		}
+		out[i] = isBuiltInDateFormat(xf.NumFmtID)
+	}
+	return out
+}
+
+func isBuiltInDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 27 && id <= 36) || (id >= 45 && id <= 47) || (id >= 50 && id <= 58)
+}
+
+// isDateFormat reports whether a custom format code contains date or time tokens outside of
+// quoted literals, escapes and bracketed colours or conditions.
+func isDateFormat(code string) bool {
+	if section, _, ok := strings.Cut(code, ";"); ok {
+		code = section
+	}
+	inQuote, inBracket, escaped := false, false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' || r == '_' || r == '*':
+			// Escapes, padding and fill characters are followed by a literal.
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("dmyhs", r):
+			return true
+		}
+	}
+	return false
+}
+
+// formatSerial renders an Excel date serial as 2006-01-02, adding the time of day when present.
+func formatSerial(serial float64, date1904 bool) string {
+	epoch := excelEpoch
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	value := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	switch {
+	case seconds == 0:
+		return value.Format("2006-01-02")
+	case days == 0 && !date1904:
+		return value.Format("15:04:05")
+	}
+	return value.Format("2006-01-02 15:04:05")
+}
+
+// formatNumber drops the binary noise of stored doubles (0.30000000000000004) by rounding to
+// the 15 significant digits Excel displays.
+func formatNumber(number float64) string {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	if err != nil {
+		rounded = number
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func parseRelationships(data []byte) map[string]string {
+	type rel struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	}
+	type doc struct {
+		Relationships []rel `xml:"Relationship"`
+	}
+	var d doc
+	_ = xml.Unmarshal(data, &d)
+	result := make(map[string]string, len(d.Relationships))
+	for _, r := range d.Relationships {
+		result[r.ID] = r.Target
+	}
+	return result
+}
+
+func attr(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func columnIndex(ref string) int {
+	ref = strings.ToUpper(ref)
+	letters := ""
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			letters += string(r)
+		} else {
+			break
+		}
+	}
+	if letters == "" {
+		return 0
+	}
+	index := 0
+	for _, r := range letters {
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}
+
+// rowIndex returns the zero-based row of a cell reference such as B12, or -1.
+func rowIndex(ref string) int {
+	digits := strings.TrimLeft(strings.ToUpper(ref), "ABCDEFGHIJKLMNOPQRSTUVWXYZ$")
+	n, err := strconv.Atoi(strings.TrimPrefix(digits, "$"))
+	if err != nil {
+		return -1
+	}
+	return n - 1
+}
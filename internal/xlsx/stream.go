@@ -0,0 +1,366 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrWriterClosed is returned when writing to a sheet that has been finished.
+var ErrWriterClosed = errors.New("xlsx: sheet already finished")
+
+// StreamWriter writes a workbook to w sheet by sheet and row by row, so only the row being
+// written is held in memory. Workbook-level parts are written by Close.
+type StreamWriter struct {
+	zw     *zip.Writer
+	styles *styleSheet
+	sheets []sheetEntry
+	open   *SheetWriter
+}
+
+type sheetEntry struct {
+	name      string
+	filterRef string
+}
+
+// NewStreamWriter starts a workbook on w.
+func NewStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{zw: zip.NewWriter(w), styles: newStyleSheet()}
+}
+
+// NewSheet finishes the previous sheet and starts a new one. The layout fields of sheet apply
+// to the whole sheet and any rows it already holds are written first; column widths must
+// therefore be known up front (see ColumnWidths).
+func (sw *StreamWriter) NewSheet(sheet Sheet) (*SheetWriter, error) {
+	if err := sw.finishSheet(); err != nil {
+		return nil, err
+	}
+	w, err := sw.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(sw.sheets)+1))
+	if err != nil {
+		return nil, err
+	}
+	rows := sheet.Rows
+	sheet.Rows = nil
+	sheetWriter := &SheetWriter{layout: sheet, w: bufio.NewWriter(w), styles: sw.styles}
+	sw.sheets = append(sw.sheets, sheetEntry{name: sheet.Name})
+	sw.open = sheetWriter
+	sheetWriter.writeHeader()
+	for _, row := range rows {
+		if err := sheetWriter.WriteRow(row); err != nil {
+			return nil, err
+		}
+	}
+	return sheetWriter, nil
+}
+
+// Close finishes the last sheet and writes the workbook, relationships and styles parts.
+func (sw *StreamWriter) Close() error {
+	if err := sw.finishSheet(); err != nil {
+		return err
+	}
+	if err := writeFile(sw.zw, "xl/styles.xml", sw.styles.xml()); err != nil {
+		return err
+	}
+	if err := writeFile(sw.zw, "xl/workbook.xml", workbookXML(sw.sheets)); err != nil {
+		return err
+	}
+	if err := writeFile(sw.zw, "xl/_rels/workbook.xml.rels", workbookRelsXML(len(sw.sheets))); err != nil {
+		return err
+	}
+	if err := writeFile(sw.zw, "_rels/.rels", rootRelsXML); err != nil {
+		return err
+	}
+	if err := writeFile(sw.zw, "[Content_Types].xml", contentTypesXML(len(sw.sheets))); err != nil {
+		return err
+	}
+	return sw.zw.Close()
+}
+
+func (sw *StreamWriter) finishSheet() error {
+	if sw.open == nil {
+		return nil
+	}
+	ref, err := sw.open.finish()
+	sw.sheets[len(sw.sheets)-1].filterRef = ref
+	sw.open = nil
+	return err
+}
+
+// SheetWriter appends rows to the sheet being streamed.
+type SheetWriter struct {
+	layout Sheet
+	w      *bufio.Writer
+	styles *styleSheet
+	rows   int
+	width  int
+	done   bool
+	err    error
+}
+
+// WriteRow appends a row formatted by the layout's RowStyles and CellStyles.
+func (s *SheetWriter) WriteRow(values []string) error {
+	return s.WriteStyledRow(values, Style{}, nil)
+}
+
+// WriteStyledRow appends a row, applying style to the whole row and cells by column index on
+// top of the layout's formatting.
+func (s *SheetWriter) WriteStyledRow(values []string, style Style, cells map[int]Style) error {
+	if s.done {
+		return ErrWriterClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	i := s.rows
+	rowStyle, hasRowStyle := s.layout.RowStyles[i]
+	if !hasRowStyle && i < s.layout.HeaderRows {
+		rowStyle = HeaderStyle
+	}
+	rowStyle = rowStyle.Merge(style)
+	s.write(`<row r="` + strconv.Itoa(i+1) + `">`)
+	for j, value := range values {
+		cellStyle := rowStyle.Merge(s.layout.CellStyles[Position{Row: i, Col: j}]).Merge(cells[j])
+		typ := CellString
+		if i >= s.layout.HeaderRows && j < len(s.layout.Columns) {
+			typ = s.layout.Columns[j].Type
+		}
+		s.write(cellXML(cellRef(i, j), value, typ, cellStyle, s.styles))
+	}
+	s.write(`</row>`)
+	s.rows++
+	if len(values) > s.width {
+		s.width = len(values)
+	}
+	return s.err
+}
+
+func (s *SheetWriter) write(value string) {
+	if s.err == nil {
+		_, s.err = s.w.WriteString(value)
+	}
+}
+
+func (s *SheetWriter) writeHeader() {
+	sheet := s.layout
+	s.write(`<?xml version="1.0" encoding="UTF-8"?>`)
+	s.write(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if sheet.HeaderRows > 0 {
+		s.write(fmt.Sprintf(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="%d" topLeftCell="%s" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`,
+			sheet.HeaderRows, cellRef(sheet.HeaderRows, 0)))
+	}
+	var cols strings.Builder
+	for i, column := range sheet.Columns {
+		if column.Width > 0 {
+			cols.WriteString(fmt.Sprintf(`<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(column.Width, 'f', 2, 64)))
+		}
+	}
+	if cols.Len() > 0 {
+		s.write(`<cols>` + cols.String() + `</cols>`)
+	}
+	s.write(`<sheetData>`)
+}
+
+// finish closes the sheet XML and returns the autofilter range, if any.
+func (s *SheetWriter) finish() (string, error) {
+	s.done = true
+	sheet := s.layout
+	s.write(`</sheetData>`)
+	ref, ok := autoFilterRef(sheet, s.rows, s.width)
+	if ok {
+		s.write(`<autoFilter ref="` + ref + `"/>`)
+	}
+	var validations []string
+	for j, column := range sheet.Columns {
+		formula, valid := listFormula(column.Options)
+		if !valid {
+			continue
+		}
+		sqref := cellRef(sheet.HeaderRows, j) + ":" + columnName(j) + "1048576"
+		validations = append(validations, fmt.Sprintf(`<dataValidation type="list" allowBlank="1" showErrorMessage="1" sqref="%s"><formula1>%s</formula1></dataValidation>`, sqref, escapeXML(formula)))
+	}
+	if len(validations) > 0 {
+		s.write(fmt.Sprintf(`<dataValidations count="%d">%s</dataValidations>`, len(validations), strings.Join(validations, "")))
+	}
+	s.write(`</worksheet>`)
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	if !ok {
+		ref = ""
+	}
+	return ref, s.err
+}
+
+// ColumnWidths accumulates the content width of each column for sheets whose rows are
+// streamed, so widths can be fitted before the sheet is started.
+type ColumnWidths []float64
+
+// Observe records the values of one row.
+func (w *ColumnWidths) Observe(row []string) {
+	for len(*w) < len(row) {
+		*w = append(*w, 0)
+	}
+	for i, value := range row {
+		if width := textWidth(value); width > (*w)[i] {
+			(*w)[i] = width
+		}
+	}
+}
+
+// Apply sets unset widths in columns from the observed content, clamped to [min, max], and
+// returns the extended slice.
+func (w ColumnWidths) Apply(columns []Column, min, max float64) []Column {
+	for len(columns) < len(w) {
+		columns = append(columns, Column{})
+	}
+	for i := range columns {
+		if columns[i].Width > 0 {
+			continue
+		}
+		width := 2.0
+		if i < len(w) {
+			width += w[i]
+		}
+		if width < min {
+			width = min
+		}
+		if width > max {
+			width = max
+		}
+		columns[i].Width = width
+	}
+	return columns
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func contentTypesXML(sheetCount int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheetCount; i++ {
+		b.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i))
+	}
+	b.WriteString(`</Types>`)
+	return []byte(b.String())
+}
+
+var rootRelsXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`)
+
+func workbookXML(sheets []sheetEntry) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `)
+	b.WriteString(`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	b.WriteString(`<sheets>`)
+	for i, sheet := range sheets {
+		b.WriteString(fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXML(sheet.name), i+1, i+1))
+	}
+	b.WriteString(`</sheets>`)
+	var names strings.Builder
+	for i, sheet := range sheets {
+		if sheet.filterRef != "" {
+			quoted := "'" + strings.ReplaceAll(sheet.name, "'", "''") + "'!" + absoluteRef(sheet.filterRef)
+			names.WriteString(fmt.Sprintf(`<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">%s</definedName>`, i, escapeXML(quoted)))
+		}
+	}
+	if names.Len() > 0 {
+		b.WriteString(`<definedNames>` + names.String() + `</definedNames>`)
+	}
+	b.WriteString(`</workbook>`)
+	return []byte(b.String())
+}
+
+func workbookRelsXML(sheetCount int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheetCount; i++ {
+		b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i))
+	}
+	b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheetCount+1))
+	b.WriteString(`</Relationships>`)
+	return []byte(b.String())
+}
+
+// numberPattern matches the decimal notation a <v> element may carry. strconv.ParseFloat also
+// takes NaN, Inf and hexadecimal floats, which spreadsheet applications reject as corrupt.
+var numberPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// cellXML writes a single cell. Typed values that fail to parse fall back to strings; empty
+// cells are only written when they carry formatting.
+func cellXML(ref, value string, typ CellType, style Style, styles *styleSheet) string {
+	if value == "" {
+		if style.IsZero() {
+			return ""
+		}
+		return fmt.Sprintf(`<c r="%s" s="%d"/>`, ref, styles.id(style, false))
+	}
+	attrs := `r="` + ref + `"`
+	switch typ {
+	case CellNumber:
+		if _, err := strconv.ParseFloat(value, 64); err == nil && numberPattern.MatchString(value) {
+			return fmt.Sprintf(`<c %s%s><v>%s</v></c>`, attrs, styleAttr(style, false, styles), value)
+		}
+	case CellDate:
+		if serial, ok := dateSerial(value); ok {
+			return fmt.Sprintf(`<c %s%s><v>%s</v></c>`, attrs, styleAttr(style, true, styles), serial)
+		}
+	case CellBool:
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			flag := "0"
+			if parsed {
+				flag = "1"
+			}
+			return fmt.Sprintf(`<c %s t="b"%s><v>%s</v></c>`, attrs, styleAttr(style, false, styles), flag)
+		}
+	}
+	return fmt.Sprintf(`<c %s t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, attrs, styleAttr(style, false, styles), escapeXML(value))
+}
+
+func styleAttr(style Style, date bool, styles *styleSheet) string {
+	if style.IsZero() && !date {
+		return ""
+	}
+	return fmt.Sprintf(` s="%d"`, styles.id(style, date))
+}
+
+// autoFilterRef spans the last header row down to the last data row.
+func autoFilterRef(sheet Sheet, rows, width int) (string, bool) {
+	if !sheet.AutoFilter || sheet.HeaderRows == 0 || rows < sheet.HeaderRows || width == 0 {
+		return "", false
+	}
+	last := rows - 1
+	if last < sheet.HeaderRows {
+		last = sheet.HeaderRows
+	}
+	return cellRef(sheet.HeaderRows-1, 0) + ":" + cellRef(last, width-1), true
+}
+
+func absoluteRef(ref string) string {
+	parts := strings.Split(ref, ":")
+	for i, part := range parts {
+		split := strings.IndexFunc(part, func(r rune) bool { return r >= '0' && r <= '9' })
+		parts[i] = "$" + part[:split] + "$" + part[split:]
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,247 @@
+package xlsx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CellType controls how the values of a column are written. Values that do not parse as the
+// column's type are written as strings, so nothing is lost.
+type CellType int
+
+const (
+	// CellString writes the value verbatim; the default.
+	CellString CellType = iota
+	// CellNumber writes decimal numbers as numeric cells.
+	CellNumber
+	// CellDate writes 2006-01-02 or RFC 3339 values as date serials formatted yyyy-mm-dd.
+	CellDate
+	// CellBool writes true/false values as boolean cells.
+	CellBool
+)
+
+// Column carries the presentation of one sheet column.
+type Column struct {
+	// Width in characters; zero keeps the application default.
+	Width float64
+	Type  CellType
+	// Options renders a dropdown on the data rows. Lists containing commas or longer than
+	// Excel's 255 character limit for inline lists are not rendered.
+	Options []string
+}
+
+// Style is the formatting of a cell. Colours are RRGGBB hex strings.
+type Style struct {
+	Bold      bool
+	Italic    bool
+	Underline bool
+	Color     string
+	Fill      string
+}
+
+// IsZero reports whether the style leaves the cell unformatted.
+func (s Style) IsZero() bool {
+	return s == Style{}
+}
+
+// Merge returns s with the set properties of other applied on top.
+func (s Style) Merge(other Style) Style {
+	s.Bold = s.Bold || other.Bold
+	s.Italic = s.Italic || other.Italic
+	s.Underline = s.Underline || other.Underline
+	if other.Color != "" {
+		s.Color = other.Color
+	}
+	if other.Fill != "" {
+		s.Fill = other.Fill
+	}
+	return s
+}
+
+// Position addresses a cell by zero-based row and column.
+type Position struct {
+	Row int
+	Col int
+}
+
+// HeaderStyle formats the header rows of a sheet unless RowStyles overrides them.
+var HeaderStyle = Style{Bold: true, Fill: "F3F4F6"}
+
+// FitWidths sets unset column widths from the longest value in each column, counting wide
+// characters twice and clamping to [min, max].
+func (s *Sheet) FitWidths(min, max float64) {
+	var widths ColumnWidths
+	for _, row := range s.Rows {
+		widths.Observe(row)
+	}
+	s.Columns = widths.Apply(s.Columns, min, max)
+}
+
+func textWidth(value string) float64 {
+	var longest, current float64
+	for _, r := range value {
+		switch {
+		case r == '\n':
+			current = 0
+			continue
+		case r > unicode.MaxLatin1 && !unicode.IsMark(r):
+			current += 2
+		default:
+			current++
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+const dateNumFmtID = 164
+
+// styleKey identifies one cellXfs record.
+type styleKey struct {
+	style Style
+	date  bool
+}
+
+// styleSheet collects the distinct cell formats used across a workbook. Index 0 is the
+// unformatted default.
+type styleSheet struct {
+	keys  []styleKey
+	index map[styleKey]int
+}
+
+func newStyleSheet() *styleSheet {
+	return &styleSheet{keys: []styleKey{{}}, index: map[styleKey]int{{}: 0}}
+}
+
+func (s *styleSheet) id(style Style, date bool) int {
+	key := styleKey{style: style, date: date}
+	if idx, ok := s.index[key]; ok {
+		return idx
+	}
+	s.keys = append(s.keys, key)
+	s.index[key] = len(s.keys) - 1
+	return len(s.keys) - 1
+}
+
+func (s *styleSheet) xml() []byte {
+	fonts := []string{fontXML(Style{})}
+	fontIDs := map[string]int{fonts[0]: 0}
+	fills := []string{`<fill><patternFill patternType="none"/></fill>`, `<fill><patternFill patternType="gray125"/></fill>`}
+	fillIDs := map[string]int{"": 0}
+	var xfs strings.Builder
+	for _, key := range s.keys {
+		font := fontXML(key.style)
+		fontID, ok := fontIDs[font]
+		if !ok {
+			fontID = len(fonts)
+			fonts = append(fonts, font)
+			fontIDs[font] = fontID
+		}
+		fill := colorRGB(key.style.Fill)
+		fillID, ok := fillIDs[fill]
+		if !ok {
+			fillID = len(fills)
+			fills = append(fills, fmt.Sprintf(`<fill><patternFill patternType="solid"><fgColor rgb="%s"/><bgColor indexed="64"/></patternFill></fill>`, fill))
+			fillIDs[fill] = fillID
+		}
+		numFmt := 0
+		if key.date {
+			numFmt = dateNumFmtID
+		}
+		xfs.WriteString(fmt.Sprintf(`<xf numFmtId="%d" fontId="%d" fillId="%d" borderId="0" xfId="0"`, numFmt, fontID, fillID))
+		if numFmt != 0 {
+			xfs.WriteString(` applyNumberFormat="1"`)
+		}
+		if fontID != 0 {
+			xfs.WriteString(` applyFont="1"`)
+		}
+		if fillID != 0 {
+			xfs.WriteString(` applyFill="1"`)
+		}
+		xfs.WriteString(`/>`)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(fmt.Sprintf(`<numFmts count="1"><numFmt numFmtId="%d" formatCode="yyyy-mm-dd"/></numFmts>`, dateNumFmtID))
+	b.WriteString(fmt.Sprintf(`<fonts count="%d">%s</fonts>`, len(fonts), strings.Join(fonts, "")))
+	b.WriteString(fmt.Sprintf(`<fills count="%d">%s</fills>`, len(fills), strings.Join(fills, "")))
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	b.WriteString(fmt.Sprintf(`<cellXfs count="%d">%s</cellXfs>`, len(s.keys), xfs.String()))
+	b.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	b.WriteString(`</styleSheet>`)
+	return []byte(b.String())
+}
+
+func fontXML(style Style) string {
+	var b strings.Builder
+	b.WriteString(`<font>`)
+	if style.Bold {
+		b.WriteString(`<b/>`)
+	}
+	if style.Italic {
+		b.WriteString(`<i/>`)
+	}
+	if style.Underline {
+		b.WriteString(`<u/>`)
+	}
+	b.WriteString(`<sz val="11"/>`)
+	if color := colorRGB(style.Color); color != "" {
+		b.WriteString(`<color rgb="` + color + `"/>`)
+	}
+	b.WriteString(`<name val="Calibri"/><family val="2"/></font>`)
+	return b.String()
+}
+
+// colorRGB converts RRGGBB (with or without #, or the short RGB form) to Excel's ARGB.
+func colorRGB(value string) string {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) != 6 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(value, 16, 32); err != nil {
+		return ""
+	}
+	return "FF" + strings.ToUpper(value)
+}
+
+// excelEpoch is day zero of the 1900 date system as Excel counts it.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// dateSerial converts a stored date to an Excel serial day number.
+func dateSerial(value string) (string, bool) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			days := parsed.UTC().Sub(excelEpoch).Hours() / 24
+			return strconv.FormatFloat(days, 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
+
+// listFormula renders dropdown options as an inline list formula.
+func listFormula(options []string) (string, bool) {
+	if len(options) == 0 {
+		return "", false
+	}
+	for _, option := range options {
+		if strings.Contains(option, ",") {
+			return "", false
+		}
+	}
+	joined := strings.Join(options, ",")
+	if len([]rune(joined)) > 255 {
+		return "", false
+	}
+	return `"` + strings.ReplaceAll(joined, `"`, `""`) + `"`, true
+}
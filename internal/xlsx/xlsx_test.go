@@ -1,6 +1,12 @@
 package xlsx
 
-import "testing"
+import (
+	"archive/zip"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
 
 func TestEncodeDecodeWorkbook(t *testing.T) {
 	wb := Workbook{Sheets: []Sheet{{Name: "Systems", Rows: [][]string{{"ID", "Name"}, {"1", "审批台账"}}}}}
@@ -29,3 +35,201 @@ func TestSheetByName(t *testing.T) {
 		t.Fatalf("expected to find sheet by case-insensitive name")
 	}
 }
+
+func TestEncodeLayout(t *testing.T) {
+	sheet := Sheet{
+		Name:       "IP",
+		Rows:       [][]string{{"ID", "上线日期", "端口数", "状态"}, {"1", "2024-03-01", "48", "在用"}, {"2", "未知", "", "停用"}},
+		Columns:    []Column{{}, {Type: CellDate}, {Type: CellNumber}, {Options: []string{"在用", "停用"}}},
+		HeaderRows: 1,
+		AutoFilter: true,
+		RowStyles:  map[int]Style{2: {Bold: true}},
+		CellStyles: map[Position]Style{{Row: 1, Col: 3}: {Fill: "#fff2cc"}},
+	}
+	sheet.FitWidths(8, 40)
+	data, err := Encode(Workbook{Sheets: []Sheet{sheet}})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range reader.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		parts[f.Name] = string(content)
+	}
+	worksheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`state="frozen"`,
+		`<autoFilter ref="A1:D3"/>`,
+		`<c r="B2" s="2"><v>45352</v></c>`,
+		`<c r="C2"><v>48</v></c>`,
+		`sqref="D2:D1048576"`,
+		`<col min="2" max="2" width="12.00" customWidth="1"/>`,
+	} {
+		if !strings.Contains(worksheet, want) {
+			t.Fatalf("expected %s in worksheet: %s", want, worksheet)
+		}
+	}
+	if !strings.Contains(parts["xl/styles.xml"], `<fgColor rgb="FFFFF2CC"/>`) || !strings.Contains(parts["xl/styles.xml"], `formatCode="yyyy-mm-dd"`) {
+		t.Fatalf("unexpected styles part: %s", parts["xl/styles.xml"])
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], "_xlnm._FilterDatabase") {
+		t.Fatalf("expected filter range to be defined")
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got := decoded.Sheets[0].Rows[1]; got[1] != "2024-03-01" || got[2] != "48" {
+		t.Fatalf("expected typed cells to read back, got %q", got)
+	}
+	if got := decoded.Sheets[0].Rows[2]; got[1] != "未知" || got[3] != "停用" {
+		t.Fatalf("unexpected fallback values: %q", got)
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sw := NewStreamWriter(buf)
+	first, err := sw.NewSheet(Sheet{Name: "IP", Rows: [][]string{{"ID", "Name"}}, HeaderRows: 1, AutoFilter: true})
+	if err != nil {
+		t.Fatalf("new sheet: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := first.WriteRow([]string{strconv.Itoa(i), "10.0.0." + strconv.Itoa(i)}); err != nil {
+			t.Fatalf("write row: %v", err)
+		}
+	}
+	second, err := sw.NewSheet(Sheet{Name: "System"})
+	if err != nil {
+		t.Fatalf("new sheet: %v", err)
+	}
+	if err := first.WriteRow([]string{"4"}); err != ErrWriterClosed {
+		t.Fatalf("expected finished sheet to reject rows, got %v", err)
+	}
+	if err := second.WriteStyledRow([]string{"ERP"}, Style{Bold: true}, map[int]Style{0: {Color: "c00000"}}); err != nil {
+		t.Fatalf("write styled row: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data := buf.Bytes()
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(decoded.Sheets) != 2 || len(decoded.Sheets[0].Rows) != 4 || decoded.Sheets[0].Rows[3][1] != "10.0.0.3" || decoded.Sheets[1].Rows[0][0] != "ERP" {
+		t.Fatalf("unexpected workbook %+v", decoded.Sheets)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	for _, f := range reader.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		if f.Name == "xl/worksheets/sheet1.xml" && !strings.Contains(string(content), `<autoFilter ref="A1:B4"/>`) {
+			t.Fatalf("expected filter over the streamed rows: %s", content)
+		}
+	}
+}
+
+func buildTestWorkbook(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeResolvesTypesFormulasAndMerges(t *testing.T) {
+	data := buildTestWorkbook(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+			`<sheet name="台账" sheetId="1" r:id="rId1"/><sheet name="备注" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Target="/xl/worksheets/other.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>系统</t></si><si><r><t>核心</t></r><r><rPr><b/></rPr><t>交换机</t></r><rPh><t>x</t></rPh></si><si><t>资产</t></si></sst>`,
+		"xl/styles.xml": `<styleSheet><numFmts><numFmt numFmtId="165" formatCode="yyyy/mm/dd\ hh:mm"/><numFmt numFmtId="166" formatCode="0.00E+00"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="165"/><xf numFmtId="166"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetViews><sheetView/></sheetViews><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>2</v></c><c r="C1" t="s"><v>0</v></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2" s="1"><v>45352</v></c><c r="C2" s="2"><v>45352.5</v></c><c r="D2" s="3"><v>1234.5</v></c></row>` +
+			`<row r="4"><c r="A4"><f>SUM(1,2)</f><v>3</v></c><c r="B4" t="str"><f>"a"&amp;"b"</f><v>ab</v></c><c r="C4" t="b"><v>1</v></c><c r="D4"><v>0.30000000000000004</v></c>` +
+			`<c r="E4" t="inlineStr"><is><r><t>富</t></r><r><t>文本</t></r></is></c></row>` +
+			`</sheetData><mergeCells count="1"><mergeCell ref="A1:B1"/></mergeCells></worksheet>`,
+		"xl/worksheets/other.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>说明</t></is></c></row></sheetData></worksheet>`,
+	})
+	wb, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(wb.Sheets) != 2 || wb.Sheets[1].Rows[0][0] != "说明" {
+		t.Fatalf("expected both sheets, got %+v", wb.Sheets)
+	}
+	rows := wb.Sheets[0].Rows
+	if len(rows) != 4 || len(rows[2]) != 0 {
+		t.Fatalf("expected the row gap to be kept, got %q", rows)
+	}
+	if got := rows[0]; len(got) != 3 || got[0] != "资产" || got[1] != "资产" || got[2] != "系统" {
+		t.Fatalf("expected the merged header to span its columns, got %q", got)
+	}
+	if got := rows[1]; got[0] != "核心交换机" || got[1] != "2024-03-01" || got[2] != "2024-03-01 12:00:00" || got[3] != "1234.5" {
+		t.Fatalf("unexpected typed values %q", got)
+	}
+	if got := rows[3]; got[0] != "3" || got[1] != "ab" || got[2] != "true" || got[3] != "0.3" || got[4] != "富文本" {
+		t.Fatalf("unexpected formula and inline values %q", got)
+	}
+
+	reader, err := OpenReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open reader: %v", err)
+	}
+	iter, err := reader.Rows("台账")
+	if err != nil {
+		t.Fatalf("open rows: %v", err)
+	}
+	defer iter.Close()
+	count := 0
+	for iter.Next() {
+		if iter.Index() != count {
+			t.Fatalf("expected index %d, got %d", count, iter.Index())
+		}
+		count++
+	}
+	if iter.Err() != nil || count != 4 {
+		t.Fatalf("expected 4 streamed rows, got %d (%v)", count, iter.Err())
+	}
+}
+
+func TestNumberCellsOnlyCarryFiniteDecimals(t *testing.T) {
+	styles := newStyleSheet()
+	if got := cellXML("A1", "-1.5e3", CellNumber, Style{}, styles); got != `<c r="A1"><v>-1.5e3</v></c>` {
+		t.Fatalf("expected a numeric cell, got %s", got)
+	}
+	for _, value := range []string{"NaN", "Inf", "-infinity", "0x1p4", "1e400"} {
+		if got := cellXML("A1", value, CellNumber, Style{}, styles); !strings.Contains(got, `t="inlineStr"`) {
+			t.Fatalf("%q: expected a string cell, got %s", value, got)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-import axios, { AxiosError } from 'axios';
+import axios, { AxiosError, InternalAxiosRequestConfig } from 'axios';
 
 const resolveBaseURL = (): string | undefined => {
   const envBase = import.meta.env.VITE_API_BASE_URL?.trim();
@@ -51,10 +51,53 @@ api.interceptors.request.use(
   }
 );
 
+// Access tokens are short-lived; an expired one is exchanged once for a new pair using the
+// refresh token, and concurrent requests share that exchange.
+let refreshing: Promise<string | null> | null = null;
+
+const refreshAccessToken = (): Promise<string | null> => {
+  if (refreshing) {
+    return refreshing;
+  }
+  const refreshToken = typeof window !== 'undefined' ? localStorage.getItem('ledger.refreshToken') : null;
+  if (!refreshToken) {
+    return Promise.resolve(null);
+  }
+  refreshing = axios
+    .post<{ token: string; refreshToken: string }>(
+      '/auth/refresh',
+      { refreshToken },
+      { baseURL: api.defaults.baseURL, withCredentials: true }
+    )
+    .then(({ data }) => {
+      localStorage.setItem('ledger.token', data.token);
+      localStorage.setItem('ledger.refreshToken', data.refreshToken);
+      return data.token;
+    })
+    .catch(() => {
+      localStorage.removeItem('ledger.token');
+      localStorage.removeItem('ledger.refreshToken');
+      return null;
+    })
+    .finally(() => {
+      refreshing = null;
+    });
+  return refreshing;
+};
+
 // Response interceptor to handle errors
 api.interceptors.response.use(
   (response) => response,
-  (error: AxiosError) => {
+  async (error: AxiosError<{ error?: string }>) => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+    if (error.response?.status === 401 && error.response.data?.error === 'invalid_session' && config && !config._retried) {
+      config._retried = true;
+      const token = await refreshAccessToken();
+      if (token) {
+        config.headers.Authorization = `Bearer ${token}`;
+        return api(config);
+      }
+    }
     // Return error for component to handle
     return Promise.reject(error);
   }
@@ -9,10 +9,13 @@ import '../styles/login.css';
 
 interface PasswordLoginResponse {
   token: string;
+  refreshToken: string;
+  sessionId?: string;
   username: string;
   admin?: boolean;
   issuedAt?: string;
   expiresAt?: string;
+  refreshExpiresAt?: string;
 }
 
 const Login = () => {
@@ -44,6 +47,7 @@ const Login = () => {
       });
       // 保存token到localStorage
       localStorage.setItem('ledger.token', data.token);
+      localStorage.setItem('ledger.refreshToken', data.refreshToken);
       localStorage.setItem('ledger.username', data.username);
       localStorage.setItem('ledger.admin', data.admin ? 'true' : 'false');
       setToken(data.token, data.username, Boolean(data.admin));
@@ -52,8 +56,13 @@ const Login = () => {
     } catch (err) {
       const axiosError = err as AxiosError<{ error?: string }>;
       const message = axiosError.response?.data?.error || axiosError.message || '登录失败，请稍后重试。';
+      const retryAfter = Number(axiosError.response?.headers?.['retry-after'] ?? 0);
       if (message === 'invalid_credentials') {
         setError('用户名或密码错误。');
+      } else if (message === 'account_locked') {
+        setError(`登录失败次数过多，账号已锁定，请 ${Math.ceil(retryAfter / 60)} 分钟后重试或联系管理员解锁。`);
+      } else if (message === 'login_throttled') {
+        setError(`尝试过于频繁，请 ${retryAfter} 秒后重试。`);
       } else {
         setError(message);
       }